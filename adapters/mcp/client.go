@@ -0,0 +1,392 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Transport carries JSON-RPC messages to an upstream MCP server.
+type Transport interface {
+	// Call sends a request and waits for the response with the same id.
+	Call(ctx context.Context, method string, params interface{}) (json.RawMessage, error)
+	// Notify sends a notification that expects no response.
+	Notify(ctx context.Context, method string, params interface{}) error
+	Close() error
+}
+
+// RPCError is a JSON-RPC error returned by the upstream MCP server.
+type RPCError struct {
+	Code    int
+	Message string
+	Data    interface{}
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("mcp error %d: %s", e.Code, e.Message)
+}
+
+type clientMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  interface{}     `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// HTTPTransport speaks MCP streamable HTTP: every message is POSTed to a single
+// endpoint and responses arrive as JSON or as a server-sent event stream.
+type HTTPTransport struct {
+	url     string
+	client  *http.Client
+	headers map[string]string
+	nextID  atomic.Int64
+
+	mu        sync.Mutex
+	sessionID string
+}
+
+func NewHTTPTransport(url string, headers map[string]string) *HTTPTransport {
+	return &HTTPTransport{
+		url:     strings.TrimSpace(url),
+		client:  &http.Client{Timeout: 60 * time.Second},
+		headers: headers,
+	}
+}
+
+func (t *HTTPTransport) Call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	id := t.nextID.Add(1)
+	resp, err := t.post(ctx, clientMessage{JSONRPC: "2.0", ID: &id, Method: method, Params: params})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("mcp server returned HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return readSSEResponse(resp.Body, id)
+	}
+	var msg clientMessage
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		return nil, fmt.Errorf("decode mcp response: %w", err)
+	}
+	return messageResult(msg)
+}
+
+func (t *HTTPTransport) Notify(ctx context.Context, method string, params interface{}) error {
+	resp, err := t.post(ctx, clientMessage{JSONRPC: "2.0", Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (t *HTTPTransport) Close() error { return nil }
+
+func (t *HTTPTransport) post(ctx context.Context, msg clientMessage) (*http.Response, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("marshal mcp request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create mcp request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	t.mu.Lock()
+	if t.sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", t.sessionID)
+	}
+	t.mu.Unlock()
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if session := resp.Header.Get("Mcp-Session-Id"); session != "" {
+		t.mu.Lock()
+		t.sessionID = session
+		t.mu.Unlock()
+	}
+	return resp, nil
+}
+
+func readSSEResponse(body io.Reader, id int64) (json.RawMessage, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 8*1024*1024)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "data:") {
+			data.WriteString(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+			continue
+		}
+		if line != "" || data.Len() == 0 {
+			continue
+		}
+		var msg clientMessage
+		if err := json.Unmarshal([]byte(data.String()), &msg); err == nil && msg.ID != nil && *msg.ID == id {
+			return messageResult(msg)
+		}
+		data.Reset()
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if data.Len() > 0 {
+		var msg clientMessage
+		if err := json.Unmarshal([]byte(data.String()), &msg); err == nil && msg.ID != nil && *msg.ID == id {
+			return messageResult(msg)
+		}
+	}
+	return nil, fmt.Errorf("mcp event stream ended without a response")
+}
+
+// StdioTransport speaks newline-delimited JSON-RPC over a pair of pipes,
+// usually the stdin/stdout of an MCP server subprocess.
+type StdioTransport struct {
+	w      io.Writer
+	closer func() error
+	nextID atomic.Int64
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	pending map[int64]chan clientMessage
+	err     error
+}
+
+// NewStdioTransport reads responses from r and writes requests to w.
+func NewStdioTransport(r io.Reader, w io.Writer) *StdioTransport {
+	t := &StdioTransport{w: w, pending: map[int64]chan clientMessage{}}
+	go t.readLoop(r)
+	return t
+}
+
+// StartStdioServer launches command and connects to it over stdio. The server
+// process is terminated by Close.
+func StartStdioServer(command string, args ...string) (*StdioTransport, error) {
+	cmd := exec.Command(command, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start mcp server: %w", err)
+	}
+	t := NewStdioTransport(stdout, stdin)
+	t.closer = func() error {
+		_ = stdin.Close()
+		if cmd.Process != nil {
+			_ = cmd.Process.Kill()
+		}
+		return cmd.Wait()
+	}
+	return t, nil
+}
+
+func (t *StdioTransport) Call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	id := t.nextID.Add(1)
+	ch := make(chan clientMessage, 1)
+	t.mu.Lock()
+	if t.err != nil {
+		t.mu.Unlock()
+		return nil, t.err
+	}
+	t.pending[id] = ch
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.pending, id)
+		t.mu.Unlock()
+	}()
+
+	if err := t.write(clientMessage{JSONRPC: "2.0", ID: &id, Method: method, Params: params}); err != nil {
+		return nil, err
+	}
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			return nil, t.closedErr()
+		}
+		return messageResult(msg)
+	case <-ctx.Done():
+		_ = t.Notify(context.Background(), "notifications/cancelled", map[string]interface{}{
+			"requestId": id,
+			"reason":    ctx.Err().Error(),
+		})
+		return nil, ctx.Err()
+	}
+}
+
+func (t *StdioTransport) Notify(_ context.Context, method string, params interface{}) error {
+	return t.write(clientMessage{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (t *StdioTransport) Close() error {
+	if t.closer != nil {
+		return t.closer()
+	}
+	return nil
+}
+
+func (t *StdioTransport) write(msg clientMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal mcp request: %w", err)
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err = t.w.Write(append(body, '\n'))
+	return err
+}
+
+func (t *StdioTransport) readLoop(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 8*1024*1024)
+	for scanner.Scan() {
+		var msg clientMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil || msg.ID == nil || msg.Method != "" {
+			// Server-initiated requests and notifications are not supported.
+			continue
+		}
+		t.mu.Lock()
+		ch := t.pending[*msg.ID]
+		t.mu.Unlock()
+		if ch != nil {
+			ch <- msg
+		}
+	}
+	t.mu.Lock()
+	t.err = errors.New("mcp server closed the connection")
+	for id, ch := range t.pending {
+		close(ch)
+		delete(t.pending, id)
+	}
+	t.mu.Unlock()
+}
+
+func (t *StdioTransport) closedErr() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+func messageResult(msg clientMessage) (json.RawMessage, error) {
+	if msg.Error != nil {
+		return nil, &RPCError{Code: msg.Error.Code, Message: msg.Error.Message, Data: msg.Error.Data}
+	}
+	return msg.Result, nil
+}
+
+// Client is a minimal MCP client covering the tool surface.
+type Client struct {
+	transport  Transport
+	ServerName string
+}
+
+// Tool is an MCP tool definition returned by tools/list.
+type Tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"inputSchema,omitempty"`
+}
+
+// ToolResult is the result of tools/call.
+type ToolResult struct {
+	Content           []map[string]interface{} `json:"content"`
+	StructuredContent map[string]interface{}   `json:"structuredContent,omitempty"`
+	IsError           bool                     `json:"isError,omitempty"`
+}
+
+// NewClient performs the MCP initialize handshake over transport.
+func NewClient(ctx context.Context, transport Transport) (*Client, error) {
+	raw, err := transport.Call(ctx, "initialize", map[string]interface{}{
+		"protocolVersion": "2024-11-05",
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]interface{}{"name": "mcp-mig-adapter", "version": "0.1.0"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mcp initialize: %w", err)
+	}
+	var result struct {
+		ServerInfo struct {
+			Name string `json:"name"`
+		} `json:"serverInfo"`
+	}
+	_ = json.Unmarshal(raw, &result)
+	if err := transport.Notify(ctx, "notifications/initialized", nil); err != nil {
+		return nil, fmt.Errorf("mcp initialized notification: %w", err)
+	}
+	return &Client{transport: transport, ServerName: result.ServerInfo.Name}, nil
+}
+
+// ListTools returns every tool the server exposes, following pagination.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var tools []Tool
+	cursor := ""
+	for {
+		params := map[string]interface{}{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		raw, err := c.transport.Call(ctx, "tools/list", params)
+		if err != nil {
+			return nil, fmt.Errorf("mcp tools/list: %w", err)
+		}
+		var page struct {
+			Tools      []Tool `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+		if err := json.Unmarshal(raw, &page); err != nil {
+			return nil, fmt.Errorf("decode tools/list: %w", err)
+		}
+		tools = append(tools, page.Tools...)
+		if page.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// CallTool invokes a tool with the given arguments.
+func (c *Client) CallTool(ctx context.Context, name string, arguments map[string]interface{}) (ToolResult, error) {
+	if arguments == nil {
+		arguments = map[string]interface{}{}
+	}
+	raw, err := c.transport.Call(ctx, "tools/call", map[string]interface{}{"name": name, "arguments": arguments})
+	if err != nil {
+		return ToolResult{}, err
+	}
+	var result ToolResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return ToolResult{}, fmt.Errorf("decode tools/call: %w", err)
+	}
+	return result, nil
+}
+
+func (c *Client) Close() error {
+	return c.transport.Close()
+}
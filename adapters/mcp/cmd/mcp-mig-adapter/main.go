@@ -1,30 +1,118 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/InvariantDynamics/model-interface-gateway-oss/adapters/mcp"
+	"github.com/InvariantDynamics/model-interface-gateway-oss/core/pkg/mig"
 )
 
 func main() {
+	mode := flag.String("mode", "mcp-server", "adapter mode: mcp-server (MIG exposed as MCP) or mig-provider (MCP exposed as MIG)")
 	addr := flag.String("addr", ":8090", "adapter listen address")
 	manifestPath := flag.String("manifest", "examples/mcp-mig-adapter.manifest.yaml", "path to adapter manifest")
 	migURL := flag.String("mig-url", "http://localhost:8080", "migd base URL")
 	migToken := flag.String("mig-token", "", "optional bearer token for MIG backend")
 	tenantID := flag.String("tenant-id", "", "optional tenant header for MIG backend")
+	mcpURL := flag.String("mcp-url", "", "upstream MCP server streamable HTTP endpoint (mig-provider mode)")
+	mcpCommand := flag.String("mcp-command", "", "upstream MCP server executable launched over stdio (mig-provider mode)")
+	var mcpArgs stringList
+	flag.Var(&mcpArgs, "mcp-arg", "argument passed to -mcp-command; repeat once per argument")
+	capabilityPrefix := flag.String("capability-prefix", "", "capability ID prefix for exposed tools (default mcp.<server name>)")
+	authScope := flag.String("auth-scope", "", "optional scope required to invoke exposed tools")
 	flag.Parse()
 
-	manifest, err := mcp.LoadManifest(*manifestPath)
+	switch *mode {
+	case "mcp-server":
+		manifest, err := mcp.LoadManifest(*manifestPath)
+		if err != nil {
+			log.Fatalf("failed to load manifest: %v", err)
+		}
+		adapter := mcp.NewAdapter(*migURL, manifest)
+		adapter.SetBearerToken(*migToken)
+		adapter.SetTenantID(*tenantID)
+		log.Printf("mcp adapter listening on %s", *addr)
+		if err := http.ListenAndServe(*addr, adapter); err != nil {
+			log.Fatalf("adapter server failed: %v", err)
+		}
+	case "mig-provider":
+		runMIGProvider(*addr, *mcpURL, *mcpCommand, mcpArgs, *capabilityPrefix, *authScope)
+	default:
+		log.Fatalf("unsupported mode %q", *mode)
+	}
+}
+
+// stringList collects the values of a repeated flag, so arguments containing
+// spaces or quotes reach the upstream server unchanged.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func runMIGProvider(addr, mcpURL, mcpCommand string, mcpArgs []string, capabilityPrefix, authScope string) {
+	var transport mcp.Transport
+	switch {
+	case mcpURL != "" && mcpCommand != "":
+		log.Fatal("use only one of -mcp-url or -mcp-command")
+	case len(mcpArgs) > 0 && mcpCommand == "":
+		log.Fatal("-mcp-arg requires -mcp-command")
+	case mcpURL != "":
+		transport = mcp.NewHTTPTransport(mcpURL, nil)
+	case mcpCommand != "":
+		stdio, err := mcp.StartStdioServer(mcpCommand, mcpArgs...)
+		if err != nil {
+			log.Fatalf("failed to start MCP server: %v", err)
+		}
+		transport = stdio
+	default:
+		log.Fatal("-mcp-url or -mcp-command is required in mig-provider mode")
+	}
+	defer transport.Close()
+
+	cfg, err := mig.ConfigFromEnv()
 	if err != nil {
-		log.Fatalf("failed to load manifest: %v", err)
+		log.Fatalf("invalid config: %v", err)
 	}
-	adapter := mcp.NewAdapter(*migURL, manifest)
-	adapter.SetBearerToken(*migToken)
-	adapter.SetTenantID(*tenantID)
-	log.Printf("mcp adapter listening on %s", *addr)
-	if err := http.ListenAndServe(*addr, adapter); err != nil {
+	svc, err := mig.NewServiceWithOptions(mig.ServiceOptions{AuditLogPath: cfg.AuditLogPath})
+	if err != nil {
+		log.Fatalf("failed to initialize service: %v", err)
+	}
+	defer svc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	client, err := mcp.NewClient(ctx, transport)
+	if err != nil {
+		cancel()
+		log.Fatalf("failed to initialize MCP client: %v", err)
+	}
+	opts := mcp.ExposeOptions{CapabilityPrefix: capabilityPrefix}
+	if authScope != "" {
+		opts.AuthScopes = []string{authScope}
+	}
+	descs, err := mcp.ExposeServer(ctx, svc, client, opts)
+	cancel()
+	if err != nil {
+		log.Fatalf("failed to expose MCP tools: %v", err)
+	}
+	for _, desc := range descs {
+		log.Printf("exposed MCP tool as capability %s", desc.ID)
+	}
+
+	mux := http.NewServeMux()
+	mig.RegisterHTTPRoutes(mux, svc)
+	log.Printf("mcp adapter serving MIG on %s (auth=%s)", addr, cfg.Auth.Mode)
+	if err := http.ListenAndServe(addr, mig.AuthMiddleware(cfg.Auth)(mux)); err != nil {
 		log.Fatalf("adapter server failed: %v", err)
 	}
 }
@@ -0,0 +1,169 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/InvariantDynamics/model-interface-gateway-oss/core/pkg/mig"
+)
+
+// ExposeOptions controls how upstream MCP tools are registered as MIG
+// capabilities.
+type ExposeOptions struct {
+	// CapabilityPrefix is prepended to each tool name to form the capability ID.
+	// Defaults to "mcp.<server name>".
+	CapabilityPrefix string
+	Version          string
+	AuthScopes       []string
+}
+
+// ExposeServer registers every tool of an upstream MCP server as a MIG
+// capability on svc. Each tool inputSchema is stored with AddSchema, so INVOKE
+// payloads are validated against it before they are routed to tools/call.
+// Every tool is checked before any is registered, so nothing is registered
+// when two tool names map to the same capability ID or a tool is invalid.
+func ExposeServer(ctx context.Context, svc *mig.Service, client *Client, opts ExposeOptions) ([]mig.CapabilityDescriptor, error) {
+	tools, err := client.ListTools(ctx)
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.Trim(opts.CapabilityPrefix, ".")
+	if prefix == "" {
+		prefix = "mcp." + capabilitySegment(client.ServerName)
+	}
+	version := opts.Version
+	if version == "" {
+		version = "1.0.0"
+	}
+
+	type exposedTool struct {
+		name        string
+		desc        mig.CapabilityDescriptor
+		inputSchema map[string]interface{}
+	}
+	ids := make(map[string]string, len(tools))
+	exposed := make([]exposedTool, 0, len(tools))
+	for _, tool := range tools {
+		if tool.Name == "" {
+			continue
+		}
+		id := prefix + "." + capabilitySegment(tool.Name)
+		if other, taken := ids[id]; taken {
+			return nil, fmt.Errorf("tools %q and %q both map to capability %s", other, tool.Name, id)
+		}
+		ids[id] = tool.Name
+		inputSchema := tool.InputSchema
+		if len(inputSchema) == 0 {
+			inputSchema = map[string]interface{}{"type": "object"}
+		}
+		desc := mig.CapabilityDescriptor{
+			ID:              id,
+			Version:         version,
+			Modes:           []string{"unary"},
+			InputSchemaURI:  fmt.Sprintf("schema://%s/input/v1", strings.ReplaceAll(id, ".", "/")),
+			OutputSchemaURI: fmt.Sprintf("schema://%s/output/v1", strings.ReplaceAll(id, ".", "/")),
+			AuthScopes:      opts.AuthScopes,
+		}
+		if migErr := mig.ValidateSchema(mig.SchemaUpsertRequest{URI: desc.InputSchemaURI, Schema: inputSchema}); migErr != nil {
+			return nil, fmt.Errorf("input schema for %s: %s", tool.Name, migErr.Message)
+		}
+		if migErr := mig.ValidateDescriptor(desc); migErr != nil {
+			return nil, fmt.Errorf("capability for %s: %s", tool.Name, migErr.Message)
+		}
+		exposed = append(exposed, exposedTool{name: tool.Name, desc: desc, inputSchema: inputSchema})
+	}
+
+	out := make([]mig.CapabilityDescriptor, 0, len(exposed))
+	for _, tool := range exposed {
+		if migErr := svc.AddSchema(mig.SchemaUpsertRequest{URI: tool.desc.InputSchemaURI, Schema: tool.inputSchema}); migErr != nil {
+			return nil, fmt.Errorf("register input schema for %s: %s", tool.name, migErr.Message)
+		}
+		if migErr := svc.AddSchema(mig.SchemaUpsertRequest{URI: tool.desc.OutputSchemaURI, Schema: toolResultSchema()}); migErr != nil {
+			return nil, fmt.Errorf("register output schema for %s: %s", tool.name, migErr.Message)
+		}
+		if migErr := svc.AddCapability(mig.CapabilityUpsertRequest{Descriptor: tool.desc}); migErr != nil {
+			return nil, fmt.Errorf("register capability for %s: %s", tool.name, migErr.Message)
+		}
+		if migErr := svc.BindProvider(tool.desc.ID, ToolProvider(client, tool.name)); migErr != nil {
+			return nil, fmt.Errorf("bind provider for %s: %s", tool.name, migErr.Message)
+		}
+		out = append(out, tool.desc)
+	}
+	return out, nil
+}
+
+// ToolProvider routes MIG invocations to tools/call on the upstream server,
+// passing the invoke payload through as tool arguments.
+func ToolProvider(client *Client, toolName string) mig.Provider {
+	return mig.ProviderFunc(func(ctx context.Context, req mig.InvokeRequest) (map[string]interface{}, *mig.MigError) {
+		result, err := client.CallTool(ctx, toolName, req.Payload)
+		if err != nil {
+			return nil, migErrorFromMCP(err)
+		}
+		payload := map[string]interface{}{"content": result.Content}
+		if result.StructuredContent != nil {
+			payload["structured_content"] = result.StructuredContent
+		}
+		if result.IsError {
+			return nil, &mig.MigError{
+				Code:      mig.ErrorInternal,
+				Message:   "mcp tool reported an error",
+				Retryable: false,
+				Details:   payload,
+			}
+		}
+		return payload, nil
+	})
+}
+
+func migErrorFromMCP(err error) *mig.MigError {
+	var rpcErr *RPCError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return &mig.MigError{Code: mig.ErrorTimeout, Message: "mcp tool call timed out", Retryable: true}
+	case errors.Is(err, context.Canceled):
+		return &mig.MigError{Code: mig.ErrorTimeout, Message: "mcp tool call cancelled", Retryable: true}
+	case errors.As(err, &rpcErr):
+		code := mig.ErrorInternal
+		switch rpcErr.Code {
+		case -32602:
+			code = mig.ErrorInvalidRequest
+		case -32601:
+			code = mig.ErrorUnsupportedCapability
+		}
+		return &mig.MigError{Code: code, Message: rpcErr.Message, Retryable: false, Details: map[string]interface{}{"mcp_code": rpcErr.Code}}
+	default:
+		return &mig.MigError{Code: mig.ErrorUnavailable, Message: "mcp server unavailable: " + err.Error(), Retryable: true}
+	}
+}
+
+func toolResultSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"content":            map[string]interface{}{"type": "array"},
+			"structured_content": map[string]interface{}{"type": "object"},
+		},
+		"required": []interface{}{"content"},
+	}
+}
+
+// capabilitySegment lowercases a name and replaces characters that are not
+// safe in capability IDs, HTTP paths, or NATS subjects.
+func capabilitySegment(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "server"
+	}
+	return b.String()
+}
@@ -0,0 +1,222 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/InvariantDynamics/model-interface-gateway-oss/core/pkg/mig"
+)
+
+// fakeMCPServer answers the subset of MCP used by the reverse adapter.
+func fakeMCPServer(t *testing.T, req map[string]interface{}) (interface{}, *rpcError) {
+	return fakeMCPServerWithTools(t, req, "get-forecast")
+}
+
+func fakeMCPServerWithTools(t *testing.T, req map[string]interface{}, names ...string) (interface{}, *rpcError) {
+	t.Helper()
+	switch req["method"] {
+	case "initialize":
+		return map[string]interface{}{
+			"protocolVersion": "2024-11-05",
+			"serverInfo":      map[string]interface{}{"name": "Weather Tools"},
+		}, nil
+	case "tools/list":
+		tools := make([]interface{}, 0, len(names))
+		for _, name := range names {
+			tools = append(tools, map[string]interface{}{
+				"name":        name,
+				"description": "Forecast for a city",
+				"inputSchema": map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{"city": map[string]interface{}{"type": "string"}},
+					"required":   []interface{}{"city"},
+				},
+			})
+		}
+		return map[string]interface{}{"tools": tools}, nil
+	case "tools/call":
+		params, _ := req["params"].(map[string]interface{})
+		args, _ := params["arguments"].(map[string]interface{})
+		if args["city"] == "" || args["city"] == nil {
+			return map[string]interface{}{"content": []interface{}{map[string]interface{}{"type": "text", "text": "city missing"}}, "isError": true}, nil
+		}
+		return map[string]interface{}{"content": []interface{}{map[string]interface{}{"type": "text", "text": "sunny in " + args["city"].(string)}}}, nil
+	default:
+		return nil, &rpcError{Code: -32601, Message: "method not found"}
+	}
+}
+
+func TestExposeServerOverHTTP(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode request: %v", err)
+			return
+		}
+		if req["id"] == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		result, rpcErr := fakeMCPServer(t, req)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req["id"], "result": result, "error": rpcErr})
+	}))
+	defer upstream.Close()
+
+	client, err := NewClient(context.Background(), NewHTTPTransport(upstream.URL, nil))
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	svc := mig.NewService()
+	descs, err := ExposeServer(context.Background(), svc, client, ExposeOptions{})
+	if err != nil {
+		t.Fatalf("expose server: %v", err)
+	}
+	if len(descs) != 1 || descs[0].ID != "mcp.weather_tools.get-forecast" {
+		t.Fatalf("unexpected descriptors: %#v", descs)
+	}
+
+	resp, migErr := svc.Invoke(context.Background(), descs[0].ID, mig.InvokeRequest{
+		Header:  mig.MessageHeader{TenantID: "acme"},
+		Payload: map[string]interface{}{"city": "Oslo"},
+	}, "tester", mig.AnonymousPrincipal())
+	if migErr != nil {
+		t.Fatalf("invoke failed: %v", migErr.Message)
+	}
+	content, _ := resp.Payload["content"].([]map[string]interface{})
+	if len(content) != 1 || content[0]["text"] != "sunny in Oslo" {
+		t.Fatalf("unexpected payload: %#v", resp.Payload)
+	}
+
+	_, migErr = svc.Invoke(context.Background(), descs[0].ID, mig.InvokeRequest{
+		Header:  mig.MessageHeader{TenantID: "acme"},
+		Payload: map[string]interface{}{"city": ""},
+	}, "tester", mig.AnonymousPrincipal())
+	if migErr == nil || migErr.Code != mig.ErrorInternal {
+		t.Fatalf("expected tool error to surface as %s, got %#v", mig.ErrorInternal, migErr)
+	}
+
+	// The tool inputSchema is enforced before the call reaches the server.
+	_, migErr = svc.Invoke(context.Background(), descs[0].ID, mig.InvokeRequest{
+		Header:  mig.MessageHeader{TenantID: "acme"},
+		Payload: map[string]interface{}{},
+	}, "tester", mig.AnonymousPrincipal())
+	if migErr == nil || migErr.Code != mig.ErrorInvalidRequest {
+		t.Fatalf("expected schema violation to surface as %s, got %#v", mig.ErrorInvalidRequest, migErr)
+	}
+}
+
+func TestExposeServerRejectsCollidingToolNames(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode request: %v", err)
+			return
+		}
+		if req["id"] == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		result, rpcErr := fakeMCPServerWithTools(t, req, "get-forecast", "Get-Forecast")
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req["id"], "result": result, "error": rpcErr})
+	}))
+	defer upstream.Close()
+
+	client, err := NewClient(context.Background(), NewHTTPTransport(upstream.URL, nil))
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	svc := mig.NewService()
+	if _, err := ExposeServer(context.Background(), svc, client, ExposeOptions{}); err == nil || !strings.Contains(err.Error(), "mcp.weather_tools.get-forecast") {
+		t.Fatalf("expected a capability ID collision error, got %v", err)
+	}
+	for _, desc := range svc.ListCapabilities() {
+		if strings.HasPrefix(desc.ID, "mcp.") {
+			t.Fatalf("nothing should be registered on a collision, found %s", desc.ID)
+		}
+	}
+}
+
+func TestExposeServerRegistersNothingWhenAToolIsInvalid(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode request: %v", err)
+			return
+		}
+		if req["id"] == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		result, rpcErr := fakeMCPServerWithTools(t, req, "get-forecast")
+		if req["method"] == "tools/list" {
+			// The second tool's inputSchema is not a valid JSON Schema.
+			tools := result.(map[string]interface{})["tools"].([]interface{})
+			result = map[string]interface{}{"tools": append(tools, map[string]interface{}{
+				"name":        "get-alerts",
+				"inputSchema": map[string]interface{}{"type": 5},
+			})}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req["id"], "result": result, "error": rpcErr})
+	}))
+	defer upstream.Close()
+
+	client, err := NewClient(context.Background(), NewHTTPTransport(upstream.URL, nil))
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	svc := mig.NewService()
+	if _, err := ExposeServer(context.Background(), svc, client, ExposeOptions{}); err == nil || !strings.Contains(err.Error(), "get-alerts") {
+		t.Fatalf("expected an invalid schema error, got %v", err)
+	}
+	for _, desc := range svc.ListCapabilities() {
+		if strings.HasPrefix(desc.ID, "mcp.") {
+			t.Fatalf("nothing should be registered when a tool is invalid, found %s", desc.ID)
+		}
+	}
+}
+
+func TestStdioTransportRoundTrip(t *testing.T) {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+	defer serverWriter.Close()
+	go func() {
+		scanner := bufio.NewScanner(serverReader)
+		encoder := json.NewEncoder(serverWriter)
+		for scanner.Scan() {
+			var req map[string]interface{}
+			if json.Unmarshal(scanner.Bytes(), &req) != nil || req["id"] == nil {
+				continue
+			}
+			result, rpcErr := fakeMCPServer(t, req)
+			_ = encoder.Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req["id"], "result": result, "error": rpcErr})
+		}
+	}()
+
+	client, err := NewClient(context.Background(), NewStdioTransport(clientReader, clientWriter))
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	if client.ServerName != "Weather Tools" {
+		t.Fatalf("unexpected server name: %q", client.ServerName)
+	}
+	tools, err := client.ListTools(context.Background())
+	if err != nil || len(tools) != 1 {
+		t.Fatalf("list tools: %v %#v", err, tools)
+	}
+	result, err := client.CallTool(context.Background(), "get-forecast", map[string]interface{}{"city": "Lima"})
+	if err != nil {
+		t.Fatalf("call tool: %v", err)
+	}
+	if len(result.Content) != 1 || result.Content[0]["text"] != "sunny in Lima" {
+		t.Fatalf("unexpected result: %#v", result)
+	}
+}
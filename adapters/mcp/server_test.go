@@ -12,6 +12,7 @@ import (
 
 func TestToolsListAndCall(t *testing.T) {
 	svc := mig.NewService()
+	_ = svc.BindProvider("observatory.models.infer", mig.EchoProvider())
 	mux := http.NewServeMux()
 	mig.RegisterHTTPRoutes(mux, svc)
 	backend := httptest.NewServer(mux)
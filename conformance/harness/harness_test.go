@@ -16,6 +16,7 @@ import (
 
 func newTestServer() (*mig.Service, *httptest.Server) {
 	svc := mig.NewService()
+	_ = svc.BindProvider("observatory.models.infer", mig.EchoProvider())
 	mux := http.NewServeMux()
 	mig.RegisterHTTPRoutes(mux, svc)
 	authCfg := mig.AuthConfig{Mode: mig.AuthModeNone}
@@ -94,7 +95,7 @@ func TestPublishSubscribeReplay(t *testing.T) {
 		t.Fatalf("expected sequence 1, got %d", ack.Sequence)
 	}
 
-	replay, stream, unsubscribe, err2 := svc.Subscribe("observatory.inference.completed", "0")
+	replay, stream, unsubscribe, err2 := svc.Subscribe("acme", "observatory.inference.completed", "0")
 	if err2 != nil {
 		t.Fatalf("subscribe failed: %v", err2.Message)
 	}
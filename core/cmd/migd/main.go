@@ -24,8 +24,15 @@ func main() {
 		log.Fatalf("invalid config: %v", err)
 	}
 	svc, err := mig.NewServiceWithOptions(mig.ServiceOptions{
-		NATSURL:      cfg.NATSURL,
-		AuditLogPath: cfg.AuditLogPath,
+		NATSURL:             cfg.NATSURL,
+		AuditLogPath:        cfg.AuditLogPath,
+		ShadowLogPath:       cfg.ShadowLogPath,
+		JobRetention:        cfg.JobRetention,
+		MaxJobsPerTenant:    cfg.MaxJobsPerTenant,
+		WebhookSecret:       cfg.WebhookSecret,
+		WebhookAllowedHosts: cfg.WebhookHosts,
+		MessageTTL:          cfg.MessageTTL,
+		DemoEcho:            cfg.DemoEcho,
 	})
 	if err != nil {
 		log.Fatalf("failed to initialize service: %v", err)
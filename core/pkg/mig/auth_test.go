@@ -41,7 +41,7 @@ func TestAuthMiddlewareTenantMismatch(t *testing.T) {
 }
 
 func TestAuthMiddlewareAllowsScopedInvoke(t *testing.T) {
-	svc := NewService()
+	svc := newDemoService(t)
 	mux := http.NewServeMux()
 	RegisterHTTPRoutes(mux, svc)
 	server := httptest.NewServer(AuthMiddleware(AuthConfig{Mode: AuthModeJWT, JWTSecret: "secret"})(mux))
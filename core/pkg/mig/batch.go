@@ -0,0 +1,137 @@
+package mig
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	maxBatchItems           = 1000
+	defaultBatchConcurrency = 8
+	maxBatchConcurrency     = 64
+)
+
+// InvokeBatchRequest invokes one capability once per item. Header applies to
+// every item; its DeadlineMS bounds the whole batch.
+type InvokeBatchRequest struct {
+	Header     MessageHeader     `json:"header"`
+	Capability string            `json:"capability,omitempty"`
+	Items      []InvokeBatchItem `json:"items"`
+	// MaxConcurrency bounds the items in flight at once. It defaults to 8
+	// and is capped at 64.
+	MaxConcurrency int `json:"max_concurrency,omitempty"`
+}
+
+type InvokeBatchItem struct {
+	IdempotencyKey string                 `json:"idempotency_key,omitempty"`
+	Payload        map[string]interface{} `json:"payload"`
+}
+
+// InvokeBatchResponse holds one result per item, in request order.
+type InvokeBatchResponse struct {
+	Header     MessageHeader       `json:"header"`
+	Capability string              `json:"capability"`
+	Results    []InvokeBatchResult `json:"results"`
+	Succeeded  int                 `json:"succeeded"`
+	Failed     int                 `json:"failed"`
+}
+
+// InvokeBatchResult carries either the item's response payload or its error.
+type InvokeBatchResult struct {
+	Index     int                    `json:"index"`
+	MessageID string                 `json:"message_id"`
+	Payload   map[string]interface{} `json:"payload,omitempty"`
+	Error     *MigError              `json:"error,omitempty"`
+}
+
+// InvokeBatch runs every item through Invoke with bounded concurrency, so each
+// item is checked against scopes and quota, counted in usage, and audited on
+// its own. Item failures are reported per item; only an invalid batch fails
+// as a whole.
+func (s *Service) InvokeBatch(ctx context.Context, capability string, req InvokeBatchRequest, actor string, principal Principal) (InvokeBatchResponse, *MigError) {
+	head := req.Header
+	if err := head.Normalize(time.Now()); err != nil {
+		s.recordError(ErrorInvalidRequest, "invoke_batch")
+		return InvokeBatchResponse{}, invalid(err.Error())
+	}
+	if capability == "" {
+		capability = req.Capability
+	}
+	if capability == "" {
+		s.recordError(ErrorInvalidRequest, "invoke_batch")
+		return InvokeBatchResponse{}, invalid("capability is required")
+	}
+	if len(req.Items) == 0 || len(req.Items) > maxBatchItems {
+		s.recordError(ErrorInvalidRequest, "invoke_batch")
+		return InvokeBatchResponse{}, invalid(fmt.Sprintf("items must hold between 1 and %d entries", maxBatchItems))
+	}
+	concurrency := req.MaxConcurrency
+	switch {
+	case concurrency < 0:
+		s.recordError(ErrorInvalidRequest, "invoke_batch")
+		return InvokeBatchResponse{}, invalid("max_concurrency must be >= 0")
+	case concurrency == 0:
+		concurrency = defaultBatchConcurrency
+	case concurrency > maxBatchConcurrency:
+		concurrency = maxBatchConcurrency
+	}
+
+	deadlineAt := callDeadline(ctx, head, time.Now())
+	batchCtx, cancel := context.WithDeadline(ctx, deadlineAt)
+	defer cancel()
+
+	results := make([]InvokeBatchResult, len(req.Items))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, item := range req.Items {
+		itemHead := head
+		itemHead.MessageID = fmt.Sprintf("%s.%d", head.MessageID, i)
+		itemHead.IdempotencyKey = item.IdempotencyKey
+		itemHead.Meta = make(map[string]interface{}, len(head.Meta))
+		for k, v := range head.Meta {
+			itemHead.Meta[k] = v
+		}
+		results[i] = InvokeBatchResult{Index: i, MessageID: itemHead.MessageID}
+
+		acquired := false
+		select {
+		case sem <- struct{}{}:
+			acquired = true
+		case <-batchCtx.Done():
+		}
+		remaining := time.Until(deadlineAt)
+		if batchCtx.Err() != nil || remaining < time.Millisecond {
+			if acquired {
+				<-sem
+			}
+			results[i].Error = &MigError{Code: ErrorTimeout, Message: "batch deadline exceeded before the item started", Retryable: true}
+			continue
+		}
+		itemHead.DeadlineMS = int(remaining.Milliseconds())
+		wg.Add(1)
+		go func(i int, in InvokeRequest) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			resp, migErr := s.Invoke(batchCtx, capability, in, actor, principal)
+			if migErr != nil {
+				results[i].Error = migErr
+				return
+			}
+			results[i].Payload = resp.Payload
+		}(i, InvokeRequest{Header: itemHead, Capability: capability, Payload: item.Payload})
+	}
+	wg.Wait()
+
+	id, _ := splitCapabilityRef(capability)
+	out := InvokeBatchResponse{Header: head, Capability: id, Results: results}
+	for _, result := range results {
+		if result.Error != nil {
+			out.Failed++
+		} else {
+			out.Succeeded++
+		}
+	}
+	return out, nil
+}
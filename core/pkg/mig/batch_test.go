@@ -0,0 +1,223 @@
+package mig
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	migv01 "github.com/InvariantDynamics/model-interface-gateway-oss/proto/mig/v0_1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func newBatchService(t *testing.T) (*Service, *int32) {
+	t.Helper()
+	svc := NewService()
+	if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: testDescriptor("acme.score.item")}); err != nil {
+		t.Fatalf("add: %v", err.Message)
+	}
+	var inflight, peak int32
+	_ = svc.BindProvider("acme.score.item", ProviderFunc(func(_ context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+		now := atomic.AddInt32(&inflight, 1)
+		defer atomic.AddInt32(&inflight, -1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if now <= old || atomic.CompareAndSwapInt32(&peak, old, now) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		if req.Payload["fail"] == true {
+			return nil, &MigError{Code: ErrorInvalidRequest, Message: "bad item", Retryable: false}
+		}
+		return map[string]interface{}{"score": req.Payload["n"]}, nil
+	}))
+	return svc, &peak
+}
+
+func TestInvokeBatchReturnsResultsInOrder(t *testing.T) {
+	svc, peak := newBatchService(t)
+	items := make([]InvokeBatchItem, 6)
+	for i := range items {
+		items[i] = InvokeBatchItem{IdempotencyKey: "item-" + string(rune('a'+i)), Payload: map[string]interface{}{"n": float64(i)}}
+	}
+	items[2].Payload["fail"] = true
+
+	resp, err := svc.InvokeBatch(context.Background(), "acme.score.item", InvokeBatchRequest{
+		Header:         MessageHeader{TenantID: "acme", MessageID: "batch-1"},
+		Items:          items,
+		MaxConcurrency: 2,
+	}, "tester", AnonymousPrincipal())
+	if err != nil {
+		t.Fatalf("batch: %v", err.Message)
+	}
+	if resp.Succeeded != 5 || resp.Failed != 1 || len(resp.Results) != 6 {
+		t.Fatalf("unexpected batch counts: %#v", resp)
+	}
+	for i, result := range resp.Results {
+		if result.Index != i || result.MessageID != "batch-1."+string(rune('0'+i)) {
+			t.Fatalf("result %d out of order: %#v", i, result)
+		}
+		if i == 2 {
+			if result.Error == nil || result.Error.Code != ErrorInvalidRequest {
+				t.Fatalf("expected item 2 to fail: %#v", result)
+			}
+			continue
+		}
+		if result.Error != nil || result.Payload["score"] != float64(i) {
+			t.Fatalf("unexpected result %d: %#v", i, result)
+		}
+	}
+	if got := atomic.LoadInt32(peak); got > 2 {
+		t.Fatalf("max_concurrency exceeded: %d in flight", got)
+	}
+	if usage := svc.Usage(); usage.TenantInvocations["acme"] != 5 {
+		t.Fatalf("each successful item should count once: %#v", usage)
+	}
+	successes := 0
+	for _, record := range svc.AuditExport("acme") {
+		if record.Outcome == "success" {
+			successes++
+		}
+	}
+	if successes != 5 {
+		t.Fatalf("expected one audit record per successful item, got %d", successes)
+	}
+
+	// Per-item idempotency keys replay earlier results without new usage.
+	if _, err := svc.InvokeBatch(context.Background(), "acme.score.item", InvokeBatchRequest{
+		Header: MessageHeader{TenantID: "acme"},
+		Items:  items[:2],
+	}, "tester", AnonymousPrincipal()); err != nil {
+		t.Fatalf("replay: %v", err.Message)
+	}
+	if usage := svc.Usage(); usage.TenantInvocations["acme"] != 5 {
+		t.Fatalf("replayed items should not be charged again: %#v", usage)
+	}
+}
+
+func TestInvokeBatchCountsItemsTowardQuota(t *testing.T) {
+	svc, _ := newBatchService(t)
+	if _, err := svc.SetQuota(QuotaRequest{TenantID: "acme", MaxInvocations: 2}); err != nil {
+		t.Fatalf("quota: %v", err.Message)
+	}
+	resp, err := svc.InvokeBatch(context.Background(), "acme.score.item", InvokeBatchRequest{
+		Header:         MessageHeader{TenantID: "acme"},
+		Items:          []InvokeBatchItem{{Payload: map[string]interface{}{"n": 1.0}}, {Payload: map[string]interface{}{"n": 2.0}}, {Payload: map[string]interface{}{"n": 3.0}}},
+		MaxConcurrency: 1,
+	}, "tester", AnonymousPrincipal())
+	if err != nil {
+		t.Fatalf("batch: %v", err.Message)
+	}
+	if resp.Succeeded != 2 || resp.Results[2].Error == nil || resp.Results[2].Error.Code != ErrorRateLimited {
+		t.Fatalf("third item should hit the quota: %#v", resp)
+	}
+}
+
+func TestInvokeBatchHoldsQuotaAcrossConcurrentItems(t *testing.T) {
+	svc, _ := newBatchService(t)
+	if _, err := svc.SetQuota(QuotaRequest{TenantID: "acme", MaxInvocations: 2}); err != nil {
+		t.Fatalf("quota: %v", err.Message)
+	}
+	items := make([]InvokeBatchItem, 8)
+	for i := range items {
+		items[i] = InvokeBatchItem{Payload: map[string]interface{}{"n": float64(i)}}
+	}
+	resp, err := svc.InvokeBatch(context.Background(), "acme.score.item", InvokeBatchRequest{
+		Header:         MessageHeader{TenantID: "acme"},
+		Items:          items,
+		MaxConcurrency: len(items),
+	}, "tester", AnonymousPrincipal())
+	if err != nil {
+		t.Fatalf("batch: %v", err.Message)
+	}
+	if resp.Succeeded != 2 || resp.Failed != 6 {
+		t.Fatalf("concurrent items must not overshoot the quota: %#v", resp)
+	}
+	if usage := svc.Usage(); usage.TenantInvocations["acme"] != 2 {
+		t.Fatalf("expected usage to stop at the quota: %#v", usage)
+	}
+}
+
+func TestInvokeBatchRejectsInvalidBatches(t *testing.T) {
+	svc, _ := newBatchService(t)
+	cases := map[string]InvokeBatchRequest{
+		"no items":    {Header: MessageHeader{TenantID: "acme"}},
+		"no tenant":   {Items: []InvokeBatchItem{{}}},
+		"concurrency": {Header: MessageHeader{TenantID: "acme"}, Items: []InvokeBatchItem{{}}, MaxConcurrency: -1},
+		"too many":    {Header: MessageHeader{TenantID: "acme"}, Items: make([]InvokeBatchItem, maxBatchItems+1)},
+	}
+	for name, req := range cases {
+		if _, err := svc.InvokeBatch(context.Background(), "acme.score.item", req, "tester", AnonymousPrincipal()); err == nil || err.Code != ErrorInvalidRequest {
+			t.Fatalf("%s: expected invalid request, got %#v", name, err)
+		}
+	}
+}
+
+func TestInvokeBatchOverHTTPAndGRPC(t *testing.T) {
+	svc, _ := newBatchService(t)
+
+	mux := http.NewServeMux()
+	RegisterHTTPRoutes(mux, svc)
+	server := httptest.NewServer(AuthMiddleware(AuthConfig{Mode: AuthModeNone})(mux))
+	defer server.Close()
+	body, _ := json.Marshal(InvokeBatchRequest{
+		Header: MessageHeader{TenantID: "acme"},
+		Items:  []InvokeBatchItem{{Payload: map[string]interface{}{"n": 1.0}}, {Payload: map[string]interface{}{"fail": true}}},
+	})
+	httpResp, err := http.Post(server.URL+"/mig/v0.1/invoke-batch/acme.score.item", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("http batch: %v", err)
+	}
+	defer httpResp.Body.Close()
+	var decoded InvokeBatchResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&decoded); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if httpResp.StatusCode != http.StatusOK || decoded.Succeeded != 1 || decoded.Results[1].Error == nil {
+		t.Fatalf("unexpected http batch response: %d %#v", httpResp.StatusCode, decoded)
+	}
+
+	listener := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(GRPCUnaryAuthInterceptor(AuthConfig{Mode: AuthModeNone})))
+	RegisterGRPCServices(grpcServer, svc)
+	defer grpcServer.Stop()
+	go func() {
+		_ = grpcServer.Serve(listener)
+	}()
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("grpc dial: %v", err)
+	}
+	defer conn.Close()
+	ok, _ := structpb.NewStruct(map[string]interface{}{"n": 7})
+	bad, _ := structpb.NewStruct(map[string]interface{}{"fail": true})
+	grpcResp, err := migv01.NewInvocationClient(conn).InvokeBatch(context.Background(), &migv01.InvokeBatchRequest{
+		Header:     &migv01.MessageHeader{TenantId: "acme", MigVersion: "0.1"},
+		Capability: "acme.score.item",
+		Items:      []*migv01.InvokeBatchItem{{Payload: ok}, {Payload: bad}},
+	})
+	if err != nil {
+		t.Fatalf("grpc batch: %v", err)
+	}
+	results := grpcResp.GetResults()
+	if grpcResp.GetSucceeded() != 1 || len(results) != 2 {
+		t.Fatalf("unexpected grpc batch response: %v", grpcResp)
+	}
+	if results[0].GetPayload().AsMap()["score"] != float64(7) || results[1].GetError().GetCode() != migv01.MigErrorCode_MIG_INVALID_REQUEST {
+		t.Fatalf("unexpected grpc results: %v", results)
+	}
+}
@@ -0,0 +1,341 @@
+package mig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	CanaryActive     = "active"
+	CanaryRolledBack = "rolled_back"
+
+	CanaryArmStable    = "stable"
+	CanaryArmCandidate = "candidate"
+
+	// CanaryMetaKey reports which canary arm served an invocation.
+	CanaryMetaKey = "mig.canary"
+
+	canaryStickyTenant  = "tenant"
+	canaryStickySession = "session"
+
+	defaultCanaryErrorRate       = 0.2
+	defaultCanaryMinimumRequests = 20
+	defaultCanaryWindowMS        = 60000
+)
+
+// CanaryConfig splits unpinned traffic for a capability ID between a stable
+// and a candidate version. Both versions must already be registered.
+type CanaryConfig struct {
+	Capability string `json:"capability"`
+	// StableVersion defaults to the highest stable version other than the
+	// candidate.
+	StableVersion    string `json:"stable_version,omitempty"`
+	CandidateVersion string `json:"candidate_version"`
+	// Weight is the percentage (0-100) of sticky keys sent to the candidate.
+	Weight int `json:"weight"`
+	// StickyOn is "tenant" (default) or "session". Calls without a session
+	// ID fall back to the tenant.
+	StickyOn string `json:"sticky_on,omitempty"`
+	// The canary rolls back to stable once the candidate has failed at least
+	// ErrorRateThreshold of MinimumRequests or more calls within WindowMS.
+	ErrorRateThreshold float64 `json:"error_rate_threshold,omitempty"`
+	MinimumRequests    int     `json:"minimum_requests,omitempty"`
+	WindowMS           int     `json:"window_ms,omitempty"`
+}
+
+// CanaryStatus is the admin view of one canary.
+type CanaryStatus struct {
+	CanaryConfig
+	State          string          `json:"state"`
+	RollbackReason string          `json:"rollback_reason,omitempty"`
+	RolledBackAt   string          `json:"rolled_back_at,omitempty"`
+	Stable         CanaryArmStatus `json:"stable"`
+	Candidate      CanaryArmStatus `json:"candidate"`
+}
+
+// CanaryArmStatus counts invocations in the current rollback window.
+type CanaryArmStatus struct {
+	Requests int `json:"requests"`
+	Failures int `json:"failures"`
+}
+
+type canary struct {
+	cfg CanaryConfig
+
+	mu           sync.Mutex
+	state        string
+	reason       string
+	rolledBackAt time.Time
+	windowStart  time.Time
+	stable       CanaryArmStatus
+	candidate    CanaryArmStatus
+}
+
+// canaryRoute is the split decision for one invocation.
+type canaryRoute struct {
+	canary  *canary
+	arm     string
+	version string
+}
+
+func normalizeCanaryConfig(cfg CanaryConfig) (CanaryConfig, *MigError) {
+	if cfg.Capability == "" || cfg.CandidateVersion == "" {
+		return cfg, invalid("capability and candidate_version are required")
+	}
+	if cfg.Weight < 0 || cfg.Weight > 100 {
+		return cfg, invalid("weight must be between 0 and 100")
+	}
+	switch cfg.StickyOn {
+	case "":
+		cfg.StickyOn = canaryStickyTenant
+	case canaryStickyTenant, canaryStickySession:
+	default:
+		return cfg, invalid("sticky_on must be tenant or session")
+	}
+	if cfg.ErrorRateThreshold < 0 || cfg.ErrorRateThreshold > 1 {
+		return cfg, invalid("error_rate_threshold must be between 0 and 1")
+	}
+	if cfg.MinimumRequests < 0 || cfg.WindowMS < 0 {
+		return cfg, invalid("canary values must be >= 0")
+	}
+	if cfg.ErrorRateThreshold == 0 {
+		cfg.ErrorRateThreshold = defaultCanaryErrorRate
+	}
+	if cfg.MinimumRequests == 0 {
+		cfg.MinimumRequests = defaultCanaryMinimumRequests
+	}
+	if cfg.WindowMS == 0 {
+		cfg.WindowMS = defaultCanaryWindowMS
+	}
+	return cfg, nil
+}
+
+// SetCanary creates or replaces the canary for a capability ID. Replacing a
+// canary resets its counters and re-activates a rolled back split.
+func (s *Service) SetCanary(cfg CanaryConfig) (CanaryStatus, *MigError) {
+	cfg, migErr := normalizeCanaryConfig(cfg)
+	if migErr != nil {
+		return CanaryStatus{}, migErr
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.capabilities[capabilityKey(cfg.Capability, cfg.CandidateVersion)]; !ok {
+		return CanaryStatus{}, invalid("candidate_version " + cfg.CandidateVersion + " of " + cfg.Capability + " is not registered")
+	}
+	if cfg.StableVersion == "" {
+		cfg.StableVersion = s.defaultStableVersionLocked(cfg.Capability, cfg.CandidateVersion)
+		if cfg.StableVersion == "" {
+			return CanaryStatus{}, invalid("no stable version of " + cfg.Capability + " is registered besides the candidate")
+		}
+	} else if _, ok := s.capabilities[capabilityKey(cfg.Capability, cfg.StableVersion)]; !ok {
+		return CanaryStatus{}, invalid("stable_version " + cfg.StableVersion + " of " + cfg.Capability + " is not registered")
+	}
+	if cfg.StableVersion == cfg.CandidateVersion {
+		return CanaryStatus{}, invalid("stable_version and candidate_version must differ")
+	}
+	c := &canary{cfg: cfg, state: CanaryActive, windowStart: time.Now()}
+	s.canaries[cfg.Capability] = c
+	return c.status(), nil
+}
+
+func (s *Service) defaultStableVersionLocked(id, candidate string) string {
+	var (
+		best  semVersion
+		found string
+	)
+	for _, desc := range s.capabilities {
+		if desc.ID != id || desc.Version == candidate {
+			continue
+		}
+		version, ok := parseSemver(desc.Version)
+		if !ok {
+			continue
+		}
+		if found == "" || preferVersion(version, best, true) {
+			best, found = version, desc.Version
+		}
+	}
+	return found
+}
+
+// DeleteCanary removes a canary so unpinned calls resolve to the highest
+// stable version again.
+func (s *Service) DeleteCanary(capability string) *MigError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.canaries[capability]; !ok {
+		return &MigError{Code: ErrorUnsupportedCapability, Message: "no canary configured for " + capability, Retryable: false}
+	}
+	delete(s.canaries, capability)
+	return nil
+}
+
+// Canaries lists canary state ordered by capability ID.
+func (s *Service) Canaries() []CanaryStatus {
+	s.mu.RLock()
+	canaries := make([]*canary, 0, len(s.canaries))
+	for _, c := range s.canaries {
+		canaries = append(canaries, c)
+	}
+	s.mu.RUnlock()
+	out := make([]CanaryStatus, 0, len(canaries))
+	for _, c := range canaries {
+		out = append(out, c.status())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Capability < out[j].Capability })
+	return out
+}
+
+// routeCanaryLocked picks the canary arm for an unpinned invocation. Callers
+// must hold s.mu.
+func (s *Service) routeCanaryLocked(id string, head MessageHeader) *canaryRoute {
+	c, ok := s.canaries[id]
+	if !ok {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	route := &canaryRoute{canary: c, arm: CanaryArmStable, version: c.cfg.StableVersion}
+	if c.state == CanaryActive && canaryBucket(id, c.stickyKey(head)) < c.cfg.Weight {
+		route.arm, route.version = CanaryArmCandidate, c.cfg.CandidateVersion
+	}
+	return route
+}
+
+func (c *canary) stickyKey(head MessageHeader) string {
+	if c.cfg.StickyOn == canaryStickySession && head.SessionID != "" {
+		return "session:" + head.SessionID
+	}
+	return "tenant:" + head.TenantID
+}
+
+// canaryBucket maps a sticky key to [0, 100). Raising the weight only moves
+// keys from stable to candidate, never back.
+func canaryBucket(id, key string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id + "|" + key))
+	return int(h.Sum32() % 100)
+}
+
+// record counts the outcome of a routed call and reports whether it rolled the
+// canary back.
+func (c *canary) record(arm string, migErr *MigError) (bool, string) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Sub(c.windowStart) >= time.Duration(c.cfg.WindowMS)*time.Millisecond {
+		c.windowStart = now
+		c.stable = CanaryArmStatus{}
+		c.candidate = CanaryArmStatus{}
+	}
+	counts := &c.stable
+	if arm == CanaryArmCandidate {
+		counts = &c.candidate
+	}
+	counts.Requests++
+	if migErr != nil && breakerCountsFailure(migErr.Code) {
+		counts.Failures++
+	}
+	if arm != CanaryArmCandidate || c.state != CanaryActive || c.candidate.Requests < c.cfg.MinimumRequests {
+		return false, ""
+	}
+	rate := float64(c.candidate.Failures) / float64(c.candidate.Requests)
+	if rate < c.cfg.ErrorRateThreshold {
+		return false, ""
+	}
+	c.state = CanaryRolledBack
+	c.rolledBackAt = now
+	c.reason = fmt.Sprintf("candidate error rate %.2f reached threshold %.2f over %d requests", rate, c.cfg.ErrorRateThreshold, c.candidate.Requests)
+	return true, c.reason
+}
+
+func (c *canary) status() CanaryStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := CanaryStatus{
+		CanaryConfig:   c.cfg,
+		State:          c.state,
+		RollbackReason: c.reason,
+		Stable:         c.stable,
+		Candidate:      c.candidate,
+	}
+	if c.state == CanaryRolledBack {
+		out.RolledBackAt = c.rolledBackAt.UTC().Format(time.RFC3339)
+	}
+	return out
+}
+
+// countCanaryRoute counts a call routed by a canary split. It is called once
+// the call is dispatched, or fails for want of a provider, so the route
+// counts match the outcomes the canary records.
+func (s *Service) countCanaryRoute(route *canaryRoute, capability string) {
+	if metrics := s.metricsSnapshot(); route != nil && metrics != nil {
+		metrics.RecordCanaryRoute(capability, route.arm, route.version)
+	}
+}
+
+// callerAborted reports whether a call ended by CANCEL or because the caller
+// went away. Running out of the call deadline is not an abort: it is what a
+// hanging arm looks like.
+func callerAborted(ctx, reqCtx context.Context) bool {
+	if _, cancelled := cancelledBy(reqCtx); cancelled {
+		return true
+	}
+	return errors.Is(ctx.Err(), context.Canceled)
+}
+
+// finishCanary feeds an invocation outcome into its canary, audits routed
+// failures, and audits an automatic rollback. Calls aborted by CANCEL or by
+// the caller are audited but not counted, since they say nothing about the
+// arm that served them.
+func (s *Service) finishCanary(route *canaryRoute, actor string, req InvokeRequest, migErr *MigError, aborted bool) {
+	if route == nil {
+		return
+	}
+	var rolledBack bool
+	var reason string
+	if !aborted {
+		rolledBack, reason = route.canary.record(route.arm, migErr)
+	}
+	if migErr == nil && !rolledBack {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if migErr != nil {
+		s.audit = append(s.audit, AuditRecord{
+			Actor:      actor,
+			TenantID:   req.Header.TenantID,
+			Capability: req.Capability,
+			Version:    route.version,
+			Canary:     route.arm,
+			Outcome:    "error",
+			Timestamp:  time.Now().UTC().Format(time.RFC3339),
+			MessageID:  req.Header.MessageID,
+			ErrorCode:  migErr.Code,
+		})
+		s.writeAuditLogLocked(s.audit[len(s.audit)-1])
+	}
+	if rolledBack {
+		s.audit = append(s.audit, AuditRecord{
+			Actor:      "system",
+			TenantID:   req.Header.TenantID,
+			Capability: req.Capability,
+			Version:    route.version,
+			Canary:     route.arm,
+			Outcome:    "canary_rolled_back",
+			Timestamp:  time.Now().UTC().Format(time.RFC3339),
+			MessageID:  req.Header.MessageID,
+			Reason:     reason,
+		})
+		s.writeAuditLogLocked(s.audit[len(s.audit)-1])
+		if s.metrics != nil {
+			s.metrics.RecordCanaryRollback(req.Capability)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package mig
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// addCanaryVersions registers 1.0.0 and 2.0.0 of id; 2.0.0 fails while failing
+// is set.
+func addCanaryVersions(t *testing.T, svc *Service, id string, failing *atomic.Bool) {
+	t.Helper()
+	for _, version := range []string{"1.0.0", "2.0.0"} {
+		desc := testDescriptor(id)
+		desc.Version = version
+		if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: desc}); err != nil {
+			t.Fatalf("add %s: %v", version, err.Message)
+		}
+		served := version
+		if err := svc.BindProvider(id+"@"+version, ProviderFunc(func(context.Context, InvokeRequest) (map[string]interface{}, *MigError) {
+			if served == "2.0.0" && failing != nil && failing.Load() {
+				return nil, &MigError{Code: ErrorUnavailable, Message: "candidate down", Retryable: true}
+			}
+			return map[string]interface{}{"served_by": served}, nil
+		})); err != nil {
+			t.Fatalf("bind %s: %v", version, err.Message)
+		}
+	}
+}
+
+func TestCanarySplitsStickyTraffic(t *testing.T) {
+	svc := NewService()
+	addCanaryVersions(t, svc, "acme.tools.canary", nil)
+	status, err := svc.SetCanary(CanaryConfig{Capability: "acme.tools.canary", CandidateVersion: "2.0.0", Weight: 30})
+	if err != nil {
+		t.Fatalf("set canary: %v", err.Message)
+	}
+	if status.StableVersion != "1.0.0" || status.StickyOn != "tenant" || status.State != CanaryActive {
+		t.Fatalf("unexpected canary defaults: %#v", status)
+	}
+
+	candidates := 0
+	for i := 0; i < 200; i++ {
+		tenant := fmt.Sprintf("tenant-%d", i)
+		var first string
+		for j := 0; j < 2; j++ {
+			resp, err := svc.Invoke(context.Background(), "acme.tools.canary", InvokeRequest{
+				Header:  MessageHeader{TenantID: tenant},
+				Payload: map[string]interface{}{},
+			}, "tester", AnonymousPrincipal())
+			if err != nil {
+				t.Fatalf("invoke: %v", err.Message)
+			}
+			arm := resp.Header.Meta[CanaryMetaKey]
+			version := resp.Header.Meta[CapabilityVersionMetaKey]
+			if (arm == CanaryArmCandidate) != (version == "2.0.0") || resp.Payload["served_by"] != version {
+				t.Fatalf("split decision does not match serving version: %#v %#v", resp.Header.Meta, resp.Payload)
+			}
+			if j == 0 {
+				first = version.(string)
+			} else if version != first {
+				t.Fatalf("tenant %s moved from %s to %v", tenant, first, version)
+			}
+		}
+		if first == "2.0.0" {
+			candidates++
+		}
+	}
+	if candidates < 30 || candidates > 90 {
+		t.Fatalf("expected roughly 30%% of tenants on the candidate, got %d/200", candidates)
+	}
+
+	audited := map[string]bool{}
+	for _, record := range svc.AuditExport("") {
+		if record.Capability == "acme.tools.canary" {
+			audited[record.Canary+"@"+record.Version] = true
+		}
+	}
+	if !audited["stable@1.0.0"] || !audited["candidate@2.0.0"] {
+		t.Fatalf("expected audit records for both arms, got %v", audited)
+	}
+
+	// Pinned calls bypass the split.
+	resp, err := svc.Invoke(context.Background(), "acme.tools.canary@1.0.0", InvokeRequest{
+		Header:  MessageHeader{TenantID: "tenant-0"},
+		Payload: map[string]interface{}{},
+	}, "tester", AnonymousPrincipal())
+	if err != nil || resp.Payload["served_by"] != "1.0.0" {
+		t.Fatalf("pinned invoke: %#v %#v", resp.Payload, err)
+	}
+	if _, routed := resp.Header.Meta[CanaryMetaKey]; routed {
+		t.Fatalf("pinned invoke should not be split: %#v", resp.Header.Meta)
+	}
+
+	if err := svc.DeleteCanary("acme.tools.canary"); err != nil {
+		t.Fatalf("delete canary: %v", err.Message)
+	}
+	if len(svc.Canaries()) != 0 {
+		t.Fatal("expected canary to be removed")
+	}
+}
+
+func TestCanaryRollsBackOnCandidateErrors(t *testing.T) {
+	svc := NewService()
+	var failing atomic.Bool
+	failing.Store(true)
+	addCanaryVersions(t, svc, "acme.tools.rollback", &failing)
+	if _, err := svc.SetCanary(CanaryConfig{
+		Capability:         "acme.tools.rollback",
+		CandidateVersion:   "2.0.0",
+		Weight:             100,
+		ErrorRateThreshold: 0.5,
+		MinimumRequests:    3,
+	}); err != nil {
+		t.Fatalf("set canary: %v", err.Message)
+	}
+	invoke := func() (InvokeResponse, *MigError) {
+		return svc.Invoke(context.Background(), "acme.tools.rollback", InvokeRequest{
+			Header:  MessageHeader{TenantID: "acme"},
+			Payload: map[string]interface{}{},
+		}, "tester", AnonymousPrincipal())
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := invoke(); err == nil || err.Code != ErrorUnavailable {
+			t.Fatalf("expected candidate failure, got %#v", err)
+		}
+	}
+	status := svc.Canaries()[0]
+	if status.State != CanaryRolledBack || status.RollbackReason == "" || status.Candidate.Failures != 3 {
+		t.Fatalf("expected rollback, got %#v", status)
+	}
+	resp, err := invoke()
+	if err != nil {
+		t.Fatalf("invoke after rollback: %v", err.Message)
+	}
+	if resp.Payload["served_by"] != "1.0.0" || resp.Header.Meta[CanaryMetaKey] != CanaryArmStable {
+		t.Fatalf("expected stable after rollback: %#v %#v", resp.Header.Meta, resp.Payload)
+	}
+
+	outcomes := map[string]int{}
+	for _, record := range svc.AuditExport("") {
+		if record.Capability == "acme.tools.rollback" {
+			outcomes[record.Outcome]++
+		}
+	}
+	if outcomes["error"] != 3 || outcomes["canary_rolled_back"] != 1 || outcomes["success"] != 1 {
+		t.Fatalf("unexpected audit outcomes: %v", outcomes)
+	}
+}
+
+func TestCanaryRoutesCountOnlyAuthorizedCalls(t *testing.T) {
+	svc := NewService()
+	registry := prometheus.NewRegistry()
+	svc.SetMetrics(NewMetrics(registry))
+	for _, version := range []string{"1.0.0", "2.0.0"} {
+		desc := testDescriptor("acme.tools.guarded")
+		desc.Version = version
+		desc.AuthScopes = []string{"capability:guarded"}
+		if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: desc, Provider: &ProviderConfig{Type: ProviderTypeEcho}}); err != nil {
+			t.Fatalf("add %s: %v", version, err.Message)
+		}
+	}
+	if _, err := svc.SetCanary(CanaryConfig{Capability: "acme.tools.guarded", CandidateVersion: "2.0.0", Weight: 100}); err != nil {
+		t.Fatalf("set canary: %v", err.Message)
+	}
+
+	routed := func() float64 {
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatalf("gather: %v", err)
+		}
+		total := 0.0
+		for _, family := range families {
+			if family.GetName() == "mig_gateway_canary_routed_total" {
+				for _, metric := range family.GetMetric() {
+					total += metric.GetCounter().GetValue()
+				}
+			}
+		}
+		return total
+	}
+	invoke := func(principal Principal) *MigError {
+		_, err := svc.Invoke(context.Background(), "acme.tools.guarded", InvokeRequest{Header: MessageHeader{TenantID: "acme"}}, "tester", principal)
+		return err
+	}
+	if err := invoke(jwtPrincipal("mallory")); err == nil || err.Code != ErrorForbidden {
+		t.Fatalf("expected forbidden, got %#v", err)
+	}
+	if got := routed(); got != 0 {
+		t.Fatalf("unauthorized calls must not count as routed, got %v", got)
+	}
+	if err := invoke(jwtPrincipal("alice", "capability:guarded")); err != nil {
+		t.Fatalf("invoke: %v", err.Message)
+	}
+	if got := routed(); got != 1 {
+		t.Fatalf("expected one routed call, got %v", got)
+	}
+}
+
+func TestCanaryIgnoresCallerAborts(t *testing.T) {
+	svc := NewService()
+	started := make(chan struct{}, 8)
+	for _, version := range []string{"1.0.0", "2.0.0"} {
+		desc := testDescriptor("acme.tools.slowcanary")
+		desc.Version = version
+		if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: desc}); err != nil {
+			t.Fatalf("add %s: %v", version, err.Message)
+		}
+		_ = svc.BindProvider("acme.tools.slowcanary@"+version, ProviderFunc(func(ctx context.Context, _ InvokeRequest) (map[string]interface{}, *MigError) {
+			started <- struct{}{}
+			<-ctx.Done()
+			return nil, &MigError{Code: ErrorTimeout, Message: "aborted", Retryable: true}
+		}))
+	}
+	if _, err := svc.SetCanary(CanaryConfig{
+		Capability:         "acme.tools.slowcanary",
+		CandidateVersion:   "2.0.0",
+		Weight:             100,
+		ErrorRateThreshold: 0.5,
+		MinimumRequests:    2,
+	}); err != nil {
+		t.Fatalf("set canary: %v", err.Message)
+	}
+
+	// One caller goes away and one call is cancelled.
+	errs := make(chan *MigError, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_, err := svc.Invoke(ctx, "acme.tools.slowcanary", InvokeRequest{
+			Header: MessageHeader{TenantID: "acme", DeadlineMS: 5000},
+		}, "tester", AnonymousPrincipal())
+		errs <- err
+	}()
+	waitSignal(t, started, "candidate was not called")
+	cancel()
+	<-errs
+	go func() {
+		_, err := svc.Invoke(context.Background(), "acme.tools.slowcanary", InvokeRequest{
+			Header: MessageHeader{TenantID: "acme", MessageID: "canary-cancel", DeadlineMS: 5000},
+		}, "tester", AnonymousPrincipal())
+		errs <- err
+	}()
+	waitSignal(t, started, "candidate was not called")
+	if ack, _ := svc.Cancel(CancelRequest{Header: MessageHeader{TenantID: "acme"}}, "canary-cancel", "tester", AnonymousPrincipal()); ack.Status != CancelStatusCancelled {
+		t.Fatalf("unexpected cancel ack: %#v", ack)
+	}
+	<-errs
+	status := svc.Canaries()[0]
+	if status.State != CanaryActive || status.Candidate.Requests != 0 || status.Candidate.Failures != 0 {
+		t.Fatalf("caller aborts must not count against the candidate, got %#v", status)
+	}
+
+	// A candidate that hangs until the deadline is failing.
+	for i := 0; i < 2; i++ {
+		if _, err := svc.Invoke(context.Background(), "acme.tools.slowcanary", InvokeRequest{
+			Header: MessageHeader{TenantID: "acme", DeadlineMS: 30},
+		}, "tester", AnonymousPrincipal()); err == nil || err.Code != ErrorTimeout {
+			t.Fatalf("expected a timeout, got %#v", err)
+		}
+	}
+	if status := svc.Canaries()[0]; status.State != CanaryRolledBack {
+		t.Fatalf("deadline timeouts should roll the candidate back, got %#v", status)
+	}
+}
+
+func TestCanaryRouteCountsMatchRecordedOutcomes(t *testing.T) {
+	svc := NewService()
+	registry := prometheus.NewRegistry()
+	svc.SetMetrics(NewMetrics(registry))
+	if err := svc.AddSchema(SchemaUpsertRequest{URI: "schema://acme/unbound/v1", Schema: map[string]interface{}{
+		"type": "object", "required": []interface{}{"input"},
+	}}); err != nil {
+		t.Fatalf("add schema: %v", err.Message)
+	}
+	for _, version := range []string{"1.0.0", "2.0.0"} {
+		desc := testDescriptor("acme.tools.unbound")
+		desc.Version = version
+		desc.InputSchemaURI = "schema://acme/unbound/v1"
+		upsert := CapabilityUpsertRequest{Descriptor: desc}
+		if version == "1.0.0" {
+			upsert.Provider = &ProviderConfig{Type: ProviderTypeEcho}
+		}
+		if err := svc.AddCapability(upsert); err != nil {
+			t.Fatalf("add %s: %v", version, err.Message)
+		}
+	}
+	if _, err := svc.SetCanary(CanaryConfig{
+		Capability:         "acme.tools.unbound",
+		CandidateVersion:   "2.0.0",
+		Weight:             100,
+		ErrorRateThreshold: 0.5,
+		MinimumRequests:    2,
+	}); err != nil {
+		t.Fatalf("set canary: %v", err.Message)
+	}
+	routed := func() float64 {
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatalf("gather: %v", err)
+		}
+		total := 0.0
+		for _, family := range families {
+			if family.GetName() == "mig_gateway_canary_routed_total" {
+				for _, metric := range family.GetMetric() {
+					total += metric.GetCounter().GetValue()
+				}
+			}
+		}
+		return total
+	}
+
+	// A candidate without a provider counts as routed and failed.
+	for i := 0; i < 2; i++ {
+		if _, err := svc.Invoke(context.Background(), "acme.tools.unbound", InvokeRequest{
+			Header:  MessageHeader{TenantID: "acme"},
+			Payload: map[string]interface{}{"input": "x"},
+		}, "tester", AnonymousPrincipal()); err == nil || err.Code != ErrorUnavailable {
+			t.Fatalf("expected MIG_UNAVAILABLE, got %#v", err)
+		}
+	}
+	status := svc.Canaries()[0]
+	if routed() != 2 || status.Candidate.Requests != 2 || status.State != CanaryRolledBack {
+		t.Fatalf("expected two routed, recorded failures, got %v routed and %#v", routed(), status)
+	}
+
+	// A payload the schema rejects never reaches the stable arm.
+	if _, err := svc.Invoke(context.Background(), "acme.tools.unbound", InvokeRequest{Header: MessageHeader{TenantID: "acme"}}, "tester", AnonymousPrincipal()); err == nil || err.Code != ErrorInvalidRequest {
+		t.Fatalf("expected a schema violation, got %#v", err)
+	}
+	if status := svc.Canaries()[0]; routed() != 2 || status.Stable.Requests != 0 {
+		t.Fatalf("rejected payloads must not count, got %v routed and %#v", routed(), status)
+	}
+}
+
+func TestCanaryConfigValidation(t *testing.T) {
+	svc := NewService()
+	addCanaryVersions(t, svc, "acme.tools.validate", nil)
+	for _, cfg := range []CanaryConfig{
+		{Capability: "acme.tools.validate"},
+		{Capability: "acme.tools.validate", CandidateVersion: "3.0.0", Weight: 10},
+		{Capability: "acme.tools.validate", CandidateVersion: "2.0.0", Weight: 101},
+		{Capability: "acme.tools.validate", CandidateVersion: "2.0.0", StableVersion: "2.0.0"},
+		{Capability: "acme.tools.validate", CandidateVersion: "2.0.0", StickyOn: "region"},
+	} {
+		if _, err := svc.SetCanary(cfg); err == nil || err.Code != ErrorInvalidRequest {
+			t.Fatalf("expected %#v to be rejected, got %#v", cfg, err)
+		}
+	}
+}
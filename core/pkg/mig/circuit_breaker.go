@@ -0,0 +1,344 @@
+package mig
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+
+	defaultBreakerFailureRate     = 0.5
+	defaultBreakerMinimumRequests = 10
+	defaultBreakerWindowMS        = 30000
+	defaultBreakerCooldownMS      = 30000
+	defaultBreakerHalfOpenProbes  = 1
+
+	defaultBreakerEndpoint = "default"
+)
+
+// CircuitBreakerConfig trips a capability (or each endpoint of a pooled
+// capability) open when too many invocations fail, so callers fail fast
+// instead of waiting out their deadline against a dead backend.
+type CircuitBreakerConfig struct {
+	// FailureRateThreshold is the failure ratio in (0, 1] that opens the
+	// breaker once MinimumRequests have been seen in the current window.
+	FailureRateThreshold float64 `json:"failure_rate_threshold,omitempty"`
+	MinimumRequests      int     `json:"minimum_requests,omitempty"`
+	WindowMS             int     `json:"window_ms,omitempty"`
+	// CooldownMS is how long the breaker stays open before letting
+	// HalfOpenRequests trial invocations through.
+	CooldownMS       int `json:"cooldown_ms,omitempty"`
+	HalfOpenRequests int `json:"half_open_requests,omitempty"`
+}
+
+// CircuitBreakerStatus is the admin view of one breaker.
+type CircuitBreakerStatus struct {
+	Endpoint     string `json:"endpoint"`
+	State        string `json:"state"`
+	Requests     int    `json:"requests"`
+	Failures     int    `json:"failures"`
+	OpenedAt     string `json:"opened_at,omitempty"`
+	RetryAfterMS int64  `json:"retry_after_ms,omitempty"`
+}
+
+type circuitBreaker struct {
+	cfg        CircuitBreakerConfig
+	capability string
+	endpoint   string
+	metrics    func() *Metrics
+
+	mu          sync.Mutex
+	state       string
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int
+}
+
+func normalizeBreakerConfig(cfg CircuitBreakerConfig) (CircuitBreakerConfig, *MigError) {
+	if cfg.FailureRateThreshold < 0 || cfg.FailureRateThreshold > 1 {
+		return cfg, invalid("circuit_breaker.failure_rate_threshold must be between 0 and 1")
+	}
+	if cfg.MinimumRequests < 0 || cfg.WindowMS < 0 || cfg.CooldownMS < 0 || cfg.HalfOpenRequests < 0 {
+		return cfg, invalid("circuit_breaker values must be >= 0")
+	}
+	if cfg.FailureRateThreshold == 0 {
+		cfg.FailureRateThreshold = defaultBreakerFailureRate
+	}
+	if cfg.MinimumRequests == 0 {
+		cfg.MinimumRequests = defaultBreakerMinimumRequests
+	}
+	if cfg.WindowMS == 0 {
+		cfg.WindowMS = defaultBreakerWindowMS
+	}
+	if cfg.CooldownMS == 0 {
+		cfg.CooldownMS = defaultBreakerCooldownMS
+	}
+	if cfg.HalfOpenRequests == 0 {
+		cfg.HalfOpenRequests = defaultBreakerHalfOpenProbes
+	}
+	return cfg, nil
+}
+
+func (s *Service) newCircuitBreaker(capability, endpoint string, cfg CircuitBreakerConfig) *circuitBreaker {
+	b := &circuitBreaker{
+		cfg:         cfg,
+		capability:  capability,
+		endpoint:    endpoint,
+		state:       BreakerClosed,
+		windowStart: time.Now(),
+		metrics:     s.metricsSnapshot,
+	}
+	if metrics := s.metricsSnapshot(); metrics != nil {
+		metrics.SetBreakerState(capability, endpoint, BreakerClosed)
+	}
+	return b
+}
+
+// available reports whether a call could be admitted without reserving a
+// half-open probe slot. Pools use it to skip open endpoints.
+func (b *circuitBreaker) available(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		return now.Sub(b.openedAt) >= time.Duration(b.cfg.CooldownMS)*time.Millisecond
+	case BreakerHalfOpen:
+		return b.probes < b.cfg.HalfOpenRequests
+	}
+	return true
+}
+
+// retryAfter is the remaining cooldown of an open breaker.
+func (b *circuitBreaker) retryAfter(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != BreakerOpen {
+		return 0
+	}
+	return time.Duration(b.cfg.CooldownMS)*time.Millisecond - now.Sub(b.openedAt)
+}
+
+// allow admits a call or returns the fast-fail error for an open breaker.
+func (b *circuitBreaker) allow() *MigError {
+	now := time.Now()
+	b.mu.Lock()
+	from := b.state
+	cooldown := time.Duration(b.cfg.CooldownMS) * time.Millisecond
+	if b.state == BreakerOpen && now.Sub(b.openedAt) >= cooldown {
+		b.state = BreakerHalfOpen
+		b.probes = 0
+	}
+	switch {
+	case b.state == BreakerOpen:
+		retryAfter := cooldown - now.Sub(b.openedAt)
+		b.mu.Unlock()
+		return b.openError(retryAfter)
+	case b.state == BreakerHalfOpen && b.probes >= b.cfg.HalfOpenRequests:
+		b.mu.Unlock()
+		return b.openError(0)
+	case b.state == BreakerHalfOpen:
+		b.probes++
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.transitioned(from, to)
+	return nil
+}
+
+func (b *circuitBreaker) openError(retryAfter time.Duration) *MigError {
+	retryAfterMS := retryAfter.Milliseconds()
+	if retryAfterMS < 1 {
+		retryAfterMS = 1
+	}
+	return &MigError{
+		Code:      ErrorUnavailable,
+		Message:   "circuit breaker open for " + b.capability,
+		Retryable: true,
+		Details: map[string]interface{}{
+			"capability":     b.capability,
+			"endpoint":       b.endpoint,
+			"retry_after_ms": retryAfterMS,
+		},
+	}
+}
+
+// record feeds the outcome of an admitted call back into the breaker.
+func (b *circuitBreaker) record(ctx context.Context, migErr *MigError) {
+	if migErr != nil && errors.Is(ctx.Err(), context.Canceled) {
+		// The caller went away; that says nothing about the backend.
+		b.mu.Lock()
+		if b.state == BreakerHalfOpen && b.probes > 0 {
+			b.probes--
+		}
+		b.mu.Unlock()
+		return
+	}
+	failed := migErr != nil && breakerCountsFailure(migErr.Code)
+	now := time.Now()
+	b.mu.Lock()
+	from := b.state
+	switch b.state {
+	case BreakerHalfOpen:
+		if failed {
+			b.trip(now)
+		} else {
+			b.reset(now)
+			b.state = BreakerClosed
+		}
+	case BreakerClosed:
+		if now.Sub(b.windowStart) >= time.Duration(b.cfg.WindowMS)*time.Millisecond {
+			b.reset(now)
+		}
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= b.cfg.MinimumRequests && float64(b.failures)/float64(b.requests) >= b.cfg.FailureRateThreshold {
+			b.trip(now)
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.transitioned(from, to)
+}
+
+func (b *circuitBreaker) trip(now time.Time) {
+	b.state = BreakerOpen
+	b.openedAt = now
+	b.probes = 0
+}
+
+func (b *circuitBreaker) reset(now time.Time) {
+	b.windowStart = now
+	b.requests = 0
+	b.failures = 0
+	b.probes = 0
+}
+
+// close drops the breaker's metric series once its provider is replaced.
+func (b *circuitBreaker) close() {
+	if b.metrics != nil {
+		if metrics := b.metrics(); metrics != nil {
+			metrics.DeleteBreaker(b.capability, b.endpoint)
+		}
+	}
+}
+
+func (b *circuitBreaker) transitioned(from, to string) {
+	if from == to || b.metrics == nil {
+		return
+	}
+	if metrics := b.metrics(); metrics != nil {
+		metrics.RecordBreakerTransition(b.capability, b.endpoint, from, to)
+	}
+}
+
+func (b *circuitBreaker) status() CircuitBreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := CircuitBreakerStatus{Endpoint: b.endpoint, State: b.state, Requests: b.requests, Failures: b.failures}
+	if b.state != BreakerClosed {
+		out.OpenedAt = b.openedAt.UTC().Format(time.RFC3339)
+	}
+	if b.state == BreakerOpen {
+		remaining := time.Duration(b.cfg.CooldownMS)*time.Millisecond - time.Since(b.openedAt)
+		if remaining > 0 {
+			out.RetryAfterMS = remaining.Milliseconds()
+		}
+	}
+	return out
+}
+
+// breakerCountsFailure limits tripping to backend failures. Client errors such
+// as invalid payloads or missing scopes do not indicate an unhealthy backend.
+func breakerCountsFailure(code string) bool {
+	switch code {
+	case ErrorUnavailable, ErrorTimeout, ErrorInternal:
+		return true
+	}
+	return false
+}
+
+// breakerProvider guards a single-endpoint provider with a circuit breaker.
+type breakerProvider struct {
+	inner   Provider
+	breaker *circuitBreaker
+}
+
+func (p *breakerProvider) Invoke(ctx context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+	if migErr := p.breaker.allow(); migErr != nil {
+		return nil, migErr
+	}
+	payload, migErr := p.inner.Invoke(ctx, req)
+	p.breaker.record(ctx, migErr)
+	return payload, migErr
+}
+
+func (p *breakerProvider) InvokeStream(ctx context.Context, req InvokeRequest, emit func(StreamFrame) error) *MigError {
+	if migErr := p.breaker.allow(); migErr != nil {
+		return migErr
+	}
+	migErr := p.inner.InvokeStream(ctx, req, emit)
+	p.breaker.record(ctx, migErr)
+	return migErr
+}
+
+func (p *breakerProvider) Close() error {
+	closeProvider(p.inner)
+	p.breaker.close()
+	return nil
+}
+
+// withCircuitBreaker attaches breakers to a provider built from admin config:
+// one per endpoint for pools, or a single "default" breaker otherwise.
+func (s *Service) withCircuitBreaker(capability string, provider Provider, cfg CircuitBreakerConfig) (Provider, *MigError) {
+	cfg, migErr := normalizeBreakerConfig(cfg)
+	if migErr != nil {
+		return nil, migErr
+	}
+	if pool, ok := provider.(*poolProvider); ok {
+		for _, ep := range pool.endpoints {
+			ep.breaker = s.newCircuitBreaker(capability, ep.name, cfg)
+		}
+		return pool, nil
+	}
+	return &breakerProvider{inner: provider, breaker: s.newCircuitBreaker(capability, defaultBreakerEndpoint, cfg)}, nil
+}
+
+// CircuitBreakers returns breaker state keyed by capability ID and version
+// ("id@version").
+func (s *Service) CircuitBreakers() map[string][]CircuitBreakerStatus {
+	s.mu.RLock()
+	providers := make(map[string]Provider, len(s.providers))
+	for capability, provider := range s.providers {
+		providers[capability] = provider
+	}
+	s.mu.RUnlock()
+	out := map[string][]CircuitBreakerStatus{}
+	for capability, provider := range providers {
+		var statuses []CircuitBreakerStatus
+		switch p := provider.(type) {
+		case *breakerProvider:
+			statuses = append(statuses, p.breaker.status())
+		case *poolProvider:
+			for _, ep := range p.endpoints {
+				if ep.breaker != nil {
+					statuses = append(statuses, ep.breaker.status())
+				}
+			}
+		}
+		if len(statuses) > 0 {
+			sort.Slice(statuses, func(i, j int) bool { return statuses[i].Endpoint < statuses[j].Endpoint })
+			out[capability] = statuses
+		}
+	}
+	return out
+}
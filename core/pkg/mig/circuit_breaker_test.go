@@ -0,0 +1,121 @@
+package mig
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerFastFailsAndRecovers(t *testing.T) {
+	var failing atomic.Bool
+	var hits atomic.Int64
+	failing.Store(true)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		hits.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer upstream.Close()
+
+	svc := NewService()
+	defer svc.Close()
+	if err := svc.AddCapability(CapabilityUpsertRequest{
+		Descriptor:     testDescriptor("acme.models.flaky"),
+		Provider:       &ProviderConfig{Type: ProviderTypeHTTP, HTTP: &HTTPProviderConfig{URL: upstream.URL}},
+		CircuitBreaker: &CircuitBreakerConfig{MinimumRequests: 2, FailureRateThreshold: 0.5, CooldownMS: 100},
+	}); err != nil {
+		t.Fatalf("add capability: %v", err.Message)
+	}
+	invoke := func() *MigError {
+		_, err := svc.Invoke(context.Background(), "acme.models.flaky", InvokeRequest{Header: MessageHeader{TenantID: "acme"}}, "tester", AnonymousPrincipal())
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := invoke(); err == nil || err.Code != ErrorUnavailable {
+			t.Fatalf("expected upstream failure, got %#v", err)
+		}
+	}
+	err := invoke()
+	if err == nil || err.Code != ErrorUnavailable || !err.Retryable {
+		t.Fatalf("expected fast-fail, got %#v", err)
+	}
+	if _, ok := err.Details["retry_after_ms"]; !ok {
+		t.Fatalf("expected retry_after_ms in details: %#v", err.Details)
+	}
+	if hits.Load() != 2 {
+		t.Fatalf("open breaker should not reach upstream, got %d hits", hits.Load())
+	}
+	if state := svc.CircuitBreakers()["acme.models.flaky@1.0.0"][0].State; state != BreakerOpen {
+		t.Fatalf("expected open breaker, got %s", state)
+	}
+
+	failing.Store(false)
+	time.Sleep(120 * time.Millisecond)
+	if err := invoke(); err != nil {
+		t.Fatalf("expected half-open probe to succeed: %#v", err)
+	}
+	if state := svc.CircuitBreakers()["acme.models.flaky@1.0.0"][0].State; state != BreakerClosed {
+		t.Fatalf("expected breaker to close after successful probe, got %s", state)
+	}
+}
+
+func TestCircuitBreakerIgnoresClientErrors(t *testing.T) {
+	svc := NewService()
+	b := svc.newCircuitBreaker("acme.models.strict", defaultBreakerEndpoint, CircuitBreakerConfig{
+		FailureRateThreshold: 0.5, MinimumRequests: 1, WindowMS: 1000, CooldownMS: 1000, HalfOpenRequests: 1,
+	})
+	for i := 0; i < 5; i++ {
+		if err := b.allow(); err != nil {
+			t.Fatalf("breaker should stay closed: %#v", err)
+		}
+		b.record(context.Background(), &MigError{Code: ErrorInvalidRequest})
+	}
+	if st := b.status(); st.State != BreakerClosed || st.Failures != 0 {
+		t.Fatalf("client errors should not count as failures: %#v", st)
+	}
+}
+
+func TestPoolCircuitBreakerSkipsOpenEndpoint(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+	up := poolBackend(t, "up", nil)
+
+	svc := NewService()
+	defer svc.Close()
+	if err := svc.AddCapability(CapabilityUpsertRequest{
+		Descriptor: testDescriptor("acme.pool.breaker"),
+		Provider: &ProviderConfig{Type: ProviderTypePool, Pool: &PoolProviderConfig{Endpoints: []PoolEndpointConfig{
+			{Name: "down", ProviderConfig: ProviderConfig{Type: ProviderTypeHTTP, HTTP: &HTTPProviderConfig{URL: down.URL}}},
+			{Name: "up", ProviderConfig: ProviderConfig{Type: ProviderTypeHTTP, HTTP: &HTTPProviderConfig{URL: up.URL}}},
+		}}},
+		CircuitBreaker: &CircuitBreakerConfig{MinimumRequests: 1, CooldownMS: 60000},
+	}); err != nil {
+		t.Fatalf("add capability: %v", err.Message)
+	}
+
+	// Round-robin reaches "down" within two calls and trips its breaker.
+	for i := 0; i < 2; i++ {
+		_, _ = svc.Invoke(context.Background(), "acme.pool.breaker", InvokeRequest{Header: MessageHeader{TenantID: "acme"}}, "tester", AnonymousPrincipal())
+	}
+	for i := 0; i < 4; i++ {
+		if got := invokeBackend(t, svc, "acme.pool.breaker", MessageHeader{}); got != "up" {
+			t.Fatalf("expected open endpoint to be skipped, got %q", got)
+		}
+	}
+	states := map[string]string{}
+	for _, st := range svc.CircuitBreakers()["acme.pool.breaker@1.0.0"] {
+		states[st.Endpoint] = st.State
+	}
+	if states["down"] != BreakerOpen || states["up"] != BreakerClosed {
+		t.Fatalf("unexpected breaker states: %#v", states)
+	}
+}
@@ -0,0 +1,456 @@
+package mig
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CompositeStepsMetaKey lists the per-step results and timings of a
+	// composite invocation in the response header meta.
+	CompositeStepsMetaKey = "mig.composite_steps"
+	// ParentCapabilityMetaKey names the composite capability that issued a
+	// step invocation.
+	ParentCapabilityMetaKey = "mig.parent_capability"
+
+	CompositeStepSuccess = "success"
+	CompositeStepError   = "error"
+	CompositeStepSkipped = "skipped"
+	// CompositeStepCancelled marks steps cut short by a failing sibling.
+	CompositeStepCancelled = "cancelled"
+
+	maxCompositeDepth = 8
+)
+
+// CompositeProviderConfig defines a capability as a DAG of calls to other
+// capabilities. Steps run as soon as the steps they depend on have succeeded,
+// so independent branches run in parallel. The first failing step cancels
+// the steps still running and fails the composite with its error code.
+type CompositeProviderConfig struct {
+	Steps []CompositeStep `json:"steps"`
+	// Output is a template rendered against {"input": ..., "steps": {...}}.
+	// It defaults to {"steps": {"<id>": <step output>, ...}}.
+	Output map[string]interface{} `json:"output,omitempty"`
+}
+
+// CompositeStep is one capability call in a composite. Input is a template
+// rendered against the composite input and earlier step outputs, as in
+// {"text": "{{input.text}}", "lang": "{{steps.detect.language}}"}; every
+// "steps.<id>" reference adds an implicit dependency. A nil Input forwards
+// the composite input unchanged.
+type CompositeStep struct {
+	ID         string                 `json:"id"`
+	Capability string                 `json:"capability"`
+	DependsOn  []string               `json:"depends_on,omitempty"`
+	Input      map[string]interface{} `json:"input,omitempty"`
+	// TimeoutMS caps the step. Steps never outlive the composite deadline.
+	TimeoutMS int `json:"timeout_ms,omitempty"`
+}
+
+type compositeProvider struct {
+	s          *Service
+	capability string
+	steps      []compositePlanStep
+	output     map[string]interface{}
+}
+
+type compositePlanStep struct {
+	CompositeStep
+	deps []string
+}
+
+type compositeStepState struct {
+	status    string
+	payload   map[string]interface{}
+	version   string
+	servedBy  string
+	started   time.Duration
+	duration  time.Duration
+	errorCode string
+	message   string
+}
+
+func (s *Service) newCompositeProvider(capability string, cfg CompositeProviderConfig) (Provider, *MigError) {
+	id, _ := splitCapabilityRef(capability)
+	if len(cfg.Steps) == 0 {
+		return nil, invalid("provider.composite.steps must not be empty")
+	}
+	index := make(map[string]int, len(cfg.Steps))
+	for i, step := range cfg.Steps {
+		if step.ID == "" || strings.ContainsAny(step.ID, ".[]{}'\" ") {
+			return nil, invalid(fmt.Sprintf("composite step %d needs an id without spaces, quotes, dots, brackets, or braces", i))
+		}
+		if _, dup := index[step.ID]; dup {
+			return nil, invalid("duplicate composite step id " + step.ID)
+		}
+		index[step.ID] = i
+	}
+	plan := make([]compositePlanStep, len(cfg.Steps))
+	for i, step := range cfg.Steps {
+		ref, _ := splitCapabilityRef(step.Capability)
+		if ref == "" {
+			return nil, invalid("composite step " + step.ID + " needs a capability")
+		}
+		if ref == id {
+			return nil, invalid("composite step " + step.ID + " must not call the composite itself")
+		}
+		if step.TimeoutMS < 0 {
+			return nil, invalid("composite step " + step.ID + " timeout_ms must be >= 0")
+		}
+		refs, err := compositeStepRefs(step.Input)
+		if err != nil {
+			return nil, invalid("composite step " + step.ID + " input: " + err.Error())
+		}
+		deps := append([]string{}, step.DependsOn...)
+		for _, dep := range refs {
+			if !slices.Contains(deps, dep) {
+				deps = append(deps, dep)
+			}
+		}
+		for _, dep := range deps {
+			if _, ok := index[dep]; !ok {
+				return nil, invalid("composite step " + step.ID + " depends on unknown step " + dep)
+			}
+			if dep == step.ID {
+				return nil, invalid("composite step " + step.ID + " depends on itself")
+			}
+		}
+		plan[i] = compositePlanStep{CompositeStep: step, deps: deps}
+	}
+	if cycle := compositeCycle(plan, index); cycle != "" {
+		return nil, invalid("composite steps contain a cycle through " + cycle)
+	}
+	refs, err := compositeStepRefs(cfg.Output)
+	if err != nil {
+		return nil, invalid("composite output: " + err.Error())
+	}
+	for _, ref := range refs {
+		if _, ok := index[ref]; !ok {
+			return nil, invalid("composite output references unknown step " + ref)
+		}
+	}
+	return &compositeProvider{s: s, capability: id, steps: plan, output: cfg.Output}, nil
+}
+
+// compositeStepRefs returns the step IDs a template reads through
+// "steps.<id>" references.
+func compositeStepRefs(template map[string]interface{}) ([]string, error) {
+	if template == nil {
+		return nil, nil
+	}
+	if err := checkTemplate(template); err != nil {
+		return nil, err
+	}
+	var out []string
+	var walk func(value interface{})
+	walk = func(value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		case string:
+			refs, _ := templateRefs(v)
+			for _, ref := range refs {
+				path, _ := parsePath(ref)
+				if len(path) >= 2 && path[0].key == "steps" && !path[1].isIndex && !slices.Contains(out, path[1].key) {
+					out = append(out, path[1].key)
+				}
+			}
+		}
+	}
+	walk(template)
+	return out, nil
+}
+
+// compositeCycle returns a step on a dependency cycle, or "" for a DAG.
+func compositeCycle(plan []compositePlanStep, index map[string]int) string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(plan))
+	var visit func(i int) string
+	visit = func(i int) string {
+		switch state[i] {
+		case visiting:
+			return plan[i].ID
+		case visited:
+			return ""
+		}
+		state[i] = visiting
+		for _, dep := range plan[i].deps {
+			if cycle := visit(index[dep]); cycle != "" {
+				return cycle
+			}
+		}
+		state[i] = visited
+		return ""
+	}
+	for i := range plan {
+		if cycle := visit(i); cycle != "" {
+			return cycle
+		}
+	}
+	return ""
+}
+
+// Invoke runs the DAG. Each step is a full Service invocation on behalf of
+// the composite's caller, so scopes, quotas, transforms, fallbacks, usage,
+// and audit apply per step.
+func (p *compositeProvider) Invoke(ctx context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+	inv := invocationFromContext(ctx)
+	if inv == nil {
+		return nil, &MigError{Code: ErrorInternal, Message: "composite capabilities run only through Service.Invoke", Retryable: false}
+	}
+	if inv.depth >= maxCompositeDepth {
+		return nil, invalid(fmt.Sprintf("composite nesting exceeds %d levels", maxCompositeDepth))
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	started := time.Now()
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr *MigError
+		failed   string
+	)
+	states := make(map[string]*compositeStepState, len(p.steps))
+	outputs := make(map[string]interface{}, len(p.steps))
+	done := make(map[string]chan struct{}, len(p.steps))
+	for _, step := range p.steps {
+		states[step.ID] = &compositeStepState{status: CompositeStepSkipped}
+		done[step.ID] = make(chan struct{})
+	}
+	for _, step := range p.steps {
+		wg.Add(1)
+		go func(step compositePlanStep) {
+			defer wg.Done()
+			defer close(done[step.ID])
+			for _, dep := range step.deps {
+				select {
+				case <-done[dep]:
+				case <-runCtx.Done():
+					return
+				}
+			}
+			mu.Lock()
+			for _, dep := range step.deps {
+				if states[dep].status != CompositeStepSuccess {
+					mu.Unlock()
+					return
+				}
+			}
+			doc := map[string]interface{}{"input": req.Payload, "steps": copyOutputs(outputs)}
+			mu.Unlock()
+			if runCtx.Err() != nil {
+				return
+			}
+
+			state := p.runStep(runCtx, inv, req.Header, step, doc, started)
+			mu.Lock()
+			states[step.ID] = state
+			switch {
+			case state.status == CompositeStepSuccess:
+				outputs[step.ID] = state.payload
+			case firstErr != nil:
+				state.status = CompositeStepCancelled
+			default:
+				firstErr = &MigError{Code: state.errorCode, Message: state.message}
+				failed = step.ID
+				cancel()
+			}
+			mu.Unlock()
+		}(step)
+	}
+	wg.Wait()
+
+	report := make([]interface{}, 0, len(p.steps))
+	for _, step := range p.steps {
+		report = append(report, states[step.ID].report(step.CompositeStep))
+	}
+	inv.setMeta(CompositeStepsMetaKey, report)
+	p.auditSteps(inv, req.Header, states)
+
+	if firstErr == nil && ctx.Err() != nil {
+		return nil, &MigError{Code: ErrorTimeout, Message: "deadline exceeded", Retryable: true}
+	}
+	if firstErr != nil {
+		return nil, &MigError{
+			Code:      firstErr.Code,
+			Message:   "composite step " + failed + " failed: " + firstErr.Message,
+			Retryable: firstErr.Code == ErrorTimeout || firstErr.Code == ErrorUnavailable || firstErr.Code == ErrorRateLimited,
+			Details:   map[string]interface{}{"step": failed, "steps": report},
+		}
+	}
+	if p.output == nil {
+		return map[string]interface{}{"steps": outputs}, nil
+	}
+	rendered, err := renderTemplate(p.output, map[string]interface{}{"input": req.Payload, "steps": outputs}, false)
+	if err != nil {
+		return nil, &MigError{Code: ErrorInternal, Message: "composite output failed: " + err.Error(), Retryable: false}
+	}
+	return rendered.(map[string]interface{}), nil
+}
+
+func (p *compositeProvider) InvokeStream(ctx context.Context, req InvokeRequest, emit func(StreamFrame) error) *MigError {
+	return streamUnary(ctx, p.Invoke, req, emit)
+}
+
+// runStep invokes one step with a deadline carved from the time left on the
+// composite's own deadline.
+func (p *compositeProvider) runStep(ctx context.Context, inv *invocation, parent MessageHeader, step compositePlanStep, doc map[string]interface{}, started time.Time) *compositeStepState {
+	state := &compositeStepState{started: time.Since(started)}
+	fail := func(code, message string) *compositeStepState {
+		state.status, state.errorCode, state.message = CompositeStepError, code, message
+		return state
+	}
+	payload := doc["input"].(map[string]interface{})
+	if step.Input != nil {
+		rendered, err := renderTemplate(step.Input, doc, false)
+		if err != nil {
+			return fail(ErrorInvalidRequest, "input mapping failed: "+err.Error())
+		}
+		payload = rendered.(map[string]interface{})
+	}
+	budget := time.Duration(parent.DeadlineMS) * time.Millisecond
+	if deadline, ok := ctx.Deadline(); ok {
+		budget = time.Until(deadline)
+	}
+	if step.TimeoutMS > 0 && time.Duration(step.TimeoutMS)*time.Millisecond < budget {
+		budget = time.Duration(step.TimeoutMS) * time.Millisecond
+	}
+	if budget < time.Millisecond {
+		return fail(ErrorTimeout, "no time left on the composite deadline")
+	}
+	head := MessageHeader{
+		MessageID:   parent.MessageID + "." + step.ID,
+		TenantID:    parent.TenantID,
+		SessionID:   parent.SessionID,
+		Traceparent: parent.Traceparent,
+		DeadlineMS:  int(budget.Milliseconds()),
+		Meta:        map[string]interface{}{ParentCapabilityMetaKey: p.capability},
+	}
+	if parent.IdempotencyKey != "" {
+		head.IdempotencyKey = parent.IdempotencyKey + "." + step.ID
+	}
+	begin := time.Now()
+	resp, migErr := p.s.Invoke(ctx, step.Capability, InvokeRequest{Header: head, Payload: payload}, inv.actor, inv.principal)
+	state.duration = time.Since(begin)
+	if migErr != nil {
+		return fail(migErr.Code, migErr.Message)
+	}
+	state.status = CompositeStepSuccess
+	state.payload = resp.Payload
+	state.servedBy = resp.Capability
+	state.version, _ = resp.Header.Meta[CapabilityVersionMetaKey].(string)
+	return state
+}
+
+func (st *compositeStepState) report(step CompositeStep) map[string]interface{} {
+	out := map[string]interface{}{
+		"id":         step.ID,
+		"capability": step.Capability,
+		"status":     st.status,
+	}
+	if st.status == CompositeStepSkipped {
+		return out
+	}
+	out["started_ms"] = durationMS(st.started)
+	out["duration_ms"] = durationMS(st.duration)
+	if st.servedBy != "" {
+		out["served_by"] = st.servedBy
+	}
+	if st.version != "" {
+		out["version"] = st.version
+	}
+	if st.errorCode != "" {
+		out["error_code"] = st.errorCode
+	}
+	return out
+}
+
+// auditSteps records failed and skipped steps. Successful steps are audited
+// by their own invocations with the composite as parent.
+func (p *compositeProvider) auditSteps(inv *invocation, parent MessageHeader, states map[string]*compositeStepState) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+	for _, step := range p.steps {
+		state := states[step.ID]
+		if state.status == CompositeStepSuccess {
+			continue
+		}
+		record := AuditRecord{
+			Actor:      inv.actor,
+			TenantID:   parent.TenantID,
+			Capability: step.Capability,
+			Outcome:    "composite_step_" + state.status,
+			Timestamp:  now,
+			MessageID:  parent.MessageID + "." + step.ID,
+			Parent:     p.capability,
+			ErrorCode:  state.errorCode,
+		}
+		if state.status != CompositeStepSkipped {
+			record.DurationMS = durationMS(state.duration)
+		}
+		p.s.audit = append(p.s.audit, record)
+		p.s.writeAuditLogLocked(record)
+	}
+}
+
+func copyOutputs(outputs map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(outputs))
+	for k, v := range outputs {
+		out[k] = v
+	}
+	return out
+}
+
+// invocation carries the caller of an in-flight Service invocation to its
+// provider, and collects header meta the provider adds to the response.
+type invocation struct {
+	actor     string
+	principal Principal
+	depth     int
+	// shadow marks a mirrored call. It and the calls it makes are kept off
+	// quotas, usage, and the audit log, and are not mirrored again.
+	shadow bool
+
+	mu   sync.Mutex
+	meta map[string]interface{}
+}
+
+type invocationKey struct{}
+
+func invocationFromContext(ctx context.Context) *invocation {
+	inv, _ := ctx.Value(invocationKey{}).(*invocation)
+	return inv
+}
+
+func (inv *invocation) setMeta(key string, value interface{}) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if inv.meta == nil {
+		inv.meta = map[string]interface{}{}
+	}
+	inv.meta[key] = value
+}
+
+func (inv *invocation) copyMeta(dst map[string]interface{}) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	for k, v := range inv.meta {
+		dst[k] = v
+	}
+}
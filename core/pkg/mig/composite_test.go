@@ -0,0 +1,202 @@
+package mig
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func addComposite(t *testing.T, svc *Service, id string, cfg CompositeProviderConfig) *MigError {
+	t.Helper()
+	return svc.AddCapability(CapabilityUpsertRequest{
+		Descriptor: testDescriptor(id),
+		Provider:   &ProviderConfig{Type: ProviderTypeComposite, Composite: &cfg},
+	})
+}
+
+func TestCompositeRunsStepsAsDAG(t *testing.T) {
+	svc := NewService()
+	for _, id := range []string{"acme.text.detect", "acme.text.translate", "acme.text.summarize"} {
+		if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: testDescriptor(id)}); err != nil {
+			t.Fatalf("add %s: %v", id, err.Message)
+		}
+	}
+	_ = svc.BindProvider("acme.text.detect", ProviderFunc(func(context.Context, InvokeRequest) (map[string]interface{}, *MigError) {
+		return map[string]interface{}{"language": "fr"}, nil
+	}))
+	// translate and summarize only return once both have started, so the
+	// composite must run them in parallel.
+	var barrier sync.WaitGroup
+	barrier.Add(2)
+	var translateDeadline int
+	_ = svc.BindProvider("acme.text.translate", ProviderFunc(func(_ context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+		translateDeadline = req.Header.DeadlineMS
+		barrier.Done()
+		barrier.Wait()
+		return map[string]interface{}{"text": "hello from " + req.Payload["from"].(string)}, nil
+	}))
+	_ = svc.BindProvider("acme.text.summarize", ProviderFunc(func(_ context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+		barrier.Done()
+		barrier.Wait()
+		return map[string]interface{}{"summary": strings.ToUpper(req.Payload["text"].(string))}, nil
+	}))
+	err := addComposite(t, svc, "acme.text.pipeline", CompositeProviderConfig{
+		Steps: []CompositeStep{
+			{ID: "detect", Capability: "acme.text.detect"},
+			{ID: "translate", Capability: "acme.text.translate", TimeoutMS: 500, Input: map[string]interface{}{
+				"text": "{{input.text}}", "from": "{{steps.detect.language}}",
+			}},
+			{ID: "summarize", Capability: "acme.text.summarize", DependsOn: []string{"detect"}, Input: map[string]interface{}{
+				"text": "{{input.text}}",
+			}},
+		},
+		Output: map[string]interface{}{
+			"translation": "{{steps.translate.text}}",
+			"summary":     "{{steps.summarize.summary}}",
+		},
+	})
+	if err != nil {
+		t.Fatalf("add composite: %v", err.Message)
+	}
+
+	discovered, err := svc.Discover(DiscoverRequest{Header: MessageHeader{TenantID: "acme"}}, AnonymousPrincipal())
+	if err != nil {
+		t.Fatalf("discover: %v", err.Message)
+	}
+	found := false
+	for _, desc := range discovered.Capabilities {
+		found = found || desc.ID == "acme.text.pipeline"
+	}
+	if !found {
+		t.Fatal("composite should be discoverable")
+	}
+
+	resp, err := svc.Invoke(context.Background(), "acme.text.pipeline", InvokeRequest{
+		Header:  MessageHeader{TenantID: "acme", DeadlineMS: 2000},
+		Payload: map[string]interface{}{"text": "bonjour"},
+	}, "tester", AnonymousPrincipal())
+	if err != nil {
+		t.Fatalf("invoke: %v", err.Message)
+	}
+	if resp.Payload["translation"] != "hello from fr" || resp.Payload["summary"] != "BONJOUR" {
+		t.Fatalf("unexpected payload: %#v", resp.Payload)
+	}
+	if translateDeadline <= 0 || translateDeadline > 500 {
+		t.Fatalf("step deadline should be capped at 500ms, got %d", translateDeadline)
+	}
+	steps, _ := resp.Header.Meta[CompositeStepsMetaKey].([]interface{})
+	if len(steps) != 3 {
+		t.Fatalf("expected three step reports, got %#v", resp.Header.Meta[CompositeStepsMetaKey])
+	}
+	for _, raw := range steps {
+		step := raw.(map[string]interface{})
+		if step["status"] != CompositeStepSuccess || step["version"] != "1.0.0" {
+			t.Fatalf("unexpected step report: %#v", step)
+		}
+		if _, ok := step["duration_ms"].(float64); !ok {
+			t.Fatalf("step report needs a duration: %#v", step)
+		}
+	}
+
+	parents := 0
+	for _, record := range svc.AuditExport("acme") {
+		if record.Parent == "acme.text.pipeline" && record.Outcome == "success" {
+			parents++
+			if !strings.HasPrefix(record.MessageID, resp.Header.MessageID+".") {
+				t.Fatalf("step message ID should derive from the composite: %#v", record)
+			}
+		}
+	}
+	if parents != 3 {
+		t.Fatalf("expected three step audit records, got %d", parents)
+	}
+}
+
+func TestCompositeFailureCancelsRunningSteps(t *testing.T) {
+	svc := NewService()
+	for _, id := range []string{"acme.ops.broken", "acme.ops.slow", "acme.ops.after"} {
+		if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: testDescriptor(id)}); err != nil {
+			t.Fatalf("add %s: %v", id, err.Message)
+		}
+	}
+	slowStarted, slowCancelled := make(chan struct{}), make(chan struct{})
+	_ = svc.BindProvider("acme.ops.broken", ProviderFunc(func(context.Context, InvokeRequest) (map[string]interface{}, *MigError) {
+		<-slowStarted
+		return nil, &MigError{Code: ErrorUnavailable, Message: "down", Retryable: true}
+	}))
+	_ = svc.BindProvider("acme.ops.slow", ProviderFunc(func(ctx context.Context, _ InvokeRequest) (map[string]interface{}, *MigError) {
+		close(slowStarted)
+		<-ctx.Done()
+		close(slowCancelled)
+		return nil, &MigError{Code: ErrorTimeout, Message: "cancelled", Retryable: true}
+	}))
+	afterCalled := false
+	_ = svc.BindProvider("acme.ops.after", ProviderFunc(func(context.Context, InvokeRequest) (map[string]interface{}, *MigError) {
+		afterCalled = true
+		return map[string]interface{}{}, nil
+	}))
+	err := addComposite(t, svc, "acme.ops.flow", CompositeProviderConfig{Steps: []CompositeStep{
+		{ID: "broken", Capability: "acme.ops.broken"},
+		{ID: "slow", Capability: "acme.ops.slow"},
+		{ID: "after", Capability: "acme.ops.after", DependsOn: []string{"broken"}},
+	}})
+	if err != nil {
+		t.Fatalf("add composite: %v", err.Message)
+	}
+
+	_, err = svc.Invoke(context.Background(), "acme.ops.flow", InvokeRequest{
+		Header:  MessageHeader{TenantID: "acme", DeadlineMS: 5000},
+		Payload: map[string]interface{}{},
+	}, "tester", AnonymousPrincipal())
+	if err == nil || err.Code != ErrorUnavailable || err.Details["step"] != "broken" {
+		t.Fatalf("expected the broken step's error, got %#v", err)
+	}
+	select {
+	case <-slowCancelled:
+	case <-time.After(time.Second):
+		t.Fatal("running sibling step was not cancelled")
+	}
+	if afterCalled {
+		t.Fatal("dependent step should be skipped")
+	}
+	statuses := map[string]interface{}{}
+	for _, raw := range err.Details["steps"].([]interface{}) {
+		step := raw.(map[string]interface{})
+		statuses[step["id"].(string)] = step["status"]
+	}
+	if statuses["broken"] != CompositeStepError || statuses["slow"] != CompositeStepCancelled || statuses["after"] != CompositeStepSkipped {
+		t.Fatalf("unexpected step statuses: %#v", statuses)
+	}
+	outcomes := map[string]string{}
+	for _, record := range svc.AuditExport("acme") {
+		if record.Parent == "acme.ops.flow" {
+			outcomes[record.Capability] = record.Outcome
+		}
+	}
+	if outcomes["acme.ops.broken"] != "composite_step_error" || outcomes["acme.ops.after"] != "composite_step_skipped" {
+		t.Fatalf("unexpected audit trail: %#v", outcomes)
+	}
+}
+
+func TestCompositeRejectsInvalidGraphs(t *testing.T) {
+	svc := NewService()
+	cases := map[string]CompositeProviderConfig{
+		"cycle": {Steps: []CompositeStep{
+			{ID: "a", Capability: "acme.x", DependsOn: []string{"b"}},
+			{ID: "b", Capability: "acme.y", Input: map[string]interface{}{"v": "{{steps.a.v}}"}},
+		}},
+		"unknown step": {Steps: []CompositeStep{
+			{ID: "a", Capability: "acme.x", Input: map[string]interface{}{"v": "{{steps.missing.v}}"}},
+		}},
+		"self call": {Steps: []CompositeStep{{ID: "a", Capability: "acme.graph@^1"}}},
+		"duplicate": {Steps: []CompositeStep{{ID: "a", Capability: "acme.x"}, {ID: "a", Capability: "acme.y"}}},
+		"empty":     {},
+	}
+	for name, cfg := range cases {
+		if err := addComposite(t, svc, "acme.graph", cfg); err == nil || err.Code != ErrorInvalidRequest {
+			t.Fatalf("%s: expected invalid request, got %#v", name, err)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -14,7 +15,14 @@ type Config struct {
 	NATSURL           string
 	EnableNATSBinding bool
 	AuditLogPath      string
+	ShadowLogPath     string
 	EnableMetrics     bool
+	JobRetention      time.Duration
+	MaxJobsPerTenant  int
+	WebhookSecret     string
+	WebhookHosts      []string
+	MessageTTL        time.Duration
+	DemoEcho          bool
 }
 
 func ConfigFromEnv() (Config, error) {
@@ -24,7 +32,34 @@ func ConfigFromEnv() (Config, error) {
 		NATSURL:           strings.TrimSpace(os.Getenv("MIGD_NATS_URL")),
 		EnableNATSBinding: envBool("MIGD_ENABLE_NATS_BINDING", true),
 		AuditLogPath:      strings.TrimSpace(os.Getenv("MIGD_AUDIT_LOG_PATH")),
+		ShadowLogPath:     strings.TrimSpace(os.Getenv("MIGD_SHADOW_LOG_PATH")),
 		EnableMetrics:     envBool("MIGD_ENABLE_METRICS", true),
+		WebhookSecret:     strings.TrimSpace(os.Getenv("MIGD_WEBHOOK_SECRET")),
+		DemoEcho:          envBool("MIGD_DEMO_ECHO", false),
+	}
+	if raw := strings.TrimSpace(os.Getenv("MIGD_JOB_RETENTION")); raw != "" {
+		retention, err := time.ParseDuration(raw)
+		if err != nil || retention <= 0 {
+			return Config{}, fmt.Errorf("invalid MIGD_JOB_RETENTION %q", raw)
+		}
+		cfg.JobRetention = retention
+	}
+	if raw := strings.TrimSpace(os.Getenv("MIGD_MAX_JOBS_PER_TENANT")); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			return Config{}, fmt.Errorf("invalid MIGD_MAX_JOBS_PER_TENANT %q", raw)
+		}
+		cfg.MaxJobsPerTenant = limit
+	}
+	if raw := strings.TrimSpace(os.Getenv("MIGD_WEBHOOK_ALLOWED_HOSTS")); raw != "" {
+		cfg.WebhookHosts = strings.Split(raw, ",")
+	}
+	if raw := strings.TrimSpace(os.Getenv("MIGD_MESSAGE_TTL")); raw != "" {
+		ttl, err := time.ParseDuration(raw)
+		if err != nil || ttl <= 0 {
+			return Config{}, fmt.Errorf("invalid MIGD_MESSAGE_TTL %q", raw)
+		}
+		cfg.MessageTTL = ttl
 	}
 
 	authMode := strings.ToLower(strings.TrimSpace(envOrDefault("MIGD_AUTH_MODE", string(AuthModeNone))))
@@ -0,0 +1,55 @@
+package mig
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DeadlineHeader carries the absolute deadline of an invocation, as an
+// RFC 3339 timestamp, on requests to HTTP providers.
+const DeadlineHeader = "X-MIG-Deadline"
+
+// callDeadline returns when a call must finish: DeadlineMS after now, or
+// sooner when ctx already carries an earlier deadline, such as a gRPC
+// grpc-timeout or the remaining budget of an enclosing invocation.
+func callDeadline(ctx context.Context, head MessageHeader, now time.Time) time.Time {
+	deadlineAt := now.Add(time.Duration(head.DeadlineMS) * time.Millisecond)
+	if parent, ok := ctx.Deadline(); ok && parent.Before(deadlineAt) {
+		return parent
+	}
+	return deadlineAt
+}
+
+// checkBudget rejects a call up front when the time left before deadlineAt is
+// gone or smaller than the minimum latency the capability declares.
+func checkBudget(capDesc CapabilityDescriptor, deadlineAt, now time.Time) *MigError {
+	remaining := deadlineAt.Sub(now)
+	if remaining < time.Millisecond {
+		return &MigError{Code: ErrorTimeout, Message: "no time left on the call deadline", Retryable: true}
+	}
+	minLatency := time.Duration(capDesc.QoS.MinLatencyMS) * time.Millisecond
+	if remaining < minLatency {
+		return &MigError{
+			Code:      ErrorTimeout,
+			Message:   fmt.Sprintf("deadline budget of %dms is below the %dms minimum latency of %s", remaining.Milliseconds(), capDesc.QoS.MinLatencyMS, capDesc.ID),
+			Retryable: false,
+			Details: map[string]interface{}{
+				"remaining_ms":   remaining.Milliseconds(),
+				"min_latency_ms": capDesc.QoS.MinLatencyMS,
+			},
+		}
+	}
+	return nil
+}
+
+// remainingMS is the budget left on ctx in whole milliseconds, for the
+// DeadlineMS of a request handed to a provider. It never drops below 1, since
+// a zero DeadlineMS would be normalized back to the default.
+func remainingMS(ctx context.Context, fallback int) int {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return fallback
+	}
+	return max(int(time.Until(deadline).Milliseconds()), 1)
+}
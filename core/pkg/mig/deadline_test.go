@@ -0,0 +1,132 @@
+package mig
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInvokeHonoursCallerDeadline(t *testing.T) {
+	svc := NewService()
+	var seen InvokeRequest
+	var remaining time.Duration
+	addRetryCapability(t, svc, testDescriptor("acme.tools.budget"), RetryPolicyConfig{MaxAttempts: 1}, ProviderFunc(func(ctx context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+		seen = req
+		deadline, _ := ctx.Deadline()
+		remaining = time.Until(deadline)
+		return map[string]interface{}{}, nil
+	}))
+
+	// A gRPC grpc-timeout or an enclosing call's budget arrives as a context
+	// deadline that is tighter than the header's.
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	resp, err := svc.Invoke(ctx, "acme.tools.budget", InvokeRequest{Header: MessageHeader{TenantID: "acme", DeadlineMS: 30000}}, "tester", AnonymousPrincipal())
+	if err != nil {
+		t.Fatalf("invoke: %v", err.Message)
+	}
+	if seen.Header.DeadlineMS <= 0 || seen.Header.DeadlineMS > 300 || remaining > 300*time.Millisecond {
+		t.Fatalf("provider should see the caller's budget, got DeadlineMS=%d remaining=%s", seen.Header.DeadlineMS, remaining)
+	}
+	if resp.Header.DeadlineMS > 300 {
+		t.Fatalf("response should report the effective deadline, got %d", resp.Header.DeadlineMS)
+	}
+}
+
+func TestRetriesSubtractSpentBudget(t *testing.T) {
+	svc := NewService()
+	desc := testDescriptor("acme.tools.flaky")
+	desc.Idempotent = true
+	var budgets []int
+	addRetryCapability(t, svc, desc, RetryPolicyConfig{MaxAttempts: 3, InitialBackoffMS: 50}, ProviderFunc(func(_ context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+		budgets = append(budgets, req.Header.DeadlineMS)
+		if len(budgets) < 3 {
+			return nil, &MigError{Code: ErrorUnavailable, Message: "down", Retryable: true}
+		}
+		return map[string]interface{}{}, nil
+	}))
+
+	if _, err := svc.Invoke(context.Background(), desc.ID, InvokeRequest{Header: MessageHeader{TenantID: "acme", DeadlineMS: 2000}}, "tester", AnonymousPrincipal()); err != nil {
+		t.Fatalf("invoke: %v", err.Message)
+	}
+	if len(budgets) != 3 || budgets[0] > 2000 || budgets[1] > budgets[0]-40 || budgets[2] > budgets[1]-40 {
+		t.Fatalf("each attempt should get what is left of the budget, got %v", budgets)
+	}
+}
+
+func TestHTTPProviderSendsAbsoluteDeadline(t *testing.T) {
+	var mu sync.Mutex
+	var header string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		header = r.Header.Get(DeadlineHeader)
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer upstream.Close()
+
+	svc := NewService()
+	if err := svc.AddCapability(CapabilityUpsertRequest{
+		Descriptor: testDescriptor("acme.models.remote"),
+		Provider:   &ProviderConfig{Type: ProviderTypeHTTP, HTTP: &HTTPProviderConfig{URL: upstream.URL}},
+	}); err != nil {
+		t.Fatalf("add capability: %v", err.Message)
+	}
+	sent := time.Now()
+	if _, err := svc.Invoke(context.Background(), "acme.models.remote", InvokeRequest{Header: MessageHeader{TenantID: "acme", DeadlineMS: 1500}}, "tester", AnonymousPrincipal()); err != nil {
+		t.Fatalf("invoke: %v", err.Message)
+	}
+	returned := time.Now()
+	mu.Lock()
+	defer mu.Unlock()
+	deadline, err := time.Parse(time.RFC3339Nano, header)
+	if err != nil {
+		t.Fatalf("expected an RFC 3339 %s header, got %q", DeadlineHeader, header)
+	}
+	if deadline.Before(sent.Add(1500*time.Millisecond)) || deadline.After(returned.Add(1500*time.Millisecond)) {
+		t.Fatalf("deadline %s does not match a 1500ms budget from %s", deadline, sent)
+	}
+}
+
+func TestInvokeRejectsBudgetBelowMinLatency(t *testing.T) {
+	svc := NewService()
+	desc := testDescriptor("acme.models.heavy")
+	desc.Modes = []string{ModeUnary, ModeServerStream}
+	desc.QoS.MinLatencyMS = 500
+	calls := 0
+	if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: desc}); err != nil {
+		t.Fatalf("add capability: %v", err.Message)
+	}
+	_ = svc.BindProvider(desc.ID, ProviderFunc(func(context.Context, InvokeRequest) (map[string]interface{}, *MigError) {
+		calls++
+		return map[string]interface{}{}, nil
+	}))
+
+	_, err := svc.Invoke(context.Background(), desc.ID, InvokeRequest{Header: MessageHeader{TenantID: "acme", DeadlineMS: 100}}, "tester", AnonymousPrincipal())
+	if err == nil || err.Code != ErrorTimeout || err.Retryable {
+		t.Fatalf("expected a non-retryable MIG_TIMEOUT, got %#v", err)
+	}
+	if err.Details["min_latency_ms"] != 500 {
+		t.Fatalf("expected the minimum latency in details, got %#v", err.Details)
+	}
+	streamErr := svc.InvokeStream(context.Background(), desc.ID, InvokeRequest{Header: MessageHeader{TenantID: "acme", DeadlineMS: 100}}, "tester", AnonymousPrincipal(), func(StreamFrame) error { return nil })
+	if streamErr == nil || streamErr.Code != ErrorTimeout {
+		t.Fatalf("expected streams to be rejected too, got %#v", streamErr)
+	}
+	if calls != 0 {
+		t.Fatalf("provider must not be called, got %d calls", calls)
+	}
+
+	if _, err := svc.Invoke(context.Background(), desc.ID, InvokeRequest{Header: MessageHeader{TenantID: "acme", DeadlineMS: 2000}}, "tester", AnonymousPrincipal()); err != nil {
+		t.Fatalf("invoke with enough budget: %v", err.Message)
+	}
+
+	desc.ID = "acme.models.negative"
+	desc.QoS.MinLatencyMS = -1
+	if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: desc}); err == nil || err.Code != ErrorInvalidRequest {
+		t.Fatalf("expected negative min_latency_ms to be rejected, got %#v", err)
+	}
+}
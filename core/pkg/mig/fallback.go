@@ -0,0 +1,141 @@
+package mig
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	// ServedByMetaKey names the capability that served a call after a
+	// fallback; FallbackFromMetaKey names the capability that was asked for.
+	ServedByMetaKey     = "mig.served_by"
+	FallbackFromMetaKey = "mig.fallback_from"
+	// FallbackChainMetaKey lists the capabilities that failed before the one
+	// that served the call, with their error codes.
+	FallbackChainMetaKey = "mig.fallback_chain"
+)
+
+var defaultFallbackOn = []string{ErrorUnavailable, ErrorRateLimited, ErrorTimeout}
+
+// FallbackPolicy lists capabilities to try, in order, when an invocation
+// fails with one of the On error codes. Entries may carry a version range
+// ("id@^1"). Fallback capabilities' own fallback lists are not followed.
+type FallbackPolicy struct {
+	Capabilities []string `json:"capabilities"`
+	// On defaults to MIG_UNAVAILABLE, MIG_RATE_LIMITED, and MIG_TIMEOUT.
+	On []string `json:"on,omitempty"`
+}
+
+func validateFallback(desc CapabilityDescriptor) *MigError {
+	policy := desc.Fallback
+	if policy == nil {
+		return nil
+	}
+	if len(policy.Capabilities) == 0 {
+		return invalid("fallback.capabilities must not be empty")
+	}
+	for _, ref := range policy.Capabilities {
+		id, _ := splitCapabilityRef(ref)
+		if id == "" {
+			return invalid("fallback.capabilities must not contain empty entries")
+		}
+		if id == desc.ID {
+			return invalid("fallback.capabilities must not reference the capability itself")
+		}
+	}
+	for _, code := range policy.On {
+		if !knownErrorCode(code) {
+			return invalid(fmt.Sprintf("fallback.on contains unknown error code %q", code))
+		}
+	}
+	return nil
+}
+
+func knownErrorCode(code string) bool {
+	switch code {
+	case ErrorInvalidRequest, ErrorUnauthorized, ErrorForbidden, ErrorNotFound, ErrorUnsupportedCapability,
+		ErrorVersionMismatch, ErrorTimeout, ErrorRateLimited, ErrorBackpressure, ErrorUnavailable, ErrorInternal:
+		return true
+	}
+	return false
+}
+
+// triggers reports whether an error code moves the call to the next fallback.
+func (p *FallbackPolicy) triggers(code string) bool {
+	if p == nil || len(p.Capabilities) == 0 {
+		return false
+	}
+	if len(p.On) == 0 {
+		return slices.Contains(defaultFallbackOn, code)
+	}
+	return slices.Contains(p.On, code)
+}
+
+// invokeFallback walks the primary's fallback list within the time left of
+// the original deadline. Each fallback runs through the normal invoke path,
+// so scopes, transforms, quotas, usage, and audit apply to the capability
+// that actually ran. The primary failure is audited with outcome fallback.
+func (s *Service) invokeFallback(ctx context.Context, primary CapabilityDescriptor, primaryKey string, head MessageHeader, payload map[string]interface{}, primaryErr *MigError, deadlineAt time.Time, actor string, principal Principal) (InvokeResponse, *MigError) {
+	s.auditFallback(actor, head, primary, primaryErr)
+	chain := []interface{}{map[string]interface{}{"capability": primary.ID, "error_code": primaryErr.Code}}
+	lastErr := primaryErr
+	for _, ref := range primary.Fallback.Capabilities {
+		remaining := time.Until(deadlineAt)
+		if remaining < time.Millisecond {
+			break
+		}
+		fbHead := head
+		fbHead.Meta = make(map[string]interface{}, len(head.Meta))
+		for k, v := range head.Meta {
+			switch k {
+			case CapabilityVersionMetaKey, CanaryMetaKey:
+				continue
+			}
+			fbHead.Meta[k] = v
+		}
+		fbHead.DeadlineMS = int(remaining.Milliseconds())
+
+		resp, migErr := s.invoke(ctx, ref, InvokeRequest{Header: fbHead, Payload: payload}, actor, principal, false)
+		if migErr == nil {
+			resp.Header.Meta[ServedByMetaKey] = resp.Capability
+			resp.Header.Meta[FallbackFromMetaKey] = primary.ID
+			resp.Header.Meta[FallbackChainMetaKey] = chain
+			if head.IdempotencyKey != "" {
+				s.mu.Lock()
+				s.rememberIdempotentLocked(fmt.Sprintf("%s:%s:%s", head.TenantID, primaryKey, head.IdempotencyKey), resp, time.Now())
+				s.mu.Unlock()
+			}
+			return resp, nil
+		}
+		chain = append(chain, map[string]interface{}{"capability": ref, "error_code": migErr.Code})
+		lastErr = migErr
+		if !primary.Fallback.triggers(migErr.Code) {
+			break
+		}
+	}
+	out := *lastErr
+	out.Details = make(map[string]interface{}, len(lastErr.Details)+1)
+	for k, v := range lastErr.Details {
+		out.Details[k] = v
+	}
+	out.Details["fallback_chain"] = chain
+	return InvokeResponse{}, &out
+}
+
+func (s *Service) auditFallback(actor string, head MessageHeader, primary CapabilityDescriptor, migErr *MigError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.audit = append(s.audit, AuditRecord{
+		Actor:      actor,
+		TenantID:   head.TenantID,
+		Capability: primary.ID,
+		Version:    primary.Version,
+		Outcome:    "fallback",
+		Timestamp:  time.Now().UTC().Format(time.RFC3339),
+		MessageID:  head.MessageID,
+		ErrorCode:  migErr.Code,
+	})
+	s.writeAuditLogLocked(s.audit[len(s.audit)-1])
+}
@@ -0,0 +1,125 @@
+package mig
+
+import (
+	"context"
+	"testing"
+)
+
+func TestInvokeFallsBackInOrder(t *testing.T) {
+	svc := NewService()
+	primary := testDescriptor("acme.models.large")
+	primary.Fallback = &FallbackPolicy{Capabilities: []string{"acme.models.medium", "acme.models.small@^1"}}
+	for _, desc := range []CapabilityDescriptor{primary, testDescriptor("acme.models.medium"), testDescriptor("acme.models.small")} {
+		if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: desc}); err != nil {
+			t.Fatalf("add %s: %v", desc.ID, err.Message)
+		}
+	}
+	failWith := func(code string) Provider {
+		return ProviderFunc(func(context.Context, InvokeRequest) (map[string]interface{}, *MigError) {
+			return nil, &MigError{Code: code, Message: "down", Retryable: true}
+		})
+	}
+	_ = svc.BindProvider("acme.models.large", failWith(ErrorUnavailable))
+	_ = svc.BindProvider("acme.models.medium", failWith(ErrorRateLimited))
+	_ = svc.BindProvider("acme.models.small", ProviderFunc(func(_ context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+		return map[string]interface{}{"model": "small", "input": req.Payload["input"]}, nil
+	}))
+	if _, err := svc.SetQuota(QuotaRequest{TenantID: "acme", MaxInvocations: 10}); err != nil {
+		t.Fatalf("set quota: %v", err.Message)
+	}
+
+	resp, err := svc.Invoke(context.Background(), "acme.models.large", InvokeRequest{
+		Header:  MessageHeader{TenantID: "acme", IdempotencyKey: "fb-1"},
+		Payload: map[string]interface{}{"input": "hi"},
+	}, "tester", AnonymousPrincipal())
+	if err != nil {
+		t.Fatalf("invoke: %v", err.Message)
+	}
+	if resp.Capability != "acme.models.small" || resp.Payload["model"] != "small" || resp.Payload["input"] != "hi" {
+		t.Fatalf("unexpected response: %#v", resp)
+	}
+	if resp.Header.Meta[ServedByMetaKey] != "acme.models.small" || resp.Header.Meta[FallbackFromMetaKey] != "acme.models.large" {
+		t.Fatalf("unexpected fallback meta: %#v", resp.Header.Meta)
+	}
+	if chain, _ := resp.Header.Meta[FallbackChainMetaKey].([]interface{}); len(chain) != 2 {
+		t.Fatalf("expected two failed hops, got %#v", resp.Header.Meta[FallbackChainMetaKey])
+	}
+
+	usage := svc.Usage()
+	if usage.TenantInvocations["acme"] != 1 || usage.CapabilityInvocations["acme.models.small"] != 1 || usage.CapabilityInvocations["acme.models.large"] != 0 {
+		t.Fatalf("usage must be charged to the serving capability: %#v", usage)
+	}
+	outcomes := map[string]string{}
+	for _, record := range svc.AuditExport("acme") {
+		outcomes[record.Capability] = record.Outcome
+	}
+	if outcomes["acme.models.large"] != "fallback" || outcomes["acme.models.small"] != "success" {
+		t.Fatalf("unexpected audit trail: %#v", outcomes)
+	}
+
+	// The idempotency key replays the fallback result without another hop.
+	replay, err := svc.Invoke(context.Background(), "acme.models.large", InvokeRequest{
+		Header:  MessageHeader{TenantID: "acme", IdempotencyKey: "fb-1"},
+		Payload: map[string]interface{}{"input": "hi"},
+	}, "tester", AnonymousPrincipal())
+	if err != nil || replay.Capability != "acme.models.small" {
+		t.Fatalf("unexpected replay: %#v %#v", replay, err)
+	}
+	if svc.Usage().TenantInvocations["acme"] != 1 {
+		t.Fatal("replay should not be charged again")
+	}
+}
+
+func TestFallbackStopsOnNonTriggeringError(t *testing.T) {
+	svc := NewService()
+	primary := testDescriptor("acme.models.strict")
+	primary.Fallback = &FallbackPolicy{Capabilities: []string{"acme.models.backup"}, On: []string{ErrorTimeout}}
+	for _, desc := range []CapabilityDescriptor{primary, testDescriptor("acme.models.backup")} {
+		if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: desc}); err != nil {
+			t.Fatalf("add %s: %v", desc.ID, err.Message)
+		}
+	}
+	backupCalls := 0
+	primaryCode := ErrorUnavailable
+	_ = svc.BindProvider("acme.models.strict", ProviderFunc(func(context.Context, InvokeRequest) (map[string]interface{}, *MigError) {
+		return nil, &MigError{Code: primaryCode, Message: "down", Retryable: true}
+	}))
+	_ = svc.BindProvider("acme.models.backup", ProviderFunc(func(context.Context, InvokeRequest) (map[string]interface{}, *MigError) {
+		backupCalls++
+		return nil, &MigError{Code: ErrorInternal, Message: "broken"}
+	}))
+	invoke := func() *MigError {
+		_, err := svc.Invoke(context.Background(), "acme.models.strict", InvokeRequest{
+			Header:  MessageHeader{TenantID: "acme"},
+			Payload: map[string]interface{}{},
+		}, "tester", AnonymousPrincipal())
+		return err
+	}
+	if err := invoke(); err == nil || err.Code != ErrorUnavailable || backupCalls != 0 {
+		t.Fatalf("UNAVAILABLE is not in fallback.on, got %#v after %d backup calls", err, backupCalls)
+	}
+
+	primaryCode = ErrorTimeout
+	err := invoke()
+	if err == nil || err.Code != ErrorInternal || backupCalls != 1 {
+		t.Fatalf("expected the backup error, got %#v", err)
+	}
+	if chain, _ := err.Details["fallback_chain"].([]interface{}); len(chain) != 2 {
+		t.Fatalf("expected fallback_chain details, got %#v", err.Details)
+	}
+}
+
+func TestFallbackValidation(t *testing.T) {
+	svc := NewService()
+	for _, policy := range []*FallbackPolicy{
+		{},
+		{Capabilities: []string{"acme.models.self"}},
+		{Capabilities: []string{"acme.models.other"}, On: []string{"MIG_NOPE"}},
+	} {
+		desc := testDescriptor("acme.models.self")
+		desc.Fallback = policy
+		if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: desc}); err == nil || err.Code != ErrorInvalidRequest {
+			t.Fatalf("expected %#v to be rejected, got %#v", policy, err)
+		}
+	}
+}
@@ -160,6 +160,50 @@ func (g *grpcServer) Invoke(ctx context.Context, req *migv01.InvokeRequest) (*mi
 	}, nil
 }
 
+func (g *grpcServer) InvokeBatch(ctx context.Context, req *migv01.InvokeBatchRequest) (*migv01.InvokeBatchResponse, error) {
+	principal := principalFromContext(ctx)
+	in := InvokeBatchRequest{
+		Header:         messageHeaderFromProto(req.GetHeader()),
+		Capability:     req.GetCapability(),
+		MaxConcurrency: int(req.GetMaxConcurrency()),
+	}
+	for _, item := range req.GetItems() {
+		in.Items = append(in.Items, InvokeBatchItem{
+			IdempotencyKey: item.GetIdempotencyKey(),
+			Payload:        structToMap(item.GetPayload()),
+		})
+	}
+	if err := applyPrincipalHeaderFromPrincipal(&in.Header, principal); err != nil {
+		return nil, grpcStatusFromMigError(err)
+	}
+	actor := principal.Subject
+	if actor == "" {
+		actor = "anonymous"
+	}
+	out, migErr := g.svc.InvokeBatch(ctx, in.Capability, in, actor, principal)
+	if migErr != nil {
+		return nil, grpcStatusFromMigError(migErr)
+	}
+	resp := &migv01.InvokeBatchResponse{
+		Header:     messageHeaderToProto(out.Header),
+		Capability: out.Capability,
+		Succeeded:  uint32(out.Succeeded),
+		Failed:     uint32(out.Failed),
+	}
+	for _, result := range out.Results {
+		item := &migv01.InvokeBatchResult{
+			Index:     uint32(result.Index),
+			MessageId: result.MessageID,
+			Error:     migErrorToProto(result.Error),
+		}
+		if result.Error == nil {
+			item.Payload = mapToStruct(result.Payload)
+		}
+		resp.Results = append(resp.Results, item)
+	}
+	return resp, nil
+}
+
 func (g *grpcServer) StreamInvoke(stream grpc.BidiStreamingServer[migv01.StreamFrame, migv01.StreamFrame]) error {
 	principal := principalFromContext(stream.Context())
 	if g.svc.metrics != nil {
@@ -180,24 +224,36 @@ func (g *grpcServer) StreamInvoke(stream grpc.BidiStreamingServer[migv01.StreamF
 	})
 	defer unregisterConn()
 
+	sessions := g.svc.newStreamSessions(func(frame StreamFrame) error {
+		return stream.Send(streamFrameToProto(frame))
+	})
+	defer sessions.wait()
+	defer sessions.closeAll()
+
+	actor := principal.Subject
+	if actor == "" {
+		actor = "anonymous"
+	}
 	for {
 		frame, err := stream.Recv()
 		if err != nil {
 			if err == io.EOF {
+				// The client is done sending; let open sessions finish.
+				sessions.wait()
 				return nil
 			}
 			return err
 		}
 		in := streamFrameFromProto(frame)
 		if migErr := applyPrincipalHeaderFromPrincipal(&in.Header, principal); migErr != nil {
-			if sendErr := stream.Send(streamFrameToProto(StreamFrame{
+			if sendErr := sessions.send(StreamFrame{
 				Header:     in.Header,
 				StreamID:   in.StreamID,
 				Capability: in.Capability,
 				Kind:       "error",
 				EndStream:  true,
 				Error:      migErr,
-			})); sendErr != nil {
+			}); sendErr != nil {
 				return sendErr
 			}
 			continue
@@ -205,31 +261,12 @@ func (g *grpcServer) StreamInvoke(stream grpc.BidiStreamingServer[migv01.StreamF
 
 		switch in.Kind {
 		case "request":
-			actor := principal.Subject
-			if actor == "" {
-				actor = "anonymous"
-			}
-			invokeReq := InvokeRequest{Header: in.Header, Capability: in.Capability, Payload: in.Payload}
-			result, migErr := g.svc.Invoke(stream.Context(), in.Capability, invokeReq, actor, principal)
-			response := StreamFrame{
-				Header:     in.Header,
-				StreamID:   in.StreamID,
-				Capability: in.Capability,
-				Kind:       "response",
-				EndStream:  true,
-			}
-			if migErr != nil {
-				response.Kind = "error"
-				response.Error = migErr
-			} else {
-				response.Payload = result.Payload
-			}
-			if err := stream.Send(streamFrameToProto(response)); err != nil {
+			if err := sessions.request(stream.Context(), in, actor, principal); err != nil {
 				return err
 			}
 		case "control":
 			cancelReq := CancelRequest{Header: in.Header, TargetMessageID: in.Header.MessageID, Reason: "grpc stream control cancel"}
-			ack, migErr := g.svc.Cancel(cancelReq, cancelReq.TargetMessageID)
+			ack, migErr := g.svc.Cancel(cancelReq, cancelReq.TargetMessageID, actor, principal)
 			response := StreamFrame{Header: in.Header, StreamID: in.StreamID, Capability: in.Capability, Kind: "control", EndStream: true}
 			if migErr != nil {
 				response.Kind = "error"
@@ -237,18 +274,18 @@ func (g *grpcServer) StreamInvoke(stream grpc.BidiStreamingServer[migv01.StreamF
 			} else {
 				response.Payload = map[string]interface{}{"accepted": ack.Accepted, "status": ack.Status}
 			}
-			if err := stream.Send(streamFrameToProto(response)); err != nil {
+			if err := sessions.send(response); err != nil {
 				return err
 			}
 		default:
-			if err := stream.Send(streamFrameToProto(StreamFrame{
+			if err := sessions.send(StreamFrame{
 				Header:     in.Header,
 				StreamID:   in.StreamID,
 				Capability: in.Capability,
 				Kind:       "error",
 				EndStream:  true,
 				Error:      &MigError{Code: ErrorInvalidRequest, Message: "frame.kind must be request or control", Retryable: false},
-			})); err != nil {
+			}); err != nil {
 				return err
 			}
 		}
@@ -302,7 +339,7 @@ func (g *grpcServer) Subscribe(req *migv01.SubscribeRequest, stream grpc.ServerS
 		},
 	})
 	defer unregisterConn()
-	replay, updates, unsubscribe, migErr := g.svc.Subscribe(req.GetTopic(), req.GetResumeCursor())
+	replay, updates, unsubscribe, migErr := g.svc.Subscribe(head.TenantID, req.GetTopic(), req.GetResumeCursor())
 	if migErr != nil {
 		return grpcStatusFromMigError(migErr)
 	}
@@ -338,7 +375,11 @@ func (g *grpcServer) Cancel(ctx context.Context, req *migv01.CancelRequest) (*mi
 	if err := applyPrincipalHeaderFromPrincipal(&in.Header, principal); err != nil {
 		return nil, grpcStatusFromMigError(err)
 	}
-	out, migErr := g.svc.Cancel(in, in.TargetMessageID)
+	actor := principal.Subject
+	if actor == "" {
+		actor = "anonymous"
+	}
+	out, migErr := g.svc.Cancel(in, in.TargetMessageID, actor, principal)
 	if migErr != nil {
 		return nil, grpcStatusFromMigError(migErr)
 	}
@@ -509,8 +550,18 @@ func capabilityToProto(capability CapabilityDescriptor) *migv01.CapabilityDescri
 			SupportsReplay:    capability.QoS.SupportsReplay,
 			DeliverySemantics: deliverySemanticsToProto(capability.QoS.DeliverySemantics),
 			SupportsOrdering:  capability.QoS.SupportsOrdering,
+			MinLatencyMs:      uint32(capability.QoS.MinLatencyMS),
 		},
+		Idempotent: capability.Idempotent,
+		Fallback:   fallbackToProto(capability.Fallback),
+	}
+}
+
+func fallbackToProto(policy *FallbackPolicy) *migv01.FallbackPolicy {
+	if policy == nil {
+		return nil
 	}
+	return &migv01.FallbackPolicy{Capabilities: policy.Capabilities, On: policy.On}
 }
 
 func streamPreferenceFromProto(pref migv01.StreamPreference) string {
@@ -14,7 +14,7 @@ import (
 )
 
 func TestGRPCHelloDiscoverInvoke(t *testing.T) {
-	svc := NewService()
+	svc := newDemoService(t)
 	listener := bufconn.Listen(1024 * 1024)
 	server := grpc.NewServer(
 		grpc.UnaryInterceptor(GRPCUnaryAuthInterceptor(AuthConfig{Mode: AuthModeNone})),
@@ -79,7 +79,7 @@ func TestGRPCHelloDiscoverInvoke(t *testing.T) {
 }
 
 func TestGRPCStreamInvoke(t *testing.T) {
-	svc := NewService()
+	svc := newDemoService(t)
 	listener := bufconn.Listen(1024 * 1024)
 	server := grpc.NewServer(
 		grpc.UnaryInterceptor(GRPCUnaryAuthInterceptor(AuthConfig{Mode: AuthModeNone})),
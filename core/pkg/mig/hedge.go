@@ -0,0 +1,196 @@
+package mig
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHedgeDelayMS    = 100
+	defaultHedgeMaxHedges  = 1
+	defaultHedgeMinSamples = 20
+	hedgeLatencyWindow     = 128
+)
+
+// HedgePolicyConfig sends a duplicate of a slow unary invocation to another
+// pool endpoint. The first successful reply wins and the other attempts are
+// cancelled.
+type HedgePolicyConfig struct {
+	// DelayMS is how long the first attempt may run before a hedge is sent.
+	// With Percentile set it is only used until MinSamples latencies exist.
+	DelayMS int `json:"delay_ms,omitempty"`
+	// Percentile in (0, 100) derives the delay from recent successful
+	// latencies, e.g. 95 hedges calls slower than the observed p95.
+	Percentile float64 `json:"percentile,omitempty"`
+	MinSamples int     `json:"min_samples,omitempty"`
+	// MaxHedges caps the extra attempts per invocation.
+	MaxHedges int `json:"max_hedges,omitempty"`
+}
+
+type hedgePolicy struct {
+	cfg HedgePolicyConfig
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	nextSlot  int
+}
+
+func normalizeHedgePolicy(cfg HedgePolicyConfig) (HedgePolicyConfig, *MigError) {
+	if cfg.DelayMS < 0 || cfg.MinSamples < 0 || cfg.MaxHedges < 0 {
+		return cfg, invalid("hedge values must be >= 0")
+	}
+	if cfg.Percentile < 0 || cfg.Percentile >= 100 {
+		return cfg, invalid("hedge.percentile must be between 0 and 100")
+	}
+	if cfg.DelayMS == 0 {
+		cfg.DelayMS = defaultHedgeDelayMS
+	}
+	if cfg.MinSamples == 0 {
+		cfg.MinSamples = defaultHedgeMinSamples
+	}
+	if cfg.MaxHedges == 0 {
+		cfg.MaxHedges = defaultHedgeMaxHedges
+	}
+	return cfg, nil
+}
+
+// delay returns the wait before the next hedge.
+func (h *hedgePolicy) delay() time.Duration {
+	fixed := time.Duration(h.cfg.DelayMS) * time.Millisecond
+	if h.cfg.Percentile == 0 {
+		return fixed
+	}
+	h.mu.Lock()
+	if len(h.latencies) < h.cfg.MinSamples {
+		h.mu.Unlock()
+		return fixed
+	}
+	sorted := append([]time.Duration(nil), h.latencies...)
+	h.mu.Unlock()
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(math.Ceil(h.cfg.Percentile/100*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
+
+func (h *hedgePolicy) observe(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.latencies) < hedgeLatencyWindow {
+		h.latencies = append(h.latencies, latency)
+		return
+	}
+	h.latencies[h.nextSlot] = latency
+	h.nextSlot = (h.nextSlot + 1) % hedgeLatencyWindow
+}
+
+// invokeHedged races the primary attempt against up to MaxHedges delayed
+// attempts on other endpoints. Every attempt runs under a child of ctx so the
+// losers are cancelled as soon as a winner replies.
+func (p *poolProvider) invokeHedged(ctx context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+	type result struct {
+		attempt int
+		payload map[string]interface{}
+		err     *MigError
+	}
+	attemptCtx, cancelAttempts := context.WithCancel(ctx)
+	defer cancelAttempts()
+
+	results := make(chan result, p.hedge.cfg.MaxHedges+1)
+	used := map[*poolEndpoint]bool{}
+	start := time.Now()
+	launch := func(attempt int) *MigError {
+		ep, migErr := p.pick(req, used)
+		if migErr != nil {
+			return migErr
+		}
+		used[ep] = true
+		go func() {
+			var payload map[string]interface{}
+			migErr := p.callEndpoint(attemptCtx, ep, func(ep *poolEndpoint) *MigError {
+				var err *MigError
+				payload, err = ep.provider.Invoke(attemptCtx, req)
+				return err
+			})
+			results <- result{attempt: attempt, payload: payload, err: migErr}
+		}()
+		return nil
+	}
+
+	if migErr := launch(0); migErr != nil {
+		return nil, migErr
+	}
+	outstanding := 1
+	hedges := 0
+	timer := time.NewTimer(p.hedge.delay())
+	defer timer.Stop()
+	var lastErr *MigError
+	for {
+		var hedgeC <-chan time.Time
+		if hedges < p.hedge.cfg.MaxHedges {
+			hedgeC = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			return nil, &MigError{Code: ErrorTimeout, Message: "deadline exceeded", Retryable: true}
+		case <-hedgeC:
+			hedges++
+			if launch(hedges) == nil {
+				outstanding++
+				p.recordHedge()
+			}
+			if hedges < p.hedge.cfg.MaxHedges {
+				timer.Reset(p.hedge.delay())
+			}
+		case out := <-results:
+			outstanding--
+			if out.err == nil {
+				p.hedge.observe(time.Since(start))
+				p.recordHedgeWin(out.attempt)
+				return out.payload, nil
+			}
+			lastErr = out.err
+			if outstanding == 0 {
+				return nil, lastErr
+			}
+		}
+	}
+}
+
+func (p *poolProvider) recordHedge() {
+	if metrics := p.svc.metricsSnapshot(); metrics != nil {
+		metrics.RecordHedge(p.capability)
+	}
+}
+
+// recordHedgeWin counts which attempt replied first; attempt 0 is the primary.
+func (p *poolProvider) recordHedgeWin(attempt int) {
+	metrics := p.svc.metricsSnapshot()
+	if metrics == nil {
+		return
+	}
+	winner := "primary"
+	if attempt > 0 {
+		winner = "hedge"
+	}
+	metrics.RecordHedgeWin(p.capability, winner)
+}
+
+// withHedge enables hedging on a pooled provider.
+func withHedge(provider Provider, cfg HedgePolicyConfig) *MigError {
+	cfg, migErr := normalizeHedgePolicy(cfg)
+	if migErr != nil {
+		return migErr
+	}
+	pool, ok := provider.(*poolProvider)
+	if !ok || len(pool.endpoints) < 2 {
+		return invalid("hedge requires a pool provider with at least two endpoints")
+	}
+	pool.hedge = &hedgePolicy{cfg: cfg}
+	return nil
+}
@@ -0,0 +1,79 @@
+package mig
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedgedInvokeCancelsSlowAttempt(t *testing.T) {
+	var hits, cancelled atomic.Int64
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		// Drain the body so the server notices when the client hangs up.
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+			cancelled.Add(1)
+		case <-time.After(2 * time.Second):
+			_, _ = w.Write([]byte(`{"backend":"slow"}`))
+		}
+	}))
+	defer slow.Close()
+	fast := poolBackend(t, "fast", nil)
+
+	svc := NewService()
+	defer svc.Close()
+	if err := svc.AddCapability(CapabilityUpsertRequest{
+		Descriptor: testDescriptor("acme.models.hedged"),
+		Provider: &ProviderConfig{Type: ProviderTypePool, Pool: &PoolProviderConfig{Endpoints: []PoolEndpointConfig{
+			{Name: "slow", ProviderConfig: ProviderConfig{Type: ProviderTypeHTTP, HTTP: &HTTPProviderConfig{URL: slow.URL}}},
+			{Name: "fast", ProviderConfig: ProviderConfig{Type: ProviderTypeHTTP, HTTP: &HTTPProviderConfig{URL: fast.URL}}},
+		}}},
+		Hedge: &HedgePolicyConfig{DelayMS: 20},
+	}); err != nil {
+		t.Fatalf("add capability: %v", err.Message)
+	}
+
+	for i := 0; i < 4; i++ {
+		start := time.Now()
+		if got := invokeBackend(t, svc, "acme.models.hedged", MessageHeader{}); got != "fast" {
+			t.Fatalf("expected the fast endpoint to win, got %q", got)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("hedge did not cut latency: %s", elapsed)
+		}
+	}
+	if hits.Load() == 0 {
+		t.Fatal("expected some primary attempts to reach the slow endpoint")
+	}
+	waitFor(t, func() bool { return cancelled.Load() == hits.Load() }, "expected losing attempts to be cancelled")
+}
+
+func TestHedgeRequiresPool(t *testing.T) {
+	svc := NewService()
+	err := svc.AddCapability(CapabilityUpsertRequest{
+		Descriptor: testDescriptor("acme.models.single"),
+		Provider:   &ProviderConfig{Type: ProviderTypeEcho},
+		Hedge:      &HedgePolicyConfig{DelayMS: 10},
+	})
+	if err == nil || err.Code != ErrorInvalidRequest {
+		t.Fatalf("expected invalid request, got %#v", err)
+	}
+}
+
+func TestHedgePercentileDelay(t *testing.T) {
+	h := &hedgePolicy{cfg: HedgePolicyConfig{DelayMS: 500, Percentile: 90, MinSamples: 10}}
+	if got := h.delay(); got != 500*time.Millisecond {
+		t.Fatalf("expected fixed delay before enough samples, got %s", got)
+	}
+	for i := 1; i <= 10; i++ {
+		h.observe(time.Duration(i) * 10 * time.Millisecond)
+	}
+	if got := h.delay(); got != 90*time.Millisecond {
+		t.Fatalf("expected p90 delay of 90ms, got %s", got)
+	}
+}
@@ -1,10 +1,10 @@
 package mig
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,14 +15,28 @@ func RegisterHTTPRoutes(mux *http.ServeMux, svc *Service) {
 	mux.HandleFunc("POST /mig/v0.1/hello", svc.handleHello)
 	mux.HandleFunc("POST /mig/v0.1/discover", svc.handleDiscover)
 	mux.HandleFunc("POST /mig/v0.1/invoke/{capability}", svc.handleInvoke)
+	mux.HandleFunc("POST /mig/v0.1/invoke-batch/{capability}", svc.handleInvokeBatch)
 	mux.HandleFunc("POST /mig/v0.1/publish/{topic}", svc.handlePublish)
 	mux.HandleFunc("GET /mig/v0.1/subscribe/{topic}", svc.handleSubscribe)
 	mux.HandleFunc("POST /mig/v0.1/cancel/{message_id}", svc.handleCancel)
+	mux.HandleFunc("GET /mig/v0.1/jobs", svc.handleListJobs)
+	mux.HandleFunc("GET /mig/v0.1/jobs/{id}", svc.handleGetJob)
 	mux.HandleFunc("POST /mig/v0.1/heartbeat", svc.handleHeartbeat)
 	mux.HandleFunc("GET /mig/v0.1/stream", svc.handleStream)
+	mux.HandleFunc("GET /mig/v0.1/providers/connect", svc.handleProviderConnect)
 
 	mux.HandleFunc("POST /admin/v0.1/capabilities", svc.handleAddCapability)
 	mux.HandleFunc("GET /admin/v0.1/capabilities", svc.handleListCapabilities)
+	mux.HandleFunc("POST /admin/v0.1/transforms/dry-run", svc.handleTransformDryRun)
+	mux.HandleFunc("POST /admin/v0.1/canaries", svc.handleSetCanary)
+	mux.HandleFunc("GET /admin/v0.1/canaries", svc.handleListCanaries)
+	mux.HandleFunc("DELETE /admin/v0.1/canaries/{capability}", svc.handleDeleteCanary)
+	mux.HandleFunc("POST /admin/v0.1/shadows", svc.handleSetShadow)
+	mux.HandleFunc("GET /admin/v0.1/shadows", svc.handleListShadows)
+	mux.HandleFunc("GET /admin/v0.1/shadows/comparisons", svc.handleShadowComparisons)
+	mux.HandleFunc("PUT /admin/v0.1/shadows/opt-outs/{tenant_id}", svc.handleShadowOptOut)
+	mux.HandleFunc("DELETE /admin/v0.1/shadows/opt-outs/{tenant_id}", svc.handleShadowOptOut)
+	mux.HandleFunc("DELETE /admin/v0.1/shadows/{capability}", svc.handleDeleteShadow)
 	mux.HandleFunc("POST /admin/v0.1/schemas", svc.handleAddSchema)
 	mux.HandleFunc("GET /admin/v0.1/health/conformance", svc.handleConformanceHealth)
 	mux.HandleFunc("GET /admin/v0.1/connections", svc.handleConnections)
@@ -93,24 +107,114 @@ func (s *Service) handleInvoke(w http.ResponseWriter, r *http.Request) {
 			actor = "anonymous"
 		}
 	}
+	if req.StreamPreference == ModeServerStream {
+		s.serveInvokeSSE(w, r, capability, req, actor, principal)
+		return
+	}
 	resp, err := s.Invoke(r.Context(), capability, req, actor, principal)
 	if err != nil {
-		status := http.StatusBadRequest
-		if err.Code == ErrorUnsupportedCapability {
-			status = http.StatusNotFound
-		} else if err.Code == ErrorTimeout {
-			status = http.StatusGatewayTimeout
-		} else if err.Code == ErrorRateLimited {
-			status = http.StatusTooManyRequests
-		} else if err.Code == ErrorForbidden {
-			status = http.StatusForbidden
+		writeMigError(w, req.Header, invokeErrorStatus(err.Code), *err)
+		return
+	}
+	if _, async := resp.Header.Meta[JobIDMetaKey]; async {
+		writeJSON(w, http.StatusAccepted, resp)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// serveInvokeSSE answers a server_stream INVOKE as server-sent events, one
+// "mig-frame" event per StreamFrame. Failures before the first frame are
+// returned as a normal error response; later ones arrive as an error frame.
+func (s *Service) serveInvokeSSE(w http.ResponseWriter, r *http.Request, capability string, req InvokeRequest, actor string, principal Principal) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	if s.metrics != nil {
+		s.metrics.IncActiveStream("sse_invoke")
+		defer s.metrics.DecActiveStream("sse_invoke")
+	}
+	streamID := "stream-" + req.Header.MessageID
+	started := false
+	send := func(frame StreamFrame) error {
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("Connection", "keep-alive")
+			w.WriteHeader(http.StatusOK)
+			started = true
 		}
-		writeMigError(w, req.Header, status, *err)
+		frame.StreamID = streamID
+		buf, err := json.Marshal(frame)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: mig-frame\ndata: %s\n\n", buf); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+	migErr := s.InvokeStream(r.Context(), capability, req, actor, principal, func(frame StreamFrame) error {
+		streamID = "stream-" + frame.Header.MessageID
+		return send(frame)
+	})
+	if migErr == nil {
+		return
+	}
+	if !started {
+		writeMigError(w, req.Header, invokeErrorStatus(migErr.Code), *migErr)
+		return
+	}
+	_ = send(StreamFrame{Header: req.Header, Capability: capability, Kind: "error", EndStream: true, Error: migErr})
+}
+
+// handleInvokeBatch answers 200 whenever the batch itself is valid; item
+// failures are reported in the per-item results.
+func (s *Service) handleInvokeBatch(w http.ResponseWriter, r *http.Request) {
+	principal := principalFromContext(r.Context())
+	capability := r.PathValue("capability")
+	var req InvokeBatchRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if migErr := applyPrincipalHeader(&req.Header, principal, r); migErr != nil {
+		writeMigError(w, req.Header, http.StatusForbidden, *migErr)
+		return
+	}
+	actor := principal.Subject
+	if actor == "" {
+		actor = r.Header.Get("X-Actor")
+		if actor == "" {
+			actor = "anonymous"
+		}
+	}
+	resp, err := s.InvokeBatch(r.Context(), capability, req, actor, principal)
+	if err != nil {
+		writeMigError(w, req.Header, invokeErrorStatus(err.Code), *err)
 		return
 	}
 	writeJSON(w, http.StatusOK, resp)
 }
 
+func invokeErrorStatus(code string) int {
+	switch code {
+	case ErrorUnsupportedCapability:
+		return http.StatusNotFound
+	case ErrorTimeout:
+		return http.StatusGatewayTimeout
+	case ErrorRateLimited:
+		return http.StatusTooManyRequests
+	case ErrorForbidden:
+		return http.StatusForbidden
+	case ErrorUnavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
+
 func (s *Service) handlePublish(w http.ResponseWriter, r *http.Request) {
 	principal := principalFromContext(r.Context())
 	topic := r.PathValue("topic")
@@ -138,17 +242,17 @@ func (s *Service) handleSubscribe(w http.ResponseWriter, r *http.Request) {
 	principal := principalFromContext(r.Context())
 	topic := r.PathValue("topic")
 	resumeCursor := r.URL.Query().Get("resume_cursor")
-	events, stream, unsubscribe, err := s.Subscribe(topic, resumeCursor)
+	tenantID := tenantFromRequest(r)
+	if principal.TenantID != "" {
+		tenantID = principal.TenantID
+	}
+	events, stream, unsubscribe, err := s.Subscribe(tenantID, topic, resumeCursor)
 	if err != nil {
-		writeMigError(w, MessageHeader{TenantID: tenantFromRequest(r)}, http.StatusBadRequest, *err)
+		writeMigError(w, MessageHeader{TenantID: tenantID}, http.StatusBadRequest, *err)
 		return
 	}
 	defer unsubscribe()
 
-	tenantID := tenantFromRequest(r)
-	if principal.TenantID != "" {
-		tenantID = principal.TenantID
-	}
 	_, unregisterConn := s.RegisterConnection(ConnectionSnapshot{
 		Protocol:   "http",
 		Kind:       "sse_subscribe",
@@ -215,14 +319,61 @@ func (s *Service) handleCancel(w http.ResponseWriter, r *http.Request) {
 		writeMigError(w, req.Header, http.StatusForbidden, *migErr)
 		return
 	}
-	resp, err := s.Cancel(req, messageID)
+	actor := principal.Subject
+	if actor == "" {
+		actor = r.Header.Get("X-Actor")
+		if actor == "" {
+			actor = "anonymous"
+		}
+	}
+	resp, err := s.Cancel(req, messageID, actor, principal)
 	if err != nil {
-		writeMigError(w, req.Header, http.StatusBadRequest, *err)
+		status := http.StatusBadRequest
+		if err.Code == ErrorForbidden {
+			status = http.StatusForbidden
+		}
+		writeMigError(w, req.Header, status, *err)
 		return
 	}
 	writeJSON(w, http.StatusOK, resp)
 }
 
+// jobTenant resolves the tenant a job lookup is scoped to: the authenticated
+// principal's, or else tenant_id / X-Tenant-ID.
+func jobTenant(w http.ResponseWriter, r *http.Request) (string, bool) {
+	head := MessageHeader{TenantID: r.URL.Query().Get("tenant_id")}
+	if migErr := applyPrincipalHeader(&head, principalFromContext(r.Context()), r); migErr != nil {
+		status := http.StatusForbidden
+		if migErr.Code == ErrorInvalidRequest {
+			status = http.StatusBadRequest
+		}
+		writeMigError(w, head, status, *migErr)
+		return "", false
+	}
+	return head.TenantID, true
+}
+
+func (s *Service) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	tenantID, ok := jobTenant(w, r)
+	if !ok {
+		return
+	}
+	job, err := s.GetJob(tenantID, r.PathValue("id"))
+	if err != nil {
+		writeMigError(w, MessageHeader{TenantID: tenantID}, http.StatusNotFound, *err)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (s *Service) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	tenantID, ok := jobTenant(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"jobs": s.Jobs(tenantID)})
+}
+
 func (s *Service) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
 	principal := principalFromContext(r.Context())
 	var req HeartbeatRequest
@@ -275,6 +426,16 @@ func (s *Service) handleStream(w http.ResponseWriter, r *http.Request) {
 	})
 	defer unregisterConn()
 
+	sessions := s.newStreamSessions(func(frame StreamFrame) error {
+		return conn.WriteJSON(frame)
+	})
+	defer sessions.wait()
+	defer sessions.closeAll()
+
+	actor := principal.Subject
+	if actor == "" {
+		actor = "anonymous"
+	}
 	for {
 		var frame StreamFrame
 		if readErr := conn.ReadJSON(&frame); readErr != nil {
@@ -284,7 +445,7 @@ func (s *Service) handleStream(w http.ResponseWriter, r *http.Request) {
 			frame.StreamID = "stream-" + frame.Header.MessageID
 		}
 		if migErr := applyPrincipalHeader(&frame.Header, principal, r); migErr != nil {
-			_ = conn.WriteJSON(StreamFrame{
+			_ = sessions.send(StreamFrame{
 				Header:     frame.Header,
 				StreamID:   frame.StreamID,
 				Capability: frame.Capability,
@@ -297,30 +458,7 @@ func (s *Service) handleStream(w http.ResponseWriter, r *http.Request) {
 
 		switch frame.Kind {
 		case "request":
-			invokeReq := InvokeRequest{
-				Header:     frame.Header,
-				Capability: frame.Capability,
-				Payload:    frame.Payload,
-			}
-			actor := principal.Subject
-			if actor == "" {
-				actor = "anonymous"
-			}
-			resp, invokeErr := s.Invoke(context.Background(), frame.Capability, invokeReq, actor, principal)
-			out := StreamFrame{
-				Header:     frame.Header,
-				StreamID:   frame.StreamID,
-				Capability: frame.Capability,
-				Kind:       "response",
-				EndStream:  true,
-			}
-			if invokeErr != nil {
-				out.Kind = "error"
-				out.Error = invokeErr
-			} else {
-				out.Payload = resp.Payload
-			}
-			if writeErr := conn.WriteJSON(out); writeErr != nil {
+			if err := sessions.request(r.Context(), frame, actor, principal); err != nil {
 				return
 			}
 		case "control":
@@ -331,7 +469,7 @@ func (s *Service) handleStream(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 			if action != "cancel" {
-				_ = conn.WriteJSON(StreamFrame{
+				_ = sessions.send(StreamFrame{
 					Header:    frame.Header,
 					StreamID:  frame.StreamID,
 					Kind:      "error",
@@ -349,7 +487,7 @@ func (s *Service) handleStream(w http.ResponseWriter, r *http.Request) {
 				TargetMessageID: frame.Header.MessageID,
 				Reason:          "websocket control cancel",
 			}
-			ack, cancelErr := s.Cancel(cancelReq, cancelReq.TargetMessageID)
+			ack, cancelErr := s.Cancel(cancelReq, cancelReq.TargetMessageID, actor, principal)
 			out := StreamFrame{
 				Header:    frame.Header,
 				StreamID:  frame.StreamID,
@@ -365,11 +503,11 @@ func (s *Service) handleStream(w http.ResponseWriter, r *http.Request) {
 					"status":   ack.Status,
 				}
 			}
-			if writeErr := conn.WriteJSON(out); writeErr != nil {
+			if writeErr := sessions.send(out); writeErr != nil {
 				return
 			}
 		default:
-			_ = conn.WriteJSON(StreamFrame{
+			_ = sessions.send(StreamFrame{
 				Header:     frame.Header,
 				StreamID:   frame.StreamID,
 				Capability: frame.Capability,
@@ -398,7 +536,95 @@ func (s *Service) handleAddCapability(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Service) handleListCapabilities(w http.ResponseWriter, _ *http.Request) {
-	writeJSON(w, http.StatusOK, map[string]interface{}{"capabilities": s.ListCapabilities()})
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"capabilities": s.ListCapabilities(),
+		"pools":        s.ProviderPools(),
+		"breakers":     s.CircuitBreakers(),
+	})
+}
+
+func (s *Service) handleTransformDryRun(w http.ResponseWriter, r *http.Request) {
+	var req TransformDryRunRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	resp, err := s.TransformDryRun(req)
+	if err != nil {
+		status := http.StatusBadRequest
+		if err.Code == ErrorUnsupportedCapability {
+			status = http.StatusNotFound
+		}
+		writeJSON(w, status, map[string]string{"error": err.Message})
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Service) handleSetCanary(w http.ResponseWriter, r *http.Request) {
+	var req CanaryConfig
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	status, err := s.SetCanary(req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Message})
+		return
+	}
+	writeJSON(w, http.StatusCreated, status)
+}
+
+func (s *Service) handleListCanaries(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"canaries": s.Canaries()})
+}
+
+func (s *Service) handleDeleteCanary(w http.ResponseWriter, r *http.Request) {
+	if err := s.DeleteCanary(r.PathValue("capability")); err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Message})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) handleSetShadow(w http.ResponseWriter, r *http.Request) {
+	var req ShadowConfig
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := s.SetShadow(req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Message})
+		return
+	}
+	writeJSON(w, http.StatusCreated, req)
+}
+
+func (s *Service) handleListShadows(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"shadows":  s.Shadows(),
+		"opt_outs": s.ShadowOptOuts(),
+	})
+}
+
+func (s *Service) handleDeleteShadow(w http.ResponseWriter, r *http.Request) {
+	if err := s.DeleteShadow(r.PathValue("capability")); err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Message})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) handleShadowComparisons(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"comparisons": s.ShadowComparisons(r.URL.Query().Get("capability"), limit),
+	})
+}
+
+func (s *Service) handleShadowOptOut(w http.ResponseWriter, r *http.Request) {
+	if err := s.SetShadowOptOut(r.PathValue("tenant_id"), r.Method == http.MethodPut); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Message})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (s *Service) handleAddSchema(w http.ResponseWriter, r *http.Request) {
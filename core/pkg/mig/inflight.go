@@ -0,0 +1,317 @@
+package mig
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// CancelAck statuses.
+const (
+	CancelStatusCancelled        = "cancelled"
+	CancelStatusNotFound         = "not_found"
+	CancelStatusAlreadyCompleted = "already_completed"
+)
+
+// CancelAdminScope lets an authenticated principal cancel any invocation of
+// its tenant. Without it, principals may only cancel their own.
+const CancelAdminScope = "mig:admin"
+
+const (
+	// defaultMessageTTL is how long idempotent responses are remembered.
+	defaultMessageTTL = 24 * time.Hour
+	// recentMessageTTL is how long cancellations and completed message IDs
+	// are remembered, unless the message TTL is shorter. It only needs to
+	// cover a CANCEL racing the end of its invocation.
+	recentMessageTTL     = 10 * time.Minute
+	messagePruneInterval = time.Minute
+)
+
+// cancelCause is the context cause of an invocation aborted by CANCEL.
+type cancelCause struct {
+	reason string
+}
+
+func (c *cancelCause) Error() string {
+	return "invocation cancelled: " + c.reason
+}
+
+// cancelledError is the error an invocation fails with once CANCEL has
+// aborted it. It matches the error returned for a message ID that was
+// cancelled before it started.
+func cancelledError(reason string) *MigError {
+	return &MigError{Code: ErrorTimeout, Message: "invocation cancelled: " + reason, Retryable: true}
+}
+
+// cancelledBy reports the CANCEL reason that aborted ctx, if any.
+func cancelledBy(ctx context.Context) (string, bool) {
+	var cause *cancelCause
+	if errors.As(context.Cause(ctx), &cause) {
+		return cause.reason, true
+	}
+	return "", false
+}
+
+// Owner identities are the principal's subject behind subjectOwnerPrefix, so
+// noOwner and adminCanceller cannot be matched by any subject.
+const (
+	subjectOwnerPrefix = "subject:"
+	noOwner            = "none"
+	adminCanceller     = "admin"
+)
+
+// messageOwner identifies who may cancel a message besides admins: the
+// subject of an authenticated principal, or "" for unauthenticated callers,
+// who share one identity. Messages of an authenticated principal without a
+// subject are owned by nobody, so only admins may cancel them.
+func messageOwner(principal Principal) string {
+	if !principal.Authenticated {
+		return ""
+	}
+	if principal.Subject == "" {
+		return noOwner
+	}
+	return subjectOwnerPrefix + principal.Subject
+}
+
+// canceller is the identity a CANCEL acts with: adminCanceller for an
+// authenticated principal holding CancelAdminScope, otherwise the owner
+// identity of its own messages. ok is false for an authenticated principal
+// without a subject, which owns nothing.
+func canceller(principal Principal) (string, bool) {
+	if _, admin := principal.Scopes[CancelAdminScope]; admin && principal.Authenticated {
+		return adminCanceller, true
+	}
+	by := messageOwner(principal)
+	return by, by != noOwner
+}
+
+// mayCancel reports whether by may abort a message owned by owner: admins may
+// cancel anything in their tenant, everyone else only their own messages.
+func mayCancel(owner, by string) bool {
+	return by == adminCanceller || owner == by
+}
+
+// inflightCall is a running invocation that CANCEL can abort.
+type inflightCall struct {
+	owner  string
+	cancel context.CancelCauseFunc
+}
+
+// cancelMark records a CANCEL that aborted a message, so a duplicate of the
+// invocation that had not registered yet is refused too.
+type cancelMark struct {
+	reason    string
+	by        string
+	expiresAt time.Time
+}
+
+type idempotencyEntry struct {
+	resp      InvokeResponse
+	expiresAt time.Time
+}
+
+// messageKey namespaces message IDs, and the state kept about them, by
+// tenant. Both parts are kept apart, since either may contain any character.
+type messageKey struct {
+	tenantID  string
+	messageID string
+}
+
+// trackInvocation registers a running invocation under its tenant and message
+// ID so CANCEL can abort it. The returned context is cancelled, with a
+// cancelCause, when that happens. release unregisters the invocation and
+// remembers it as completed; it is safe to call more than once.
+func (s *Service) trackInvocation(ctx context.Context, head MessageHeader, principal Principal) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	call := &inflightCall{owner: messageOwner(principal), cancel: cancel}
+	key := messageKey{head.TenantID, head.MessageID}
+
+	s.mu.Lock()
+	s.inflight[key] = append(s.inflight[key], call)
+	if s.inflightTenants[head.MessageID] == nil {
+		s.inflightTenants[head.MessageID] = map[string]struct{}{}
+	}
+	s.inflightTenants[head.MessageID][head.TenantID] = struct{}{}
+	// A CANCEL that landed between the pre-dispatch check and now would
+	// otherwise find nothing to abort.
+	if reason, cancelled := s.precancelledLocked(head, principal, time.Now()); cancelled {
+		cancel(&cancelCause{reason: reason})
+	}
+	s.mu.Unlock()
+
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			s.mu.Lock()
+			calls := s.inflight[key]
+			for i, c := range calls {
+				if c == call {
+					calls = append(calls[:i], calls[i+1:]...)
+					break
+				}
+			}
+			if len(calls) == 0 {
+				delete(s.inflight, key)
+				tenants := s.inflightTenants[head.MessageID]
+				delete(tenants, head.TenantID)
+				if len(tenants) == 0 {
+					delete(s.inflightTenants, head.MessageID)
+				}
+			} else {
+				s.inflight[key] = calls
+			}
+			now := time.Now()
+			s.completed[key] = now.Add(s.recentTTL())
+			s.pruneMessagesLocked(now)
+			s.mu.Unlock()
+			cancel(nil)
+		})
+	}
+}
+
+// precancelledLocked reports whether a CANCEL for the message arrived before
+// the invocation did. A mark left by a non-admin principal only applies to
+// that principal's invocations. Callers must hold s.mu for reading.
+func (s *Service) precancelledLocked(head MessageHeader, principal Principal, now time.Time) (string, bool) {
+	mark, ok := s.cancelled[messageKey{head.TenantID, head.MessageID}]
+	if !ok || now.After(mark.expiresAt) || !mayCancel(messageOwner(principal), mark.by) {
+		return "", false
+	}
+	return mark.reason, true
+}
+
+// cancelMessage carries out a CANCEL. It reports a forbidden error, after
+// auditing it, when the caller does not own the running work.
+func (s *Service) cancelMessage(head MessageHeader, messageID, reason, actor string, principal Principal) (string, *MigError) {
+	now := time.Now()
+	key := messageKey{head.TenantID, messageID}
+	by, ok := canceller(principal)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !ok {
+		s.auditCancelRejectedLocked(actor, head.TenantID, messageID, "cancel by "+actor+" rejected: principal has no subject")
+		return "", &MigError{Code: ErrorForbidden, Message: "only a principal with a subject or an admin may cancel", Retryable: false}
+	}
+	s.pruneMessagesLocked(now)
+	calls := s.inflight[key]
+	j := s.jobs[key]
+	if j != nil && j.terminal() {
+		j = nil
+	}
+	allowed := j == nil || mayCancel(j.owner, by)
+	for _, call := range calls {
+		allowed = allowed && mayCancel(call.owner, by)
+	}
+	if !allowed {
+		s.auditCancelRejectedLocked(actor, head.TenantID, messageID, "cancel by "+actor+" rejected: not the originating principal")
+		return "", &MigError{Code: ErrorForbidden, Message: "only the originating principal or an admin may cancel this invocation", Retryable: false}
+	}
+
+	if len(calls) == 0 && j == nil {
+		if s.completedLocked(key, now) {
+			return CancelStatusAlreadyCompleted, nil
+		}
+		if tenantID, found := s.foreignMessageLocked(head.TenantID, messageID); found {
+			// Answer as for an unknown ID so other tenants' message IDs
+			// cannot be probed, but leave a trail for the owner.
+			s.auditCancelRejectedLocked(actor, tenantID, messageID, "cancel from tenant "+head.TenantID+" rejected")
+		}
+		// Nothing is recorded for unknown IDs, so they cost no memory.
+		return CancelStatusNotFound, nil
+	}
+	for _, call := range calls {
+		call.cancel(&cancelCause{reason: reason})
+	}
+	if j != nil {
+		s.cancelJobLocked(j)
+	}
+	s.cancelled[key] = cancelMark{reason: reason, by: by, expiresAt: now.Add(s.recentTTL())}
+	return CancelStatusCancelled, nil
+}
+
+// recentTTL is how long cancellations and completed message IDs are kept.
+func (s *Service) recentTTL() time.Duration {
+	return min(s.messageTTL, recentMessageTTL)
+}
+
+// completedLocked reports whether a message key names an invocation or async
+// job that has already finished. Callers must hold s.mu.
+func (s *Service) completedLocked(key messageKey, now time.Time) bool {
+	if expiresAt, done := s.completed[key]; done && now.Before(expiresAt) {
+		return true
+	}
+	j, ok := s.jobs[key]
+	return ok && j.terminal()
+}
+
+// foreignMessageLocked finds another tenant running an invocation under
+// messageID. Callers must hold s.mu.
+func (s *Service) foreignMessageLocked(tenantID, messageID string) (string, bool) {
+	for owner := range s.inflightTenants[messageID] {
+		if owner != tenantID {
+			return owner, true
+		}
+	}
+	return "", false
+}
+
+// auditCancelRejectedLocked records a refused CANCEL against the tenant that
+// owns the message. Callers must hold s.mu.
+func (s *Service) auditCancelRejectedLocked(actor, tenantID, messageID, reason string) {
+	record := AuditRecord{
+		Actor:     actor,
+		TenantID:  tenantID,
+		Outcome:   "cancel_rejected",
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		MessageID: messageID,
+		ErrorCode: ErrorForbidden,
+		Reason:    reason,
+	}
+	s.audit = append(s.audit, record)
+	s.writeAuditLogLocked(record)
+}
+
+// idempotentLocked returns a cached response that has not expired. Callers
+// must hold s.mu for reading.
+func (s *Service) idempotentLocked(key string, now time.Time) (InvokeResponse, bool) {
+	entry, ok := s.idempotency[key]
+	if !ok || now.After(entry.expiresAt) {
+		return InvokeResponse{}, false
+	}
+	return entry.resp, true
+}
+
+// rememberIdempotentLocked caches a response for the message TTL. Callers
+// must hold s.mu.
+func (s *Service) rememberIdempotentLocked(key string, resp InvokeResponse, now time.Time) {
+	s.idempotency[key] = idempotencyEntry{resp: resp, expiresAt: now.Add(s.messageTTL)}
+}
+
+// pruneMessagesLocked drops expired cancellations, completed message IDs,
+// and idempotent responses, at most once per messagePruneInterval. Callers
+// must hold s.mu.
+func (s *Service) pruneMessagesLocked(now time.Time) {
+	if now.Sub(s.messagesPrunedAt) < messagePruneInterval {
+		return
+	}
+	s.messagesPrunedAt = now
+	s.pruneJobsLocked(now)
+	for key, mark := range s.cancelled {
+		if now.After(mark.expiresAt) {
+			delete(s.cancelled, key)
+		}
+	}
+	for key, expiresAt := range s.completed {
+		if now.After(expiresAt) {
+			delete(s.completed, key)
+		}
+	}
+	for key, entry := range s.idempotency {
+		if now.After(entry.expiresAt) {
+			delete(s.idempotency, key)
+		}
+	}
+}
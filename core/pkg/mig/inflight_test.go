@@ -0,0 +1,436 @@
+package mig
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func newCancelService(t *testing.T) (*Service, chan struct{}, chan struct{}) {
+	t.Helper()
+	started, aborted := make(chan struct{}, 4), make(chan struct{}, 4)
+	svc := NewService()
+	if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: testDescriptor("acme.slow.run")}); err != nil {
+		t.Fatalf("add: %v", err.Message)
+	}
+	_ = svc.BindProvider("acme.slow.run", ProviderFunc(func(ctx context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+		if req.Payload["block"] != true {
+			return map[string]interface{}{"ok": true}, nil
+		}
+		started <- struct{}{}
+		<-ctx.Done()
+		aborted <- struct{}{}
+		return nil, &MigError{Code: ErrorTimeout, Message: "aborted", Retryable: true}
+	}))
+	if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: streamDescriptor("acme.slow.stream")}); err != nil {
+		t.Fatalf("add: %v", err.Message)
+	}
+	_ = svc.BindProvider("acme.slow.stream", StreamProviderFunc(func(ctx context.Context, _ InvokeRequest, emit func(StreamFrame) error) *MigError {
+		_ = emit(StreamFrame{Kind: "event", Payload: map[string]interface{}{"token": "first"}})
+		started <- struct{}{}
+		<-ctx.Done()
+		aborted <- struct{}{}
+		return nil
+	}))
+	return svc, started, aborted
+}
+
+func waitSignal(t *testing.T, ch chan struct{}, msg string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal(msg)
+	}
+}
+
+func TestCancelAbortsRunningInvoke(t *testing.T) {
+	svc, started, aborted := newCancelService(t)
+	errs := make(chan *MigError, 1)
+	go func() {
+		_, err := svc.Invoke(context.Background(), "acme.slow.run", InvokeRequest{
+			Header:  MessageHeader{TenantID: "acme", MessageID: "run-1"},
+			Payload: map[string]interface{}{"block": true},
+		}, "tester", AnonymousPrincipal())
+		errs <- err
+	}()
+	waitSignal(t, started, "invocation did not start")
+
+	ack, err := svc.Cancel(CancelRequest{Header: MessageHeader{TenantID: "globex"}}, "run-1", "tester", AnonymousPrincipal())
+	if err != nil || ack.Status != CancelStatusNotFound {
+		t.Fatalf("another tenant must not see the invocation: %#v %#v", ack, err)
+	}
+	ack, err = svc.Cancel(CancelRequest{Header: MessageHeader{TenantID: "acme"}, Reason: "user"}, "run-1", "tester", AnonymousPrincipal())
+	if err != nil || !ack.Accepted || ack.Status != CancelStatusCancelled {
+		t.Fatalf("unexpected cancel ack: %#v %#v", ack, err)
+	}
+	waitSignal(t, aborted, "provider context was not cancelled")
+	select {
+	case migErr := <-errs:
+		if migErr == nil || migErr.Code != ErrorTimeout || migErr.Message != "invocation cancelled: user" {
+			t.Fatalf("unexpected invoke error: %#v", migErr)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("invoke did not return after cancel")
+	}
+
+	ack, _ = svc.Cancel(CancelRequest{Header: MessageHeader{TenantID: "acme"}}, "run-1", "tester", AnonymousPrincipal())
+	if ack.Accepted || ack.Status != CancelStatusAlreadyCompleted {
+		t.Fatalf("expected already_completed, got %#v", ack)
+	}
+}
+
+func TestCancelStatuses(t *testing.T) {
+	svc, _, _ := newCancelService(t)
+	ack, _ := svc.Cancel(CancelRequest{Header: MessageHeader{TenantID: "acme"}}, "run-later", "tester", AnonymousPrincipal())
+	if !ack.Accepted || ack.Status != CancelStatusNotFound {
+		t.Fatalf("expected not_found, got %#v", ack)
+	}
+	// Nothing is recorded for the unknown ID, so a later invocation runs.
+	if _, err := svc.Invoke(context.Background(), "acme.slow.run", InvokeRequest{
+		Header: MessageHeader{TenantID: "acme", MessageID: "run-later"},
+	}, "tester", AnonymousPrincipal()); err != nil {
+		t.Fatalf("a cancel of an unknown ID must not apply later: %v", err.Message)
+	}
+
+	if _, err := svc.Invoke(context.Background(), "acme.slow.run", InvokeRequest{
+		Header: MessageHeader{TenantID: "acme", MessageID: "run-done"},
+	}, "tester", AnonymousPrincipal()); err != nil {
+		t.Fatalf("invoke: %v", err.Message)
+	}
+	ack, _ = svc.Cancel(CancelRequest{Header: MessageHeader{TenantID: "acme"}}, "run-done", "tester", AnonymousPrincipal())
+	if ack.Accepted || ack.Status != CancelStatusAlreadyCompleted {
+		t.Fatalf("expected already_completed, got %#v", ack)
+	}
+}
+
+func TestCancelEndsStreamWithControlFrame(t *testing.T) {
+	svc, started, aborted := newCancelService(t)
+	var mu sync.Mutex
+	var frames []StreamFrame
+	errs := make(chan *MigError, 1)
+	go func() {
+		errs <- svc.InvokeStream(context.Background(), "acme.slow.stream", InvokeRequest{
+			Header: MessageHeader{TenantID: "acme", MessageID: "stream-1"},
+		}, "tester", AnonymousPrincipal(), func(frame StreamFrame) error {
+			mu.Lock()
+			defer mu.Unlock()
+			frames = append(frames, frame)
+			return nil
+		})
+	}()
+	waitSignal(t, started, "stream did not start")
+	if ack, _ := svc.Cancel(CancelRequest{Header: MessageHeader{TenantID: "acme"}, Reason: "stop"}, "stream-1", "tester", AnonymousPrincipal()); ack.Status != CancelStatusCancelled {
+		t.Fatalf("unexpected cancel ack: %#v", ack)
+	}
+	waitSignal(t, aborted, "stream provider was not cancelled")
+	if err := <-errs; err != nil {
+		t.Fatalf("a cancelled stream should end cleanly, got %#v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(frames) != 2 {
+		t.Fatalf("expected an event and a control frame, got %#v", frames)
+	}
+	if last := frames[1]; last.Kind != "control" || !last.EndStream || last.Payload["action"] != "cancelled" || last.Payload["reason"] != "stop" {
+		t.Fatalf("unexpected terminal frame: %#v", last)
+	}
+	records := svc.AuditExport("acme")
+	if last := records[len(records)-1]; last.Outcome != "cancelled" || last.Frames != 2 {
+		t.Fatalf("unexpected audit record: %#v", last)
+	}
+}
+
+func TestCancelSessionOverWebSocket(t *testing.T) {
+	svc := newSessionService(t)
+	mux := http.NewServeMux()
+	RegisterHTTPRoutes(mux, svc)
+	srv := httptest.NewServer(AuthMiddleware(AuthConfig{Mode: AuthModeNone})(mux))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+srv.URL[len("http"):]+"/mig/v0.1/stream", nil)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.WriteJSON(StreamFrame{
+		Header:     MessageHeader{TenantID: "acme", MessageID: "sess-cancel", Meta: map[string]interface{}{StreamModeMetaKey: ModeBidiStream}},
+		StreamID:   "audio-9",
+		Capability: "acme.audio.transcribe",
+		Kind:       "request",
+		Payload:    map[string]interface{}{"chunk": "one"},
+	}); err != nil {
+		t.Fatalf("write frame: %v", err)
+	}
+	read := func() StreamFrame {
+		var frame StreamFrame
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("read frame: %v", err)
+		}
+		return frame
+	}
+	if frame := read(); frame.Kind != "event" {
+		t.Fatalf("expected a partial, got %#v", frame)
+	}
+
+	if err := conn.WriteJSON(StreamFrame{
+		Header:   MessageHeader{TenantID: "acme", MessageID: "sess-cancel"},
+		StreamID: "cancel-1",
+		Kind:     "control",
+		Payload:  map[string]interface{}{"action": "cancel"},
+	}); err != nil {
+		t.Fatalf("write frame: %v", err)
+	}
+	var got []string
+	for len(got) < 2 {
+		frame := read()
+		action, _ := frame.Payload["action"].(string)
+		status, _ := frame.Payload["status"].(string)
+		got = append(got, frame.StreamID+":"+frame.Kind+":"+action+status)
+	}
+	joined := strings.Join(got, ",")
+	if !strings.Contains(joined, "audio-9:control:cancelled") || !strings.Contains(joined, "cancel-1:control:"+CancelStatusCancelled) {
+		t.Fatalf("expected the ack and a terminal control frame, got %v", got)
+	}
+}
+
+func TestCancelServerStreamOverWebSocket(t *testing.T) {
+	svc, started, aborted := newCancelService(t)
+	mux := http.NewServeMux()
+	RegisterHTTPRoutes(mux, svc)
+	srv := httptest.NewServer(AuthMiddleware(AuthConfig{Mode: AuthModeNone})(mux))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+srv.URL[len("http"):]+"/mig/v0.1/stream", nil)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.WriteJSON(StreamFrame{
+		Header:     MessageHeader{TenantID: "acme", MessageID: "tokens-1"},
+		StreamID:   "tokens",
+		Capability: "acme.slow.stream",
+		Kind:       "request",
+	}); err != nil {
+		t.Fatalf("write frame: %v", err)
+	}
+	waitSignal(t, started, "stream did not start")
+
+	// The stream is still running, so the cancel is only read if the call
+	// does not hold up the connection's read loop.
+	if err := conn.WriteJSON(StreamFrame{
+		Header:   MessageHeader{TenantID: "acme", MessageID: "tokens-1"},
+		StreamID: "cancel-tokens",
+		Kind:     "control",
+		Payload:  map[string]interface{}{"action": "cancel"},
+	}); err != nil {
+		t.Fatalf("write frame: %v", err)
+	}
+	waitSignal(t, aborted, "stream provider was not cancelled")
+	var got []string
+	for len(got) < 3 {
+		var frame StreamFrame
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("read frame: %v", err)
+		}
+		action, _ := frame.Payload["action"].(string)
+		status, _ := frame.Payload["status"].(string)
+		got = append(got, frame.StreamID+":"+frame.Kind+":"+action+status)
+	}
+	joined := strings.Join(got, ",")
+	if !strings.Contains(joined, "tokens:event:") || !strings.Contains(joined, "tokens:control:cancelled") || !strings.Contains(joined, "cancel-tokens:control:"+CancelStatusCancelled) {
+		t.Fatalf("expected the event, the ack, and a terminal control frame, got %v", got)
+	}
+}
+
+func jwtPrincipal(subject string, scopes ...string) Principal {
+	p := Principal{Subject: subject, TenantID: "acme", Scopes: map[string]struct{}{}, Authenticated: true}
+	for _, scope := range scopes {
+		p.Scopes[scope] = struct{}{}
+	}
+	return p
+}
+
+func TestCancelRequiresOwnerOrAdmin(t *testing.T) {
+	svc, started, aborted := newCancelService(t)
+	alice := jwtPrincipal("alice")
+	errs := make(chan *MigError, 1)
+	go func() {
+		_, err := svc.Invoke(context.Background(), "acme.slow.run", InvokeRequest{
+			Header:  MessageHeader{TenantID: "acme", MessageID: "run-owned"},
+			Payload: map[string]interface{}{"block": true},
+		}, "alice", alice)
+		errs <- err
+	}()
+	waitSignal(t, started, "invocation did not start")
+
+	_, err := svc.Cancel(CancelRequest{Header: MessageHeader{TenantID: "acme"}}, "run-owned", "bob", jwtPrincipal("bob"))
+	if err == nil || err.Code != ErrorForbidden {
+		t.Fatalf("expected forbidden cancel, got %#v", err)
+	}
+	records := svc.AuditExport("acme")
+	if last := records[len(records)-1]; last.Outcome != "cancel_rejected" || last.Actor != "bob" || last.MessageID != "run-owned" {
+		t.Fatalf("rejected cancel should be audited: %#v", last)
+	}
+	// Unauthenticated callers, such as NATS requests, are not admins.
+	if _, err := svc.Cancel(CancelRequest{Header: MessageHeader{TenantID: "acme"}}, "run-owned", "nats", AnonymousPrincipal()); err == nil || err.Code != ErrorForbidden {
+		t.Fatalf("expected an unauthenticated cancel to be forbidden, got %#v", err)
+	}
+
+	ack, err := svc.Cancel(CancelRequest{Header: MessageHeader{TenantID: "acme"}}, "run-owned", "ops", jwtPrincipal("ops", CancelAdminScope))
+	if err != nil || ack.Status != CancelStatusCancelled {
+		t.Fatalf("admins may cancel: %#v %#v", ack, err)
+	}
+	waitSignal(t, aborted, "provider context was not cancelled")
+	<-errs
+
+	// A pre-emptive cancel from bob does not block alice's invocation.
+	if _, err := svc.Cancel(CancelRequest{Header: MessageHeader{TenantID: "acme"}}, "run-next", "bob", jwtPrincipal("bob")); err != nil {
+		t.Fatalf("cancel: %v", err.Message)
+	}
+	if _, err := svc.Invoke(context.Background(), "acme.slow.run", InvokeRequest{
+		Header: MessageHeader{TenantID: "acme", MessageID: "run-next"},
+	}, "alice", alice); err != nil {
+		t.Fatalf("another principal's cancel must not apply: %v", err.Message)
+	}
+}
+
+func TestCancelIsScopedToTenant(t *testing.T) {
+	svc, started, aborted := newCancelService(t)
+	// globex cancelling an ID does not block acme's invocation with it.
+	if _, err := svc.Cancel(CancelRequest{Header: MessageHeader{TenantID: "globex"}}, "shared-1", "mallory", AnonymousPrincipal()); err != nil {
+		t.Fatalf("cancel: %v", err.Message)
+	}
+	if _, err := svc.Invoke(context.Background(), "acme.slow.run", InvokeRequest{
+		Header: MessageHeader{TenantID: "acme", MessageID: "shared-1"},
+	}, "tester", AnonymousPrincipal()); err != nil {
+		t.Fatalf("a foreign cancel must not apply: %v", err.Message)
+	}
+
+	go func() {
+		_, _ = svc.Invoke(context.Background(), "acme.slow.run", InvokeRequest{
+			Header:  MessageHeader{TenantID: "acme", MessageID: "shared-2"},
+			Payload: map[string]interface{}{"block": true},
+		}, "tester", AnonymousPrincipal())
+	}()
+	waitSignal(t, started, "invocation did not start")
+	ack, err := svc.Cancel(CancelRequest{Header: MessageHeader{TenantID: "globex"}}, "shared-2", "mallory", AnonymousPrincipal())
+	if err != nil || ack.Status != CancelStatusNotFound {
+		t.Fatalf("a foreign cancel should look like an unknown ID: %#v %#v", ack, err)
+	}
+	records := svc.AuditExport("acme")
+	if last := records[len(records)-1]; last.Outcome != "cancel_rejected" || last.Actor != "mallory" || last.MessageID != "shared-2" {
+		t.Fatalf("cross-tenant cancel should be audited for the owner: %#v", last)
+	}
+	if _, err := svc.Cancel(CancelRequest{Header: MessageHeader{TenantID: "acme"}}, "shared-2", "tester", AnonymousPrincipal()); err != nil {
+		t.Fatalf("cancel: %v", err.Message)
+	}
+	waitSignal(t, aborted, "provider context was not cancelled")
+}
+
+func TestCancelKeysDoNotCollideAcrossTenants(t *testing.T) {
+	svc, started, aborted := newCancelService(t)
+	// Tenant IDs may contain "/", so "acme" + "eu/run-1" must stay apart
+	// from "acme/eu" + "run-1".
+	if _, err := svc.Cancel(CancelRequest{Header: MessageHeader{TenantID: "acme"}}, "eu/run-1", "tester", AnonymousPrincipal()); err != nil {
+		t.Fatalf("cancel: %v", err.Message)
+	}
+	if _, err := svc.Invoke(context.Background(), "acme.slow.run", InvokeRequest{
+		Header: MessageHeader{TenantID: "acme/eu", MessageID: "run-1"},
+	}, "tester", AnonymousPrincipal()); err != nil {
+		t.Fatalf("another tenant's cancel must not apply: %v", err.Message)
+	}
+
+	go func() {
+		_, _ = svc.Invoke(context.Background(), "acme.slow.run", InvokeRequest{
+			Header:  MessageHeader{TenantID: "acme/eu", MessageID: "run-2"},
+			Payload: map[string]interface{}{"block": true},
+		}, "tester", AnonymousPrincipal())
+	}()
+	waitSignal(t, started, "invocation did not start")
+	ack, err := svc.Cancel(CancelRequest{Header: MessageHeader{TenantID: "acme"}}, "eu/run-2", "tester", AnonymousPrincipal())
+	if err != nil || ack.Status != CancelStatusNotFound {
+		t.Fatalf("expected not_found for another tenant's invocation, got %#v %#v", ack, err)
+	}
+	if ack, _ := svc.Cancel(CancelRequest{Header: MessageHeader{TenantID: "acme/eu"}}, "run-2", "tester", AnonymousPrincipal()); ack.Status != CancelStatusCancelled {
+		t.Fatalf("unexpected cancel ack: %#v", ack)
+	}
+	waitSignal(t, aborted, "provider context was not cancelled")
+}
+
+func TestCancelWithoutSubjectOwnsNothing(t *testing.T) {
+	svc, started, aborted := newCancelService(t)
+	anonymousToken := jwtPrincipal("")
+	go func() {
+		_, _ = svc.Invoke(context.Background(), "acme.slow.run", InvokeRequest{
+			Header:  MessageHeader{TenantID: "acme", MessageID: "run-nosub"},
+			Payload: map[string]interface{}{"block": true},
+		}, "anonymous", anonymousToken)
+	}()
+	waitSignal(t, started, "invocation did not start")
+
+	if _, err := svc.Cancel(CancelRequest{Header: MessageHeader{TenantID: "acme"}}, "run-nosub", "bob", jwtPrincipal("bob")); err == nil || err.Code != ErrorForbidden {
+		t.Fatalf("a subject must not cancel a message owned by nobody, got %#v", err)
+	}
+	if _, err := svc.Cancel(CancelRequest{Header: MessageHeader{TenantID: "acme"}}, "run-nosub", "anonymous", anonymousToken); err == nil || err.Code != ErrorForbidden {
+		t.Fatalf("a principal without a subject must not cancel, got %#v", err)
+	}
+	ack, err := svc.Cancel(CancelRequest{Header: MessageHeader{TenantID: "acme"}}, "run-nosub", "ops", jwtPrincipal("ops", CancelAdminScope))
+	if err != nil || ack.Status != CancelStatusCancelled {
+		t.Fatalf("admins may cancel: %#v %#v", ack, err)
+	}
+	waitSignal(t, aborted, "provider context was not cancelled")
+}
+
+func TestMessageStateExpires(t *testing.T) {
+	svc, err := NewServiceWithOptions(ServiceOptions{MessageTTL: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("service: %v", err)
+	}
+	if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: testDescriptor("acme.tools.count")}); err != nil {
+		t.Fatalf("add: %v", err.Message)
+	}
+	calls := 0
+	_ = svc.BindProvider("acme.tools.count", ProviderFunc(func(context.Context, InvokeRequest) (map[string]interface{}, *MigError) {
+		calls++
+		return map[string]interface{}{"calls": calls}, nil
+	}))
+	invoke := func(messageID, idemKey string) *MigError {
+		_, err := svc.Invoke(context.Background(), "acme.tools.count", InvokeRequest{
+			Header: MessageHeader{TenantID: "acme", MessageID: messageID, IdempotencyKey: idemKey},
+		}, "tester", AnonymousPrincipal())
+		return err
+	}
+
+	cancel := func(messageID string) string {
+		ack, _ := svc.Cancel(CancelRequest{Header: MessageHeader{TenantID: "acme"}}, messageID, "tester", AnonymousPrincipal())
+		return ack.Status
+	}
+	_ = invoke("done", "")
+	if status := cancel("done"); status != CancelStatusAlreadyCompleted {
+		t.Fatalf("expected already_completed, got %s", status)
+	}
+	_ = invoke("idem-1", "k")
+	_ = invoke("idem-2", "k")
+	if calls != 2 {
+		t.Fatalf("expected an idempotent replay, got %d calls", calls)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if status := cancel("done"); status != CancelStatusNotFound {
+		t.Fatalf("expired completions should be forgotten, got %s", status)
+	}
+	_ = invoke("idem-3", "k")
+	if calls != 3 {
+		t.Fatalf("expired idempotent responses should be forgotten, got %d calls", calls)
+	}
+}
@@ -0,0 +1,572 @@
+package mig
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// AsyncMetaKey set to true in INVOKE header meta runs the call as a job
+	// and returns its ID right away.
+	AsyncMetaKey = "mig.async"
+	// AsyncTopicMetaKey and AsyncWebhookMetaKey choose how the caller is told
+	// that a job finished: an event on a MIG topic, a signed webhook, or both.
+	AsyncTopicMetaKey   = "mig.async_topic"
+	AsyncWebhookMetaKey = "mig.async_webhook"
+	// JobRetentionMetaKey shortens how long a finished job is kept.
+	JobRetentionMetaKey = "mig.job_retention_ms"
+	// JobIDMetaKey carries the job ID in the accepted response.
+	JobIDMetaKey = "mig.job_id"
+
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+
+	// Webhook requests carry the HMAC-SHA256 of "<timestamp>.<body>" keyed
+	// with the webhook secret, hex encoded as "sha256=<digest>".
+	WebhookSignatureHeader = "X-MIG-Signature"
+	WebhookTimestampHeader = "X-MIG-Timestamp"
+
+	defaultJobRetention     = 24 * time.Hour
+	defaultMaxJobsPerTenant = 1000
+	defaultJobDeadline      = time.Hour
+	webhookAttempts         = 3
+	webhookBackoff          = time.Second
+)
+
+// Job is the tenant-scoped view of an asynchronous invocation. Its ID is the
+// message ID of the INVOKE that started it.
+type Job struct {
+	ID            string                 `json:"id"`
+	TenantID      string                 `json:"tenant_id"`
+	Capability    string                 `json:"capability"`
+	Version       string                 `json:"version,omitempty"`
+	Status        string                 `json:"status"`
+	CreatedAt     string                 `json:"created_at"`
+	StartedAt     string                 `json:"started_at,omitempty"`
+	CompletedAt   string                 `json:"completed_at,omitempty"`
+	ExpiresAt     string                 `json:"expires_at,omitempty"`
+	Result        map[string]interface{} `json:"result,omitempty"`
+	Error         *MigError              `json:"error,omitempty"`
+	Notify        JobNotify              `json:"notify"`
+	Notifications []JobNotification      `json:"notifications,omitempty"`
+}
+
+type JobNotify struct {
+	Topic   string `json:"topic,omitempty"`
+	Webhook string `json:"webhook,omitempty"`
+}
+
+// JobNotification records one completion notice.
+type JobNotification struct {
+	Kind     string `json:"kind"`
+	Target   string `json:"target"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts,omitempty"`
+	Error    string `json:"error,omitempty"`
+	At       string `json:"at"`
+}
+
+type job struct {
+	Job
+	owner     string
+	cancel    context.CancelFunc
+	retention time.Duration
+	expiresAt time.Time
+	idemKey   string
+}
+
+func (j *job) terminal() bool {
+	switch j.Status {
+	case JobSucceeded, JobFailed, JobCancelled:
+		return true
+	}
+	return false
+}
+
+// finishLocked moves the job to a terminal status. Callers must hold s.mu.
+func (j *job) finishLocked(status string, now time.Time) {
+	j.Status = status
+	j.CompletedAt = now.UTC().Format(time.RFC3339)
+	j.expiresAt = now.Add(j.retention)
+	j.ExpiresAt = j.expiresAt.UTC().Format(time.RFC3339)
+}
+
+func (j *job) view() Job {
+	out := j.Job
+	out.Notifications = append([]JobNotification(nil), j.Notifications...)
+	return out
+}
+
+// startJob validates an async INVOKE, registers the job, and runs it in the
+// background with its own deadline. Without an explicit deadline_ms, jobs
+// get an hour instead of the unary default.
+func (s *Service) startJob(capability string, req InvokeRequest, actor string, principal Principal) (InvokeResponse, *MigError) {
+	explicitDeadline := req.Header.DeadlineMS
+	head := req.Header
+	if err := head.Normalize(time.Now()); err != nil {
+		s.recordError(ErrorInvalidRequest, "invoke")
+		return InvokeResponse{}, invalid(err.Error())
+	}
+	if capability == "" {
+		capability = req.Capability
+	}
+	if capability == "" {
+		s.recordError(ErrorInvalidRequest, "invoke")
+		return InvokeResponse{}, invalid("capability is required")
+	}
+	notify, retention, migErr := s.jobOptions(head.Meta)
+	if migErr != nil {
+		s.recordError(ErrorInvalidRequest, "invoke")
+		return InvokeResponse{}, migErr
+	}
+	jobDeadline := defaultJobDeadline
+	if explicitDeadline > 0 {
+		jobDeadline = time.Duration(explicitDeadline) * time.Millisecond
+	}
+	constraint, _ := head.Meta[CapabilityVersionMetaKey].(string)
+
+	now := time.Now()
+	s.mu.Lock()
+	s.pruneJobsLocked(now)
+	_, capDesc, migErr := s.resolveCapabilityLocked(capability, constraint)
+	if migErr != nil {
+		s.mu.Unlock()
+		s.recordError(migErr.Code, "invoke")
+		return InvokeResponse{}, migErr
+	}
+	if !principal.HasAnyScope(capDesc.AuthScopes) {
+		s.mu.Unlock()
+		s.recordError(ErrorForbidden, "invoke")
+		return InvokeResponse{}, &MigError{Code: ErrorForbidden, Message: "insufficient capability scope", Retryable: false}
+	}
+	idemKey := ""
+	if head.IdempotencyKey != "" {
+		idemKey = fmt.Sprintf("%s:job:%s:%s", head.TenantID, capDesc.ID, head.IdempotencyKey)
+		if accepted, ok := s.idempotentLocked(idemKey, now); ok {
+			s.mu.Unlock()
+			return accepted, nil
+		}
+	}
+	if existing, ok := s.jobs[messageKey{head.TenantID, head.MessageID}]; ok {
+		s.mu.Unlock()
+		return jobAccepted(head, existing.view()), nil
+	}
+	if migErr := s.makeJobRoomLocked(head.TenantID); migErr != nil {
+		s.mu.Unlock()
+		s.recordError(migErr.Code, "invoke")
+		return InvokeResponse{}, migErr
+	}
+	jobCtx, cancel := context.WithTimeout(context.Background(), jobDeadline)
+	j := &job{
+		Job: Job{
+			ID:         head.MessageID,
+			TenantID:   head.TenantID,
+			Capability: capDesc.ID,
+			Status:     JobPending,
+			CreatedAt:  now.UTC().Format(time.RFC3339),
+			Notify:     notify,
+		},
+		owner:     messageOwner(principal),
+		cancel:    cancel,
+		retention: retention,
+		idemKey:   idemKey,
+	}
+	s.jobs[messageKey{j.TenantID, j.ID}] = j
+	accepted := jobAccepted(head, j.view())
+	if idemKey != "" {
+		s.rememberIdempotentLocked(idemKey, accepted, now)
+	}
+	s.mu.Unlock()
+
+	inner := req
+	inner.Header = head
+	inner.Header.DeadlineMS = int(jobDeadline.Milliseconds())
+	inner.Header.Meta = make(map[string]interface{}, len(head.Meta))
+	for k, v := range head.Meta {
+		switch k {
+		case AsyncMetaKey, AsyncTopicMetaKey, AsyncWebhookMetaKey, JobRetentionMetaKey:
+			continue
+		}
+		inner.Header.Meta[k] = v
+	}
+	go s.runJob(jobCtx, j, capability, inner, actor, principal)
+	return accepted, nil
+}
+
+func jobAccepted(head MessageHeader, j Job) InvokeResponse {
+	head.Meta = cloneMeta(head.Meta)
+	head.Meta[JobIDMetaKey] = j.ID
+	return InvokeResponse{
+		Header:     head,
+		Capability: j.Capability,
+		Payload: map[string]interface{}{
+			"job_id":     j.ID,
+			"status":     j.Status,
+			"status_url": "/mig/v0.1/jobs/" + url.PathEscape(j.ID),
+		},
+	}
+}
+
+func cloneMeta(meta map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(meta)+1)
+	for k, v := range meta {
+		out[k] = v
+	}
+	return out
+}
+
+func (s *Service) jobOptions(meta map[string]interface{}) (JobNotify, time.Duration, *MigError) {
+	var notify JobNotify
+	if raw, ok := meta[AsyncTopicMetaKey]; ok {
+		topic, _ := raw.(string)
+		if !strings.Contains(topic, ".") {
+			return notify, 0, invalid(AsyncTopicMetaKey + " must be a namespaced topic name")
+		}
+		notify.Topic = topic
+	}
+	if raw, ok := meta[AsyncWebhookMetaKey]; ok {
+		target, _ := raw.(string)
+		parsed, err := url.Parse(target)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return notify, 0, invalid(AsyncWebhookMetaKey + " must be an http or https URL")
+		}
+		if s.webhookSecret == "" {
+			return notify, 0, invalid("webhook notifications require a webhook secret (MIGD_WEBHOOK_SECRET)")
+		}
+		if reason := s.webhookGuard.refuseHost(parsed.Hostname()); reason != "" {
+			return notify, 0, invalid(AsyncWebhookMetaKey + " " + reason)
+		}
+		notify.Webhook = target
+	}
+	retention := s.jobRetention
+	if raw, ok := meta[JobRetentionMetaKey]; ok {
+		ms, ok := metaNumber(raw)
+		if !ok || ms <= 0 {
+			return notify, 0, invalid(JobRetentionMetaKey + " must be a positive number")
+		}
+		if requested := time.Duration(ms) * time.Millisecond; requested < retention {
+			retention = requested
+		}
+	}
+	return notify, retention, nil
+}
+
+func metaNumber(raw interface{}) (int64, bool) {
+	switch v := raw.(type) {
+	case float64:
+		return int64(v), true
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func (s *Service) runJob(ctx context.Context, j *job, capability string, req InvokeRequest, actor string, principal Principal) {
+	defer j.cancel()
+	s.mu.Lock()
+	if j.Status == JobPending {
+		j.Status = JobRunning
+		j.StartedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	s.mu.Unlock()
+
+	resp, migErr := s.invoke(ctx, capability, req, actor, principal, true)
+
+	s.mu.Lock()
+	if j.Status != JobCancelled {
+		if migErr != nil {
+			j.Error = migErr
+			j.finishLocked(JobFailed, time.Now())
+		} else {
+			j.Result = resp.Payload
+			j.Version, _ = resp.Header.Meta[CapabilityVersionMetaKey].(string)
+			j.finishLocked(JobSucceeded, time.Now())
+		}
+	}
+	view := j.view()
+	s.mu.Unlock()
+	s.notifyJob(j, view)
+}
+
+// notifyJob publishes the finished job to its topic and posts it to its
+// webhook, recording each delivery on the job.
+func (s *Service) notifyJob(j *job, view Job) {
+	if view.Notify.Topic == "" && view.Notify.Webhook == "" {
+		return
+	}
+	body, err := json.Marshal(view)
+	if err != nil {
+		return
+	}
+	var record []JobNotification
+	if view.Notify.Topic != "" {
+		var payload map[string]interface{}
+		_ = json.Unmarshal(body, &payload)
+		n := JobNotification{Kind: "topic", Target: view.Notify.Topic, Status: "delivered"}
+		// The event carries the job's result, so only subscribers in the
+		// job's tenant receive it; see eventVisibleTo.
+		if _, migErr := s.Publish(view.Notify.Topic, PublishRequest{
+			Header:  MessageHeader{TenantID: view.TenantID, Meta: map[string]interface{}{JobIDMetaKey: view.ID}},
+			Payload: payload,
+		}); migErr != nil {
+			n.Status, n.Error = "failed", migErr.Message
+		}
+		n.At = time.Now().UTC().Format(time.RFC3339)
+		record = append(record, n)
+	}
+	if view.Notify.Webhook != "" {
+		record = append(record, s.deliverWebhook(view.Notify.Webhook, view.ID, body))
+	}
+	s.mu.Lock()
+	j.Notifications = append(j.Notifications, record...)
+	s.mu.Unlock()
+}
+
+func (s *Service) deliverWebhook(target, jobID string, body []byte) JobNotification {
+	n := JobNotification{Kind: "webhook", Target: target, Status: "failed"}
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		n.Attempts = attempt
+		if err := s.postWebhook(target, jobID, body); err == nil {
+			n.Status, n.Error = "delivered", ""
+			break
+		} else {
+			n.Error = err.Error()
+		}
+		if attempt < webhookAttempts {
+			time.Sleep(webhookBackoff * time.Duration(attempt))
+		}
+	}
+	n.At = time.Now().UTC().Format(time.RFC3339)
+	return n
+}
+
+func (s *Service) postWebhook(target, jobID string, body []byte) error {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(s.webhookSecret, timestamp, body))
+	req.Header.Set("X-MIG-Job-ID", jobID)
+	resp, err := s.webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// webhookGuard keeps job webhooks away from internal services. With an
+// allowlist only the listed hosts are reached, and they may resolve to any
+// address. Without one, destinations that resolve to loopback, private,
+// link-local, or other non-public addresses are refused.
+type webhookGuard struct {
+	allowed map[string]struct{}
+}
+
+func newWebhookGuard(hosts []string) webhookGuard {
+	g := webhookGuard{}
+	for _, host := range hosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if host == "" {
+			continue
+		}
+		if g.allowed == nil {
+			g.allowed = map[string]struct{}{}
+		}
+		g.allowed[host] = struct{}{}
+	}
+	return g
+}
+
+// refuseHost explains why a webhook to host is refused up front, or returns
+// "". Host names are only resolved when the webhook is dialed.
+func (g webhookGuard) refuseHost(host string) string {
+	host = strings.ToLower(host)
+	if g.allowed != nil {
+		if _, ok := g.allowed[host]; !ok {
+			return "host " + host + " is not in MIGD_WEBHOOK_ALLOWED_HOSTS"
+		}
+		return ""
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !publicAddr(addr) {
+		return "must not target a non-public address"
+	}
+	return ""
+}
+
+// dialContext checks the resolved address of every webhook connection, so a
+// host name that resolves, or later rebinds, to an internal address is
+// refused.
+func (g webhookGuard) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if g.allowed != nil {
+		if _, ok := g.allowed[strings.ToLower(host)]; !ok {
+			return nil, fmt.Errorf("webhook host %s is not allowed", host)
+		}
+		return dialer.DialContext(ctx, network, address)
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if !publicAddr(addr) {
+			return nil, fmt.Errorf("webhook host %s resolves to non-public address %s", host, addr)
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("webhook host %s has no addresses", host)
+	}
+	return dialer.DialContext(ctx, network, net.JoinHostPort(addrs[0].String(), port))
+}
+
+// newWebhookClient returns the client for job webhooks. It does not use
+// proxies or follow redirects, so every connection goes through the guard.
+func newWebhookClient(guard webhookGuard) *http.Client {
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         guard.dialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConns:        10,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// SignWebhook returns the X-MIG-Signature value for a webhook body. Receivers
+// recompute it with their copy of the secret and compare in constant time.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// GetJob returns a job owned by tenantID. Jobs of other tenants and expired
+// jobs are reported as not found.
+func (s *Service) GetJob(tenantID, id string) (Job, *MigError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneJobsLocked(time.Now())
+	j, ok := s.jobs[messageKey{tenantID, id}]
+	if !ok {
+		return Job{}, &MigError{Code: ErrorNotFound, Message: "job not found", Retryable: false}
+	}
+	return j.view(), nil
+}
+
+// Jobs lists a tenant's jobs, newest first.
+func (s *Service) Jobs(tenantID string) []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneJobsLocked(time.Now())
+	out := []Job{}
+	for _, j := range s.jobs {
+		if j.TenantID == tenantID {
+			out = append(out, j.view())
+		}
+	}
+	sort.Slice(out, func(i, k int) bool {
+		if out[i].CreatedAt != out[k].CreatedAt {
+			return out[i].CreatedAt > out[k].CreatedAt
+		}
+		return out[i].ID < out[k].ID
+	})
+	return out
+}
+
+// cancelJobLocked cancels an unfinished job. Callers must hold s.mu.
+func (s *Service) cancelJobLocked(j *job) {
+	j.finishLocked(JobCancelled, time.Now())
+	j.cancel()
+}
+
+// pruneJobsLocked drops finished jobs whose retention has expired. Callers
+// must hold s.mu.
+func (s *Service) pruneJobsLocked(now time.Time) {
+	for _, j := range s.jobs {
+		if j.terminal() && now.After(j.expiresAt) {
+			s.dropJobLocked(j)
+		}
+	}
+}
+
+// makeJobRoomLocked keeps a tenant below its job limit by dropping its
+// finished jobs that are closest to expiry. It fails when the tenant already
+// has that many unfinished jobs. Callers must hold s.mu.
+func (s *Service) makeJobRoomLocked(tenantID string) *MigError {
+	count := 0
+	var finished []*job
+	for _, j := range s.jobs {
+		if j.TenantID != tenantID {
+			continue
+		}
+		count++
+		if j.terminal() {
+			finished = append(finished, j)
+		}
+	}
+	sort.Slice(finished, func(i, k int) bool { return finished[i].expiresAt.Before(finished[k].expiresAt) })
+	for _, j := range finished {
+		if count < s.maxJobsPerTenant {
+			break
+		}
+		s.dropJobLocked(j)
+		count--
+	}
+	if count >= s.maxJobsPerTenant {
+		return &MigError{Code: ErrorRateLimited, Message: fmt.Sprintf("tenant already has %d unfinished async jobs", count), Retryable: true}
+	}
+	return nil
+}
+
+// dropJobLocked forgets a job and its idempotent acceptance. Callers must hold
+// s.mu.
+func (s *Service) dropJobLocked(j *job) {
+	delete(s.jobs, messageKey{j.TenantID, j.ID})
+	if j.idemKey != "" {
+		delete(s.idempotency, j.idemKey)
+	}
+}
@@ -0,0 +1,332 @@
+package mig
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newJobService(t *testing.T, opts ServiceOptions) *Service {
+	t.Helper()
+	svc, err := NewServiceWithOptions(opts)
+	if err != nil {
+		t.Fatalf("service: %v", err)
+	}
+	t.Cleanup(svc.Close)
+	if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: testDescriptor("acme.train.finetune")}); err != nil {
+		t.Fatalf("add: %v", err.Message)
+	}
+	_ = svc.BindProvider("acme.train.finetune", ProviderFunc(func(ctx context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+		if req.Payload["block"] == true {
+			<-ctx.Done()
+			return nil, &MigError{Code: ErrorTimeout, Message: "aborted", Retryable: true}
+		}
+		if req.Payload["fail"] == true {
+			return nil, &MigError{Code: ErrorInvalidRequest, Message: "bad dataset", Retryable: false}
+		}
+		return map[string]interface{}{"model": "ft-" + req.Payload["dataset"].(string)}, nil
+	}))
+	return svc
+}
+
+func startAsync(t *testing.T, svc *Service, tenant, messageID string, payload map[string]interface{}, meta map[string]interface{}) InvokeResponse {
+	t.Helper()
+	if meta == nil {
+		meta = map[string]interface{}{}
+	}
+	meta[AsyncMetaKey] = true
+	resp, err := svc.Invoke(context.Background(), "acme.train.finetune", InvokeRequest{
+		Header:  MessageHeader{TenantID: tenant, MessageID: messageID, Meta: meta},
+		Payload: payload,
+	}, "tester", AnonymousPrincipal())
+	if err != nil {
+		t.Fatalf("async invoke: %v", err.Message)
+	}
+	return resp
+}
+
+func waitJob(t *testing.T, svc *Service, tenant, id string, done func(Job) bool) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := svc.GetJob(tenant, id)
+		if err != nil {
+			t.Fatalf("get job: %v", err.Message)
+		}
+		if done(job) {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job did not settle: %#v", job)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func finished(job Job) bool {
+	return job.Status == JobSucceeded || job.Status == JobFailed || job.Status == JobCancelled
+}
+
+func TestAsyncInvokeRunsJob(t *testing.T) {
+	svc := newJobService(t, ServiceOptions{})
+	resp := startAsync(t, svc, "acme", "job-1", map[string]interface{}{"dataset": "d1"}, nil)
+	if resp.Header.Meta[JobIDMetaKey] != "job-1" || resp.Payload["status_url"] != "/mig/v0.1/jobs/job-1" {
+		t.Fatalf("unexpected accepted response: %#v", resp)
+	}
+
+	job := waitJob(t, svc, "acme", "job-1", finished)
+	if job.Status != JobSucceeded || job.Result["model"] != "ft-d1" || job.Version != "1.0.0" || job.ExpiresAt == "" {
+		t.Fatalf("unexpected job: %#v", job)
+	}
+	if _, err := svc.GetJob("globex", "job-1"); err == nil || err.Code != ErrorNotFound {
+		t.Fatalf("jobs must be tenant scoped, got %#v", err)
+	}
+	if jobs := svc.Jobs("globex"); len(jobs) != 0 {
+		t.Fatalf("other tenants must not list the job: %#v", jobs)
+	}
+
+	startAsync(t, svc, "acme", "job-2", map[string]interface{}{"fail": true}, nil)
+	job = waitJob(t, svc, "acme", "job-2", finished)
+	if job.Status != JobFailed || job.Error == nil || job.Error.Code != ErrorInvalidRequest {
+		t.Fatalf("expected failed job: %#v", job)
+	}
+	if jobs := svc.Jobs("acme"); len(jobs) != 2 {
+		t.Fatalf("expected two jobs for acme, got %#v", jobs)
+	}
+}
+
+func TestCancelAbortsRunningJob(t *testing.T) {
+	svc := newJobService(t, ServiceOptions{})
+	startAsync(t, svc, "acme", "job-block", map[string]interface{}{"block": true}, nil)
+	waitJob(t, svc, "acme", "job-block", func(job Job) bool { return job.Status == JobRunning })
+
+	// Another tenant cannot cancel the job.
+	if _, err := svc.Cancel(CancelRequest{Header: MessageHeader{TenantID: "globex"}}, "job-block", "tester", AnonymousPrincipal()); err != nil {
+		t.Fatalf("cancel: %v", err.Message)
+	}
+	if job, _ := svc.GetJob("acme", "job-block"); job.Status != JobRunning {
+		t.Fatalf("foreign cancel must not affect the job: %#v", job)
+	}
+
+	if _, err := svc.Cancel(CancelRequest{Header: MessageHeader{TenantID: "acme"}, Reason: "user"}, "job-block", "tester", AnonymousPrincipal()); err != nil {
+		t.Fatalf("cancel: %v", err.Message)
+	}
+	job := waitJob(t, svc, "acme", "job-block", finished)
+	if job.Status != JobCancelled || job.Result != nil {
+		t.Fatalf("expected cancelled job: %#v", job)
+	}
+}
+
+func TestJobCompletionNotifications(t *testing.T) {
+	type delivery struct {
+		header http.Header
+		body   []byte
+	}
+	received := make(chan delivery, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- delivery{header: r.Header.Clone(), body: body}
+	}))
+	defer hook.Close()
+
+	svc := newJobService(t, ServiceOptions{WebhookSecret: "s3cret", WebhookAllowedHosts: []string{"127.0.0.1"}})
+	_, events, unsubscribe, err := svc.Subscribe("acme", "acme.jobs.done", "")
+	if err != nil {
+		t.Fatalf("subscribe: %v", err.Message)
+	}
+	defer unsubscribe()
+	_, foreign, unsubscribeForeign, err := svc.Subscribe("globex", "acme.jobs.done", "")
+	if err != nil {
+		t.Fatalf("subscribe: %v", err.Message)
+	}
+	defer unsubscribeForeign()
+
+	startAsync(t, svc, "acme", "job-notify", map[string]interface{}{"dataset": "d2"}, map[string]interface{}{
+		AsyncTopicMetaKey:   "acme.jobs.done",
+		AsyncWebhookMetaKey: hook.URL,
+	})
+
+	select {
+	case event := <-events:
+		if event.Header.Meta[JobIDMetaKey] != "job-notify" || event.Payload["status"] != JobSucceeded {
+			t.Fatalf("unexpected job event: %#v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no job event published")
+	}
+	select {
+	case event := <-foreign:
+		t.Fatalf("another tenant must not receive job results: %#v", event)
+	default:
+	}
+	if replay, _, unsubscribeReplay, _ := svc.Subscribe("globex", "acme.jobs.done", "0"); len(replay) != 0 {
+		t.Fatalf("another tenant must not replay job results: %#v", replay)
+	} else {
+		unsubscribeReplay()
+	}
+
+	select {
+	case got := <-received:
+		timestamp := got.header.Get(WebhookTimestampHeader)
+		if got.header.Get(WebhookSignatureHeader) != SignWebhook("s3cret", timestamp, got.body) {
+			t.Fatalf("webhook signature mismatch: %v", got.header)
+		}
+		var job Job
+		if err := json.Unmarshal(got.body, &job); err != nil || job.ID != "job-notify" || job.Result["model"] != "ft-d2" {
+			t.Fatalf("unexpected webhook body: %s", got.body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+
+	job := waitJob(t, svc, "acme", "job-notify", func(job Job) bool { return len(job.Notifications) == 2 })
+	for _, n := range job.Notifications {
+		if n.Status != "delivered" {
+			t.Fatalf("expected delivered notifications: %#v", job.Notifications)
+		}
+	}
+}
+
+func TestAsyncInvokeValidatesOptions(t *testing.T) {
+	svc := newJobService(t, ServiceOptions{})
+	cases := map[string]map[string]interface{}{
+		"webhook without secret": {AsyncWebhookMetaKey: "https://example.com/hook"},
+		"bad topic":              {AsyncTopicMetaKey: "jobs"},
+		"bad retention":          {JobRetentionMetaKey: -1.0},
+	}
+	for name, meta := range cases {
+		meta[AsyncMetaKey] = true
+		_, err := svc.Invoke(context.Background(), "acme.train.finetune", InvokeRequest{
+			Header:  MessageHeader{TenantID: "acme", Meta: meta},
+			Payload: map[string]interface{}{"dataset": "d"},
+		}, "tester", AnonymousPrincipal())
+		if err == nil || err.Code != ErrorInvalidRequest {
+			t.Fatalf("%s: expected invalid request, got %#v", name, err)
+		}
+	}
+}
+
+func TestWebhooksRefuseInternalDestinations(t *testing.T) {
+	var hits atomic.Int32
+	hook := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { hits.Add(1) }))
+	defer hook.Close()
+	_, port, _ := net.SplitHostPort(hook.Listener.Addr().String())
+
+	svc := newJobService(t, ServiceOptions{WebhookSecret: "s3cret"})
+	for _, target := range []string{"http://127.0.0.1:" + port + "/hook", "http://169.254.169.254/latest/meta-data", "http://[::1]/hook", "http://10.0.0.8/hook"} {
+		if _, _, err := svc.jobOptions(map[string]interface{}{AsyncWebhookMetaKey: target}); err == nil || err.Code != ErrorInvalidRequest {
+			t.Fatalf("expected %s to be refused, got %#v", target, err)
+		}
+	}
+	// A host name passes the up-front check; its resolved address is
+	// checked when the webhook is dialed.
+	target := "http://localhost:" + port + "/hook"
+	if _, _, err := svc.jobOptions(map[string]interface{}{AsyncWebhookMetaKey: target}); err != nil {
+		t.Fatalf("host names are resolved at dial time, got %#v", err)
+	}
+	if err := svc.postWebhook(target, "job-1", []byte(`{}`)); err == nil || !strings.Contains(err.Error(), "non-public address") {
+		t.Fatalf("expected the dial to be refused, got %v", err)
+	}
+	if hits.Load() != 0 {
+		t.Fatalf("the internal endpoint must not be reached, got %d requests", hits.Load())
+	}
+
+	allowlisted := newJobService(t, ServiceOptions{WebhookSecret: "s3cret", WebhookAllowedHosts: []string{"localhost"}})
+	if _, _, err := allowlisted.jobOptions(map[string]interface{}{AsyncWebhookMetaKey: "https://hooks.example.com/done"}); err == nil || err.Code != ErrorInvalidRequest {
+		t.Fatalf("expected a host outside the allowlist to be refused, got %#v", err)
+	}
+	if err := allowlisted.postWebhook(target, "job-1", []byte(`{}`)); err != nil || hits.Load() != 1 {
+		t.Fatalf("expected an allowlisted host to be reached, got %v after %d requests", err, hits.Load())
+	}
+}
+
+func TestFinishedJobsExpireAfterRetention(t *testing.T) {
+	svc := newJobService(t, ServiceOptions{JobRetention: time.Hour})
+	startAsync(t, svc, "acme", "job-short", map[string]interface{}{"dataset": "d"}, map[string]interface{}{JobRetentionMetaKey: 200.0})
+	startAsync(t, svc, "acme", "job-long", map[string]interface{}{"dataset": "d"}, nil)
+	waitJob(t, svc, "acme", "job-short", finished)
+	waitJob(t, svc, "acme", "job-long", finished)
+	time.Sleep(250 * time.Millisecond)
+
+	if _, err := svc.GetJob("acme", "job-short"); err == nil || err.Code != ErrorNotFound {
+		t.Fatalf("expected expired job to be gone, got %#v", err)
+	}
+	if _, err := svc.GetJob("acme", "job-long"); err != nil {
+		t.Fatalf("job within retention should remain: %v", err.Message)
+	}
+}
+
+func TestJobsAreCappedPerTenant(t *testing.T) {
+	svc := newJobService(t, ServiceOptions{MaxJobsPerTenant: 2})
+	startAsync(t, svc, "acme", "job-done", map[string]interface{}{"dataset": "d"}, nil)
+	waitJob(t, svc, "acme", "job-done", finished)
+	startAsync(t, svc, "acme", "job-run-1", map[string]interface{}{"block": true}, nil)
+	// The finished job makes room for the next one.
+	startAsync(t, svc, "acme", "job-run-2", map[string]interface{}{"block": true}, nil)
+	if _, err := svc.GetJob("acme", "job-done"); err == nil || err.Code != ErrorNotFound {
+		t.Fatalf("expected the finished job to be dropped, got %#v", err)
+	}
+
+	_, err := svc.Invoke(context.Background(), "acme.train.finetune", InvokeRequest{
+		Header: MessageHeader{TenantID: "acme", MessageID: "job-run-3", Meta: map[string]interface{}{AsyncMetaKey: true}},
+	}, "tester", AnonymousPrincipal())
+	if err == nil || err.Code != ErrorRateLimited {
+		t.Fatalf("expected MIG_RATE_LIMITED with every slot running, got %#v", err)
+	}
+	// Other tenants have their own limit.
+	startAsync(t, svc, "globex", "job-other", map[string]interface{}{"dataset": "d"}, nil)
+	for _, id := range []string{"job-run-1", "job-run-2"} {
+		if _, err := svc.Cancel(CancelRequest{Header: MessageHeader{TenantID: "acme"}}, id, "tester", AnonymousPrincipal()); err != nil {
+			t.Fatalf("cancel: %v", err.Message)
+		}
+	}
+}
+
+func TestJobsOverHTTP(t *testing.T) {
+	svc := newJobService(t, ServiceOptions{})
+	mux := http.NewServeMux()
+	RegisterHTTPRoutes(mux, svc)
+	server := httptest.NewServer(AuthMiddleware(AuthConfig{Mode: AuthModeNone})(mux))
+	defer server.Close()
+
+	body := `{"header":{"tenant_id":"acme","message_id":"job-http","meta":{"mig.async":true}},"payload":{"dataset":"d3"}}`
+	resp, err := http.Post(server.URL+"/mig/v0.1/invoke/acme.train.finetune", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("invoke: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", resp.StatusCode)
+	}
+	waitJob(t, svc, "acme", "job-http", finished)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/mig/v0.1/jobs/job-http", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("get job: %v", err)
+	}
+	var job Job
+	_ = json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || job.Status != JobSucceeded || job.Result["model"] != "ft-d3" {
+		t.Fatalf("unexpected job response: %d %#v", resp.StatusCode, job)
+	}
+
+	req.Header.Set("X-Tenant-ID", "globex")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("get job: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for another tenant, got %d", resp.StatusCode)
+	}
+}
@@ -18,6 +18,19 @@ type Metrics struct {
 	requestLatency *prometheus.HistogramVec
 	requestErrors  *prometheus.CounterVec
 	activeStreams  *prometheus.GaugeVec
+	poolHealthy    *prometheus.GaugeVec
+	poolInFlight   *prometheus.GaugeVec
+	breakerState   *prometheus.GaugeVec
+	breakerTrips   *prometheus.CounterVec
+	invokeAttempts *prometheus.CounterVec
+	invokeRetries  *prometheus.CounterVec
+	hedgeRequests  *prometheus.CounterVec
+	hedgeWins      *prometheus.CounterVec
+	canaryRouted   *prometheus.CounterVec
+	canaryRollback *prometheus.CounterVec
+	shadowRequests *prometheus.CounterVec
+	streamFrames   *prometheus.CounterVec
+	schemaErrors   *prometheus.CounterVec
 }
 
 func NewMetrics(registry *prometheus.Registry) *Metrics {
@@ -48,6 +61,84 @@ func NewMetrics(registry *prometheus.Registry) *Metrics {
 			Name:      "active_streams",
 			Help:      "Active stream count by type.",
 		}, []string{"type"}),
+		poolHealthy: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "mig",
+			Subsystem: "gateway",
+			Name:      "pool_endpoint_healthy",
+			Help:      "1 when a pooled provider endpoint is passing health checks.",
+		}, []string{"capability", "endpoint"}),
+		poolInFlight: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "mig",
+			Subsystem: "gateway",
+			Name:      "pool_endpoint_in_flight",
+			Help:      "In-flight invocations by pooled provider endpoint.",
+		}, []string{"capability", "endpoint"}),
+		breakerState: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "mig",
+			Subsystem: "gateway",
+			Name:      "circuit_breaker_state",
+			Help:      "Circuit breaker state by capability and endpoint (0 closed, 1 half-open, 2 open).",
+		}, []string{"capability", "endpoint"}),
+		breakerTrips: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mig",
+			Subsystem: "gateway",
+			Name:      "circuit_breaker_transitions_total",
+			Help:      "Circuit breaker state transitions.",
+		}, []string{"capability", "endpoint", "from", "to"}),
+		invokeAttempts: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mig",
+			Subsystem: "gateway",
+			Name:      "invoke_attempts_total",
+			Help:      "Provider attempts per capability, including gateway retries.",
+		}, []string{"capability", "outcome"}),
+		invokeRetries: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mig",
+			Subsystem: "gateway",
+			Name:      "invoke_retries_total",
+			Help:      "Gateway retries by capability and the error code that triggered them.",
+		}, []string{"capability", "code"}),
+		hedgeRequests: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mig",
+			Subsystem: "gateway",
+			Name:      "hedge_requests_total",
+			Help:      "Hedged attempts sent after the primary attempt was slow.",
+		}, []string{"capability"}),
+		hedgeWins: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mig",
+			Subsystem: "gateway",
+			Name:      "hedge_wins_total",
+			Help:      "Winning attempt of hedged capabilities (primary or hedge).",
+		}, []string{"capability", "winner"}),
+		canaryRouted: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mig",
+			Subsystem: "gateway",
+			Name:      "canary_routed_total",
+			Help:      "Invocations routed by a canary split, by arm (stable or candidate) and version.",
+		}, []string{"capability", "arm", "version"}),
+		canaryRollback: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mig",
+			Subsystem: "gateway",
+			Name:      "canary_rollbacks_total",
+			Help:      "Canaries rolled back automatically after the candidate error rate crossed its threshold.",
+		}, []string{"capability"}),
+		shadowRequests: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mig",
+			Subsystem: "gateway",
+			Name:      "shadow_requests_total",
+			Help:      "Mirrored invocations by comparison outcome (match, mismatch, error, dropped).",
+		}, []string{"capability", "outcome"}),
+		streamFrames: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mig",
+			Subsystem: "gateway",
+			Name:      "stream_frames_total",
+			Help:      "Frames relayed to callers of streaming invocations, by frame kind.",
+		}, []string{"capability", "kind"}),
+		schemaErrors: factory.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "mig",
+			Subsystem: "gateway",
+			Name:      "schema_violations_total",
+			Help:      "INVOKE payloads that did not match the capability input schema, by validation mode.",
+		}, []string{"capability", "mode"}),
 	}
 }
 
@@ -82,6 +173,76 @@ func (m *Metrics) DecActiveStream(streamType string) {
 	m.activeStreams.WithLabelValues(streamType).Dec()
 }
 
+func (m *Metrics) SetPoolEndpoint(capability, endpoint string, healthy bool, inFlight int64) {
+	value := 0.0
+	if healthy {
+		value = 1
+	}
+	m.poolHealthy.WithLabelValues(capability, endpoint).Set(value)
+	m.poolInFlight.WithLabelValues(capability, endpoint).Set(float64(inFlight))
+}
+
+func (m *Metrics) DeletePoolEndpoint(capability, endpoint string) {
+	m.poolHealthy.DeleteLabelValues(capability, endpoint)
+	m.poolInFlight.DeleteLabelValues(capability, endpoint)
+}
+
+func (m *Metrics) SetBreakerState(capability, endpoint, state string) {
+	value := 0.0
+	switch state {
+	case BreakerHalfOpen:
+		value = 1
+	case BreakerOpen:
+		value = 2
+	}
+	m.breakerState.WithLabelValues(capability, endpoint).Set(value)
+}
+
+func (m *Metrics) RecordBreakerTransition(capability, endpoint, from, to string) {
+	m.breakerTrips.WithLabelValues(capability, endpoint, from, to).Inc()
+	m.SetBreakerState(capability, endpoint, to)
+}
+
+func (m *Metrics) DeleteBreaker(capability, endpoint string) {
+	m.breakerState.DeleteLabelValues(capability, endpoint)
+}
+
+func (m *Metrics) RecordAttempt(capability, outcome string) {
+	m.invokeAttempts.WithLabelValues(capability, outcome).Inc()
+}
+
+func (m *Metrics) RecordRetry(capability, code string) {
+	m.invokeRetries.WithLabelValues(capability, code).Inc()
+}
+
+func (m *Metrics) RecordHedge(capability string) {
+	m.hedgeRequests.WithLabelValues(capability).Inc()
+}
+
+func (m *Metrics) RecordHedgeWin(capability, winner string) {
+	m.hedgeWins.WithLabelValues(capability, winner).Inc()
+}
+
+func (m *Metrics) RecordCanaryRoute(capability, arm, version string) {
+	m.canaryRouted.WithLabelValues(capability, arm, version).Inc()
+}
+
+func (m *Metrics) RecordCanaryRollback(capability string) {
+	m.canaryRollback.WithLabelValues(capability).Inc()
+}
+
+func (m *Metrics) RecordShadow(capability, outcome string) {
+	m.shadowRequests.WithLabelValues(capability, outcome).Inc()
+}
+
+func (m *Metrics) RecordStreamFrame(capability, kind string) {
+	m.streamFrames.WithLabelValues(capability, kind).Inc()
+}
+
+func (m *Metrics) RecordSchemaViolation(capability, mode string) {
+	m.schemaErrors.WithLabelValues(capability, mode).Inc()
+}
+
 type statusRecorder struct {
 	http.ResponseWriter
 	status int
@@ -156,7 +156,8 @@ func (b *NATSBinding) handleCancel(msg *nats.Msg) {
 	if req.TargetMessageID == "" {
 		req.TargetMessageID = messageID
 	}
-	resp, err := b.svc.Cancel(req, req.TargetMessageID)
+	principal := Principal{TenantID: req.Header.TenantID, Scopes: map[string]struct{}{}, Authenticated: false}
+	resp, err := b.svc.Cancel(req, req.TargetMessageID, "nats-client", principal)
 	if err != nil {
 		respondNATSMigError(msg, req.Header, *err)
 		return
@@ -1,6 +1,72 @@
 package mig
 
-import "testing"
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+// startNATSServer runs an in-process NATS server on a random port and returns
+// its client URL.
+func startNATSServer(t *testing.T) string {
+	t.Helper()
+	ns, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: server.RANDOM_PORT, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatalf("nats server: %v", err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server did not start")
+	}
+	t.Cleanup(ns.Shutdown)
+	return ns.ClientURL()
+}
+
+func connectNATS(t *testing.T, url string) *nats.Conn {
+	t.Helper()
+	nc, err := nats.Connect(url)
+	if err != nil {
+		t.Fatalf("connect nats: %v", err)
+	}
+	t.Cleanup(nc.Close)
+	return nc
+}
+
+// serveNATSWorker subscribes provider as a worker in the embedders queue group
+// and waits until the server has registered the subscription.
+func serveNATSWorker(t *testing.T, url string, provider Provider) {
+	t.Helper()
+	nc := connectNATS(t, url)
+	if _, err := ServeNATSWorker(nc, "acme.workers.embed", "embedders", provider); err != nil {
+		t.Fatalf("serve worker: %v", err)
+	}
+	if err := nc.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+}
+
+// newNATSService returns a service whose acme.workers.embed capability is
+// dispatched over the NATS server at url.
+func newNATSService(t *testing.T, url string) *Service {
+	t.Helper()
+	svc, err := NewServiceWithOptions(ServiceOptions{NATSURL: url})
+	if err != nil {
+		t.Fatalf("new service: %v", err)
+	}
+	t.Cleanup(svc.Close)
+	if err := svc.AddCapability(CapabilityUpsertRequest{
+		Descriptor: testDescriptor("acme.workers.embed"),
+		Provider:   &ProviderConfig{Type: ProviderTypeNATS},
+	}); err != nil {
+		t.Fatalf("add capability: %v", err.Message)
+	}
+	return svc
+}
 
 func TestStartNATSBindingRequiresConnection(t *testing.T) {
 	svc, err := NewServiceWithOptions(ServiceOptions{})
@@ -12,3 +78,105 @@ func TestStartNATSBindingRequiresConnection(t *testing.T) {
 		t.Fatal("expected error when nats connection is not configured")
 	}
 }
+
+func TestNATSProviderRequiresConnection(t *testing.T) {
+	svc := NewService()
+	err := svc.AddCapability(CapabilityUpsertRequest{
+		Descriptor: testDescriptor("acme.workers.embed"),
+		Provider:   &ProviderConfig{Type: ProviderTypeNATS},
+	})
+	if err == nil || err.Code != ErrorInvalidRequest {
+		t.Fatalf("expected nats provider without connection to be rejected, got %#v", err)
+	}
+}
+
+func TestDecodeWorkerReply(t *testing.T) {
+	payload, err := decodeWorkerReply([]byte(`{"capability":"acme.workers.embed","payload":{"vector":[1,2]}}`))
+	if err != nil {
+		t.Fatalf("decode reply: %v", err.Message)
+	}
+	if _, ok := payload["vector"]; !ok {
+		t.Fatalf("unexpected payload: %#v", payload)
+	}
+	_, err = decodeWorkerReply([]byte(`{"error":{"code":"MIG_RATE_LIMITED","message":"busy","retryable":true}}`))
+	if err == nil || err.Code != ErrorRateLimited || !err.Retryable {
+		t.Fatalf("expected worker error to pass through, got %#v", err)
+	}
+	if got := natsWorkSubject("acme", "acme.workers.embed"); got != "mig.v0_1.acme.work.acme.workers.embed" {
+		t.Fatalf("unexpected work subject: %s", got)
+	}
+}
+
+func TestNATSProviderRoundTripThroughQueueGroup(t *testing.T) {
+	url := startNATSServer(t)
+	svc := newNATSService(t, url)
+
+	var mu sync.Mutex
+	served := map[string]int{}
+	for _, name := range []string{"worker-a", "worker-b"} {
+		name := name
+		serveNATSWorker(t, url, ProviderFunc(func(_ context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+			mu.Lock()
+			served[name]++
+			mu.Unlock()
+			return map[string]interface{}{"worker": name, "text": req.Payload["text"]}, nil
+		}))
+	}
+
+	const calls = 20
+	for i := 0; i < calls; i++ {
+		resp, err := svc.Invoke(context.Background(), "acme.workers.embed", InvokeRequest{
+			Header:  MessageHeader{TenantID: "acme", DeadlineMS: 2000},
+			Payload: map[string]interface{}{"text": "hello"},
+		}, "tester", AnonymousPrincipal())
+		if err != nil {
+			t.Fatalf("invoke over nats: %v", err.Message)
+		}
+		if resp.Payload["text"] != "hello" || resp.Payload["worker"] == nil {
+			t.Fatalf("unexpected payload: %#v", resp.Payload)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if served["worker-a"]+served["worker-b"] != calls {
+		t.Fatalf("each call must be served by exactly one worker in the queue group, got %v", served)
+	}
+}
+
+func TestNATSProviderWithoutWorkersIsUnavailable(t *testing.T) {
+	svc := newNATSService(t, startNATSServer(t))
+	_, err := svc.Invoke(context.Background(), "acme.workers.embed", InvokeRequest{
+		Header: MessageHeader{TenantID: "acme", DeadlineMS: 2000},
+	}, "tester", AnonymousPrincipal())
+	if err == nil || err.Code != ErrorUnavailable || !err.Retryable {
+		t.Fatalf("expected a retryable MIG_UNAVAILABLE without responders, got %#v", err)
+	}
+}
+
+func TestNATSProviderPropagatesDeadline(t *testing.T) {
+	url := startNATSServer(t)
+	svc := newNATSService(t, url)
+
+	var headerBudget atomic.Int64
+	var ctxBudget atomic.Int64
+	serveNATSWorker(t, url, ProviderFunc(func(ctx context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+		headerBudget.Store(int64(req.Header.DeadlineMS))
+		if deadline, ok := ctx.Deadline(); ok {
+			ctxBudget.Store(time.Until(deadline).Milliseconds())
+		}
+		return map[string]interface{}{}, nil
+	}))
+
+	if _, err := svc.Invoke(context.Background(), "acme.workers.embed", InvokeRequest{
+		Header: MessageHeader{TenantID: "acme", DeadlineMS: 1500},
+	}, "tester", AnonymousPrincipal()); err != nil {
+		t.Fatalf("invoke over nats: %v", err.Message)
+	}
+	if got := headerBudget.Load(); got <= 0 || got > 1500 {
+		t.Fatalf("worker should see the remaining budget in deadline_ms, got %d", got)
+	}
+	// Mig-Deadline-Ms bounds the worker's context.
+	if got := ctxBudget.Load(); got <= 0 || got > 1500 {
+		t.Fatalf("worker context should carry the caller's deadline, got %dms", got)
+	}
+}
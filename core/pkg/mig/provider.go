@@ -0,0 +1,185 @@
+package mig
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+const (
+	ProviderTypeEcho    = "echo"
+	ProviderTypeHTTP    = "http"
+	ProviderTypeNATS    = "nats"
+	ProviderTypeProcess = "process"
+	ProviderTypePool    = "pool"
+	// ProviderTypeComposite runs a DAG of calls to other capabilities.
+	ProviderTypeComposite = "composite"
+	// ProviderTypeScatter fans each call out to several capabilities.
+	ProviderTypeScatter = "scatter"
+)
+
+// Provider executes invocations for a bound capability. The service wraps every
+// call with deadline, idempotency, quota, and audit handling, so implementations
+// only need to honour ctx cancellation and report failures as MIG errors.
+type Provider interface {
+	// Invoke performs a unary invocation and returns the response payload.
+	Invoke(ctx context.Context, req InvokeRequest) (map[string]interface{}, *MigError)
+	// InvokeStream performs a streaming invocation, calling emit once per
+	// outgoing frame. The final frame must set EndStream.
+	InvokeStream(ctx context.Context, req InvokeRequest, emit func(StreamFrame) error) *MigError
+}
+
+// ProviderFunc adapts a unary function to Provider. Streaming invocations emit
+// the unary result as a single terminal response frame.
+type ProviderFunc func(ctx context.Context, req InvokeRequest) (map[string]interface{}, *MigError)
+
+func (f ProviderFunc) Invoke(ctx context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+	return f(ctx, req)
+}
+
+func (f ProviderFunc) InvokeStream(ctx context.Context, req InvokeRequest, emit func(StreamFrame) error) *MigError {
+	return streamUnary(ctx, f, req, emit)
+}
+
+// StreamProviderFunc adapts a streaming function to Provider. Unary
+// invocations collect the stream and return the payload of its final response
+// frame.
+type StreamProviderFunc func(ctx context.Context, req InvokeRequest, emit func(StreamFrame) error) *MigError
+
+func (f StreamProviderFunc) Invoke(ctx context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+	var last map[string]interface{}
+	migErr := f(ctx, req, func(frame StreamFrame) error {
+		if frame.Kind == "" || frame.Kind == "response" {
+			last = frame.Payload
+		}
+		return nil
+	})
+	if migErr != nil {
+		return nil, migErr
+	}
+	if last == nil {
+		last = map[string]interface{}{}
+	}
+	return last, nil
+}
+
+func (f StreamProviderFunc) InvokeStream(ctx context.Context, req InvokeRequest, emit func(StreamFrame) error) *MigError {
+	return f(ctx, req, emit)
+}
+
+// streamUnary serves a streaming invocation from a unary provider call.
+func streamUnary(ctx context.Context, f ProviderFunc, req InvokeRequest, emit func(StreamFrame) error) *MigError {
+	payload, migErr := f(ctx, req)
+	if migErr != nil {
+		return migErr
+	}
+	if err := emit(StreamFrame{Kind: "response", Payload: payload, EndStream: true}); err != nil {
+		return &MigError{Code: ErrorUnavailable, Message: "stream closed: " + err.Error(), Retryable: true}
+	}
+	return nil
+}
+
+// EchoProvider returns the request payload unchanged. It backs the bootstrapped
+// demo capability and is useful for smoke-testing new descriptors.
+func EchoProvider() Provider {
+	return ProviderFunc(func(_ context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+		return map[string]interface{}{
+			"result":     "ok",
+			"echo":       req.Payload,
+			"capability": req.Capability,
+		}, nil
+	})
+}
+
+// BindProvider attaches a provider to a registered capability, replacing any
+// existing binding. capability may pin a version as "id@1.2.0"; a bare ID binds
+// the highest registered version.
+func (s *Service) BindProvider(capability string, provider Provider) *MigError {
+	if capability == "" {
+		return invalid("capability is required")
+	}
+	if provider == nil {
+		return invalid("provider is required")
+	}
+	s.mu.Lock()
+	key, _, migErr := s.resolveCapabilityLocked(capability, "")
+	if migErr != nil {
+		s.mu.Unlock()
+		return migErr
+	}
+	previous := s.providers[key]
+	s.providers[key] = provider
+	s.mu.Unlock()
+	if previous != provider {
+		closeProvider(previous)
+	}
+	return nil
+}
+
+// UnbindProvider detaches the provider from a capability. Subsequent
+// invocations fail with MIG_UNAVAILABLE until a new provider is bound.
+func (s *Service) UnbindProvider(capability string) {
+	s.mu.Lock()
+	key, _, migErr := s.resolveCapabilityLocked(capability, "")
+	if migErr != nil {
+		s.mu.Unlock()
+		return
+	}
+	previous := s.providers[key]
+	delete(s.providers, key)
+	s.mu.Unlock()
+	closeProvider(previous)
+}
+
+// closeProvider releases provider resources such as worker processes when the
+// provider implements io.Closer.
+func closeProvider(provider Provider) {
+	if closer, ok := provider.(io.Closer); ok {
+		_ = closer.Close()
+	}
+}
+
+func (s *Service) newProvider(capability string, cfg ProviderConfig) (Provider, *MigError) {
+	switch strings.ToLower(strings.TrimSpace(cfg.Type)) {
+	case ProviderTypeEcho:
+		return EchoProvider(), nil
+	case ProviderTypeHTTP:
+		if cfg.HTTP == nil {
+			return nil, invalid("provider.http is required for http providers")
+		}
+		return NewHTTPProvider(*cfg.HTTP)
+	case ProviderTypeNATS:
+		natsCfg := NATSProviderConfig{}
+		if cfg.NATS != nil {
+			natsCfg = *cfg.NATS
+		}
+		s.mu.RLock()
+		nc := s.natsConn
+		s.mu.RUnlock()
+		return NewNATSProvider(nc, natsCfg)
+	case ProviderTypeProcess:
+		if cfg.Process == nil {
+			return nil, invalid("provider.process is required for process providers")
+		}
+		return NewProcessProvider(*cfg.Process)
+	case ProviderTypePool:
+		if cfg.Pool == nil {
+			return nil, invalid("provider.pool is required for pool providers")
+		}
+		return s.newPoolProvider(capability, *cfg.Pool)
+	case ProviderTypeComposite:
+		if cfg.Composite == nil {
+			return nil, invalid("provider.composite is required for composite providers")
+		}
+		return s.newCompositeProvider(capability, *cfg.Composite)
+	case ProviderTypeScatter:
+		if cfg.Scatter == nil {
+			return nil, invalid("provider.scatter is required for scatter providers")
+		}
+		return s.newScatterProvider(capability, *cfg.Scatter)
+	case "":
+		return nil, invalid("provider.type is required")
+	default:
+		return nil, invalid("unsupported provider.type " + cfg.Type)
+	}
+}
@@ -0,0 +1,170 @@
+package mig
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPProviderConfig forwards invocations to an upstream HTTP service.
+type HTTPProviderConfig struct {
+	URL       string            `json:"url"`
+	Method    string            `json:"method,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	TimeoutMS int               `json:"timeout_ms,omitempty"`
+	// MaxResponseBytes caps the upstream response body. It defaults to
+	// defaultHTTPMaxResponseBytes.
+	MaxResponseBytes int64 `json:"max_response_bytes,omitempty"`
+}
+
+const defaultHTTPMaxResponseBytes = 8 * 1024 * 1024
+
+type httpProvider struct {
+	cfg    HTTPProviderConfig
+	client *http.Client
+}
+
+// NewHTTPProvider builds a provider that sends the invocation payload as a JSON
+// body to cfg.URL and returns the upstream JSON body as the response payload.
+func NewHTTPProvider(cfg HTTPProviderConfig) (Provider, *MigError) {
+	parsed, err := url.Parse(strings.TrimSpace(cfg.URL))
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, invalid("provider.http.url must be an absolute http(s) URL")
+	}
+	cfg.URL = parsed.String()
+	cfg.Method = strings.ToUpper(strings.TrimSpace(cfg.Method))
+	if cfg.Method == "" {
+		cfg.Method = http.MethodPost
+	}
+	if cfg.TimeoutMS < 0 {
+		return nil, invalid("provider.http.timeout_ms must be >= 0")
+	}
+	if cfg.MaxResponseBytes < 0 {
+		return nil, invalid("provider.http.max_response_bytes must be >= 0")
+	}
+	if cfg.MaxResponseBytes == 0 {
+		cfg.MaxResponseBytes = defaultHTTPMaxResponseBytes
+	}
+	return &httpProvider{cfg: cfg, client: &http.Client{}}, nil
+}
+
+func (p *httpProvider) Invoke(ctx context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+	if p.cfg.TimeoutMS > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(p.cfg.TimeoutMS)*time.Millisecond)
+		defer cancel()
+	}
+	body, err := json.Marshal(req.Payload)
+	if err != nil {
+		return nil, &MigError{Code: ErrorInvalidRequest, Message: "payload is not JSON encodable", Retryable: false}
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, p.cfg.Method, p.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, &MigError{Code: ErrorInternal, Message: "create upstream request: " + err.Error(), Retryable: false}
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json")
+	httpReq.Header.Set("X-MIG-Tenant-ID", req.Header.TenantID)
+	httpReq.Header.Set("X-MIG-Message-ID", req.Header.MessageID)
+	httpReq.Header.Set("X-MIG-Capability", req.Capability)
+	if req.Header.Traceparent != "" {
+		httpReq.Header.Set("Traceparent", req.Header.Traceparent)
+	}
+	if req.Header.IdempotencyKey != "" {
+		httpReq.Header.Set("Idempotency-Key", req.Header.IdempotencyKey)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		httpReq.Header.Set(DeadlineHeader, deadline.UTC().Format(time.RFC3339Nano))
+	}
+	for key, value := range p.cfg.Headers {
+		httpReq.Header.Set(key, value)
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, &MigError{Code: ErrorTimeout, Message: "upstream request timed out", Retryable: true}
+		}
+		return nil, &MigError{Code: ErrorUnavailable, Message: "upstream unreachable: " + err.Error(), Retryable: true}
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, p.cfg.MaxResponseBytes+1))
+	if err != nil {
+		return nil, &MigError{Code: ErrorUnavailable, Message: "read upstream response: " + err.Error(), Retryable: true}
+	}
+	if int64(len(raw)) > p.cfg.MaxResponseBytes {
+		return nil, &MigError{Code: ErrorInternal, Message: fmt.Sprintf("upstream response exceeds %d bytes", p.cfg.MaxResponseBytes), Retryable: false}
+	}
+	if resp.StatusCode >= 400 {
+		return nil, migErrorFromHTTPStatus(resp, raw)
+	}
+	return decodeUpstreamPayload(raw)
+}
+
+func (p *httpProvider) InvokeStream(ctx context.Context, req InvokeRequest, emit func(StreamFrame) error) *MigError {
+	return streamUnary(ctx, p.Invoke, req, emit)
+}
+
+// decodeUpstreamPayload accepts a JSON object as the payload as-is and wraps any
+// other JSON value under "result".
+func decodeUpstreamPayload(raw []byte) (map[string]interface{}, *MigError) {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return map[string]interface{}{}, nil
+	}
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, &MigError{Code: ErrorInternal, Message: "upstream returned invalid JSON", Retryable: false}
+	}
+	if payload, ok := value.(map[string]interface{}); ok {
+		return payload, nil
+	}
+	return map[string]interface{}{"result": value}, nil
+}
+
+// migErrorFromHTTPStatus maps an upstream failure onto the MIG error model. An
+// upstream that already speaks MIG error envelopes is passed through verbatim.
+func migErrorFromHTTPStatus(resp *http.Response, raw []byte) *MigError {
+	var envelope ErrorEnvelope
+	if json.Unmarshal(raw, &envelope) == nil && envelope.Error.Code != "" {
+		return &envelope.Error
+	}
+	migErr := &MigError{
+		Message: fmt.Sprintf("upstream returned HTTP %d", resp.StatusCode),
+		Details: map[string]interface{}{"upstream_status": resp.StatusCode},
+	}
+	switch resp.StatusCode {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusRequestEntityTooLarge:
+		migErr.Code = ErrorInvalidRequest
+	case http.StatusUnauthorized:
+		migErr.Code = ErrorUnauthorized
+	case http.StatusForbidden:
+		migErr.Code = ErrorForbidden
+	case http.StatusNotFound:
+		migErr.Code = ErrorNotFound
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		migErr.Code = ErrorTimeout
+		migErr.Retryable = true
+	case http.StatusTooManyRequests:
+		migErr.Code = ErrorRateLimited
+		migErr.Retryable = true
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		migErr.Code = ErrorUnavailable
+		migErr.Retryable = true
+	default:
+		migErr.Code = ErrorInternal
+	}
+	if retryAfter := strings.TrimSpace(resp.Header.Get("Retry-After")); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+			migErr.Details["retry_after_ms"] = seconds * 1000
+		}
+	}
+	return migErr
+}
@@ -0,0 +1,134 @@
+package mig
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPProviderForwardsPayload(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("unexpected method %s", r.Method)
+		}
+		if r.Header.Get("X-Api-Key") != "k1" {
+			t.Errorf("configured header not forwarded")
+		}
+		if r.Header.Get("X-MIG-Tenant-ID") != "acme" {
+			t.Errorf("tenant header not forwarded")
+		}
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"result": "scored", "input": body["input"]})
+	}))
+	defer upstream.Close()
+
+	svc := NewService()
+	if err := svc.AddCapability(CapabilityUpsertRequest{
+		Descriptor: testDescriptor("acme.models.score"),
+		Provider: &ProviderConfig{Type: ProviderTypeHTTP, HTTP: &HTTPProviderConfig{
+			URL:     upstream.URL,
+			Method:  "put",
+			Headers: map[string]string{"X-Api-Key": "k1"},
+		}},
+	}); err != nil {
+		t.Fatalf("add capability: %v", err.Message)
+	}
+	resp, err := svc.Invoke(context.Background(), "acme.models.score", InvokeRequest{
+		Header:  MessageHeader{TenantID: "acme"},
+		Payload: map[string]interface{}{"input": "hello"},
+	}, "tester", AnonymousPrincipal())
+	if err != nil {
+		t.Fatalf("invoke failed: %v", err.Message)
+	}
+	if resp.Payload["result"] != "scored" || resp.Payload["input"] != "hello" {
+		t.Fatalf("unexpected payload: %#v", resp.Payload)
+	}
+}
+
+func TestHTTPProviderMapsUpstreamStatus(t *testing.T) {
+	cases := []struct {
+		status    int
+		code      string
+		retryable bool
+	}{
+		{http.StatusBadRequest, ErrorInvalidRequest, false},
+		{http.StatusNotFound, ErrorNotFound, false},
+		{http.StatusTooManyRequests, ErrorRateLimited, true},
+		{http.StatusServiceUnavailable, ErrorUnavailable, true},
+		{http.StatusGatewayTimeout, ErrorTimeout, true},
+		{http.StatusInternalServerError, ErrorInternal, false},
+	}
+	for _, tc := range cases {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(tc.status)
+		}))
+		provider, migErr := NewHTTPProvider(HTTPProviderConfig{URL: upstream.URL})
+		if migErr != nil {
+			t.Fatalf("new provider: %v", migErr.Message)
+		}
+		_, err := provider.Invoke(context.Background(), InvokeRequest{Header: MessageHeader{TenantID: "acme"}})
+		upstream.Close()
+		if err == nil || err.Code != tc.code || err.Retryable != tc.retryable {
+			t.Fatalf("status %d: expected %s (retryable=%t), got %#v", tc.status, tc.code, tc.retryable, err)
+		}
+		if tc.status == http.StatusTooManyRequests && err.Details["retry_after_ms"] != 2000 {
+			t.Fatalf("expected retry_after_ms detail, got %#v", err.Details)
+		}
+	}
+}
+
+func TestHTTPProviderTimeout(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(500 * time.Millisecond):
+		}
+	}))
+	defer upstream.Close()
+
+	provider, migErr := NewHTTPProvider(HTTPProviderConfig{URL: upstream.URL, TimeoutMS: 50})
+	if migErr != nil {
+		t.Fatalf("new provider: %v", migErr.Message)
+	}
+	_, err := provider.Invoke(context.Background(), InvokeRequest{Header: MessageHeader{TenantID: "acme"}})
+	if err == nil || err.Code != ErrorTimeout {
+		t.Fatalf("expected %s, got %#v", ErrorTimeout, err)
+	}
+}
+
+func TestHTTPProviderLimitsResponseSize(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"text":"` + strings.Repeat("x", 1024) + `"}`))
+	}))
+	defer upstream.Close()
+
+	provider, migErr := NewHTTPProvider(HTTPProviderConfig{URL: upstream.URL, MaxResponseBytes: 512})
+	if migErr != nil {
+		t.Fatalf("new provider: %v", migErr.Message)
+	}
+	_, err := provider.Invoke(context.Background(), InvokeRequest{Header: MessageHeader{TenantID: "acme"}})
+	if err == nil || err.Code != ErrorInternal || err.Retryable {
+		t.Fatalf("expected a non-retryable %s for an oversized body, got %#v", ErrorInternal, err)
+	}
+
+	provider, _ = NewHTTPProvider(HTTPProviderConfig{URL: upstream.URL, MaxResponseBytes: 2048})
+	if _, err := provider.Invoke(context.Background(), InvokeRequest{Header: MessageHeader{TenantID: "acme"}}); err != nil {
+		t.Fatalf("a body within the limit should pass: %v", err.Message)
+	}
+	if _, err := NewHTTPProvider(HTTPProviderConfig{URL: upstream.URL, MaxResponseBytes: -1}); err == nil {
+		t.Fatal("expected a negative limit to be rejected")
+	}
+}
+
+func TestHTTPProviderRejectsRelativeURL(t *testing.T) {
+	if _, err := NewHTTPProvider(HTTPProviderConfig{URL: "/score"}); err == nil {
+		t.Fatal("expected relative url to be rejected")
+	}
+}
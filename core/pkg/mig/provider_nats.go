@@ -0,0 +1,139 @@
+package mig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATSProviderConfig dispatches invocations to worker processes listening on
+// mig.v0_1.<tenant>.work.<capability> in a NATS queue group.
+type NATSProviderConfig struct {
+	WorkSubject string `json:"work_subject,omitempty"`
+	TimeoutMS   int    `json:"timeout_ms,omitempty"`
+}
+
+const natsDeadlineHeader = "Mig-Deadline-Ms"
+
+type natsProvider struct {
+	nc  *nats.Conn
+	cfg NATSProviderConfig
+}
+
+// NewNATSProvider builds a provider that sends each invocation as a NATS
+// request. The first worker in the queue group to reply serves the call.
+func NewNATSProvider(nc *nats.Conn, cfg NATSProviderConfig) (Provider, *MigError) {
+	if nc == nil {
+		return nil, invalid("nats providers require MIGD_NATS_URL to be configured")
+	}
+	if cfg.TimeoutMS < 0 {
+		return nil, invalid("provider.nats.timeout_ms must be >= 0")
+	}
+	cfg.WorkSubject = strings.TrimSpace(cfg.WorkSubject)
+	return &natsProvider{nc: nc, cfg: cfg}, nil
+}
+
+func natsWorkSubject(tenantID, capability string) string {
+	return fmt.Sprintf("mig.v0_1.%s.work.%s", sanitizeNATSSegment(tenantID), sanitizeNATSSubject(capability))
+}
+
+func (p *natsProvider) Invoke(ctx context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+	if p.cfg.TimeoutMS > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(p.cfg.TimeoutMS)*time.Millisecond)
+		defer cancel()
+	}
+	target := req.Capability
+	if p.cfg.WorkSubject != "" {
+		target = p.cfg.WorkSubject
+	}
+	req.Header.DeadlineMS = remainingMS(ctx, req.Header.DeadlineMS)
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, &MigError{Code: ErrorInvalidRequest, Message: "payload is not JSON encodable", Retryable: false}
+	}
+	msg := nats.NewMsg(natsWorkSubject(req.Header.TenantID, target))
+	msg.Data = body
+	msg.Header.Set("Mig-Message-Id", req.Header.MessageID)
+	if req.Header.Traceparent != "" {
+		msg.Header.Set("Traceparent", req.Header.Traceparent)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		msg.Header.Set(natsDeadlineHeader, strconv.FormatInt(time.Until(deadline).Milliseconds(), 10))
+	}
+
+	reply, err := p.nc.RequestMsgWithContext(ctx, msg)
+	if err != nil {
+		switch {
+		case errors.Is(err, nats.ErrNoResponders):
+			return nil, &MigError{Code: ErrorUnavailable, Message: "no workers are serving " + target, Retryable: true}
+		case errors.Is(err, context.DeadlineExceeded), errors.Is(err, nats.ErrTimeout):
+			return nil, &MigError{Code: ErrorTimeout, Message: "worker did not reply before the deadline", Retryable: true}
+		default:
+			return nil, &MigError{Code: ErrorUnavailable, Message: "nats request failed: " + err.Error(), Retryable: true}
+		}
+	}
+	return decodeWorkerReply(reply.Data)
+}
+
+func (p *natsProvider) InvokeStream(ctx context.Context, req InvokeRequest, emit func(StreamFrame) error) *MigError {
+	return streamUnary(ctx, p.Invoke, req, emit)
+}
+
+// decodeWorkerReply accepts either an InvokeResponse or an ErrorEnvelope.
+func decodeWorkerReply(data []byte) (map[string]interface{}, *MigError) {
+	var reply struct {
+		Payload map[string]interface{} `json:"payload"`
+		Error   *MigError              `json:"error"`
+	}
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return nil, &MigError{Code: ErrorInternal, Message: "worker returned invalid JSON", Retryable: false}
+	}
+	if reply.Error != nil && reply.Error.Code != "" {
+		return nil, reply.Error
+	}
+	if reply.Payload == nil {
+		reply.Payload = map[string]interface{}{}
+	}
+	return reply.Payload, nil
+}
+
+// ServeNATSWorker subscribes provider to the work subject for capability in
+// the given queue group, so any number of worker processes can share the load.
+// Replies are InvokeResponse or ErrorEnvelope JSON documents.
+func ServeNATSWorker(nc *nats.Conn, capability, queue string, provider Provider) (*nats.Subscription, error) {
+	if nc == nil {
+		return nil, fmt.Errorf("nats connection is required")
+	}
+	if capability == "" || queue == "" {
+		return nil, fmt.Errorf("capability and queue are required")
+	}
+	subject := "mig.v0_1.*.work." + sanitizeNATSSubject(capability)
+	return nc.QueueSubscribe(subject, queue, func(msg *nats.Msg) {
+		var req InvokeRequest
+		if !decodeNATS(msg, &req) {
+			respondNATSError(msg, ErrorInvalidRequest, "invalid invoke request")
+			return
+		}
+		ctx := context.Background()
+		if raw := msg.Header.Get(natsDeadlineHeader); raw != "" {
+			if ms, err := strconv.ParseInt(raw, 10, 64); err == nil && ms > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, time.Duration(ms)*time.Millisecond)
+				defer cancel()
+			}
+		}
+		payload, migErr := provider.Invoke(ctx, req)
+		if migErr != nil {
+			respondNATSMigError(msg, req.Header, *migErr)
+			return
+		}
+		respondNATS(msg, InvokeResponse{Header: req.Header, Capability: req.Capability, Payload: payload})
+	})
+}
@@ -0,0 +1,494 @@
+package mig
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	PoolStrategyRoundRobin     = "round_robin"
+	PoolStrategyLeastInFlight  = "least_inflight"
+	PoolStrategyWeighted       = "weighted"
+	PoolStrategyConsistentHash = "consistent_hash"
+
+	PoolHashKeySession     = "session_id"
+	PoolHashKeyIdempotency = "idempotency_key"
+
+	defaultHealthIntervalMS       = 10000
+	defaultHealthTimeoutMS        = 2000
+	defaultHealthUnhealthyAfter   = 3
+	defaultHealthHealthyAfter     = 2
+	defaultPoolEndpointNamePrefix = "endpoint-"
+)
+
+// PoolProviderConfig spreads a capability across several provider endpoints.
+type PoolProviderConfig struct {
+	// Strategy is one of round_robin (default), least_inflight, weighted, or
+	// consistent_hash.
+	Strategy string `json:"strategy,omitempty"`
+	// HashKey selects the header field hashed by consistent_hash: session_id
+	// (default) or idempotency_key. Calls without the key fall back to
+	// round-robin.
+	HashKey     string               `json:"hash_key,omitempty"`
+	Endpoints   []PoolEndpointConfig `json:"endpoints"`
+	HealthCheck *HealthCheckConfig   `json:"health_check,omitempty"`
+}
+
+// PoolEndpointConfig is one replica in a pool. The embedded ProviderConfig
+// selects its provider type; pools cannot be nested.
+type PoolEndpointConfig struct {
+	Name   string `json:"name,omitempty"`
+	Weight int    `json:"weight,omitempty"`
+	// HealthURL is probed with GET by the active health checker. Any 2xx
+	// response counts as healthy.
+	HealthURL string `json:"health_url,omitempty"`
+	ProviderConfig
+}
+
+// HealthCheckConfig controls active probing of pool endpoints.
+type HealthCheckConfig struct {
+	IntervalMS         int `json:"interval_ms,omitempty"`
+	TimeoutMS          int `json:"timeout_ms,omitempty"`
+	UnhealthyThreshold int `json:"unhealthy_threshold,omitempty"`
+	HealthyThreshold   int `json:"healthy_threshold,omitempty"`
+}
+
+// HealthChecker is implemented by providers that can probe their own backend.
+// Pool endpoints without a health_url are probed through it when available.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// PoolStatus reports the live state of a pooled capability.
+type PoolStatus struct {
+	Strategy  string               `json:"strategy"`
+	Endpoints []PoolEndpointStatus `json:"endpoints"`
+}
+
+type PoolEndpointStatus struct {
+	Name                string `json:"name"`
+	Weight              int    `json:"weight"`
+	Healthy             bool   `json:"healthy"`
+	InFlight            int64  `json:"in_flight"`
+	ConsecutiveFailures int    `json:"consecutive_failures,omitempty"`
+	LastCheck           string `json:"last_check,omitempty"`
+	LastError           string `json:"last_error,omitempty"`
+}
+
+type poolEndpoint struct {
+	name     string
+	weight   int
+	provider Provider
+	check    func(ctx context.Context) error
+	breaker  *circuitBreaker
+	inFlight atomic.Int64
+
+	// Guarded by poolProvider.mu.
+	healthy   bool
+	failures  int
+	successes int
+	current   int
+	lastCheck time.Time
+	lastError string
+}
+
+type poolProvider struct {
+	svc        *Service
+	capability string
+	strategy   string
+	hashKey    string
+	health     HealthCheckConfig
+	endpoints  []*poolEndpoint
+	hedge      *hedgePolicy
+
+	next atomic.Uint64
+	mu   sync.Mutex
+	stop chan struct{}
+	once sync.Once
+}
+
+func (s *Service) newPoolProvider(capability string, cfg PoolProviderConfig) (Provider, *MigError) {
+	strategy := strings.ToLower(strings.TrimSpace(cfg.Strategy))
+	switch strategy {
+	case "":
+		strategy = PoolStrategyRoundRobin
+	case PoolStrategyRoundRobin, PoolStrategyLeastInFlight, PoolStrategyWeighted, PoolStrategyConsistentHash:
+	default:
+		return nil, invalid("unsupported provider.pool.strategy " + cfg.Strategy)
+	}
+	hashKey := strings.ToLower(strings.TrimSpace(cfg.HashKey))
+	switch hashKey {
+	case "":
+		hashKey = PoolHashKeySession
+	case PoolHashKeySession, PoolHashKeyIdempotency:
+	default:
+		return nil, invalid("unsupported provider.pool.hash_key " + cfg.HashKey)
+	}
+	if len(cfg.Endpoints) == 0 {
+		return nil, invalid("provider.pool.endpoints must not be empty")
+	}
+	health := HealthCheckConfig{}
+	if cfg.HealthCheck != nil {
+		health = *cfg.HealthCheck
+	}
+	if health.IntervalMS < 0 || health.TimeoutMS < 0 || health.UnhealthyThreshold < 0 || health.HealthyThreshold < 0 {
+		return nil, invalid("provider.pool.health_check values must be >= 0")
+	}
+	if health.IntervalMS == 0 {
+		health.IntervalMS = defaultHealthIntervalMS
+	}
+	if health.TimeoutMS == 0 {
+		health.TimeoutMS = defaultHealthTimeoutMS
+	}
+	if health.UnhealthyThreshold == 0 {
+		health.UnhealthyThreshold = defaultHealthUnhealthyAfter
+	}
+	if health.HealthyThreshold == 0 {
+		health.HealthyThreshold = defaultHealthHealthyAfter
+	}
+
+	p := &poolProvider{
+		svc:        s,
+		capability: capability,
+		strategy:   strategy,
+		hashKey:    hashKey,
+		health:     health,
+		stop:       make(chan struct{}),
+	}
+	seen := map[string]bool{}
+	fail := func(migErr *MigError) (Provider, *MigError) {
+		for _, ep := range p.endpoints {
+			closeProvider(ep.provider)
+		}
+		return nil, migErr
+	}
+	for i, epCfg := range cfg.Endpoints {
+		if strings.EqualFold(strings.TrimSpace(epCfg.Type), ProviderTypePool) {
+			return fail(invalid("provider.pool endpoints cannot be pools"))
+		}
+		if epCfg.Weight < 0 {
+			return fail(invalid("provider.pool.endpoints weight must be >= 0"))
+		}
+		name := strings.TrimSpace(epCfg.Name)
+		if name == "" {
+			name = defaultEndpointName(epCfg, i)
+		}
+		if seen[name] {
+			return fail(invalid("duplicate provider.pool endpoint name " + name))
+		}
+		seen[name] = true
+		provider, migErr := s.newProvider(capability, epCfg.ProviderConfig)
+		if migErr != nil {
+			return fail(migErr)
+		}
+		ep := &poolEndpoint{name: name, weight: epCfg.Weight, provider: provider, healthy: true}
+		if ep.weight == 0 {
+			ep.weight = 1
+		}
+		switch {
+		case epCfg.HealthURL != "":
+			parsed, err := url.Parse(epCfg.HealthURL)
+			if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+				closeProvider(provider)
+				return fail(invalid("provider.pool.endpoints health_url must be an absolute http(s) URL"))
+			}
+			ep.check = httpHealthCheck(parsed.String())
+		default:
+			if checker, ok := provider.(HealthChecker); ok {
+				ep.check = checker.CheckHealth
+			}
+		}
+		p.endpoints = append(p.endpoints, ep)
+	}
+	for _, ep := range p.endpoints {
+		p.publishMetrics(ep)
+	}
+	go p.healthLoop()
+	return p, nil
+}
+
+func defaultEndpointName(cfg PoolEndpointConfig, index int) string {
+	if cfg.HTTP != nil {
+		if parsed, err := url.Parse(cfg.HTTP.URL); err == nil && parsed.Host != "" {
+			return parsed.Host
+		}
+	}
+	return fmt.Sprintf("%s%d", defaultPoolEndpointNamePrefix, index)
+}
+
+func httpHealthCheck(target string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("health check returned HTTP %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+func (p *poolProvider) Invoke(ctx context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+	if p.hedge != nil {
+		return p.invokeHedged(ctx, req)
+	}
+	var payload map[string]interface{}
+	migErr := p.dispatch(ctx, req, func(ep *poolEndpoint) *MigError {
+		var err *MigError
+		payload, err = ep.provider.Invoke(ctx, req)
+		return err
+	})
+	return payload, migErr
+}
+
+func (p *poolProvider) InvokeStream(ctx context.Context, req InvokeRequest, emit func(StreamFrame) error) *MigError {
+	return p.dispatch(ctx, req, func(ep *poolEndpoint) *MigError {
+		return ep.provider.InvokeStream(ctx, req, emit)
+	})
+}
+
+func (p *poolProvider) dispatch(ctx context.Context, req InvokeRequest, call func(ep *poolEndpoint) *MigError) *MigError {
+	ep, migErr := p.pick(req, nil)
+	if migErr != nil {
+		return migErr
+	}
+	return p.callEndpoint(ctx, ep, call)
+}
+
+// callEndpoint runs one call against ep behind its circuit breaker.
+func (p *poolProvider) callEndpoint(ctx context.Context, ep *poolEndpoint, call func(ep *poolEndpoint) *MigError) *MigError {
+	if ep.breaker != nil {
+		if migErr := ep.breaker.allow(); migErr != nil {
+			return migErr
+		}
+	}
+	p.acquire(ep)
+	defer p.release(ep)
+	migErr := call(ep)
+	if ep.breaker != nil {
+		ep.breaker.record(ctx, migErr)
+	}
+	return migErr
+}
+
+// Close stops health probing and closes every endpoint provider.
+func (p *poolProvider) Close() error {
+	p.once.Do(func() {
+		close(p.stop)
+		for _, ep := range p.endpoints {
+			closeProvider(ep.provider)
+			if ep.breaker != nil {
+				ep.breaker.close()
+			}
+			if metrics := p.svc.metricsSnapshot(); metrics != nil {
+				metrics.DeletePoolEndpoint(p.capability, ep.name)
+			}
+		}
+	})
+	return nil
+}
+
+func (p *poolProvider) acquire(ep *poolEndpoint) {
+	ep.inFlight.Add(1)
+	p.publishMetrics(ep)
+}
+
+func (p *poolProvider) release(ep *poolEndpoint) {
+	ep.inFlight.Add(-1)
+	p.publishMetrics(ep)
+}
+
+// pick selects a healthy endpoint with a closed (or cooled-down) breaker
+// according to the pool strategy, skipping endpoints in exclude.
+func (p *poolProvider) pick(req InvokeRequest, exclude map[*poolEndpoint]bool) (*poolEndpoint, *MigError) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	healthy := make([]*poolEndpoint, 0, len(p.endpoints))
+	var tripped *circuitBreaker
+	for _, ep := range p.endpoints {
+		if !ep.healthy || exclude[ep] {
+			continue
+		}
+		if ep.breaker != nil && !ep.breaker.available(now) {
+			if tripped == nil || ep.breaker.retryAfter(now) < tripped.retryAfter(now) {
+				tripped = ep.breaker
+			}
+			continue
+		}
+		healthy = append(healthy, ep)
+	}
+	if len(healthy) == 0 {
+		if tripped != nil {
+			return nil, tripped.openError(tripped.retryAfter(now))
+		}
+		return nil, &MigError{Code: ErrorUnavailable, Message: "no healthy endpoints for " + p.capability, Retryable: true}
+	}
+
+	switch p.strategy {
+	case PoolStrategyLeastInFlight:
+		offset := int(p.next.Add(1) % uint64(len(healthy)))
+		best := healthy[offset]
+		for i := 1; i < len(healthy); i++ {
+			candidate := healthy[(offset+i)%len(healthy)]
+			if candidate.inFlight.Load() < best.inFlight.Load() {
+				best = candidate
+			}
+		}
+		return best, nil
+	case PoolStrategyWeighted:
+		// Smooth weighted round-robin: spreads picks evenly in proportion to
+		// weight instead of sending bursts to the heaviest endpoint.
+		total := 0
+		var best *poolEndpoint
+		for _, ep := range healthy {
+			ep.current += ep.weight
+			total += ep.weight
+			if best == nil || ep.current > best.current {
+				best = ep
+			}
+		}
+		best.current -= total
+		return best, nil
+	case PoolStrategyConsistentHash:
+		key := req.Header.SessionID
+		if p.hashKey == PoolHashKeyIdempotency {
+			key = req.Header.IdempotencyKey
+		}
+		if key != "" {
+			// Rendezvous hashing keeps a key on the same endpoint and only moves
+			// the keys of endpoints that leave the healthy set.
+			var best *poolEndpoint
+			var bestScore uint64
+			for _, ep := range healthy {
+				h := fnv.New64a()
+				_, _ = h.Write([]byte(ep.name + "/" + key))
+				if score := h.Sum64(); best == nil || score > bestScore {
+					best, bestScore = ep, score
+				}
+			}
+			return best, nil
+		}
+	}
+	return healthy[p.next.Add(1)%uint64(len(healthy))], nil
+}
+
+func (p *poolProvider) healthLoop() {
+	ticker := time.NewTicker(time.Duration(p.health.IntervalMS) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.probeAll()
+		}
+	}
+}
+
+func (p *poolProvider) probeAll() {
+	var wg sync.WaitGroup
+	for _, ep := range p.endpoints {
+		if ep.check == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(ep *poolEndpoint) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(p.health.TimeoutMS)*time.Millisecond)
+			err := ep.check(ctx)
+			cancel()
+			p.recordProbe(ep, err)
+		}(ep)
+	}
+	wg.Wait()
+}
+
+// recordProbe applies one probe result. An endpoint leaves the pool after
+// UnhealthyThreshold consecutive failures and rejoins after HealthyThreshold
+// consecutive successes.
+func (p *poolProvider) recordProbe(ep *poolEndpoint, err error) {
+	p.mu.Lock()
+	ep.lastCheck = time.Now().UTC()
+	if err != nil {
+		ep.failures++
+		ep.successes = 0
+		ep.lastError = err.Error()
+		if ep.healthy && ep.failures >= p.health.UnhealthyThreshold {
+			ep.healthy = false
+			ep.current = 0
+		}
+	} else {
+		ep.successes++
+		ep.failures = 0
+		ep.lastError = ""
+		if !ep.healthy && ep.successes >= p.health.HealthyThreshold {
+			ep.healthy = true
+		}
+	}
+	p.mu.Unlock()
+	p.publishMetrics(ep)
+}
+
+func (p *poolProvider) publishMetrics(ep *poolEndpoint) {
+	metrics := p.svc.metricsSnapshot()
+	if metrics == nil {
+		return
+	}
+	p.mu.Lock()
+	healthy := ep.healthy
+	p.mu.Unlock()
+	metrics.SetPoolEndpoint(p.capability, ep.name, healthy, ep.inFlight.Load())
+}
+
+func (p *poolProvider) status() PoolStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := PoolStatus{Strategy: p.strategy, Endpoints: make([]PoolEndpointStatus, 0, len(p.endpoints))}
+	for _, ep := range p.endpoints {
+		st := PoolEndpointStatus{
+			Name:                ep.name,
+			Weight:              ep.weight,
+			Healthy:             ep.healthy,
+			InFlight:            ep.inFlight.Load(),
+			ConsecutiveFailures: ep.failures,
+			LastError:           ep.lastError,
+		}
+		if !ep.lastCheck.IsZero() {
+			st.LastCheck = ep.lastCheck.Format(time.RFC3339)
+		}
+		out.Endpoints = append(out.Endpoints, st)
+	}
+	return out
+}
+
+// ProviderPools returns the endpoint state of every pooled capability keyed by
+// capability ID and version ("id@version").
+func (s *Service) ProviderPools() map[string]PoolStatus {
+	s.mu.RLock()
+	pools := map[string]*poolProvider{}
+	for capability, provider := range s.providers {
+		if pool, ok := provider.(*poolProvider); ok {
+			pools[capability] = pool
+		}
+	}
+	s.mu.RUnlock()
+	out := make(map[string]PoolStatus, len(pools))
+	for capability, pool := range pools {
+		out[capability] = pool.status()
+	}
+	return out
+}
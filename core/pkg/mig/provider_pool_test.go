@@ -0,0 +1,150 @@
+package mig
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func poolBackend(t *testing.T, name string, healthy *atomic.Bool) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			if healthy != nil && !healthy.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"backend":"` + name + `"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func invokeBackend(t *testing.T, svc *Service, capability string, head MessageHeader) string {
+	t.Helper()
+	if head.TenantID == "" {
+		head.TenantID = "acme"
+	}
+	resp, err := svc.Invoke(context.Background(), capability, InvokeRequest{Header: head}, "tester", AnonymousPrincipal())
+	if err != nil {
+		t.Fatalf("invoke %s: %s %s", capability, err.Code, err.Message)
+	}
+	name, _ := resp.Payload["backend"].(string)
+	return name
+}
+
+func TestPoolProviderStrategies(t *testing.T) {
+	a := poolBackend(t, "a", nil)
+	b := poolBackend(t, "b", nil)
+	endpoints := []PoolEndpointConfig{
+		{Name: "a", Weight: 3, ProviderConfig: ProviderConfig{Type: ProviderTypeHTTP, HTTP: &HTTPProviderConfig{URL: a.URL}}},
+		{Name: "b", Weight: 1, ProviderConfig: ProviderConfig{Type: ProviderTypeHTTP, HTTP: &HTTPProviderConfig{URL: b.URL}}},
+	}
+
+	svc := NewService()
+	defer svc.Close()
+	for _, strategy := range []string{PoolStrategyRoundRobin, PoolStrategyWeighted, PoolStrategyConsistentHash} {
+		if err := svc.AddCapability(CapabilityUpsertRequest{
+			Descriptor: testDescriptor("acme.pool." + strategy),
+			Provider:   &ProviderConfig{Type: ProviderTypePool, Pool: &PoolProviderConfig{Strategy: strategy, Endpoints: endpoints}},
+		}); err != nil {
+			t.Fatalf("add %s pool: %v", strategy, err.Message)
+		}
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 4; i++ {
+		counts[invokeBackend(t, svc, "acme.pool.round_robin", MessageHeader{})]++
+	}
+	if counts["a"] != 2 || counts["b"] != 2 {
+		t.Fatalf("expected even round-robin split, got %#v", counts)
+	}
+
+	counts = map[string]int{}
+	for i := 0; i < 8; i++ {
+		counts[invokeBackend(t, svc, "acme.pool.weighted", MessageHeader{})]++
+	}
+	if counts["a"] != 6 || counts["b"] != 2 {
+		t.Fatalf("expected 3:1 weighted split, got %#v", counts)
+	}
+
+	first := invokeBackend(t, svc, "acme.pool.consistent_hash", MessageHeader{SessionID: "session-42"})
+	for i := 0; i < 5; i++ {
+		if got := invokeBackend(t, svc, "acme.pool.consistent_hash", MessageHeader{SessionID: "session-42"}); got != first {
+			t.Fatalf("expected session to stick to %s, got %s", first, got)
+		}
+	}
+}
+
+func TestPoolProviderHealthChecks(t *testing.T) {
+	var bHealthy atomic.Bool
+	bHealthy.Store(true)
+	a := poolBackend(t, "a", nil)
+	b := poolBackend(t, "b", &bHealthy)
+
+	svc := NewService()
+	defer svc.Close()
+	if err := svc.AddCapability(CapabilityUpsertRequest{
+		Descriptor: testDescriptor("acme.pool.checked"),
+		Provider: &ProviderConfig{Type: ProviderTypePool, Pool: &PoolProviderConfig{
+			Endpoints: []PoolEndpointConfig{
+				{Name: "a", HealthURL: a.URL + "/healthz", ProviderConfig: ProviderConfig{Type: ProviderTypeHTTP, HTTP: &HTTPProviderConfig{URL: a.URL}}},
+				{Name: "b", HealthURL: b.URL + "/healthz", ProviderConfig: ProviderConfig{Type: ProviderTypeHTTP, HTTP: &HTTPProviderConfig{URL: b.URL}}},
+			},
+			HealthCheck: &HealthCheckConfig{IntervalMS: 10, UnhealthyThreshold: 2, HealthyThreshold: 1},
+		}},
+	}); err != nil {
+		t.Fatalf("add pool: %v", err.Message)
+	}
+
+	endpointHealthy := func(name string) bool {
+		for _, ep := range svc.ProviderPools()["acme.pool.checked@1.0.0"].Endpoints {
+			if ep.Name == name {
+				return ep.Healthy
+			}
+		}
+		t.Fatalf("endpoint %s missing from pool status", name)
+		return false
+	}
+
+	bHealthy.Store(false)
+	waitFor(t, func() bool { return !endpointHealthy("b") }, "expected b to be marked unhealthy")
+	for i := 0; i < 4; i++ {
+		if got := invokeBackend(t, svc, "acme.pool.checked", MessageHeader{}); got != "a" {
+			t.Fatalf("expected unhealthy endpoint to be skipped, got %s", got)
+		}
+	}
+
+	bHealthy.Store(true)
+	waitFor(t, func() bool { return endpointHealthy("b") }, "expected b to rejoin the pool")
+}
+
+func TestPoolProviderConfigValidation(t *testing.T) {
+	svc := NewService()
+	defer svc.Close()
+	cases := []PoolProviderConfig{
+		{},
+		{Strategy: "random", Endpoints: []PoolEndpointConfig{{ProviderConfig: ProviderConfig{Type: ProviderTypeEcho}}}},
+		{Endpoints: []PoolEndpointConfig{{ProviderConfig: ProviderConfig{Type: ProviderTypePool}}}},
+		{Endpoints: []PoolEndpointConfig{
+			{Name: "dup", ProviderConfig: ProviderConfig{Type: ProviderTypeEcho}},
+			{Name: "dup", ProviderConfig: ProviderConfig{Type: ProviderTypeEcho}},
+		}},
+	}
+	for i, cfg := range cases {
+		cfg := cfg
+		err := svc.AddCapability(CapabilityUpsertRequest{
+			Descriptor: testDescriptor("acme.pool.invalid"),
+			Provider:   &ProviderConfig{Type: ProviderTypePool, Pool: &cfg},
+		})
+		if err == nil || err.Code != ErrorInvalidRequest {
+			t.Fatalf("case %d: expected invalid request, got %#v", i, err)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package mig
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// ProcessProviderConfig launches a long-lived worker command that exchanges
+// newline-delimited JSON over stdin/stdout: one InvokeRequest per line in, and
+// InvokeResponse, StreamFrame, or ErrorEnvelope lines out. Every reply line
+// echoes the request's header.message_id.
+type ProcessProviderConfig struct {
+	Command  string            `json:"command"`
+	Args     []string          `json:"args,omitempty"`
+	Env      map[string]string `json:"env,omitempty"`
+	Dir      string            `json:"dir,omitempty"`
+	PoolSize int               `json:"pool_size,omitempty"`
+}
+
+const maxProcessLineBytes = 8 * 1024 * 1024
+
+type processProvider struct {
+	cfg   ProcessProviderConfig
+	slots chan *processWorker
+
+	mu      sync.Mutex
+	closed  bool
+	workers map[*processWorker]struct{}
+}
+
+type processWorker struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines chan []byte
+}
+
+// NewProcessProvider builds a provider backed by a pool of worker processes.
+// Workers are started on first use and restarted after crashes or kills.
+func NewProcessProvider(cfg ProcessProviderConfig) (Provider, *MigError) {
+	cfg.Command = strings.TrimSpace(cfg.Command)
+	if cfg.Command == "" {
+		return nil, invalid("provider.process.command is required")
+	}
+	if cfg.PoolSize < 0 {
+		return nil, invalid("provider.process.pool_size must be >= 0")
+	}
+	if cfg.PoolSize == 0 {
+		cfg.PoolSize = 1
+	}
+	p := &processProvider{
+		cfg:     cfg,
+		slots:   make(chan *processWorker, cfg.PoolSize),
+		workers: map[*processWorker]struct{}{},
+	}
+	for i := 0; i < cfg.PoolSize; i++ {
+		p.slots <- nil
+	}
+	return p, nil
+}
+
+func (p *processProvider) Invoke(ctx context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+	return p.roundTrip(ctx, req, nil)
+}
+
+func (p *processProvider) InvokeStream(ctx context.Context, req InvokeRequest, emit func(StreamFrame) error) *MigError {
+	_, migErr := p.roundTrip(ctx, req, emit)
+	return migErr
+}
+
+// Close terminates every worker process. Invocations after Close fail with
+// MIG_UNAVAILABLE.
+func (p *processProvider) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	workers := p.workers
+	p.workers = map[*processWorker]struct{}{}
+	p.mu.Unlock()
+	for w := range workers {
+		w.kill()
+	}
+	return nil
+}
+
+func (p *processProvider) roundTrip(ctx context.Context, req InvokeRequest, emit func(StreamFrame) error) (map[string]interface{}, *MigError) {
+	var w *processWorker
+	select {
+	case w = <-p.slots:
+	case <-ctx.Done():
+		return nil, &MigError{Code: ErrorTimeout, Message: "no process worker became available before the deadline", Retryable: true}
+	}
+	healthy := false
+	defer func() {
+		// A worker that failed mid-request may still be busy with it and
+		// deliver a stale reply later; kill it so the slot is restarted clean.
+		if !healthy && w != nil {
+			p.discard(w)
+			w = nil
+		}
+		p.slots <- w
+	}()
+
+	if w == nil {
+		started, err := p.start()
+		if err != nil {
+			return nil, &MigError{Code: ErrorUnavailable, Message: "start process worker: " + err.Error(), Retryable: true}
+		}
+		w = started
+	}
+
+	// Waiting for a worker used up part of the budget.
+	req.Header.DeadlineMS = remainingMS(ctx, req.Header.DeadlineMS)
+	if req.Header.MessageID == "" {
+		req.Header.MessageID = newMessageID()
+	}
+	line, err := json.Marshal(req)
+	if err != nil {
+		healthy = true
+		return nil, &MigError{Code: ErrorInvalidRequest, Message: "payload is not JSON encodable", Retryable: false}
+	}
+	if migErr := w.write(ctx, append(line, '\n')); migErr != nil {
+		return nil, migErr
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, &MigError{Code: ErrorTimeout, Message: "process worker did not reply before the deadline", Retryable: true}
+		case raw, ok := <-w.lines:
+			if !ok {
+				return nil, &MigError{Code: ErrorUnavailable, Message: "process worker exited", Retryable: true}
+			}
+			frame, final, err := decodeProcessLine(raw, req.Header.MessageID)
+			if err != nil {
+				return nil, &MigError{Code: ErrorInternal, Message: err.Error(), Retryable: false}
+			}
+			if frame.Error != nil {
+				healthy = true
+				return nil, frame.Error
+			}
+			if emit != nil {
+				if err := emit(frame); err != nil {
+					return nil, &MigError{Code: ErrorUnavailable, Message: "stream closed: " + err.Error(), Retryable: true}
+				}
+			}
+			if final {
+				healthy = true
+				return frame.Payload, nil
+			}
+		}
+	}
+}
+
+// write hands one request line to the worker. A worker that stops reading
+// fills the pipe, so the write gives up at the deadline; the caller then
+// discards the worker, which unblocks the pending write.
+func (w *processWorker) write(ctx context.Context, line []byte) *MigError {
+	done := make(chan error, 1)
+	go func() {
+		_, err := w.stdin.Write(line)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return &MigError{Code: ErrorUnavailable, Message: "process worker exited", Retryable: true}
+		}
+		return nil
+	case <-ctx.Done():
+		return &MigError{Code: ErrorTimeout, Message: "process worker did not accept the request before the deadline", Retryable: true}
+	}
+}
+
+// decodeProcessLine classifies one worker output line. Lines with a kind are
+// stream frames, lines with an error are terminal failures, and anything else
+// is a terminal InvokeResponse document. Lines must carry messageID, the ID of
+// the request being served.
+func decodeProcessLine(raw []byte, messageID string) (StreamFrame, bool, error) {
+	var line struct {
+		Header    MessageHeader          `json:"header"`
+		Kind      string                 `json:"kind"`
+		Payload   map[string]interface{} `json:"payload"`
+		EndStream bool                   `json:"end_stream"`
+		Error     *MigError              `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &line); err != nil {
+		return StreamFrame{}, false, fmt.Errorf("process worker wrote invalid JSON")
+	}
+	if line.Header.MessageID != messageID {
+		return StreamFrame{}, false, fmt.Errorf("process worker replied to message %q while serving %q", line.Header.MessageID, messageID)
+	}
+	if line.Error != nil && line.Error.Code != "" {
+		return StreamFrame{Kind: "error", Error: line.Error, EndStream: true}, true, nil
+	}
+	if line.Payload == nil {
+		line.Payload = map[string]interface{}{}
+	}
+	if line.Kind == "" {
+		return StreamFrame{Kind: "response", Payload: line.Payload, EndStream: true}, true, nil
+	}
+	return StreamFrame{Kind: line.Kind, Payload: line.Payload, EndStream: line.EndStream}, line.EndStream, nil
+}
+
+func (p *processProvider) start() (*processWorker, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, fmt.Errorf("provider is closed")
+	}
+	cmd := exec.Command(p.cfg.Command, p.cfg.Args...)
+	cmd.Dir = p.cfg.Dir
+	if len(p.cfg.Env) > 0 {
+		cmd.Env = os.Environ()
+		for key, value := range p.cfg.Env {
+			cmd.Env = append(cmd.Env, key+"="+value)
+		}
+	}
+	cmd.Stderr = &stderrLogger{prefix: fmt.Sprintf("process provider %s:", p.cfg.Command)}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	w := &processWorker{cmd: cmd, stdin: stdin, lines: make(chan []byte, 16)}
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), maxProcessLineBytes)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			w.lines <- append([]byte(nil), line...)
+		}
+		close(w.lines)
+		if err := cmd.Wait(); err != nil {
+			log.Printf("process provider %s: worker pid %d exited: %v", p.cfg.Command, cmd.Process.Pid, err)
+		}
+	}()
+	p.workers[w] = struct{}{}
+	return w, nil
+}
+
+func (p *processProvider) discard(w *processWorker) {
+	p.mu.Lock()
+	delete(p.workers, w)
+	p.mu.Unlock()
+	w.kill()
+}
+
+func (w *processWorker) kill() {
+	_ = w.stdin.Close()
+	if w.cmd.Process != nil {
+		_ = w.cmd.Process.Kill()
+	}
+	// Drain any buffered output so the reader goroutine can reach cmd.Wait.
+	go func() {
+		for range w.lines {
+		}
+	}()
+}
+
+// stderrLogger forwards worker stderr to the standard logger line by line.
+type stderrLogger struct {
+	prefix string
+	mu     sync.Mutex
+	buf    []byte
+}
+
+func (l *stderrLogger) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf = append(l.buf, p...)
+	for {
+		idx := bytes.IndexByte(l.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		log.Printf("%s %s", l.prefix, strings.TrimRight(string(l.buf[:idx]), "\r"))
+		l.buf = l.buf[idx+1:]
+	}
+	return len(p), nil
+}
@@ -0,0 +1,172 @@
+package mig
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestProcessProviderHelper is not a real test: it is re-executed as the worker
+// process by the tests below.
+func TestProcessProviderHelper(t *testing.T) {
+	if os.Getenv("MIG_PROCESS_PROVIDER_HELPER") != "1" {
+		t.Skip("helper process")
+	}
+	if os.Getenv("MIG_PROCESS_PROVIDER_STALL") == "1" {
+		// Never read stdin, so the gateway's writes fill the pipe.
+		time.Sleep(time.Hour)
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	out := json.NewEncoder(os.Stdout)
+	for scanner.Scan() {
+		var req InvokeRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "handling %s\n", req.Header.MessageID)
+		switch req.Payload["mode"] {
+		case "hang":
+			time.Sleep(time.Hour)
+		case "crash":
+			os.Exit(3)
+		case "fail":
+			_ = out.Encode(ErrorEnvelope{Header: req.Header, Error: MigError{Code: ErrorInvalidRequest, Message: "bad input"}})
+		case "stream":
+			_ = out.Encode(StreamFrame{Header: req.Header, Kind: "event", Payload: map[string]interface{}{"token": "a"}})
+			_ = out.Encode(StreamFrame{Header: req.Header, Kind: "response", Payload: map[string]interface{}{"token": "b"}, EndStream: true})
+		case "stale":
+			stale := req.Header
+			stale.MessageID = "earlier-request"
+			_ = out.Encode(InvokeResponse{Header: stale, Payload: map[string]interface{}{}})
+		default:
+			_ = out.Encode(InvokeResponse{Header: req.Header, Capability: req.Capability, Payload: map[string]interface{}{"pid": os.Getpid(), "input": req.Payload["input"]}})
+		}
+	}
+	os.Exit(0)
+}
+
+func newHelperProcessProvider(t *testing.T, env ...string) Provider {
+	t.Helper()
+	cfg := ProcessProviderConfig{
+		Command: os.Args[0],
+		Args:    []string{"-test.run=^TestProcessProviderHelper$"},
+		Env:     map[string]string{"MIG_PROCESS_PROVIDER_HELPER": "1"},
+	}
+	for _, key := range env {
+		cfg.Env[key] = "1"
+	}
+	provider, err := NewProcessProvider(cfg)
+	if err != nil {
+		t.Fatalf("new process provider: %v", err.Message)
+	}
+	t.Cleanup(func() { closeProvider(provider) })
+	return provider
+}
+
+func invokeProcess(provider Provider, timeout time.Duration, payload map[string]interface{}) (map[string]interface{}, *MigError) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return provider.Invoke(ctx, InvokeRequest{Header: MessageHeader{TenantID: "acme", MessageID: newMessageID()}, Payload: payload})
+}
+
+func TestProcessProviderRoundTripAndReuse(t *testing.T) {
+	provider := newHelperProcessProvider(t)
+	first, err := invokeProcess(provider, 5*time.Second, map[string]interface{}{"input": "hello"})
+	if err != nil {
+		t.Fatalf("invoke failed: %v", err.Message)
+	}
+	if first["input"] != "hello" {
+		t.Fatalf("unexpected payload: %#v", first)
+	}
+	second, err := invokeProcess(provider, 5*time.Second, map[string]interface{}{"input": "again"})
+	if err != nil {
+		t.Fatalf("invoke failed: %v", err.Message)
+	}
+	if first["pid"] != second["pid"] {
+		t.Fatalf("expected long-lived worker reuse, got pids %v and %v", first["pid"], second["pid"])
+	}
+	if _, err := invokeProcess(provider, 5*time.Second, map[string]interface{}{"mode": "fail"}); err == nil || err.Code != ErrorInvalidRequest {
+		t.Fatalf("expected worker error to pass through, got %#v", err)
+	}
+}
+
+func TestProcessProviderRestartsAfterCrashAndHang(t *testing.T) {
+	provider := newHelperProcessProvider(t)
+	before, err := invokeProcess(provider, 5*time.Second, nil)
+	if err != nil {
+		t.Fatalf("invoke failed: %v", err.Message)
+	}
+
+	if _, err := invokeProcess(provider, 5*time.Second, map[string]interface{}{"mode": "crash"}); err == nil || err.Code != ErrorUnavailable {
+		t.Fatalf("expected crash to surface %s, got %#v", ErrorUnavailable, err)
+	}
+	if _, err := invokeProcess(provider, 200*time.Millisecond, map[string]interface{}{"mode": "hang"}); err == nil || err.Code != ErrorTimeout {
+		t.Fatalf("expected hung worker to surface %s, got %#v", ErrorTimeout, err)
+	}
+
+	after, err := invokeProcess(provider, 5*time.Second, nil)
+	if err != nil {
+		t.Fatalf("invoke after restart failed: %v", err.Message)
+	}
+	if before["pid"] == after["pid"] {
+		t.Fatal("expected a fresh worker process after crash and kill")
+	}
+}
+
+func TestProcessProviderStreamsFrames(t *testing.T) {
+	provider := newHelperProcessProvider(t)
+	var frames []StreamFrame
+	err := provider.InvokeStream(context.Background(), InvokeRequest{
+		Header:  MessageHeader{TenantID: "acme"},
+		Payload: map[string]interface{}{"mode": "stream"},
+	}, func(frame StreamFrame) error {
+		frames = append(frames, frame)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("stream failed: %v", err.Message)
+	}
+	if len(frames) != 2 || frames[0].Kind != "event" || !frames[1].EndStream {
+		t.Fatalf("unexpected frames: %#v", frames)
+	}
+}
+
+func TestProcessProviderDiscardsMismatchedReplies(t *testing.T) {
+	provider := newHelperProcessProvider(t)
+	before, err := invokeProcess(provider, 5*time.Second, nil)
+	if err != nil {
+		t.Fatalf("invoke failed: %v", err.Message)
+	}
+	if _, err := invokeProcess(provider, 5*time.Second, map[string]interface{}{"mode": "stale"}); err == nil || err.Code != ErrorInternal {
+		t.Fatalf("expected a reply to another message to fail, got %#v", err)
+	}
+	after, err := invokeProcess(provider, 5*time.Second, nil)
+	if err != nil {
+		t.Fatalf("invoke after mismatch failed: %v", err.Message)
+	}
+	if before["pid"] == after["pid"] {
+		t.Fatal("expected the worker to be replaced after a mismatched reply")
+	}
+}
+
+func TestProcessProviderWriteHonoursDeadline(t *testing.T) {
+	provider := newHelperProcessProvider(t, "MIG_PROCESS_PROVIDER_STALL")
+	// Larger than any pipe buffer, so the write blocks.
+	big := strings.Repeat("x", 4*1024*1024)
+	started := time.Now()
+	if _, err := invokeProcess(provider, 200*time.Millisecond, map[string]interface{}{"input": big}); err == nil || err.Code != ErrorTimeout {
+		t.Fatalf("expected a stalled worker to surface %s, got %#v", ErrorTimeout, err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Fatalf("write should give up at the deadline, took %s", elapsed)
+	}
+	// The slot is freed for the next call.
+	if _, err := invokeProcess(provider, 200*time.Millisecond, map[string]interface{}{"input": big}); err == nil || err.Code != ErrorTimeout {
+		t.Fatalf("expected the replacement worker to time out too, got %#v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package mig
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func testDescriptor(id string) CapabilityDescriptor {
+	return CapabilityDescriptor{
+		ID:              id,
+		Version:         "1.0.0",
+		Modes:           []string{"unary"},
+		InputSchemaURI:  "schema://test/input/v1",
+		OutputSchemaURI: "schema://test/output/v1",
+	}
+}
+
+func TestInvokeDispatchesToBoundProvider(t *testing.T) {
+	svc := NewService()
+	if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: testDescriptor("acme.tools.upper")}); err != nil {
+		t.Fatalf("add capability: %v", err.Message)
+	}
+	var seen InvokeRequest
+	if err := svc.BindProvider("acme.tools.upper", ProviderFunc(func(_ context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+		seen = req
+		return map[string]interface{}{"text": "HELLO"}, nil
+	})); err != nil {
+		t.Fatalf("bind provider: %v", err.Message)
+	}
+
+	resp, err := svc.Invoke(context.Background(), "acme.tools.upper", InvokeRequest{
+		Header:  MessageHeader{TenantID: "acme"},
+		Payload: map[string]interface{}{"text": "hello"},
+	}, "tester", AnonymousPrincipal())
+	if err != nil {
+		t.Fatalf("invoke failed: %v", err.Message)
+	}
+	if resp.Payload["text"] != "HELLO" {
+		t.Fatalf("unexpected payload: %#v", resp.Payload)
+	}
+	if seen.Capability != "acme.tools.upper" || seen.Payload["text"] != "hello" {
+		t.Fatalf("provider received unexpected request: %#v", seen)
+	}
+	if got := svc.Usage().CapabilityInvocations["acme.tools.upper"]; got != 1 {
+		t.Fatalf("expected usage to be recorded, got %d", got)
+	}
+}
+
+func TestInvokeWithoutProviderIsUnavailable(t *testing.T) {
+	svc := NewService()
+	if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: testDescriptor("acme.tools.unbound")}); err != nil {
+		t.Fatalf("add capability: %v", err.Message)
+	}
+	_, err := svc.Invoke(context.Background(), "acme.tools.unbound", InvokeRequest{
+		Header: MessageHeader{TenantID: "acme"},
+	}, "tester", AnonymousPrincipal())
+	if err == nil || err.Code != ErrorUnavailable {
+		t.Fatalf("expected %s, got %#v", ErrorUnavailable, err)
+	}
+}
+
+func TestInvokeProviderDeadline(t *testing.T) {
+	svc := NewService()
+	if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: testDescriptor("acme.tools.slow")}); err != nil {
+		t.Fatalf("add capability: %v", err.Message)
+	}
+	_ = svc.BindProvider("acme.tools.slow", ProviderFunc(func(ctx context.Context, _ InvokeRequest) (map[string]interface{}, *MigError) {
+		<-ctx.Done()
+		return nil, &MigError{Code: ErrorTimeout, Message: "provider cancelled", Retryable: true}
+	}))
+
+	start := time.Now()
+	_, err := svc.Invoke(context.Background(), "acme.tools.slow", InvokeRequest{
+		Header: MessageHeader{TenantID: "acme", DeadlineMS: 50},
+	}, "tester", AnonymousPrincipal())
+	if err == nil || err.Code != ErrorTimeout {
+		t.Fatalf("expected %s, got %#v", ErrorTimeout, err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("deadline was not enforced")
+	}
+}
+
+func TestAddCapabilityWithProviderConfig(t *testing.T) {
+	svc := NewService()
+	if err := svc.AddCapability(CapabilityUpsertRequest{
+		Descriptor: testDescriptor("acme.tools.echo"),
+		Provider:   &ProviderConfig{Type: ProviderTypeEcho},
+	}); err != nil {
+		t.Fatalf("add capability: %v", err.Message)
+	}
+	resp, err := svc.Invoke(context.Background(), "acme.tools.echo", InvokeRequest{
+		Header:  MessageHeader{TenantID: "acme"},
+		Payload: map[string]interface{}{"text": "hi"},
+	}, "tester", AnonymousPrincipal())
+	if err != nil {
+		t.Fatalf("invoke failed: %v", err.Message)
+	}
+	if resp.Payload["result"] != "ok" {
+		t.Fatalf("unexpected payload: %#v", resp.Payload)
+	}
+
+	if err := svc.AddCapability(CapabilityUpsertRequest{
+		Descriptor: testDescriptor("acme.tools.bad"),
+		Provider:   &ProviderConfig{Type: "carrier-pigeon"},
+	}); err == nil || err.Code != ErrorInvalidRequest {
+		t.Fatalf("expected invalid provider type to be rejected, got %#v", err)
+	}
+}
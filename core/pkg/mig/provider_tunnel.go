@@ -0,0 +1,412 @@
+package mig
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// ProviderTunnelScope is required to register capabilities over a provider
+	// tunnel when JWT auth is enabled.
+	ProviderTunnelScope = "mig:provider"
+
+	defaultTunnelHeartbeatMS = 10000
+	// Workers choose their heartbeat interval within these bounds, so a dead
+	// worker cannot hold its capabilities for long.
+	minTunnelHeartbeatMS   = 50
+	maxTunnelHeartbeatMS   = 60000
+	tunnelMissedHeartbeats = 3
+)
+
+// tunnelSession is one connected provider worker. Invocations are pushed down
+// the socket as request frames and correlated with replies by stream ID.
+type tunnelSession struct {
+	id        string
+	tenantID  string
+	conn      *websocket.Conn
+	heartbeat time.Duration
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	pending map[string]*tunnelStream
+	owned   []string
+	done    chan struct{}
+}
+
+// tunnelStream receives the reply frames of one in-flight invocation.
+type tunnelStream struct {
+	frames chan StreamFrame
+	done   chan struct{}
+}
+
+// tunnelProvider dispatches a capability to the tunnel sessions serving it in
+// round-robin order. Tunnels belong to the tenant that opened them: only that
+// tenant's sessions may join, only its invocations are dispatched, and only
+// it discovers the capability, while a session serves it.
+type tunnelProvider struct {
+	svc        *Service
+	capability string
+	tenantID   string
+	// created is set when the tunnel announced a descriptor that was not
+	// registered before, so it is withdrawn along with the tunnel.
+	created bool
+	next    atomic.Uint64
+}
+
+// discoverableLocked reports whether tenantID may discover the capability.
+// Callers must hold s.mu.
+func (p *tunnelProvider) discoverableLocked(tenantID string) bool {
+	return p.tenantID == tenantID && len(p.svc.tunnels[p.capability]) > 0
+}
+
+func (s *Service) handleProviderConnect(w http.ResponseWriter, r *http.Request) {
+	principal := principalFromContext(r.Context())
+	if !principal.HasAnyScope([]string{ProviderTunnelScope}) {
+		writeMigError(w, MessageHeader{TenantID: tenantFromRequest(r)}, http.StatusForbidden, MigError{
+			Code:      ErrorForbidden,
+			Message:   "provider registration requires the " + ProviderTunnelScope + " scope",
+			Retryable: false,
+		})
+		return
+	}
+	conn, err := streamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	tenantID := tenantFromRequest(r)
+	if principal.TenantID != "" {
+		tenantID = principal.TenantID
+	}
+	session := &tunnelSession{
+		id:        "tunnel-" + newMessageID()[:12],
+		tenantID:  tenantID,
+		conn:      conn,
+		heartbeat: defaultTunnelHeartbeatMS * time.Millisecond,
+		pending:   map[string]*tunnelStream{},
+		done:      make(chan struct{}),
+	}
+	_, unregisterConn := s.RegisterConnection(ConnectionSnapshot{
+		ID:         session.id,
+		Protocol:   "http",
+		Kind:       "provider_tunnel",
+		TenantID:   tenantID,
+		Actor:      principal.Subject,
+		RemoteAddr: r.RemoteAddr,
+		Meta:       map[string]interface{}{"path": r.URL.Path},
+	})
+	defer unregisterConn()
+	defer s.closeTunnelSession(session)
+
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(session.heartbeat * tunnelMissedHeartbeats))
+	})
+	_ = conn.SetReadDeadline(time.Now().Add(session.heartbeat * tunnelMissedHeartbeats))
+	go session.pingLoop()
+
+	for {
+		var frame StreamFrame
+		if readErr := conn.ReadJSON(&frame); readErr != nil {
+			return
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(session.heartbeat * tunnelMissedHeartbeats))
+		if frame.Kind == "control" {
+			s.handleTunnelControl(session, frame)
+			continue
+		}
+		session.deliver(frame)
+	}
+}
+
+func (s *Service) handleTunnelControl(session *tunnelSession, frame StreamFrame) {
+	action, _ := frame.Payload["action"].(string)
+	switch strings.ToLower(strings.TrimSpace(action)) {
+	case "heartbeat":
+		_ = session.send(StreamFrame{Header: frame.Header, StreamID: frame.StreamID, Kind: "control", Payload: map[string]interface{}{"action": "heartbeat_ack"}})
+	case "register":
+		if ms, ok := frame.Payload["heartbeat_interval_ms"].(float64); ok && ms > 0 {
+			ms = min(max(ms, minTunnelHeartbeatMS), maxTunnelHeartbeatMS)
+			session.mu.Lock()
+			session.heartbeat = time.Duration(ms) * time.Millisecond
+			session.mu.Unlock()
+			_ = session.conn.SetReadDeadline(time.Now().Add(session.heartbeat * tunnelMissedHeartbeats))
+		}
+		registered, rejected := s.registerTunnelCapabilities(session, frame.Payload["capabilities"])
+		_ = session.send(StreamFrame{
+			Header:   frame.Header,
+			StreamID: frame.StreamID,
+			Kind:     "control",
+			Payload: map[string]interface{}{
+				"action":       "registered",
+				"session_id":   session.id,
+				"capabilities": registered,
+				"rejected":     rejected,
+			},
+		})
+	default:
+		session.deliver(frame)
+	}
+}
+
+// registerTunnelCapabilities binds the announced descriptors to the tunnel,
+// adding those that are not registered yet. An already registered descriptor,
+// including its auth scopes, is kept as it is. Capabilities served by a
+// non-tunnel provider or by another tenant's connected tunnel are rejected.
+func (s *Service) registerTunnelCapabilities(session *tunnelSession, raw interface{}) ([]string, map[string]interface{}) {
+	registered := []string{}
+	rejected := map[string]interface{}{}
+	var descriptors []CapabilityDescriptor
+	encoded, _ := json.Marshal(raw)
+	if err := json.Unmarshal(encoded, &descriptors); err != nil {
+		rejected["*"] = "capabilities must be a list of capability descriptors"
+		return registered, rejected
+	}
+	for _, desc := range descriptors {
+		if migErr := ValidateDescriptor(desc); migErr != nil {
+			rejected[desc.ID] = migErr.Message
+			continue
+		}
+		key := capabilityKey(desc.ID, desc.Version)
+		s.mu.Lock()
+		existing := s.providers[key]
+		provider, isTunnel := existing.(*tunnelProvider)
+		if existing != nil && !isTunnel {
+			s.mu.Unlock()
+			rejected[desc.ID] = "capability is served by another provider"
+			continue
+		}
+		if provider != nil && provider.tenantID != session.tenantID {
+			if len(s.tunnels[key]) > 0 {
+				s.mu.Unlock()
+				rejected[desc.ID] = "capability is served by another tenant's tunnel"
+				continue
+			}
+			// The previous tenant's tunnels are gone; this one takes over.
+			provider = &tunnelProvider{svc: s, capability: key, tenantID: session.tenantID, created: provider.created}
+			s.providers[key] = provider
+		}
+		if provider == nil {
+			_, registered := s.capabilities[key]
+			provider = &tunnelProvider{svc: s, capability: key, tenantID: session.tenantID, created: !registered}
+			s.providers[key] = provider
+		}
+		if provider.created {
+			s.capabilities[key] = desc
+		}
+		if !slices.Contains(s.tunnels[key], session) {
+			s.tunnels[key] = append(s.tunnels[key], session)
+		}
+		s.mu.Unlock()
+
+		session.mu.Lock()
+		if !slices.Contains(session.owned, key) {
+			session.owned = append(session.owned, key)
+		}
+		session.mu.Unlock()
+		registered = append(registered, key)
+	}
+	return registered, rejected
+}
+
+// closeTunnelSession fails in-flight invocations and withdraws capabilities
+// that no other tunnel session still serves. Descriptors the tunnel added are
+// removed. Those registered before it stay bound to the tunnel provider, which
+// hides them from DISCOVER until a worker registers again.
+func (s *Service) closeTunnelSession(session *tunnelSession) {
+	close(session.done)
+	session.mu.Lock()
+	owned := session.owned
+	session.owned = nil
+	session.mu.Unlock()
+
+	s.mu.Lock()
+	for _, capability := range owned {
+		sessions := s.tunnels[capability]
+		kept := sessions[:0]
+		for _, candidate := range sessions {
+			if candidate != session {
+				kept = append(kept, candidate)
+			}
+		}
+		if len(kept) > 0 {
+			s.tunnels[capability] = kept
+			continue
+		}
+		delete(s.tunnels, capability)
+		if provider, ok := s.providers[capability].(*tunnelProvider); ok && provider.created {
+			delete(s.providers, capability)
+			delete(s.capabilities, capability)
+		}
+	}
+	s.mu.Unlock()
+}
+
+func (t *tunnelSession) pingLoop() {
+	for {
+		t.mu.Lock()
+		interval := t.heartbeat
+		t.mu.Unlock()
+		select {
+		case <-t.done:
+			return
+		case <-time.After(interval):
+		}
+		t.writeMu.Lock()
+		err := t.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(interval))
+		t.writeMu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (t *tunnelSession) send(frame StreamFrame) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	return t.conn.WriteJSON(frame)
+}
+
+func (t *tunnelSession) deliver(frame StreamFrame) {
+	t.mu.Lock()
+	stream := t.pending[frame.StreamID]
+	t.mu.Unlock()
+	if stream == nil {
+		return
+	}
+	select {
+	case stream.frames <- frame:
+	case <-stream.done:
+	case <-t.done:
+	}
+}
+
+func (p *tunnelProvider) pick() *tunnelSession {
+	p.svc.mu.RLock()
+	defer p.svc.mu.RUnlock()
+	sessions := p.svc.tunnels[p.capability]
+	if len(sessions) == 0 {
+		return nil
+	}
+	return sessions[p.next.Add(1)%uint64(len(sessions))]
+}
+
+func (p *tunnelProvider) Invoke(ctx context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+	var final map[string]interface{}
+	migErr := p.InvokeStream(ctx, req, func(frame StreamFrame) error {
+		if frame.EndStream {
+			final = frame.Payload
+		}
+		return nil
+	})
+	if migErr != nil {
+		return nil, migErr
+	}
+	return final, nil
+}
+
+func (p *tunnelProvider) InvokeStream(ctx context.Context, req InvokeRequest, emit func(StreamFrame) error) *MigError {
+	return p.run(ctx, req, nil, emit)
+}
+
+// InvokeSession forwards each input frame down the tunnel as a request frame
+// on the same stream ID; the opening frame carries mig.stream_mode so the
+// worker knows more input follows.
+func (p *tunnelProvider) InvokeSession(ctx context.Context, req InvokeRequest, in <-chan StreamFrame, emit func(StreamFrame) error) *MigError {
+	return p.run(ctx, req, in, emit)
+}
+
+func (p *tunnelProvider) run(ctx context.Context, req InvokeRequest, in <-chan StreamFrame, emit func(StreamFrame) error) *MigError {
+	if req.Header.TenantID != p.tenantID {
+		// Answer as for an unbound capability, so other tenants learn
+		// nothing about the tunnel.
+		return &MigError{Code: ErrorUnavailable, Message: "no provider bound to capability", Retryable: true}
+	}
+	session := p.pick()
+	if session == nil {
+		return &MigError{Code: ErrorUnavailable, Message: "no provider tunnel is serving " + p.capability, Retryable: true}
+	}
+	streamID := "tunnel-" + newMessageID()
+	stream := &tunnelStream{frames: make(chan StreamFrame, 16), done: make(chan struct{})}
+	session.mu.Lock()
+	session.pending[streamID] = stream
+	session.mu.Unlock()
+	defer func() {
+		session.mu.Lock()
+		delete(session.pending, streamID)
+		session.mu.Unlock()
+		close(stream.done)
+	}()
+
+	req.Header.DeadlineMS = remainingMS(ctx, req.Header.DeadlineMS)
+	if err := session.send(StreamFrame{
+		Header:     req.Header,
+		StreamID:   streamID,
+		Capability: req.Capability,
+		Kind:       "request",
+		Payload:    req.Payload,
+	}); err != nil {
+		return &MigError{Code: ErrorUnavailable, Message: "provider tunnel closed", Retryable: true}
+	}
+
+	inputEnded := false
+	for {
+		select {
+		case <-ctx.Done():
+			_ = session.send(StreamFrame{
+				Header:   req.Header,
+				StreamID: streamID,
+				Kind:     "control",
+				Payload:  map[string]interface{}{"action": "cancel"},
+			})
+			return &MigError{Code: ErrorTimeout, Message: "provider tunnel did not reply before the deadline", Retryable: true}
+		case <-session.done:
+			return &MigError{Code: ErrorUnavailable, Message: "provider tunnel disconnected", Retryable: true}
+		case input, ok := <-in:
+			if !ok {
+				// Input ended without an EndStream frame reaching the
+				// worker (the opening frame ended it); tell it now.
+				in = nil
+				if inputEnded {
+					continue
+				}
+				input = StreamFrame{EndStream: true}
+			}
+			inputEnded = input.EndStream
+			if err := session.send(StreamFrame{
+				Header:     req.Header,
+				StreamID:   streamID,
+				Capability: req.Capability,
+				Kind:       "request",
+				Payload:    input.Payload,
+				EndStream:  input.EndStream,
+			}); err != nil {
+				return &MigError{Code: ErrorUnavailable, Message: "provider tunnel closed", Retryable: true}
+			}
+		case frame := <-stream.frames:
+			if frame.Kind == "error" {
+				if frame.Error == nil {
+					frame.Error = &MigError{Code: ErrorInternal, Message: "provider reported an error", Retryable: false}
+				}
+				return frame.Error
+			}
+			if frame.Payload == nil {
+				frame.Payload = map[string]interface{}{}
+			}
+			if err := emit(frame); err != nil {
+				return &MigError{Code: ErrorUnavailable, Message: "stream closed: " + err.Error(), Retryable: true}
+			}
+			if frame.EndStream {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package mig
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialProviderTunnel(t *testing.T, baseURL string, heartbeatMS int) *websocket.Conn {
+	t.Helper()
+	conn, _ := dialTenantTunnel(t, baseURL, "acme", heartbeatMS, testDescriptor("gpu.models.generate"))
+	return conn
+}
+
+// dialTenantTunnel opens a tunnel as tenantID, announces desc, and returns the
+// register ack payload.
+func dialTenantTunnel(t *testing.T, baseURL, tenantID string, heartbeatMS int, desc CapabilityDescriptor) (*websocket.Conn, map[string]interface{}) {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+baseURL[len("http"):]+"/mig/v0.1/providers/connect", http.Header{"X-Tenant-ID": []string{tenantID}})
+	if err != nil {
+		t.Fatalf("dial provider tunnel: %v", err)
+	}
+	if err := conn.WriteJSON(StreamFrame{
+		Header: MessageHeader{TenantID: tenantID},
+		Kind:   "control",
+		Payload: map[string]interface{}{
+			"action":                "register",
+			"heartbeat_interval_ms": heartbeatMS,
+			"capabilities":          []CapabilityDescriptor{desc},
+		},
+	}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	var ack StreamFrame
+	if err := conn.ReadJSON(&ack); err != nil {
+		t.Fatalf("read register ack: %v", err)
+	}
+	if ack.Payload["action"] != "registered" {
+		t.Fatalf("unexpected register ack: %#v", ack.Payload)
+	}
+	return conn, ack.Payload
+}
+
+func discoverIDs(svc *Service) map[string]bool {
+	return discoverTenantIDs(svc, "acme")
+}
+
+func discoverTenantIDs(svc *Service, tenantID string) map[string]bool {
+	resp, _ := svc.Discover(DiscoverRequest{Header: MessageHeader{TenantID: tenantID}}, AnonymousPrincipal())
+	out := map[string]bool{}
+	for _, desc := range resp.Capabilities {
+		out[desc.ID] = true
+	}
+	return out
+}
+
+func waitFor(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal(msg)
+}
+
+func TestProviderTunnelInvokeAndWithdraw(t *testing.T) {
+	svc := NewService()
+	mux := http.NewServeMux()
+	RegisterHTTPRoutes(mux, svc)
+	srv := httptest.NewServer(AuthMiddleware(AuthConfig{Mode: AuthModeNone})(mux))
+	defer srv.Close()
+
+	conn := dialProviderTunnel(t, srv.URL, 1000)
+	if !discoverIDs(svc)["gpu.models.generate"] {
+		t.Fatal("expected tunnel capability in discover")
+	}
+	go func() {
+		for {
+			var frame StreamFrame
+			if err := conn.ReadJSON(&frame); err != nil {
+				return
+			}
+			if frame.Kind != "request" {
+				continue
+			}
+			_ = conn.WriteJSON(StreamFrame{
+				StreamID:  frame.StreamID,
+				Kind:      "response",
+				Payload:   map[string]interface{}{"text": "generated:" + frame.Payload["prompt"].(string)},
+				EndStream: true,
+			})
+		}
+	}()
+
+	resp, err := svc.Invoke(context.Background(), "gpu.models.generate", InvokeRequest{
+		Header:  MessageHeader{TenantID: "acme", DeadlineMS: 2000},
+		Payload: map[string]interface{}{"prompt": "hi"},
+	}, "tester", AnonymousPrincipal())
+	if err != nil {
+		t.Fatalf("invoke over tunnel: %v", err.Message)
+	}
+	if resp.Payload["text"] != "generated:hi" {
+		t.Fatalf("unexpected payload: %#v", resp.Payload)
+	}
+
+	conn.Close()
+	waitFor(t, func() bool { return !discoverIDs(svc)["gpu.models.generate"] }, "expected capability to be withdrawn after disconnect")
+
+	reconnected := dialProviderTunnel(t, srv.URL, 1000)
+	defer reconnected.Close()
+	if !discoverIDs(svc)["gpu.models.generate"] {
+		t.Fatal("expected capability to return after reconnect")
+	}
+}
+
+func TestProviderTunnelMissedHeartbeats(t *testing.T) {
+	svc := NewService()
+	mux := http.NewServeMux()
+	RegisterHTTPRoutes(mux, svc)
+	srv := httptest.NewServer(AuthMiddleware(AuthConfig{Mode: AuthModeNone})(mux))
+	defer srv.Close()
+
+	// The worker never reads again, so gateway pings go unanswered.
+	conn := dialProviderTunnel(t, srv.URL, 50)
+	defer conn.Close()
+	waitFor(t, func() bool { return !discoverIDs(svc)["gpu.models.generate"] }, "expected capability to be withdrawn after missed heartbeats")
+}
+
+func TestProviderTunnelRequiresScope(t *testing.T) {
+	svc := NewService()
+	mux := http.NewServeMux()
+	RegisterHTTPRoutes(mux, svc)
+	srv := httptest.NewServer(AuthMiddleware(AuthConfig{Mode: AuthModeJWT, JWTSecret: "secret"})(mux))
+	defer srv.Close()
+
+	token := makeJWT(t, "secret", "worker-1", "acme", []string{"capability:infer"})
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+srv.URL[len("http"):]+"/mig/v0.1/providers/connect", http.Header{"Authorization": []string{"Bearer " + token}})
+	if err == nil {
+		t.Fatal("expected dial without provider scope to fail")
+	}
+	if resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403, got %#v", resp)
+	}
+}
+
+func TestProviderTunnelCannotHijackAcrossTenants(t *testing.T) {
+	svc := NewService()
+	mux := http.NewServeMux()
+	RegisterHTTPRoutes(mux, svc)
+	srv := httptest.NewServer(AuthMiddleware(AuthConfig{Mode: AuthModeNone})(mux))
+	defer srv.Close()
+
+	admin := testDescriptor("gpu.models.generate")
+	admin.AuthScopes = []string{"capability:generate"}
+	if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: admin}); err != nil {
+		t.Fatalf("add capability: %v", err.Message)
+	}
+
+	// The announced descriptor drops the auth scopes; the registered one
+	// must keep them.
+	conn, _ := dialTenantTunnel(t, srv.URL, "acme", 1000, testDescriptor("gpu.models.generate"))
+	go func() {
+		for {
+			var frame StreamFrame
+			if err := conn.ReadJSON(&frame); err != nil {
+				return
+			}
+			if frame.Kind == "request" {
+				_ = conn.WriteJSON(StreamFrame{StreamID: frame.StreamID, Kind: "response", Payload: map[string]interface{}{"served_by": "acme"}, EndStream: true})
+			}
+		}
+	}()
+	key := capabilityKey(admin.ID, admin.Version)
+	registered := func() (CapabilityDescriptor, bool) {
+		svc.mu.RLock()
+		defer svc.mu.RUnlock()
+		desc, ok := svc.capabilities[key]
+		return desc, ok
+	}
+	if desc, _ := registered(); len(desc.AuthScopes) != 1 || desc.AuthScopes[0] != "capability:generate" {
+		t.Fatalf("tunnel must not overwrite the registered descriptor, got scopes %v", desc.AuthScopes)
+	}
+
+	intruder, ack := dialTenantTunnel(t, srv.URL, "globex", 1000, testDescriptor("gpu.models.generate"))
+	defer intruder.Close()
+	if rejected, _ := ack["rejected"].(map[string]interface{}); rejected["gpu.models.generate"] == nil {
+		t.Fatalf("expected another tenant's session to be refused, got %#v", ack)
+	}
+	if !discoverTenantIDs(svc, "acme")["gpu.models.generate"] || discoverTenantIDs(svc, "globex")["gpu.models.generate"] {
+		t.Fatal("only the tunnel's tenant should discover its capability")
+	}
+
+	principal := AnonymousPrincipal()
+	if _, err := svc.Invoke(context.Background(), "gpu.models.generate", InvokeRequest{
+		Header: MessageHeader{TenantID: "globex", DeadlineMS: 2000},
+	}, "tester", principal); err == nil || err.Code != ErrorUnavailable {
+		t.Fatalf("another tenant's call must not reach the tunnel, got %#v", err)
+	}
+	resp, err := svc.Invoke(context.Background(), "gpu.models.generate", InvokeRequest{
+		Header: MessageHeader{TenantID: "acme", DeadlineMS: 2000},
+	}, "tester", principal)
+	if err != nil || resp.Payload["served_by"] != "acme" {
+		t.Fatalf("expected the owning tenant to be served, got %#v %#v", resp, err)
+	}
+
+	conn.Close()
+	waitFor(t, func() bool { return !discoverTenantIDs(svc, "acme")["gpu.models.generate"] }, "expected capability to be withdrawn after disconnect")
+	if desc, ok := registered(); !ok || len(desc.AuthScopes) != 1 {
+		t.Fatalf("admin descriptor must survive the tunnel, got %#v %v", desc, ok)
+	}
+
+	// With acme's tunnel gone, another tenant's worker may serve it.
+	successor, ack := dialTenantTunnel(t, srv.URL, "globex", 1000, testDescriptor("gpu.models.generate"))
+	defer successor.Close()
+	if rejected, _ := ack["rejected"].(map[string]interface{}); len(rejected) != 0 {
+		t.Fatalf("expected the capability to be handed over, got %#v", ack)
+	}
+	if discoverTenantIDs(svc, "acme")["gpu.models.generate"] || !discoverTenantIDs(svc, "globex")["gpu.models.generate"] {
+		t.Fatal("expected the capability to move to the new tenant")
+	}
+}
+
+func TestProviderTunnelClampsHeartbeat(t *testing.T) {
+	svc := NewService()
+	mux := http.NewServeMux()
+	RegisterHTTPRoutes(mux, svc)
+	srv := httptest.NewServer(AuthMiddleware(AuthConfig{Mode: AuthModeNone})(mux))
+	defer srv.Close()
+
+	conn := dialProviderTunnel(t, srv.URL, 1<<40)
+	defer conn.Close()
+	svc.mu.RLock()
+	sessions := svc.tunnels[capabilityKey("gpu.models.generate", "1.0.0")]
+	svc.mu.RUnlock()
+	if len(sessions) != 1 {
+		t.Fatalf("expected one session, got %d", len(sessions))
+	}
+	sessions[0].mu.Lock()
+	defer sessions[0].mu.Unlock()
+	if sessions[0].heartbeat != maxTunnelHeartbeatMS*time.Millisecond {
+		t.Fatalf("expected the heartbeat to be clamped, got %s", sessions[0].heartbeat)
+	}
+}
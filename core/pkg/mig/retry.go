@@ -0,0 +1,172 @@
+package mig
+
+import (
+	"context"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+const (
+	defaultRetryMaxAttempts    = 3
+	defaultRetryInitialBackoff = 100
+	defaultRetryMaxBackoff     = 2000
+	defaultRetryMultiplier     = 2.0
+	defaultRetryJitter         = 0.2
+)
+
+// RetryPolicyConfig retries failed invocations inside the gateway. Only errors
+// marked retryable are retried, and only for idempotent calls: the request
+// carries an idempotency key or the descriptor sets idempotent.
+type RetryPolicyConfig struct {
+	// MaxAttempts counts the first call, so 3 means up to two retries.
+	MaxAttempts      int     `json:"max_attempts,omitempty"`
+	InitialBackoffMS int     `json:"initial_backoff_ms,omitempty"`
+	MaxBackoffMS     int     `json:"max_backoff_ms,omitempty"`
+	Multiplier       float64 `json:"multiplier,omitempty"`
+	// Jitter spreads each backoff by up to +/- this fraction.
+	Jitter float64 `json:"jitter,omitempty"`
+	// RetryOn narrows retries to these error codes. Empty retries every
+	// retryable error.
+	RetryOn []string `json:"retry_on,omitempty"`
+}
+
+func normalizeRetryPolicy(cfg RetryPolicyConfig) (RetryPolicyConfig, *MigError) {
+	if cfg.MaxAttempts < 0 || cfg.InitialBackoffMS < 0 || cfg.MaxBackoffMS < 0 || cfg.Multiplier < 0 {
+		return cfg, invalid("retry values must be >= 0")
+	}
+	if cfg.Jitter < 0 || cfg.Jitter > 1 {
+		return cfg, invalid("retry.jitter must be between 0 and 1")
+	}
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if cfg.InitialBackoffMS == 0 {
+		cfg.InitialBackoffMS = defaultRetryInitialBackoff
+	}
+	if cfg.MaxBackoffMS == 0 {
+		cfg.MaxBackoffMS = defaultRetryMaxBackoff
+	}
+	if cfg.MaxBackoffMS < cfg.InitialBackoffMS {
+		cfg.MaxBackoffMS = cfg.InitialBackoffMS
+	}
+	if cfg.Multiplier == 0 {
+		cfg.Multiplier = defaultRetryMultiplier
+	}
+	if cfg.Jitter == 0 {
+		cfg.Jitter = defaultRetryJitter
+	}
+	return cfg, nil
+}
+
+// shouldRetry reports whether a failed attempt may be retried under policy.
+func (p RetryPolicyConfig) shouldRetry(migErr *MigError) bool {
+	if migErr == nil || !migErr.Retryable {
+		return false
+	}
+	return len(p.RetryOn) == 0 || slices.Contains(p.RetryOn, migErr.Code)
+}
+
+// backoff returns the jittered delay before the given retry (1-based). A
+// retry_after_ms hint from the failed attempt raises the delay.
+func (p RetryPolicyConfig) backoff(retry int, migErr *MigError) time.Duration {
+	delay := float64(p.InitialBackoffMS)
+	for i := 1; i < retry; i++ {
+		delay *= p.Multiplier
+	}
+	if delay > float64(p.MaxBackoffMS) {
+		delay = float64(p.MaxBackoffMS)
+	}
+	delay *= 1 + p.Jitter*(2*rand.Float64()-1)
+	out := time.Duration(delay) * time.Millisecond
+	if migErr != nil {
+		if hint, ok := detailMillis(migErr.Details, "retry_after_ms"); ok && hint > out {
+			out = hint
+		}
+	}
+	return out
+}
+
+func detailMillis(details map[string]interface{}, key string) (time.Duration, bool) {
+	switch v := details[key].(type) {
+	case int:
+		return time.Duration(v) * time.Millisecond, true
+	case int64:
+		return time.Duration(v) * time.Millisecond, true
+	case float64:
+		return time.Duration(v) * time.Millisecond, true
+	}
+	return 0, false
+}
+
+// invokeAttempts runs provider.Invoke under the capability retry policy. Each
+// attempt is metered, and failed attempts are audited when a policy applies.
+// It returns the number of attempts made. Each attempt carries the budget
+// left on ctx as its DeadlineMS, so time spent on earlier attempts and
+// backoff is not offered to the provider again.
+func (s *Service) invokeAttempts(ctx context.Context, provider Provider, req InvokeRequest, policy *RetryPolicyConfig, idempotent bool, actor string) (map[string]interface{}, *MigError, int) {
+	attempt := 0
+	for {
+		attempt++
+		req.Header.DeadlineMS = remainingMS(ctx, req.Header.DeadlineMS)
+		payload, migErr := provider.Invoke(ctx, req)
+		s.recordAttempt(req.Capability, migErr)
+		if migErr == nil || policy == nil {
+			return payload, migErr, attempt
+		}
+		s.auditAttempt(actor, req, attempt, migErr)
+		if !idempotent || attempt >= policy.MaxAttempts || !policy.shouldRetry(migErr) {
+			return nil, migErr, attempt
+		}
+		delay := policy.backoff(attempt, migErr)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+			// Not enough budget left for the wait plus another call.
+			return nil, migErr, attempt
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, migErr, attempt
+		case <-timer.C:
+		}
+		if metrics := s.metricsSnapshot(); metrics != nil {
+			metrics.RecordRetry(req.Capability, migErr.Code)
+		}
+	}
+}
+
+func (s *Service) recordAttempt(capability string, migErr *MigError) {
+	metrics := s.metricsSnapshot()
+	if metrics == nil {
+		return
+	}
+	outcome := "success"
+	if migErr != nil {
+		outcome = "error"
+	}
+	metrics.RecordAttempt(capability, outcome)
+}
+
+func (s *Service) auditAttempt(actor string, req InvokeRequest, attempt int, migErr *MigError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.audit = append(s.audit, AuditRecord{
+		Actor:      actor,
+		TenantID:   req.Header.TenantID,
+		Capability: req.Capability,
+		Version:    metaString(req.Header.Meta, CapabilityVersionMetaKey),
+		Canary:     metaString(req.Header.Meta, CanaryMetaKey),
+		Outcome:    "attempt_failed",
+		Timestamp:  time.Now().UTC().Format(time.RFC3339),
+		MessageID:  req.Header.MessageID,
+		Attempt:    attempt,
+		ErrorCode:  migErr.Code,
+	})
+	s.writeAuditLogLocked(s.audit[len(s.audit)-1])
+}
+
+func metaString(meta map[string]interface{}, key string) string {
+	value, _ := meta[key].(string)
+	return value
+}
@@ -0,0 +1,95 @@
+package mig
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func flakyProvider(failures int64, migErr MigError) (Provider, *atomic.Int64) {
+	var calls atomic.Int64
+	return ProviderFunc(func(_ context.Context, _ InvokeRequest) (map[string]interface{}, *MigError) {
+		if calls.Add(1) <= failures {
+			failure := migErr
+			return nil, &failure
+		}
+		return map[string]interface{}{"ok": true}, nil
+	}), &calls
+}
+
+func addRetryCapability(t *testing.T, svc *Service, desc CapabilityDescriptor, policy RetryPolicyConfig, provider Provider) {
+	t.Helper()
+	if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: desc, Retry: &policy}); err != nil {
+		t.Fatalf("add capability: %v", err.Message)
+	}
+	if err := svc.BindProvider(desc.ID, provider); err != nil {
+		t.Fatalf("bind provider: %v", err.Message)
+	}
+}
+
+func TestRetryPolicyRetriesIdempotentCalls(t *testing.T) {
+	svc := NewService()
+	desc := testDescriptor("acme.models.retry")
+	desc.Idempotent = true
+	provider, calls := flakyProvider(2, MigError{Code: ErrorUnavailable, Message: "down", Retryable: true})
+	addRetryCapability(t, svc, desc, RetryPolicyConfig{MaxAttempts: 3, InitialBackoffMS: 5}, provider)
+
+	if _, err := svc.Invoke(context.Background(), desc.ID, InvokeRequest{Header: MessageHeader{TenantID: "acme"}}, "tester", AnonymousPrincipal()); err != nil {
+		t.Fatalf("expected retries to succeed: %#v", err)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls.Load())
+	}
+	var outcomes []string
+	for _, record := range svc.AuditExport("acme") {
+		if record.Capability == desc.ID {
+			outcomes = append(outcomes, record.Outcome)
+		}
+	}
+	if len(outcomes) != 3 || outcomes[0] != "attempt_failed" || outcomes[2] != "success" {
+		t.Fatalf("unexpected audit trail: %#v", outcomes)
+	}
+}
+
+func TestRetryPolicySkipsUnsafeCalls(t *testing.T) {
+	svc := NewService()
+	provider, calls := flakyProvider(1, MigError{Code: ErrorUnavailable, Message: "down", Retryable: true})
+	addRetryCapability(t, svc, testDescriptor("acme.models.unsafe"), RetryPolicyConfig{MaxAttempts: 3, InitialBackoffMS: 5}, provider)
+
+	_, err := svc.Invoke(context.Background(), "acme.models.unsafe", InvokeRequest{Header: MessageHeader{TenantID: "acme"}}, "tester", AnonymousPrincipal())
+	if err == nil || calls.Load() != 1 {
+		t.Fatalf("non-idempotent call must not be retried: err=%#v calls=%d", err, calls.Load())
+	}
+
+	// The same call with an idempotency key is safe to retry.
+	_, err = svc.Invoke(context.Background(), "acme.models.unsafe", InvokeRequest{Header: MessageHeader{TenantID: "acme", IdempotencyKey: "k1"}}, "tester", AnonymousPrincipal())
+	if err != nil {
+		t.Fatalf("expected keyed call to succeed: %#v", err)
+	}
+
+	desc := testDescriptor("acme.models.fatal")
+	desc.Idempotent = true
+	provider, calls = flakyProvider(1, MigError{Code: ErrorInvalidRequest, Message: "bad", Retryable: false})
+	addRetryCapability(t, svc, desc, RetryPolicyConfig{MaxAttempts: 3, InitialBackoffMS: 5}, provider)
+	if _, err := svc.Invoke(context.Background(), desc.ID, InvokeRequest{Header: MessageHeader{TenantID: "acme"}}, "tester", AnonymousPrincipal()); err == nil || calls.Load() != 1 {
+		t.Fatalf("non-retryable error must not be retried: err=%#v calls=%d", err, calls.Load())
+	}
+}
+
+func TestRetryPolicyRespectsDeadlineBudget(t *testing.T) {
+	svc := NewService()
+	desc := testDescriptor("acme.models.slowretry")
+	desc.Idempotent = true
+	provider, calls := flakyProvider(5, MigError{Code: ErrorUnavailable, Message: "down", Retryable: true})
+	addRetryCapability(t, svc, desc, RetryPolicyConfig{MaxAttempts: 5, InitialBackoffMS: 1000, Jitter: 0.01}, provider)
+
+	start := time.Now()
+	_, err := svc.Invoke(context.Background(), desc.ID, InvokeRequest{Header: MessageHeader{TenantID: "acme", DeadlineMS: 200}}, "tester", AnonymousPrincipal())
+	if err == nil || err.Code != ErrorUnavailable {
+		t.Fatalf("expected the last provider error, got %#v", err)
+	}
+	if calls.Load() != 1 || time.Since(start) > 150*time.Millisecond {
+		t.Fatalf("retry must not wait past the deadline: calls=%d elapsed=%s", calls.Load(), time.Since(start))
+	}
+}
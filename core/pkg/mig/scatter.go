@@ -0,0 +1,335 @@
+package mig
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	AggregateAll          = "all"
+	AggregateFirstSuccess = "first_success"
+	AggregateMajority     = "majority"
+	AggregateQuorum       = "quorum"
+
+	ScatterBranchSuccess   = "success"
+	ScatterBranchError     = "error"
+	ScatterBranchCancelled = "cancelled"
+
+	maxScatterBranches = 64
+)
+
+// ScatterProviderConfig fans each invocation out to every target in parallel
+// and combines the branch results with Aggregator:
+//
+//   - all (default) waits for every branch and returns one result per branch.
+//   - first_success returns the first successful result and cancels the rest.
+//   - majority votes on Field and returns a result whose value more than half
+//     of the branches agree on.
+//   - quorum returns the first Quorum successful results.
+//
+// Branch failures are reported in the response payload. The call itself only
+// fails when the aggregator cannot be satisfied.
+type ScatterProviderConfig struct {
+	Targets    []ScatterTarget `json:"targets"`
+	Aggregator string          `json:"aggregator,omitempty"`
+	Field      string          `json:"field,omitempty"`
+	Quorum     int             `json:"quorum,omitempty"`
+	// TimeoutMS caps each branch. Branches never outlive the call deadline.
+	TimeoutMS int `json:"timeout_ms,omitempty"`
+}
+
+// ScatterTarget is a capability, optionally with a version range, invoked
+// Replicas times (default 1).
+type ScatterTarget struct {
+	Capability string `json:"capability"`
+	Replicas   int    `json:"replicas,omitempty"`
+}
+
+type scatterProvider struct {
+	s          *Service
+	capability string
+	cfg        ScatterProviderConfig
+	field      []pathSegment
+	branches   []scatterBranch
+}
+
+type scatterBranch struct {
+	capability string
+	replica    int
+}
+
+type scatterResult struct {
+	index    int
+	status   string
+	payload  map[string]interface{}
+	version  string
+	servedBy string
+	duration time.Duration
+	err      *MigError
+}
+
+func (s *Service) newScatterProvider(capability string, cfg ScatterProviderConfig) (Provider, *MigError) {
+	id, _ := splitCapabilityRef(capability)
+	if len(cfg.Targets) == 0 {
+		return nil, invalid("provider.scatter.targets must not be empty")
+	}
+	var branches []scatterBranch
+	for _, target := range cfg.Targets {
+		ref, _ := splitCapabilityRef(target.Capability)
+		if ref == "" {
+			return nil, invalid("scatter targets need a capability")
+		}
+		if ref == id {
+			return nil, invalid("scatter targets must not reference the capability itself")
+		}
+		if target.Replicas < 0 {
+			return nil, invalid("scatter target replicas must be >= 0")
+		}
+		replicas := target.Replicas
+		if replicas == 0 {
+			replicas = 1
+		}
+		for r := 0; r < replicas; r++ {
+			branches = append(branches, scatterBranch{capability: target.Capability, replica: r})
+		}
+	}
+	if len(branches) > maxScatterBranches {
+		return nil, invalid(fmt.Sprintf("scatter fans out to %d branches; the limit is %d", len(branches), maxScatterBranches))
+	}
+	if cfg.TimeoutMS < 0 {
+		return nil, invalid("scatter timeout_ms must be >= 0")
+	}
+	p := &scatterProvider{s: s, capability: id, cfg: cfg, branches: branches}
+	switch cfg.Aggregator {
+	case "":
+		p.cfg.Aggregator = AggregateAll
+	case AggregateAll, AggregateFirstSuccess:
+	case AggregateMajority:
+		if cfg.Field == "" {
+			return nil, invalid("majority aggregation requires field")
+		}
+		path, err := parsePath(cfg.Field)
+		if err != nil {
+			return nil, invalid("scatter field: " + err.Error())
+		}
+		p.field = path
+	case AggregateQuorum:
+		if cfg.Quorum < 1 || cfg.Quorum > len(branches) {
+			return nil, invalid(fmt.Sprintf("quorum must be between 1 and the number of branches (%d)", len(branches)))
+		}
+	default:
+		return nil, invalid("unsupported scatter aggregator " + cfg.Aggregator)
+	}
+	return p, nil
+}
+
+// Invoke runs every branch as a full Service invocation on behalf of the
+// caller and stops early once the aggregator has its answer.
+func (p *scatterProvider) Invoke(ctx context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+	inv := invocationFromContext(ctx)
+	if inv == nil {
+		return nil, &MigError{Code: ErrorInternal, Message: "scatter capabilities run only through Service.Invoke", Retryable: false}
+	}
+	if inv.depth >= maxCompositeDepth {
+		return nil, invalid(fmt.Sprintf("composite nesting exceeds %d levels", maxCompositeDepth))
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan scatterResult, len(p.branches))
+	for i, branch := range p.branches {
+		go func(i int, branch scatterBranch) {
+			results <- p.runBranch(runCtx, inv, req, i, branch)
+		}(i, branch)
+	}
+
+	collected := make([]*scatterResult, len(p.branches))
+	var (
+		decided   bool
+		stopped   bool
+		result    interface{}
+		vote      map[string]interface{}
+		successes []int
+		failures  int
+		tally     = map[string][]int{}
+	)
+	for range p.branches {
+		out := <-results
+		if stopped && out.err != nil {
+			out.status = ScatterBranchCancelled
+		}
+		collected[out.index] = &out
+		if stopped {
+			continue
+		}
+		if out.err != nil {
+			failures++
+		} else {
+			successes = append(successes, out.index)
+		}
+		switch p.cfg.Aggregator {
+		case AggregateFirstSuccess:
+			if out.err == nil {
+				decided, result = true, out.payload
+			}
+		case AggregateMajority:
+			if out.err == nil {
+				value, _ := getPath(out.payload, p.field)
+				encoded, _ := json.Marshal(value)
+				tally[string(encoded)] = append(tally[string(encoded)], out.index)
+				if voters := tally[string(encoded)]; len(voters)*2 > len(p.branches) {
+					decided, result = true, collected[voters[0]].payload
+					vote = map[string]interface{}{"field": p.cfg.Field, "value": value, "votes": len(voters)}
+				}
+			}
+		case AggregateQuorum:
+			if len(successes) == p.cfg.Quorum {
+				decided = true
+				sort.Ints(successes)
+				list := make([]interface{}, 0, len(successes))
+				for _, idx := range successes {
+					list = append(list, collected[idx].payload)
+				}
+				result = list
+			} else if len(p.branches)-failures < p.cfg.Quorum {
+				// The quorum can no longer be reached.
+				stopped = true
+				cancel()
+			}
+		}
+		if decided {
+			stopped = true
+			cancel()
+		}
+	}
+
+	branches := make([]interface{}, 0, len(collected))
+	for _, out := range collected {
+		branches = append(branches, p.report(out))
+	}
+	if p.cfg.Aggregator == AggregateAll && len(successes) > 0 {
+		list := make([]interface{}, len(collected))
+		for i, out := range collected {
+			if out.err == nil {
+				list[i] = out.payload
+			}
+		}
+		decided, result = true, list
+	}
+	if !decided {
+		return nil, p.unsatisfied(collected, successes, branches, tally)
+	}
+	counts := map[string]int{}
+	for _, out := range collected {
+		counts[out.status]++
+	}
+	payload := map[string]interface{}{
+		"aggregator": p.cfg.Aggregator,
+		"result":     result,
+		"branches":   branches,
+		"succeeded":  counts[ScatterBranchSuccess],
+		"failed":     counts[ScatterBranchError],
+	}
+	if vote != nil {
+		payload["vote"] = vote
+	}
+	return payload, nil
+}
+
+func (p *scatterProvider) InvokeStream(ctx context.Context, req InvokeRequest, emit func(StreamFrame) error) *MigError {
+	return streamUnary(ctx, p.Invoke, req, emit)
+}
+
+func (p *scatterProvider) runBranch(ctx context.Context, inv *invocation, parent InvokeRequest, index int, branch scatterBranch) scatterResult {
+	out := scatterResult{index: index}
+	budget := time.Duration(parent.Header.DeadlineMS) * time.Millisecond
+	if deadline, ok := ctx.Deadline(); ok {
+		budget = time.Until(deadline)
+	}
+	if p.cfg.TimeoutMS > 0 && time.Duration(p.cfg.TimeoutMS)*time.Millisecond < budget {
+		budget = time.Duration(p.cfg.TimeoutMS) * time.Millisecond
+	}
+	if budget < time.Millisecond {
+		out.status = ScatterBranchError
+		out.err = &MigError{Code: ErrorTimeout, Message: "no time left on the call deadline", Retryable: true}
+		return out
+	}
+	suffix := fmt.Sprintf(".b%d", index)
+	head := MessageHeader{
+		MessageID:   parent.Header.MessageID + suffix,
+		TenantID:    parent.Header.TenantID,
+		SessionID:   parent.Header.SessionID,
+		Traceparent: parent.Header.Traceparent,
+		DeadlineMS:  int(budget.Milliseconds()),
+		Meta:        map[string]interface{}{ParentCapabilityMetaKey: p.capability},
+	}
+	if parent.Header.IdempotencyKey != "" {
+		head.IdempotencyKey = parent.Header.IdempotencyKey + suffix
+	}
+	begin := time.Now()
+	resp, migErr := p.s.Invoke(ctx, branch.capability, InvokeRequest{Header: head, Payload: parent.Payload}, inv.actor, inv.principal)
+	out.duration = time.Since(begin)
+	if migErr != nil {
+		out.status, out.err = ScatterBranchError, migErr
+		return out
+	}
+	out.status = ScatterBranchSuccess
+	out.payload = resp.Payload
+	out.servedBy = resp.Capability
+	out.version, _ = resp.Header.Meta[CapabilityVersionMetaKey].(string)
+	return out
+}
+
+func (p *scatterProvider) report(out *scatterResult) map[string]interface{} {
+	branch := p.branches[out.index]
+	report := map[string]interface{}{
+		"index":       out.index,
+		"capability":  branch.capability,
+		"replica":     branch.replica,
+		"status":      out.status,
+		"duration_ms": durationMS(out.duration),
+	}
+	if out.servedBy != "" {
+		report["served_by"] = out.servedBy
+	}
+	if out.version != "" {
+		report["version"] = out.version
+	}
+	if out.err != nil {
+		report["error"] = map[string]interface{}{"code": out.err.Code, "message": out.err.Message}
+	}
+	return report
+}
+
+// unsatisfied builds the error for a call whose aggregator got no answer.
+func (p *scatterProvider) unsatisfied(collected []*scatterResult, successes []int, branches []interface{}, tally map[string][]int) *MigError {
+	details := map[string]interface{}{"aggregator": p.cfg.Aggregator, "branches": branches}
+	if len(successes) == 0 {
+		for _, out := range collected {
+			if out.err != nil && out.status == ScatterBranchError {
+				return &MigError{
+					Code:      out.err.Code,
+					Message:   fmt.Sprintf("all %d scatter branches failed", len(collected)),
+					Retryable: out.err.Retryable,
+					Details:   details,
+				}
+			}
+		}
+	}
+	msg := fmt.Sprintf("%d of %d scatter branches succeeded", len(successes), len(collected))
+	switch p.cfg.Aggregator {
+	case AggregateMajority:
+		votes := make(map[string]interface{}, len(tally))
+		for value, voters := range tally {
+			votes[value] = len(voters)
+		}
+		details["votes"] = votes
+		msg = "no majority on " + p.cfg.Field + ": " + msg
+	case AggregateQuorum:
+		msg = fmt.Sprintf("quorum of %d not reached: %s", p.cfg.Quorum, msg)
+	}
+	return &MigError{Code: ErrorUnavailable, Message: msg, Retryable: true, Details: details}
+}
@@ -0,0 +1,183 @@
+package mig
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func newScatterService(t *testing.T) *Service {
+	t.Helper()
+	svc := NewService()
+	labels := map[string]string{"acme.vote.a": "cat", "acme.vote.b": "cat", "acme.vote.d": "dog"}
+	for _, id := range []string{"acme.vote.a", "acme.vote.b", "acme.vote.c", "acme.vote.d"} {
+		if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: testDescriptor(id)}); err != nil {
+			t.Fatalf("add %s: %v", id, err.Message)
+		}
+		label, ok := labels[id]
+		if !ok {
+			_ = svc.BindProvider(id, ProviderFunc(func(context.Context, InvokeRequest) (map[string]interface{}, *MigError) {
+				return nil, &MigError{Code: ErrorUnavailable, Message: "down", Retryable: true}
+			}))
+			continue
+		}
+		_ = svc.BindProvider(id, ProviderFunc(func(_ context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+			return map[string]interface{}{"label": label, "input": req.Payload["input"]}, nil
+		}))
+	}
+	return svc
+}
+
+func addScatter(svc *Service, id string, cfg ScatterProviderConfig) *MigError {
+	return svc.AddCapability(CapabilityUpsertRequest{
+		Descriptor: testDescriptor(id),
+		Provider:   &ProviderConfig{Type: ProviderTypeScatter, Scatter: &cfg},
+	})
+}
+
+func invokeScatter(svc *Service, id string) (InvokeResponse, *MigError) {
+	return svc.Invoke(context.Background(), id, InvokeRequest{
+		Header:  MessageHeader{TenantID: "acme"},
+		Payload: map[string]interface{}{"input": "image-1"},
+	}, "tester", AnonymousPrincipal())
+}
+
+func TestScatterAggregators(t *testing.T) {
+	svc := newScatterService(t)
+	targets := []ScatterTarget{
+		{Capability: "acme.vote.a"},
+		{Capability: "acme.vote.b", Replicas: 2},
+		{Capability: "acme.vote.c"},
+		{Capability: "acme.vote.d"},
+	}
+	cases := map[string]ScatterProviderConfig{
+		"acme.ensemble.all":      {Targets: targets},
+		"acme.ensemble.first":    {Targets: targets, Aggregator: AggregateFirstSuccess},
+		"acme.ensemble.majority": {Targets: targets, Aggregator: AggregateMajority, Field: "$.label"},
+		"acme.ensemble.quorum":   {Targets: targets, Aggregator: AggregateQuorum, Quorum: 2},
+	}
+	for id, cfg := range cases {
+		if err := addScatter(svc, id, cfg); err != nil {
+			t.Fatalf("add %s: %v", id, err.Message)
+		}
+	}
+
+	resp, err := invokeScatter(svc, "acme.ensemble.all")
+	if err != nil {
+		t.Fatalf("all: %v", err.Message)
+	}
+	results := resp.Payload["result"].([]interface{})
+	if len(results) != 5 || results[3] != nil || resp.Payload["succeeded"] != 4 || resp.Payload["failed"] != 1 {
+		t.Fatalf("unexpected all payload: %#v", resp.Payload)
+	}
+	failed := resp.Payload["branches"].([]interface{})[3].(map[string]interface{})
+	if failed["status"] != ScatterBranchError || failed["error"].(map[string]interface{})["code"] != ErrorUnavailable {
+		t.Fatalf("failed branch should be reported: %#v", failed)
+	}
+	if replica := resp.Payload["branches"].([]interface{})[2].(map[string]interface{}); replica["capability"] != "acme.vote.b" || replica["replica"] != 1 {
+		t.Fatalf("unexpected replica branch: %#v", replica)
+	}
+	if _, err := structpb.NewStruct(resp.Payload); err != nil {
+		t.Fatalf("scatter payload must convert for gRPC: %v", err)
+	}
+
+	resp, err = invokeScatter(svc, "acme.ensemble.first")
+	if err != nil || resp.Payload["result"].(map[string]interface{})["input"] != "image-1" {
+		t.Fatalf("unexpected first_success response: %#v %#v", resp.Payload, err)
+	}
+
+	resp, err = invokeScatter(svc, "acme.ensemble.majority")
+	if err != nil {
+		t.Fatalf("majority: %v", err.Message)
+	}
+	vote := resp.Payload["vote"].(map[string]interface{})
+	if vote["value"] != "cat" || vote["votes"] != 3 || resp.Payload["result"].(map[string]interface{})["label"] != "cat" {
+		t.Fatalf("unexpected majority payload: %#v", resp.Payload)
+	}
+	if _, err := structpb.NewStruct(resp.Payload); err != nil {
+		t.Fatalf("scatter payload must convert for gRPC: %v", err)
+	}
+
+	resp, err = invokeScatter(svc, "acme.ensemble.quorum")
+	if err != nil || len(resp.Payload["result"].([]interface{})) != 2 {
+		t.Fatalf("unexpected quorum response: %#v %#v", resp.Payload, err)
+	}
+
+	parents := 0
+	for _, record := range svc.AuditExport("acme") {
+		if record.Parent == "acme.ensemble.all" {
+			parents++
+		}
+	}
+	if parents != 4 {
+		t.Fatalf("expected four audited branches for the all call, got %d", parents)
+	}
+}
+
+func TestScatterFailsWhenAggregatorUnsatisfied(t *testing.T) {
+	svc := newScatterService(t)
+	if err := addScatter(svc, "acme.ensemble.split", ScatterProviderConfig{
+		Targets:    []ScatterTarget{{Capability: "acme.vote.a"}, {Capability: "acme.vote.c"}, {Capability: "acme.vote.d"}},
+		Aggregator: AggregateMajority,
+		Field:      "label",
+	}); err != nil {
+		t.Fatalf("add: %v", err.Message)
+	}
+	_, err := invokeScatter(svc, "acme.ensemble.split")
+	if err == nil || err.Code != ErrorUnavailable || err.Details["votes"] == nil || len(err.Details["branches"].([]interface{})) != 3 {
+		t.Fatalf("expected no majority error, got %#v", err)
+	}
+
+	if err := addScatter(svc, "acme.ensemble.down", ScatterProviderConfig{
+		Targets: []ScatterTarget{{Capability: "acme.vote.c", Replicas: 3}},
+	}); err != nil {
+		t.Fatalf("add: %v", err.Message)
+	}
+	_, err = invokeScatter(svc, "acme.ensemble.down")
+	if err == nil || err.Code != ErrorUnavailable || !err.Retryable {
+		t.Fatalf("expected the branch error when every branch fails, got %#v", err)
+	}
+}
+
+func TestScatterFirstSuccessCancelsSlowBranches(t *testing.T) {
+	svc := newScatterService(t)
+	if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: testDescriptor("acme.vote.slow")}); err != nil {
+		t.Fatalf("add: %v", err.Message)
+	}
+	_ = svc.BindProvider("acme.vote.slow", ProviderFunc(func(ctx context.Context, _ InvokeRequest) (map[string]interface{}, *MigError) {
+		<-ctx.Done()
+		return nil, &MigError{Code: ErrorTimeout, Message: "cancelled", Retryable: true}
+	}))
+	if err := addScatter(svc, "acme.ensemble.race", ScatterProviderConfig{
+		Targets:    []ScatterTarget{{Capability: "acme.vote.slow"}, {Capability: "acme.vote.a"}},
+		Aggregator: AggregateFirstSuccess,
+	}); err != nil {
+		t.Fatalf("add: %v", err.Message)
+	}
+	resp, err := invokeScatter(svc, "acme.ensemble.race")
+	if err != nil {
+		t.Fatalf("invoke: %v", err.Message)
+	}
+	slow := resp.Payload["branches"].([]interface{})[0].(map[string]interface{})
+	if slow["status"] != ScatterBranchCancelled {
+		t.Fatalf("slow branch should be cancelled: %#v", slow)
+	}
+}
+
+func TestScatterRejectsInvalidConfig(t *testing.T) {
+	svc := NewService()
+	cases := map[string]ScatterProviderConfig{
+		"no targets":     {},
+		"self":           {Targets: []ScatterTarget{{Capability: "acme.ensemble@^1"}}},
+		"no field":       {Targets: []ScatterTarget{{Capability: "acme.x"}}, Aggregator: AggregateMajority},
+		"quorum too big": {Targets: []ScatterTarget{{Capability: "acme.x", Replicas: 2}}, Aggregator: AggregateQuorum, Quorum: 3},
+		"unknown":        {Targets: []ScatterTarget{{Capability: "acme.x"}}, Aggregator: "fastest"},
+		"too many":       {Targets: []ScatterTarget{{Capability: "acme.x", Replicas: maxScatterBranches + 1}}},
+	}
+	for name, cfg := range cases {
+		if err := addScatter(svc, "acme.ensemble", cfg); err == nil || err.Code != ErrorInvalidRequest {
+			t.Fatalf("%s: expected invalid request, got %#v", name, err)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package mig
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// Schema validation modes for INVOKE payloads, set per capability with
+// CapabilityUpsertRequest.SchemaValidation.
+const (
+	// SchemaValidationEnforce rejects payloads that do not match the input
+	// schema with MIG_INVALID_REQUEST. It is the default.
+	SchemaValidationEnforce = "enforce"
+	// SchemaValidationWarn logs and counts violations but dispatches anyway.
+	SchemaValidationWarn = "warn"
+	SchemaValidationOff  = "off"
+)
+
+func normalizeSchemaValidation(mode string) (string, *MigError) {
+	switch mode {
+	case "", SchemaValidationEnforce:
+		return SchemaValidationEnforce, nil
+	case SchemaValidationWarn, SchemaValidationOff:
+		return mode, nil
+	}
+	return "", invalid("schema_validation must be enforce, warn, or off")
+}
+
+// schemaViolation is one failed JSON Schema keyword: path is a JSON pointer
+// into the payload.
+type schemaViolation struct {
+	path    string
+	message string
+}
+
+const defaultMetaSchemaURI = "https://json-schema.org/draft/2020-12/schema"
+
+// registeredOnlyLoader refuses every URI the compiler has not been given, so
+// a $ref can only reach registered schemas and the built-in meta-schemas,
+// never local files or the network.
+type registeredOnlyLoader struct{}
+
+func (registeredOnlyLoader) Load(uri string) (any, error) {
+	return nil, fmt.Errorf("%s is not a registered schema", uri)
+}
+
+func newSchemaCompiler() *jsonschema.Compiler {
+	compiler := jsonschema.NewCompiler()
+	compiler.DefaultDraft(jsonschema.Draft2020)
+	compiler.UseLoader(registeredOnlyLoader{})
+	return compiler
+}
+
+// checkSchemaStructure validates doc against its meta-schema, draft 2020-12
+// unless it declares another $schema. $refs are not resolved here: they may
+// point at schemas registered later, and are resolved on first use.
+func checkSchemaStructure(doc map[string]interface{}) error {
+	metaURI := defaultMetaSchemaURI
+	if declared, ok := doc["$schema"].(string); ok && declared != "" {
+		metaURI = declared
+	}
+	meta, err := newSchemaCompiler().Compile(metaURI)
+	if err != nil {
+		return fmt.Errorf("unsupported $schema %s: %w", metaURI, err)
+	}
+	return meta.Validate(normalizeJSON(doc))
+}
+
+// compileSchemaLocked compiles the schema registered under uri as draft
+// 2020-12, unless it declares another $schema. Every registered schema is
+// available to $ref. Callers must hold s.mu.
+func (s *Service) compileSchemaLocked(uri string) (*jsonschema.Schema, error) {
+	compiler := newSchemaCompiler()
+	for ref, doc := range s.schemas {
+		// Schemas built in Go may use typed slices such as []string, which
+		// the compiler does not accept; a JSON round trip normalizes them.
+		if err := compiler.AddResource(ref, normalizeJSON(doc)); err != nil {
+			return nil, err
+		}
+	}
+	return compiler.Compile(uri)
+}
+
+// inputSchema returns the compiled schema registered under uri, compiling
+// and caching it on first use. ok is false when no schema is registered.
+func (s *Service) inputSchema(uri string) (*jsonschema.Schema, bool, error) {
+	s.mu.RLock()
+	compiled, cached := s.compiledSchemas[uri]
+	_, registered := s.schemas[uri]
+	s.mu.RUnlock()
+	if cached || !registered {
+		return compiled, registered, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if compiled, cached := s.compiledSchemas[uri]; cached {
+		return compiled, true, nil
+	}
+	compiled, err := s.compileSchemaLocked(uri)
+	if err != nil {
+		return nil, true, err
+	}
+	s.compiledSchemas[uri] = compiled
+	return compiled, true, nil
+}
+
+// validatePayload checks an INVOKE payload against the capability's input
+// schema. Capabilities whose input schema is not registered are not checked.
+func (s *Service) validatePayload(capDesc CapabilityDescriptor, mode string, payload map[string]interface{}) *MigError {
+	if mode == SchemaValidationOff {
+		return nil
+	}
+	uri := capDesc.InputSchemaURI
+	schema, ok, err := s.inputSchema(uri)
+	if !ok {
+		return nil
+	}
+	if err != nil {
+		if mode == SchemaValidationWarn {
+			log.Printf("schema validation for %s skipped: input schema %s does not compile: %v", capDesc.ID, uri, err)
+			return nil
+		}
+		return &MigError{Code: ErrorInternal, Message: "input schema " + uri + " does not compile: " + err.Error(), Retryable: false}
+	}
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+	violations := schemaViolations(schema.Validate(payload))
+	if len(violations) == 0 {
+		return nil
+	}
+	if metrics := s.metricsSnapshot(); metrics != nil {
+		metrics.RecordSchemaViolation(capDesc.ID, mode)
+	}
+	if mode == SchemaValidationWarn {
+		messages := make([]string, len(violations))
+		for i, v := range violations {
+			messages[i] = "at '" + v.path + "': " + v.message
+		}
+		log.Printf("payload for %s does not match %s: %s", capDesc.ID, uri, strings.Join(messages, "; "))
+		return nil
+	}
+	details := make([]interface{}, len(violations))
+	for i, v := range violations {
+		details[i] = map[string]interface{}{"path": v.path, "message": v.message}
+	}
+	return &MigError{
+		Code:      ErrorInvalidRequest,
+		Message:   "payload does not match input schema " + uri,
+		Retryable: false,
+		Details:   map[string]interface{}{"schema_uri": uri, "violations": details},
+	}
+}
+
+// schemaViolations flattens a validation error into its innermost failures,
+// ordered by payload path.
+func schemaViolations(err error) []schemaViolation {
+	var verr *jsonschema.ValidationError
+	if !errors.As(err, &verr) {
+		if err != nil {
+			return []schemaViolation{{path: "", message: err.Error()}}
+		}
+		return nil
+	}
+	var out []schemaViolation
+	var walk func(*jsonschema.ValidationError)
+	walk = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			unit := e.BasicOutput()
+			out = append(out, schemaViolation{path: unit.InstanceLocation, message: unit.Error.String()})
+			return
+		}
+		for _, cause := range e.Causes {
+			walk(cause)
+		}
+	}
+	walk(verr)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].path < out[j].path })
+	return out
+}
@@ -0,0 +1,209 @@
+package mig
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func violationPaths(t *testing.T, err *MigError) []string {
+	t.Helper()
+	if err == nil || err.Code != ErrorInvalidRequest {
+		t.Fatalf("expected MIG_INVALID_REQUEST, got %#v", err)
+	}
+	violations, _ := err.Details["violations"].([]interface{})
+	paths := make([]string, 0, len(violations))
+	for _, v := range violations {
+		violation, _ := v.(map[string]interface{})
+		if message, _ := violation["message"].(string); message == "" {
+			t.Fatalf("violation without a message: %#v", v)
+		}
+		path, _ := violation["path"].(string)
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func TestInvokeValidatesBootstrappedSchema(t *testing.T) {
+	svc := newDemoService(t)
+	invoke := func(payload map[string]interface{}) *MigError {
+		_, err := svc.Invoke(context.Background(), "observatory.models.infer", InvokeRequest{
+			Header:  MessageHeader{TenantID: "acme"},
+			Payload: payload,
+		}, "tester", AnonymousPrincipal())
+		return err
+	}
+	if paths := violationPaths(t, invoke(map[string]interface{}{})); len(paths) != 1 || paths[0] != "" {
+		t.Fatalf("expected the missing input to be reported at the root, got %v", paths)
+	}
+	if paths := violationPaths(t, invoke(map[string]interface{}{"input": 42.0})); len(paths) != 1 || paths[0] != "/input" {
+		t.Fatalf("expected a type violation at /input, got %v", paths)
+	}
+	if err := invoke(map[string]interface{}{"input": "hello"}); err != nil {
+		t.Fatalf("valid payload rejected: %v", err.Message)
+	}
+}
+
+func TestInvokeValidatesDraft2020Schema(t *testing.T) {
+	svc := NewService()
+	if err := svc.AddSchema(SchemaUpsertRequest{URI: "schema://acme/common/v1", Schema: map[string]interface{}{
+		"$defs": map[string]interface{}{
+			"score": map[string]interface{}{"type": "number", "minimum": 0, "maximum": 1},
+		},
+	}}); err != nil {
+		t.Fatalf("add schema: %v", err.Message)
+	}
+	if err := svc.AddSchema(SchemaUpsertRequest{URI: "schema://acme/rank/v1", Schema: map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type":    "object",
+		"properties": map[string]interface{}{
+			"pair":      map[string]interface{}{"type": "array", "prefixItems": []interface{}{map[string]interface{}{"type": "string"}, map[string]interface{}{"type": "integer"}}},
+			"threshold": map[string]interface{}{"$ref": "schema://acme/common/v1#/$defs/score"},
+		},
+		"required":              []interface{}{"pair"},
+		"unevaluatedProperties": false,
+	}}); err != nil {
+		t.Fatalf("add schema: %v", err.Message)
+	}
+	desc := testDescriptor("acme.models.rank")
+	desc.InputSchemaURI = "schema://acme/rank/v1"
+	if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: desc, Provider: &ProviderConfig{Type: ProviderTypeEcho}}); err != nil {
+		t.Fatalf("add capability: %v", err.Message)
+	}
+
+	_, err := svc.Invoke(context.Background(), desc.ID, InvokeRequest{
+		Header:  MessageHeader{TenantID: "acme"},
+		Payload: map[string]interface{}{"pair": []interface{}{"a", "b"}, "threshold": 2.0, "extra": true},
+	}, "tester", AnonymousPrincipal())
+	paths := violationPaths(t, err)
+	if len(paths) != 3 || paths[0] != "/extra" || paths[1] != "/pair/1" || paths[2] != "/threshold" {
+		t.Fatalf("expected violations at /extra, /pair/1, and /threshold, got %v", paths)
+	}
+	if err.Details["schema_uri"] != "schema://acme/rank/v1" {
+		t.Fatalf("expected the schema URI in details, got %#v", err.Details)
+	}
+
+	if _, err := svc.Invoke(context.Background(), desc.ID, InvokeRequest{
+		Header:  MessageHeader{TenantID: "acme"},
+		Payload: map[string]interface{}{"pair": []interface{}{"a", 1.0}, "threshold": 0.5},
+	}, "tester", AnonymousPrincipal()); err != nil {
+		t.Fatalf("valid payload rejected: %v", err.Message)
+	}
+
+	if err := svc.AddSchema(SchemaUpsertRequest{URI: "schema://acme/broken/v1", Schema: map[string]interface{}{"type": 5}}); err == nil || err.Code != ErrorInvalidRequest {
+		t.Fatalf("expected an invalid schema to be rejected, got %#v", err)
+	}
+}
+
+func TestSchemaRefsResolveOnlyRegisteredSchemas(t *testing.T) {
+	svc := NewService()
+	// mig://a refers to mig://b before it exists.
+	if err := svc.AddSchema(SchemaUpsertRequest{URI: "mig://a", Schema: map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"b": map[string]interface{}{"$ref": "mig://b"}},
+	}}); err != nil {
+		t.Fatalf("forward $ref rejected: %v", err.Message)
+	}
+	desc := testDescriptor("acme.models.forward")
+	desc.InputSchemaURI = "mig://a"
+	if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: desc, Provider: &ProviderConfig{Type: ProviderTypeEcho}}); err != nil {
+		t.Fatalf("add capability: %v", err.Message)
+	}
+	invoke := func(id string, payload map[string]interface{}) *MigError {
+		_, err := svc.Invoke(context.Background(), id, InvokeRequest{Header: MessageHeader{TenantID: "acme"}, Payload: payload}, "tester", AnonymousPrincipal())
+		return err
+	}
+	if err := invoke(desc.ID, map[string]interface{}{"b": "x"}); err == nil || err.Code != ErrorInternal {
+		t.Fatalf("expected the unresolved $ref to surface at INVOKE, got %#v", err)
+	}
+	if err := svc.AddSchema(SchemaUpsertRequest{URI: "mig://b", Schema: map[string]interface{}{"type": "integer"}}); err != nil {
+		t.Fatalf("add schema: %v", err.Message)
+	}
+	if paths := violationPaths(t, invoke(desc.ID, map[string]interface{}{"b": "x"})); len(paths) != 1 || paths[0] != "/b" {
+		t.Fatalf("expected a violation at /b once mig://b exists, got %v", paths)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret.json")
+	if err := os.WriteFile(path, []byte(`{"type": "string"}`), 0o600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err := svc.AddSchema(SchemaUpsertRequest{URI: "mig://local", Schema: map[string]interface{}{"$ref": "file://" + path}}); err != nil {
+		t.Fatalf("add schema: %v", err.Message)
+	}
+	desc = testDescriptor("acme.models.local")
+	desc.InputSchemaURI = "mig://local"
+	if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: desc, Provider: &ProviderConfig{Type: ProviderTypeEcho}}); err != nil {
+		t.Fatalf("add capability: %v", err.Message)
+	}
+	err := invoke(desc.ID, map[string]interface{}{})
+	if err == nil || err.Code != ErrorInternal || !strings.Contains(err.Message, "is not a registered schema") {
+		t.Fatalf("expected a $ref to a local file to be refused, got %#v", err)
+	}
+}
+
+func TestSchemaValidationModes(t *testing.T) {
+	svc := NewService()
+	calls := 0
+	for _, mode := range []string{SchemaValidationWarn, SchemaValidationOff} {
+		desc := testDescriptor("acme.models." + mode)
+		desc.InputSchemaURI = "schema://observatory/models/infer-input/v1"
+		if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: desc, SchemaValidation: mode}); err != nil {
+			t.Fatalf("add capability: %v", err.Message)
+		}
+		_ = svc.BindProvider(desc.ID, ProviderFunc(func(context.Context, InvokeRequest) (map[string]interface{}, *MigError) {
+			calls++
+			return map[string]interface{}{}, nil
+		}))
+		if _, err := svc.Invoke(context.Background(), desc.ID, InvokeRequest{Header: MessageHeader{TenantID: "acme"}}, "tester", AnonymousPrincipal()); err != nil {
+			t.Fatalf("%s mode must dispatch invalid payloads: %v", mode, err.Message)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("expected both providers to be called, got %d calls", calls)
+	}
+
+	desc := testDescriptor("acme.models.strict")
+	if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: desc, SchemaValidation: "strict"}); err == nil || err.Code != ErrorInvalidRequest {
+		t.Fatalf("expected an unknown mode to be rejected, got %#v", err)
+	}
+}
+
+func TestSchemaViolationsOverHTTP(t *testing.T) {
+	svc := newDemoService(t)
+	mux := http.NewServeMux()
+	RegisterHTTPRoutes(mux, svc)
+	srv := httptest.NewServer(AuthMiddleware(AuthConfig{Mode: AuthModeNone})(mux))
+	defer srv.Close()
+
+	status, body := postJSONRaw(t, srv.URL+"/mig/v0.1/invoke/observatory.models.infer", InvokeRequest{
+		Header:  MessageHeader{TenantID: "acme"},
+		Payload: map[string]interface{}{"input": true},
+	}, nil)
+	if status != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", status, body)
+	}
+	var envelope struct {
+		Error struct {
+			Code    string `json:"code"`
+			Details struct {
+				Violations []struct {
+					Path    string `json:"path"`
+					Message string `json:"message"`
+				} `json:"violations"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		t.Fatalf("decode error envelope: %v", err)
+	}
+	violations := envelope.Error.Details.Violations
+	if envelope.Error.Code != ErrorInvalidRequest || len(violations) != 1 || violations[0].Path != "/input" || violations[0].Message == "" {
+		t.Fatalf("unexpected error envelope: %s", body)
+	}
+}
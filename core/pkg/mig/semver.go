@@ -0,0 +1,262 @@
+package mig
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// semVersion is a parsed MAJOR.MINOR.PATCH[-PRERELEASE] version. Build
+// metadata is ignored for ordering.
+type semVersion struct {
+	major, minor, patch int
+	pre                 string
+}
+
+func parseSemver(raw string) (semVersion, bool) {
+	v := strings.TrimPrefix(strings.TrimSpace(raw), "v")
+	if idx := strings.IndexByte(v, '+'); idx >= 0 {
+		v = v[:idx]
+	}
+	var out semVersion
+	if idx := strings.IndexByte(v, '-'); idx >= 0 {
+		out.pre = v[idx+1:]
+		v = v[:idx]
+		if out.pre == "" {
+			return semVersion{}, false
+		}
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return semVersion{}, false
+	}
+	nums := [3]int{}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return semVersion{}, false
+		}
+		nums[i] = n
+	}
+	out.major, out.minor, out.patch = nums[0], nums[1], nums[2]
+	return out, true
+}
+
+func (v semVersion) compare(o semVersion) int {
+	for _, d := range [3]int{v.major - o.major, v.minor - o.minor, v.patch - o.patch} {
+		if d != 0 {
+			if d < 0 {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case v.pre == o.pre:
+		return 0
+	case v.pre == "":
+		return 1
+	case o.pre == "":
+		return -1
+	}
+	return comparePrerelease(v.pre, o.pre)
+}
+
+func comparePrerelease(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+// versionConstraint is a set of alternatives ("||") each holding comparators
+// that must all match.
+type versionConstraint [][]versionComparator
+
+type versionComparator struct {
+	op      string
+	version semVersion
+}
+
+// parseVersionConstraint accepts npm-style ranges: exact versions, ^ and ~
+// ranges, comparison operators, x wildcards, and "||" alternatives. Partial
+// versions such as "^1.2" or "1.x" are allowed.
+func parseVersionConstraint(raw string) (versionConstraint, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || raw == "*" || raw == "latest" {
+		return nil, nil
+	}
+	var out versionConstraint
+	for _, alternative := range strings.Split(raw, "||") {
+		var set []versionComparator
+		fields := strings.FieldsFunc(alternative, func(r rune) bool { return r == ' ' || r == ',' })
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("empty version range in %q", raw)
+		}
+		for _, field := range fields {
+			comparators, err := parseComparator(field)
+			if err != nil {
+				return nil, err
+			}
+			set = append(set, comparators...)
+		}
+		out = append(out, set)
+	}
+	return out, nil
+}
+
+func parseComparator(field string) ([]versionComparator, error) {
+	op := ""
+	for _, candidate := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(field, candidate) {
+			op = candidate
+			break
+		}
+	}
+	body := strings.TrimPrefix(strings.TrimPrefix(field, op), "v")
+	if body == "" || body == "*" || body == "x" || body == "X" {
+		return nil, nil
+	}
+
+	// Fill in a partial version; track how many components were given.
+	pre := ""
+	if idx := strings.IndexByte(body, '-'); idx >= 0 {
+		pre = body[idx+1:]
+		body = body[:idx]
+	}
+	parts := strings.Split(body, ".")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("invalid version %q", field)
+	}
+	nums := [3]int{}
+	given := 0
+	for i, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			break
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version %q", field)
+		}
+		nums[i] = n
+		given++
+	}
+	if given < 3 && pre != "" {
+		return nil, fmt.Errorf("invalid version %q", field)
+	}
+	base := semVersion{major: nums[0], minor: nums[1], patch: nums[2], pre: pre}
+	ceiling := func(component int) semVersion {
+		switch component {
+		case 0:
+			return semVersion{major: base.major + 1, pre: "0"}
+		case 1:
+			return semVersion{major: base.major, minor: base.minor + 1, pre: "0"}
+		}
+		return semVersion{major: base.major, minor: base.minor, patch: base.patch + 1, pre: "0"}
+	}
+	if given == 0 {
+		return nil, nil
+	}
+
+	switch op {
+	case "^":
+		// Changes that do not modify the left-most non-zero component.
+		bump := 0
+		switch {
+		case base.major > 0 || given == 1:
+			bump = 0
+		case base.minor > 0 || given == 2:
+			bump = 1
+		default:
+			bump = 2
+		}
+		return []versionComparator{{">=", base}, {"<", ceiling(bump)}}, nil
+	case "~":
+		bump := 1
+		if given == 1 {
+			bump = 0
+		}
+		return []versionComparator{{">=", base}, {"<", ceiling(bump)}}, nil
+	case "", "=":
+		if given == 3 {
+			return []versionComparator{{"=", base}}, nil
+		}
+		return []versionComparator{{">=", base}, {"<", ceiling(given - 1)}}, nil
+	case ">":
+		if given < 3 {
+			return []versionComparator{{">=", ceiling(given - 1)}}, nil
+		}
+	case "<=":
+		if given < 3 {
+			return []versionComparator{{"<", ceiling(given - 1)}}, nil
+		}
+	}
+	return []versionComparator{{op, base}}, nil
+}
+
+func (c versionConstraint) matches(v semVersion) bool {
+	if len(c) == 0 {
+		return true
+	}
+	for _, set := range c {
+		if setMatches(set, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func setMatches(set []versionComparator, v semVersion) bool {
+	allowPre := v.pre == ""
+	for _, comparator := range set {
+		cmp := v.compare(comparator.version)
+		ok := false
+		switch comparator.op {
+		case "=":
+			ok = cmp == 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		}
+		if !ok {
+			return false
+		}
+		// Prereleases only match ranges that name a prerelease of the same
+		// MAJOR.MINOR.PATCH, so "^1.2" never picks up 1.3.0-beta.
+		cv := comparator.version
+		if cv.pre != "" && cv.pre != "0" && cv.major == v.major && cv.minor == v.minor && cv.patch == v.patch {
+			allowPre = true
+		}
+	}
+	return allowPre
+}
@@ -0,0 +1,147 @@
+package mig
+
+import (
+	"context"
+	"testing"
+)
+
+func TestVersionConstraintMatching(t *testing.T) {
+	cases := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{"", "2.3.4", true},
+		{"*", "0.0.1", true},
+		{"1.2.3", "1.2.3", true},
+		{"1.2.3", "1.2.4", false},
+		{"v1.2.3", "1.2.3+build.7", true},
+		{"^1.2", "1.9.0", true},
+		{"^1.2", "1.1.9", false},
+		{"^1.2", "2.0.0", false},
+		{"^0.2.1", "0.2.9", true},
+		{"^0.2.1", "0.3.0", false},
+		{"~1.2.3", "1.2.9", true},
+		{"~1.2.3", "1.3.0", false},
+		{"1.x", "1.7.2", true},
+		{"1.x", "2.0.0", false},
+		{">=1.2.0 <2.0.0", "1.5.0", true},
+		{">=1.2.0, <2.0.0", "2.0.0", false},
+		{">1.2", "1.2.9", false},
+		{">1.2", "1.3.0", true},
+		{"<=1.2", "1.2.7", true},
+		{"^1.0.0 || ^3.0.0", "3.1.0", true},
+		{"^1.0.0 || ^3.0.0", "2.1.0", false},
+		{"^1.2", "1.3.0-beta.1", false},
+		{"^1.3.0-beta.1", "1.3.0-beta.2", true},
+		{"^1.3.0-beta.1", "1.3.0", true},
+		{"^1.3.0-beta.1", "1.4.0-beta.1", false},
+	}
+	for _, tc := range cases {
+		constraint, err := parseVersionConstraint(tc.constraint)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tc.constraint, err)
+		}
+		version, ok := parseSemver(tc.version)
+		if !ok {
+			t.Fatalf("parse version %q failed", tc.version)
+		}
+		if got := constraint.matches(version); got != tc.want {
+			t.Fatalf("%q matches %q = %v, want %v", tc.constraint, tc.version, got, tc.want)
+		}
+	}
+	for _, bad := range []string{"^a.b", "1.2.3.4", ">=1.2-beta", "||"} {
+		if _, err := parseVersionConstraint(bad); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestSemverOrdering(t *testing.T) {
+	ordered := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0", "1.2.0", "10.0.0"}
+	for i := 1; i < len(ordered); i++ {
+		a, _ := parseSemver(ordered[i-1])
+		b, _ := parseSemver(ordered[i])
+		if a.compare(b) >= 0 {
+			t.Fatalf("expected %s < %s", ordered[i-1], ordered[i])
+		}
+	}
+}
+
+func TestInvokeResolvesCapabilityVersions(t *testing.T) {
+	svc := NewService()
+	for _, version := range []string{"1.2.0", "1.4.1", "2.0.0", "2.1.0-rc.1"} {
+		desc := testDescriptor("acme.tools.versioned")
+		desc.Version = version
+		reply := version
+		provider := ProviderFunc(func(context.Context, InvokeRequest) (map[string]interface{}, *MigError) {
+			return map[string]interface{}{"served_by": reply}, nil
+		})
+		if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: desc}); err != nil {
+			t.Fatalf("add %s: %v", version, err.Message)
+		}
+		if err := svc.BindProvider("acme.tools.versioned@"+version, provider); err != nil {
+			t.Fatalf("bind %s: %v", version, err.Message)
+		}
+	}
+
+	invoke := func(ref string, meta map[string]interface{}) (InvokeResponse, *MigError) {
+		return svc.Invoke(context.Background(), ref, InvokeRequest{
+			Header:  MessageHeader{TenantID: "acme", Meta: meta},
+			Payload: map[string]interface{}{},
+		}, "tester", AnonymousPrincipal())
+	}
+	cases := []struct {
+		ref  string
+		meta map[string]interface{}
+		want string
+	}{
+		{"acme.tools.versioned", nil, "2.0.0"},
+		{"acme.tools.versioned@^1", nil, "1.4.1"},
+		{"acme.tools.versioned@~1.2", nil, "1.2.0"},
+		{"acme.tools.versioned@2.1.0-rc.1", nil, "2.1.0-rc.1"},
+		{"acme.tools.versioned", map[string]interface{}{CapabilityVersionMetaKey: "<1.3"}, "1.2.0"},
+	}
+	for _, tc := range cases {
+		resp, err := invoke(tc.ref, tc.meta)
+		if err != nil {
+			t.Fatalf("invoke %s: %v", tc.ref, err.Message)
+		}
+		if resp.Payload["served_by"] != tc.want {
+			t.Fatalf("invoke %s served by %v, want %s", tc.ref, resp.Payload["served_by"], tc.want)
+		}
+		if resp.Capability != "acme.tools.versioned" || resp.Header.Meta[CapabilityVersionMetaKey] != tc.want {
+			t.Fatalf("unexpected response identity: %s %#v", resp.Capability, resp.Header.Meta)
+		}
+	}
+
+	if _, err := invoke("acme.tools.versioned@^3", nil); err == nil || err.Code != ErrorVersionMismatch {
+		t.Fatalf("expected version mismatch, got %#v", err)
+	}
+	if _, err := invoke("acme.tools.missing@^1", nil); err == nil || err.Code != ErrorUnsupportedCapability {
+		t.Fatalf("expected unsupported capability, got %#v", err)
+	}
+
+	discovered, err := svc.Discover(DiscoverRequest{Header: MessageHeader{TenantID: "acme"}}, AnonymousPrincipal())
+	if err != nil {
+		t.Fatalf("discover: %v", err.Message)
+	}
+	var versions []string
+	for _, desc := range discovered.Capabilities {
+		if desc.ID == "acme.tools.versioned" {
+			versions = append(versions, desc.Version)
+		}
+	}
+	if len(versions) != 4 || versions[0] != "1.2.0" || versions[3] != "2.1.0-rc.1" {
+		t.Fatalf("expected all versions in semver order, got %v", versions)
+	}
+}
+
+func TestAddCapabilityRequiresSemver(t *testing.T) {
+	svc := NewService()
+	desc := testDescriptor("acme.tools.unversioned")
+	desc.Version = "latest"
+	if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: desc}); err == nil || err.Code != ErrorInvalidRequest {
+		t.Fatalf("expected invalid request, got %#v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"sort"
 	"strconv"
@@ -12,6 +13,7 @@ import (
 	"time"
 
 	"github.com/nats-io/nats.go"
+	"github.com/santhosh-tekuri/jsonschema/v6"
 )
 
 type Service struct {
@@ -20,15 +22,37 @@ type Service struct {
 	serverID string
 	metrics  *Metrics
 
-	capabilities map[string]CapabilityDescriptor
-	schemas      map[string]map[string]interface{}
-	events       map[string][]EventMessage
-	subscribers  map[string]map[chan EventMessage]struct{}
-	idempotency  map[string]InvokeResponse
-	cancelled    map[string]string
-	quotas       map[string]int64
-	audit        []AuditRecord
-	connections  map[string]ConnectionSnapshot
+	capabilities  map[string]CapabilityDescriptor
+	providers     map[string]Provider
+	retryPolicies map[string]RetryPolicyConfig
+	transforms    map[string]*transformPipeline
+	canaries      map[string]*canary
+	shadows       map[string]*shadow
+	shadowOptOuts map[string]struct{}
+	shadowLog     []ShadowComparison
+	tunnels       map[string][]*tunnelSession
+	schemas       map[string]map[string]interface{}
+	events        map[string][]EventMessage
+	// subscribers maps each topic's subscriber channels to their tenant.
+	subscribers map[string]map[chan EventMessage]string
+	idempotency map[string]idempotencyEntry
+	cancelled   map[messageKey]cancelMark
+	inflight    map[messageKey][]*inflightCall
+	// inflightTenants indexes the tenants running each message ID, so a
+	// CANCEL from another tenant can be audited without a scan.
+	inflightTenants map[string]map[string]struct{}
+	completed       map[messageKey]time.Time
+	quotas          map[string]int64
+	// quotaHeld counts calls admitted against a quota that have not
+	// finished, so concurrent calls cannot together overshoot it.
+	quotaHeld   map[string]int64
+	audit       []AuditRecord
+	connections map[string]ConnectionSnapshot
+
+	// compiledSchemas caches compiled input schemas by URI; it is reset
+	// whenever a schema is added, since $ref may reach the new one.
+	compiledSchemas  map[string]*jsonschema.Schema
+	schemaValidation map[string]string
 
 	tenantInvocations     map[string]int64
 	capabilityInvocations map[string]int64
@@ -40,11 +64,50 @@ type Service struct {
 	natsBinding *NATSBinding
 	natsConn    *nats.Conn
 	auditLog    *os.File
+
+	shadowLogFile *os.File
+
+	// messageTTL bounds how long cancelled, completed, and idempotency
+	// entries are kept; all of them are keyed by tenant. Cancelled and
+	// completed entries expire sooner, after recentTTL.
+	messageTTL       time.Duration
+	messagesPrunedAt time.Time
+
+	jobs             map[messageKey]*job
+	jobRetention     time.Duration
+	maxJobsPerTenant int
+	webhookSecret    string
+	webhookGuard     webhookGuard
+	webhookClient    *http.Client
 }
 
 type ServiceOptions struct {
 	NATSURL      string
 	AuditLogPath string
+	// ShadowLogPath appends shadow comparisons as JSON lines.
+	ShadowLogPath string
+	// JobRetention is how long finished async jobs are kept. It defaults to
+	// 24 hours.
+	JobRetention time.Duration
+	// MaxJobsPerTenant caps the async jobs kept per tenant. Finished jobs
+	// closest to expiry make room for new ones; when all are unfinished,
+	// new jobs fail with MIG_RATE_LIMITED. It defaults to 1000.
+	MaxJobsPerTenant int
+	// WebhookSecret signs async job webhooks. Webhooks are refused without
+	// it.
+	WebhookSecret string
+	// WebhookAllowedHosts limits job webhooks to these host names. When it
+	// is empty, webhooks to non-public addresses are refused instead.
+	WebhookAllowedHosts []string
+	// MessageTTL is how long idempotent responses are remembered. It
+	// defaults to 24 hours. Cancellations and completed message IDs are
+	// kept for 10 minutes, or MessageTTL if that is shorter.
+	MessageTTL time.Duration
+	// DemoEcho binds EchoProvider to the bootstrapped
+	// observatory.models.infer capability, for demos and smoke tests.
+	// Without it the capability is registered but unbound, so it returns
+	// MIG_UNAVAILABLE until a provider is bound.
+	DemoEcho bool
 }
 
 func NewService() *Service {
@@ -59,18 +122,47 @@ func NewServiceWithOptions(opts ServiceOptions) (*Service, error) {
 	s := &Service{
 		serverID:              "migd-core",
 		capabilities:          map[string]CapabilityDescriptor{},
+		providers:             map[string]Provider{},
+		retryPolicies:         map[string]RetryPolicyConfig{},
+		transforms:            map[string]*transformPipeline{},
+		canaries:              map[string]*canary{},
+		shadows:               map[string]*shadow{},
+		shadowOptOuts:         map[string]struct{}{},
+		tunnels:               map[string][]*tunnelSession{},
 		schemas:               map[string]map[string]interface{}{},
+		compiledSchemas:       map[string]*jsonschema.Schema{},
+		schemaValidation:      map[string]string{},
 		events:                map[string][]EventMessage{},
-		subscribers:           map[string]map[chan EventMessage]struct{}{},
-		idempotency:           map[string]InvokeResponse{},
-		cancelled:             map[string]string{},
+		subscribers:           map[string]map[chan EventMessage]string{},
+		idempotency:           map[string]idempotencyEntry{},
+		cancelled:             map[messageKey]cancelMark{},
+		inflight:              map[messageKey][]*inflightCall{},
+		inflightTenants:       map[string]map[string]struct{}{},
+		completed:             map[messageKey]time.Time{},
 		quotas:                map[string]int64{},
+		quotaHeld:             map[string]int64{},
 		tenantInvocations:     map[string]int64{},
 		capabilityInvocations: map[string]int64{},
 		connections:           map[string]ConnectionSnapshot{},
 		orgs:                  map[string]Org{},
 		tenants:               map[string]Tenant{},
 		gateways:              map[string]Gateway{},
+		jobs:                  map[messageKey]*job{},
+		messageTTL:            opts.MessageTTL,
+		jobRetention:          opts.JobRetention,
+		maxJobsPerTenant:      opts.MaxJobsPerTenant,
+		webhookSecret:         opts.WebhookSecret,
+		webhookGuard:          newWebhookGuard(opts.WebhookAllowedHosts),
+	}
+	s.webhookClient = newWebhookClient(s.webhookGuard)
+	if s.messageTTL <= 0 {
+		s.messageTTL = defaultMessageTTL
+	}
+	if s.jobRetention <= 0 {
+		s.jobRetention = defaultJobRetention
+	}
+	if s.maxJobsPerTenant <= 0 {
+		s.maxJobsPerTenant = defaultMaxJobsPerTenant
 	}
 	if opts.NATSURL != "" {
 		nc, err := nats.Connect(opts.NATSURL)
@@ -86,11 +178,36 @@ func NewServiceWithOptions(opts ServiceOptions) (*Service, error) {
 		}
 		s.auditLog = file
 	}
-	s.bootstrapDefaults()
+	if opts.ShadowLogPath != "" {
+		file, err := os.OpenFile(opts.ShadowLogPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("open shadow log: %w", err)
+		}
+		s.shadowLogFile = file
+	}
+	s.bootstrapDefaults(opts.DemoEcho)
 	return s, nil
 }
 
 func (s *Service) Close() {
+	s.mu.Lock()
+	providers := s.providers
+	s.providers = map[string]Provider{}
+	shadows := s.shadows
+	s.shadows = map[string]*shadow{}
+	for _, j := range s.jobs {
+		if !j.terminal() {
+			j.cancel()
+		}
+	}
+	s.mu.Unlock()
+	for _, provider := range providers {
+		closeProvider(provider)
+	}
+	for _, sh := range shadows {
+		closeProvider(sh.provider)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if s.natsBinding != nil {
@@ -105,6 +222,10 @@ func (s *Service) Close() {
 		_ = s.auditLog.Close()
 		s.auditLog = nil
 	}
+	if s.shadowLogFile != nil {
+		_ = s.shadowLogFile.Close()
+		s.shadowLogFile = nil
+	}
 }
 
 func (s *Service) SetMetrics(metrics *Metrics) {
@@ -113,17 +234,20 @@ func (s *Service) SetMetrics(metrics *Metrics) {
 	s.mu.Unlock()
 }
 
-func (s *Service) recordError(code, operation string) {
+func (s *Service) metricsSnapshot() *Metrics {
 	s.mu.RLock()
-	metrics := s.metrics
-	s.mu.RUnlock()
-	if metrics != nil {
+	defer s.mu.RUnlock()
+	return s.metrics
+}
+
+func (s *Service) recordError(code, operation string) {
+	if metrics := s.metricsSnapshot(); metrics != nil {
 		metrics.RecordError(code, operation)
 	}
 }
 
-func (s *Service) bootstrapDefaults() {
-	s.capabilities["observatory.models.infer"] = CapabilityDescriptor{
+func (s *Service) bootstrapDefaults(demoEcho bool) {
+	s.capabilities[capabilityKey("observatory.models.infer", "1.0.0")] = CapabilityDescriptor{
 		ID:              "observatory.models.infer",
 		Version:         "1.0.0",
 		Modes:           []string{"unary", "server_stream"},
@@ -138,6 +262,9 @@ func (s *Service) bootstrapDefaults() {
 			SupportsOrdering:  true,
 		},
 	}
+	if demoEcho {
+		s.providers[capabilityKey("observatory.models.infer", "1.0.0")] = EchoProvider()
+	}
 	s.schemas["schema://observatory/models/infer-input/v1"] = map[string]interface{}{
 		"type": "object",
 		"properties": map[string]interface{}{
@@ -204,28 +331,43 @@ func (s *Service) Discover(req DiscoverRequest, principal Principal) (DiscoverRe
 	defer s.mu.RUnlock()
 
 	out := make([]CapabilityDescriptor, 0, len(s.capabilities))
-	for _, capDesc := range s.capabilities {
+	for key, capDesc := range s.capabilities {
 		if req.Query != "" && !strings.Contains(capDesc.ID, req.Query) {
 			continue
 		}
 		if !principal.HasAnyScope(capDesc.AuthScopes) {
 			continue
 		}
+		if tunnel, ok := s.providers[key].(*tunnelProvider); ok && !tunnel.discoverableLocked(head.TenantID) {
+			continue
+		}
 		out = append(out, capDesc)
 	}
-	sort.Slice(out, func(i, j int) bool {
-		return out[i].ID < out[j].ID
-	})
+	sortDescriptors(out)
 	return DiscoverResponse{Header: head, Capabilities: out}, nil
 }
 
+// Invoke runs one INVOKE. With header meta "mig.async" set to true the call
+// runs as a background job and the response carries the job ID instead.
 func (s *Service) Invoke(ctx context.Context, capability string, req InvokeRequest, actor string, principal Principal) (InvokeResponse, *MigError) {
+	if async, _ := req.Header.Meta[AsyncMetaKey].(bool); async {
+		return s.startJob(capability, req, actor, principal)
+	}
+	return s.invoke(ctx, capability, req, actor, principal, true)
+}
+
+// invoke runs one INVOKE. fallback is false for calls made on behalf of a
+// fallback chain, so chains do not nest.
+func (s *Service) invoke(ctx context.Context, capability string, req InvokeRequest, actor string, principal Principal, fallback bool) (InvokeResponse, *MigError) {
 	head := req.Header
 	if err := head.Normalize(time.Now()); err != nil {
 		s.recordError(ErrorInvalidRequest, "invoke")
 		return InvokeResponse{}, invalid(err.Error())
 	}
 	head.AddIDGMeta("core")
+	payload := req.Payload
+	deadlineAt := callDeadline(ctx, head, time.Now())
+	head.DeadlineMS = max(int(time.Until(deadlineAt).Milliseconds()), 1)
 	if capability == "" {
 		capability = req.Capability
 	}
@@ -233,90 +375,210 @@ func (s *Service) Invoke(ctx context.Context, capability string, req InvokeReque
 		s.recordError(ErrorInvalidRequest, "invoke")
 		return InvokeResponse{}, invalid("capability is required")
 	}
-	req.Capability = capability
+	constraint, _ := head.Meta[CapabilityVersionMetaKey].(string)
+	parent := invocationFromContext(ctx)
+	shadowed := parent != nil && parent.shadow
 
 	s.mu.RLock()
-	capDesc, ok := s.capabilities[capability]
-	if !ok {
+	// Canaries only split callers that did not pin a version.
+	var route *canaryRoute
+	if id, ref := splitCapabilityRef(capability); ref == "" && constraint == "" {
+		if route = s.routeCanaryLocked(id, head); route != nil {
+			constraint = "=" + route.version
+		}
+	}
+	key, capDesc, migErr := s.resolveCapabilityLocked(capability, constraint)
+	if migErr != nil {
 		s.mu.RUnlock()
-		s.recordError(ErrorUnsupportedCapability, "invoke")
-		return InvokeResponse{}, &MigError{Code: ErrorUnsupportedCapability, Message: "capability not found", Retryable: false}
+		s.recordError(migErr.Code, "invoke")
+		return InvokeResponse{}, migErr
 	}
+	capability = capDesc.ID
+	head.Meta[CapabilityVersionMetaKey] = capDesc.Version
+	if route != nil {
+		head.Meta[CanaryMetaKey] = route.arm
+	}
+	req.Capability = capability
+	req.Header = head
 	if !principal.HasAnyScope(capDesc.AuthScopes) {
 		s.mu.RUnlock()
 		s.recordError(ErrorForbidden, "invoke")
 		return InvokeResponse{}, &MigError{Code: ErrorForbidden, Message: "insufficient capability scope", Retryable: false}
 	}
-	if reason, cancelled := s.cancelled[head.MessageID]; cancelled {
+	provider := s.providers[key]
+	if provider == nil {
+		s.mu.RUnlock()
+		s.recordError(ErrorUnavailable, "invoke")
+		unbound := &MigError{Code: ErrorUnavailable, Message: "no provider bound to capability", Retryable: true}
+		// A candidate without a provider has failed just as if it had been
+		// called.
+		s.countCanaryRoute(route, capability)
+		s.finishCanary(route, actor, req, unbound, false)
+		if fallback && capDesc.Fallback.triggers(unbound.Code) {
+			return s.invokeFallback(ctx, capDesc, key, head, payload, unbound, deadlineAt, actor, principal)
+		}
+		return InvokeResponse{}, unbound
+	}
+	if reason, cancelled := s.precancelledLocked(head, principal, time.Now()); cancelled {
 		s.mu.RUnlock()
 		s.recordError(ErrorTimeout, "invoke")
-		return InvokeResponse{}, &MigError{Code: ErrorTimeout, Message: "invocation cancelled: " + reason, Retryable: true}
+		return InvokeResponse{}, cancelledError(reason)
 	}
 	if head.IdempotencyKey != "" {
-		idKey := fmt.Sprintf("%s:%s:%s", head.TenantID, capability, head.IdempotencyKey)
-		if cached, exists := s.idempotency[idKey]; exists {
+		idKey := fmt.Sprintf("%s:%s:%s", head.TenantID, key, head.IdempotencyKey)
+		if cached, exists := s.idempotentLocked(idKey, time.Now()); exists {
 			s.mu.RUnlock()
 			cached.Header = head
 			return cached, nil
 		}
 	}
-	quota, hasQuota := s.quotas[head.TenantID]
-	used := s.tenantInvocations[head.TenantID]
+	if migErr := checkBudget(capDesc, deadlineAt, time.Now()); migErr != nil {
+		s.mu.RUnlock()
+		s.recordError(migErr.Code, "invoke")
+		return InvokeResponse{}, migErr
+	}
+	var policy *RetryPolicyConfig
+	if configured, ok := s.retryPolicies[key]; ok {
+		policy = &configured
+	}
+	var mirror *shadow
+	if !shadowed {
+		mirror = s.shadowForLocked(capability, head)
+	}
+	transforms := s.transforms[key]
+	validation := s.schemaValidation[key]
 	s.mu.RUnlock()
+	idempotent := capDesc.Idempotent || head.IdempotencyKey != ""
 
-	if hasQuota && used >= quota {
-		s.recordError(ErrorRateLimited, "invoke")
-		return InvokeResponse{}, &MigError{Code: ErrorRateLimited, Message: "tenant quota exceeded", Retryable: true}
+	held := false
+	if !shadowed {
+		if held, migErr = s.holdQuota(head.TenantID); migErr != nil {
+			s.recordError(migErr.Code, "invoke")
+			return InvokeResponse{}, migErr
+		}
+	}
+	defer s.releaseQuota(head.TenantID, &held)
+	if migErr := s.validatePayload(capDesc, validation, req.Payload); migErr != nil {
+		s.recordError(migErr.Code, "invoke")
+		return InvokeResponse{}, migErr
+	}
+	if steps := transforms.steps(TransformDirectionInput); len(steps) > 0 {
+		transformed, err := applySteps(steps, req.Payload, false, nil)
+		if err != nil {
+			s.recordError(ErrorInvalidRequest, "invoke")
+			return InvokeResponse{}, invalid("input transform failed: " + err.Error())
+		}
+		req.Payload = transformed
 	}
 
-	deadline := time.Duration(head.DeadlineMS) * time.Millisecond
-	reqCtx, cancel := context.WithTimeout(ctx, deadline)
+	s.countCanaryRoute(route, capability)
+	trackedCtx, release := s.trackInvocation(ctx, head, principal)
+	defer release()
+	reqCtx, cancel := context.WithDeadline(trackedCtx, deadlineAt)
 	defer cancel()
+	inv := &invocation{actor: actor, principal: principal, shadow: shadowed}
+	if parent != nil {
+		inv.depth = parent.depth + 1
+	}
+	reqCtx = context.WithValue(reqCtx, invocationKey{}, inv)
 
 	type result struct {
-		payload map[string]interface{}
-		err     *MigError
+		payload  map[string]interface{}
+		err      *MigError
+		attempts int
 	}
 	ch := make(chan result, 1)
+	started := time.Now()
 	go func() {
-		ch <- result{payload: map[string]interface{}{
-			"result":       "ok",
-			"echo":         req.Payload,
-			"capability":   capability,
-			"delivery_qos": capDesc.QoS.DeliverySemantics,
-		}}
+		payload, err, attempts := s.invokeAttempts(reqCtx, provider, req, policy, idempotent, actor)
+		ch <- result{payload: payload, err: err, attempts: attempts}
 	}()
 
 	select {
 	case <-reqCtx.Done():
 		s.recordError(ErrorTimeout, "invoke")
-		return InvokeResponse{}, &MigError{Code: ErrorTimeout, Message: "deadline exceeded", Retryable: true}
+		timeout := &MigError{Code: ErrorTimeout, Message: "deadline exceeded", Retryable: true}
+		if reason, cancelled := cancelledBy(reqCtx); cancelled {
+			timeout = cancelledError(reason)
+		}
+		s.finishCanary(route, actor, req, timeout, callerAborted(ctx, reqCtx))
+		return InvokeResponse{}, timeout
 	case out := <-ch:
+		s.finishCanary(route, actor, req, out.err, out.err != nil && callerAborted(ctx, reqCtx))
+		var outputErr *MigError
+		if steps := transforms.steps(TransformDirectionOutput); len(steps) > 0 && out.err == nil {
+			transformed, err := applySteps(steps, out.payload, false, nil)
+			if err != nil {
+				outputErr = &MigError{Code: ErrorInternal, Message: "output transform failed: " + err.Error(), Retryable: false}
+			} else {
+				out.payload = transformed
+			}
+		}
+		if mirror != nil {
+			// The shadow gets the request as the caller sent it and is
+			// compared with what the caller gets back.
+			primaryErr := out.err
+			if outputErr != nil {
+				primaryErr = outputErr
+			}
+			s.mirror(mirror, InvokeRequest{Header: head, Capability: capability, Payload: payload}, inv, capDesc.Version, out.payload, primaryErr, time.Since(started))
+		}
 		if out.err != nil {
 			s.recordError(out.err.Code, "invoke")
+			if reason, cancelled := cancelledBy(reqCtx); cancelled {
+				// A cancelled call is not retried down the fallback chain.
+				return InvokeResponse{}, cancelledError(reason)
+			}
+			if fallback && capDesc.Fallback.triggers(out.err.Code) {
+				// The failed call used no quota; the fallback takes its own.
+				s.releaseQuota(head.TenantID, &held)
+				return s.invokeFallback(ctx, capDesc, key, head, payload, out.err, deadlineAt, actor, principal)
+			}
 			return InvokeResponse{}, out.err
 		}
+		if outputErr != nil {
+			s.recordError(outputErr.Code, "invoke")
+			return InvokeResponse{}, outputErr
+		}
+		inv.copyMeta(head.Meta)
 		resp := InvokeResponse{
 			Header:          head,
 			Capability:      capability,
 			Payload:         out.payload,
 			ResultSchemaURI: capDesc.OutputSchemaURI,
 		}
+		if shadowed {
+			return resp, nil
+		}
 		s.mu.Lock()
 		if head.IdempotencyKey != "" {
-			idKey := fmt.Sprintf("%s:%s:%s", head.TenantID, capability, head.IdempotencyKey)
-			s.idempotency[idKey] = resp
+			idKey := fmt.Sprintf("%s:%s:%s", head.TenantID, key, head.IdempotencyKey)
+			s.rememberIdempotentLocked(idKey, resp, time.Now())
 		}
 		s.tenantInvocations[head.TenantID]++
 		s.capabilityInvocations[capability]++
-		s.audit = append(s.audit, AuditRecord{
+		if held {
+			s.unholdQuotaLocked(head.TenantID)
+			held = false
+		}
+		record := AuditRecord{
 			Actor:      actor,
 			TenantID:   head.TenantID,
 			Capability: capability,
+			Version:    capDesc.Version,
 			Outcome:    "success",
 			Timestamp:  time.Now().UTC().Format(time.RFC3339),
 			MessageID:  head.MessageID,
-		})
+			DurationMS: durationMS(time.Since(started)),
+		}
+		record.Parent, _ = head.Meta[ParentCapabilityMetaKey].(string)
+		if route != nil {
+			record.Canary = route.arm
+		}
+		if policy != nil {
+			record.Attempt = out.attempts
+		}
+		s.audit = append(s.audit, record)
 		s.writeAuditLogLocked(s.audit[len(s.audit)-1])
 		s.mu.Unlock()
 		return resp, nil
@@ -355,7 +617,10 @@ func (s *Service) Publish(topic string, req PublishRequest) (PublishAck, *MigErr
 		Replay:      false,
 	}
 	s.events[topic] = append(s.events[topic], event)
-	for sub := range s.subscribers[topic] {
+	for sub, tenantID := range s.subscribers[topic] {
+		if !eventVisibleTo(event, tenantID) {
+			continue
+		}
 		select {
 		case sub <- event:
 		default:
@@ -371,7 +636,19 @@ func (s *Service) Publish(topic string, req PublishRequest) (PublishAck, *MigErr
 	}, nil
 }
 
-func (s *Service) Subscribe(topic, resumeCursor string) ([]EventMessage, <-chan EventMessage, func(), *MigError) {
+// eventVisibleTo reports whether a subscriber in tenantID may receive event.
+// Job notifications, marked with JobIDMetaKey, carry job results, so only the
+// job's tenant receives them.
+func eventVisibleTo(event EventMessage, tenantID string) bool {
+	if _, job := event.Header.Meta[JobIDMetaKey]; job {
+		return event.Header.TenantID == tenantID
+	}
+	return true
+}
+
+// Subscribe streams a topic to a subscriber in tenantID, replaying retained
+// events from resumeCursor first.
+func (s *Service) Subscribe(tenantID, topic, resumeCursor string) ([]EventMessage, <-chan EventMessage, func(), *MigError) {
 	if topic == "" {
 		s.recordError(ErrorInvalidRequest, "subscribe")
 		return nil, nil, nil, invalid("topic is required")
@@ -396,16 +673,18 @@ func (s *Service) Subscribe(topic, resumeCursor string) ([]EventMessage, <-chan
 	if start > len(all) {
 		start = len(all)
 	}
-	snapshot := make([]EventMessage, len(all[start:]))
-	copy(snapshot, all[start:])
-	for i := range snapshot {
-		snapshot[i].Replay = true
+	snapshot := make([]EventMessage, 0, len(all[start:]))
+	for _, event := range all[start:] {
+		if eventVisibleTo(event, tenantID) {
+			event.Replay = true
+			snapshot = append(snapshot, event)
+		}
 	}
 	if s.subscribers[topic] == nil {
-		s.subscribers[topic] = map[chan EventMessage]struct{}{}
+		s.subscribers[topic] = map[chan EventMessage]string{}
 	}
 	ch := make(chan EventMessage, 32)
-	s.subscribers[topic][ch] = struct{}{}
+	s.subscribers[topic][ch] = tenantID
 	unsub := func() {
 		s.mu.Lock()
 		if subs := s.subscribers[topic]; subs != nil {
@@ -417,7 +696,12 @@ func (s *Service) Subscribe(topic, resumeCursor string) ([]EventMessage, <-chan
 	return snapshot, ch, unsub, nil
 }
 
-func (s *Service) Cancel(req CancelRequest, messageID string) (CancelAck, *MigError) {
+// Cancel aborts the tenant's running invocations, streams, and async job
+// with messageID. The ack status is cancelled, not_found, or
+// already_completed; only already_completed is not accepted. Authenticated
+// principals may only cancel their own work unless they hold
+// CancelAdminScope.
+func (s *Service) Cancel(req CancelRequest, messageID, actor string, principal Principal) (CancelAck, *MigError) {
 	head := req.Header
 	if err := head.Normalize(time.Now()); err != nil {
 		s.recordError(ErrorInvalidRequest, "cancel")
@@ -431,14 +715,16 @@ func (s *Service) Cancel(req CancelRequest, messageID string) (CancelAck, *MigEr
 		s.recordError(ErrorInvalidRequest, "cancel")
 		return CancelAck{}, invalid("target message id is required")
 	}
-	s.mu.Lock()
-	s.cancelled[messageID] = req.Reason
-	s.mu.Unlock()
+	status, migErr := s.cancelMessage(head, messageID, req.Reason, actor, principal)
+	if migErr != nil {
+		s.recordError(migErr.Code, "cancel")
+		return CancelAck{}, migErr
+	}
 	return CancelAck{
 		Header:          head,
 		TargetMessageID: messageID,
-		Accepted:        true,
-		Status:          "cancelled",
+		Accepted:        status != CancelStatusAlreadyCompleted,
+		Status:          status,
 	}, nil
 }
 
@@ -458,16 +744,91 @@ func (s *Service) Heartbeat(req HeartbeatRequest) (HeartbeatAck, *MigError) {
 	return HeartbeatAck{Header: head, SuggestedIntervalMS: req.IntervalMS, LoadFactor: load}, nil
 }
 
+// AddCapability registers a capability version. Descriptors with the same ID
+// and a different version coexist; the same ID and version is replaced.
 func (s *Service) AddCapability(req CapabilityUpsertRequest) *MigError {
-	if req.Descriptor.ID == "" || req.Descriptor.Version == "" {
-		return invalid("descriptor.id and descriptor.version are required")
+	if err := ValidateDescriptor(req.Descriptor); err != nil {
+		return err
 	}
-	if req.Descriptor.InputSchemaURI == "" || req.Descriptor.OutputSchemaURI == "" {
-		return invalid("schema URIs are required")
+	key := capabilityKey(req.Descriptor.ID, req.Descriptor.Version)
+	if req.CircuitBreaker != nil && req.Provider == nil {
+		return invalid("circuit_breaker requires a provider")
+	}
+	if req.Hedge != nil && req.Provider == nil {
+		return invalid("hedge requires a provider")
+	}
+	validation, err := normalizeSchemaValidation(req.SchemaValidation)
+	if err != nil {
+		return err
+	}
+	var retry *RetryPolicyConfig
+	if req.Retry != nil {
+		normalized, err := normalizeRetryPolicy(*req.Retry)
+		if err != nil {
+			return err
+		}
+		retry = &normalized
+	}
+	var transforms *transformPipeline
+	if req.Transforms != nil {
+		compiled, err := compileTransforms(*req.Transforms)
+		if err != nil {
+			return err
+		}
+		s.mu.RLock()
+		inputSchema, outputSchema := s.schemas[req.Descriptor.InputSchemaURI], s.schemas[req.Descriptor.OutputSchemaURI]
+		s.mu.RUnlock()
+		if err := validateTransforms(compiled, inputSchema, outputSchema); err != nil {
+			return err
+		}
+		transforms = compiled
+	}
+	var provider Provider
+	if req.Provider != nil {
+		built, err := s.newProvider(key, *req.Provider)
+		if err != nil {
+			return err
+		}
+		provider = built
+	}
+	if req.CircuitBreaker != nil {
+		guarded, err := s.withCircuitBreaker(key, provider, *req.CircuitBreaker)
+		if err != nil {
+			closeProvider(provider)
+			return err
+		}
+		provider = guarded
+	}
+	if req.Hedge != nil {
+		if err := withHedge(provider, *req.Hedge); err != nil {
+			closeProvider(provider)
+			return err
+		}
 	}
 	s.mu.Lock()
-	s.capabilities[req.Descriptor.ID] = req.Descriptor
+	s.capabilities[key] = req.Descriptor
+	if retry != nil {
+		s.retryPolicies[key] = *retry
+	} else {
+		delete(s.retryPolicies, key)
+	}
+	if transforms != nil {
+		s.transforms[key] = transforms
+	} else {
+		delete(s.transforms, key)
+	}
+	if validation != SchemaValidationEnforce {
+		s.schemaValidation[key] = validation
+	} else {
+		delete(s.schemaValidation, key)
+	}
+	var previous Provider
+	if provider != nil {
+		previous = s.providers[key]
+		s.providers[key] = provider
+	}
 	s.mu.Unlock()
+	closeProvider(previous)
 	return nil
 }
 
@@ -478,20 +839,136 @@ func (s *Service) ListCapabilities() []CapabilityDescriptor {
 	for _, desc := range s.capabilities {
 		out = append(out, desc)
 	}
-	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	sortDescriptors(out)
 	return out
 }
 
+// capabilityKey identifies one registered version of a capability in the
+// catalog, provider, and policy maps.
+func capabilityKey(id, version string) string {
+	return id + "@" + version
+}
+
+// splitCapabilityRef splits "id@constraint" into its parts.
+func splitCapabilityRef(ref string) (string, string) {
+	if idx := strings.LastIndexByte(ref, '@'); idx >= 0 {
+		return ref[:idx], ref[idx+1:]
+	}
+	return ref, ""
+}
+
+// resolveCapabilityLocked finds the highest registered version of a capability
+// that satisfies the version constraint. A constraint in ref ("id@^1.2") takes
+// precedence over the one passed separately. Callers must hold s.mu.
+func (s *Service) resolveCapabilityLocked(ref, constraint string) (string, CapabilityDescriptor, *MigError) {
+	id, refConstraint := splitCapabilityRef(ref)
+	if refConstraint != "" {
+		constraint = refConstraint
+	}
+	parsed, err := parseVersionConstraint(constraint)
+	if err != nil {
+		return "", CapabilityDescriptor{}, invalid("invalid capability version constraint: " + err.Error())
+	}
+	var (
+		bestKey  string
+		best     CapabilityDescriptor
+		bestVer  semVersion
+		found    bool
+		resolved bool
+	)
+	for key, desc := range s.capabilities {
+		if desc.ID != id {
+			continue
+		}
+		found = true
+		version, ok := parseSemver(desc.Version)
+		if !ok || !parsed.matches(version) {
+			continue
+		}
+		if !resolved || preferVersion(version, bestVer, parsed == nil) {
+			bestKey, best, bestVer, resolved = key, desc, version, true
+		}
+	}
+	switch {
+	case !found:
+		return "", CapabilityDescriptor{}, &MigError{Code: ErrorUnsupportedCapability, Message: "capability not found", Retryable: false}
+	case !resolved:
+		return "", CapabilityDescriptor{}, &MigError{
+			Code:      ErrorVersionMismatch,
+			Message:   "no version of " + id + " satisfies " + constraint,
+			Retryable: false,
+			Details:   map[string]interface{}{"capability": id, "constraint": constraint},
+		}
+	}
+	return bestKey, best, nil
+}
+
+// preferVersion reports whether candidate beats current. Without a constraint
+// a stable release beats any prerelease, so prereleases are only picked by
+// default when nothing else is registered.
+func preferVersion(candidate, current semVersion, unconstrained bool) bool {
+	if unconstrained && (candidate.pre == "") != (current.pre == "") {
+		return candidate.pre == ""
+	}
+	return candidate.compare(current) > 0
+}
+
+// ValidateDescriptor reports why AddCapability would reject desc, without
+// registering anything.
+func ValidateDescriptor(desc CapabilityDescriptor) *MigError {
+	if desc.ID == "" || desc.Version == "" {
+		return invalid("descriptor.id and descriptor.version are required")
+	}
+	if strings.Contains(desc.ID, "@") {
+		return invalid("descriptor.id must not contain '@'")
+	}
+	if _, ok := parseSemver(desc.Version); !ok {
+		return invalid("descriptor.version must be a semantic version such as 1.2.0")
+	}
+	if desc.InputSchemaURI == "" || desc.OutputSchemaURI == "" {
+		return invalid("schema URIs are required")
+	}
+	if desc.QoS.MinLatencyMS < 0 {
+		return invalid("qos.min_latency_ms must be >= 0")
+	}
+	return validateFallback(desc)
+}
+
+// sortDescriptors orders by ID, then by ascending semantic version.
+func sortDescriptors(out []CapabilityDescriptor) {
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ID != out[j].ID {
+			return out[i].ID < out[j].ID
+		}
+		vi, _ := parseSemver(out[i].Version)
+		vj, _ := parseSemver(out[j].Version)
+		return vi.compare(vj) < 0
+	})
+}
+
 func (s *Service) AddSchema(req SchemaUpsertRequest) *MigError {
+	if err := ValidateSchema(req); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schemas[req.URI] = req.Schema
+	s.compiledSchemas = map[string]*jsonschema.Schema{}
+	return nil
+}
+
+// ValidateSchema reports why AddSchema would reject req, without storing the
+// schema.
+func ValidateSchema(req SchemaUpsertRequest) *MigError {
 	if req.URI == "" {
 		return invalid("uri is required")
 	}
 	if len(req.Schema) == 0 {
 		return invalid("schema is required")
 	}
-	s.mu.Lock()
-	s.schemas[req.URI] = req.Schema
-	s.mu.Unlock()
+	if err := checkSchemaStructure(req.Schema); err != nil {
+		return invalid("schema is not valid: " + err.Error())
+	}
 	return nil
 }
 
@@ -507,9 +984,9 @@ func (s *Service) ValidatePolicy(req PolicyValidateRequest) (PolicyValidateRespo
 		return PolicyValidateResponse{Allowed: false, Reason: "unsupported action"}, nil
 	}
 	s.mu.RLock()
-	_, exists := s.capabilities[req.Capability]
+	_, _, migErr := s.resolveCapabilityLocked(req.Capability, "")
 	s.mu.RUnlock()
-	if !exists {
+	if migErr != nil {
 		return PolicyValidateResponse{Allowed: false, Reason: "capability does not exist"}, nil
 	}
 	return PolicyValidateResponse{Allowed: true}, nil
@@ -528,6 +1005,42 @@ func (s *Service) SetQuota(req QuotaRequest) (QuotaResponse, *MigError) {
 	return QuotaResponse{TenantID: req.TenantID, MaxInvocations: req.MaxInvocations}, nil
 }
 
+// holdQuota admits one call against the tenant's quota. Calls in flight
+// count as used until they finish, so concurrent calls, such as batch items,
+// cannot together go over it. held reports whether releaseQuota must follow.
+func (s *Service) holdQuota(tenantID string) (held bool, migErr *MigError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	quota, ok := s.quotas[tenantID]
+	if !ok {
+		return false, nil
+	}
+	if s.tenantInvocations[tenantID]+s.quotaHeld[tenantID] >= quota {
+		return false, &MigError{Code: ErrorRateLimited, Message: "tenant quota exceeded", Retryable: true}
+	}
+	s.quotaHeld[tenantID]++
+	return true, nil
+}
+
+// releaseQuota gives back a hold taken by holdQuota, at most once.
+func (s *Service) releaseQuota(tenantID string, held *bool) {
+	if !*held {
+		return
+	}
+	*held = false
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unholdQuotaLocked(tenantID)
+}
+
+func (s *Service) unholdQuotaLocked(tenantID string) {
+	if s.quotaHeld[tenantID] <= 1 {
+		delete(s.quotaHeld, tenantID)
+		return
+	}
+	s.quotaHeld[tenantID]--
+}
+
 func (s *Service) AuditExport(tenantID string) []AuditRecord {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -6,6 +6,28 @@ import (
 	"time"
 )
 
+// newDemoService returns a service with EchoProvider bound to the
+// bootstrapped observatory.models.infer capability.
+func newDemoService(t *testing.T) *Service {
+	t.Helper()
+	svc, err := NewServiceWithOptions(ServiceOptions{DemoEcho: true})
+	if err != nil {
+		t.Fatalf("service: %v", err)
+	}
+	return svc
+}
+
+func TestBootstrapCapabilityIsUnboundByDefault(t *testing.T) {
+	svc := NewService()
+	_, err := svc.Invoke(context.Background(), "observatory.models.infer", InvokeRequest{
+		Header:  MessageHeader{TenantID: "acme"},
+		Payload: map[string]interface{}{"input": "hello"},
+	}, "tester", jwtPrincipal("tester", "capability:infer"))
+	if err == nil || err.Code != ErrorUnavailable {
+		t.Fatalf("expected %s without the demo echo provider, got %#v", ErrorUnavailable, err)
+	}
+}
+
 func TestHeaderNormalizeDefaults(t *testing.T) {
 	head := MessageHeader{TenantID: "acme"}
 	if err := head.Normalize(time.Now()); err != nil {
@@ -23,7 +45,7 @@ func TestHeaderNormalizeDefaults(t *testing.T) {
 }
 
 func TestInvokeIdempotency(t *testing.T) {
-	svc := NewService()
+	svc := newDemoService(t)
 	req := InvokeRequest{
 		Header: MessageHeader{TenantID: "acme", IdempotencyKey: "id-1"},
 		Payload: map[string]interface{}{
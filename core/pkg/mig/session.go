@@ -0,0 +1,328 @@
+package mig
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// StreamModeMetaKey on the header of a request frame opens a client_stream or
+// bidi_stream session. Later request frames with the same stream ID feed the
+// session until one sets EndStream.
+const StreamModeMetaKey = "mig.stream_mode"
+
+const sessionInputBuffer = 16
+
+// SessionProvider is implemented by providers that accept several request
+// frames per invocation, such as audio chunks for a transcription model.
+type SessionProvider interface {
+	// InvokeSession serves one client-streaming or bidirectional invocation.
+	// req carries the opening frame. in yields each later request frame and
+	// is closed after the frame that set EndStream. Output frames go to emit
+	// as they are produced; the final one must set EndStream.
+	InvokeSession(ctx context.Context, req InvokeRequest, in <-chan StreamFrame, emit func(StreamFrame) error) *MigError
+}
+
+// SessionProviderFunc adapts a session function to Provider and
+// SessionProvider. Unary and server-streaming calls run it with the request
+// as the only input frame.
+type SessionProviderFunc func(ctx context.Context, req InvokeRequest, in <-chan StreamFrame, emit func(StreamFrame) error) *MigError
+
+func (f SessionProviderFunc) Invoke(ctx context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+	return StreamProviderFunc(f.InvokeStream).Invoke(ctx, req)
+}
+
+func (f SessionProviderFunc) InvokeStream(ctx context.Context, req InvokeRequest, emit func(StreamFrame) error) *MigError {
+	in := make(chan StreamFrame)
+	close(in)
+	return f(ctx, req, in, emit)
+}
+
+func (f SessionProviderFunc) InvokeSession(ctx context.Context, req InvokeRequest, in <-chan StreamFrame, emit func(StreamFrame) error) *MigError {
+	return f(ctx, req, in, emit)
+}
+
+// StreamSession is an open client_stream or bidi_stream invocation. Input
+// frames are passed in with Send; output frames go to the emit function given
+// to OpenSession.
+type StreamSession struct {
+	mode       string
+	tenantID   string
+	inputSteps []compiledStep
+	in         chan StreamFrame
+	cancel     func()
+
+	mu        sync.Mutex
+	inputDone bool
+
+	done chan struct{}
+	err  *MigError
+}
+
+// OpenSession starts a client_stream or bidi_stream invocation with req as
+// its first input frame. The capability must advertise mode and its provider
+// must implement SessionProvider. The header deadline bounds the whole
+// session. When the session ends it is audited with the number of frames
+// relayed, and Done is closed.
+func (s *Service) OpenSession(ctx context.Context, capability, mode string, req InvokeRequest, endInput bool, actor string, principal Principal, emit func(StreamFrame) error) (*StreamSession, *MigError) {
+	if mode != ModeClientStream && mode != ModeBidiStream {
+		s.recordError(ErrorInvalidRequest, "invoke_session")
+		return nil, invalid(StreamModeMetaKey + " must be client_stream or bidi_stream")
+	}
+	call, ok, migErr := s.prepareStream(ctx, capability, req, principal, mode, "invoke_session")
+	if migErr != nil {
+		return nil, migErr
+	}
+	if !ok {
+		s.recordError(ErrorUnsupportedCapability, "invoke_session")
+		return nil, &MigError{Code: ErrorUnsupportedCapability, Message: "capability does not support " + mode, Retryable: false}
+	}
+	provider, ok := call.provider.(SessionProvider)
+	if !ok {
+		s.recordError(ErrorUnsupportedCapability, "invoke_session")
+		return nil, &MigError{Code: ErrorUnsupportedCapability, Message: "the provider bound to " + call.capDesc.ID + " does not accept streamed input", Retryable: false}
+	}
+	reqCtx, cancel := s.streamContext(ctx, call, actor, principal)
+	session := &StreamSession{
+		mode:       mode,
+		tenantID:   call.req.Header.TenantID,
+		inputSteps: call.inputSteps,
+		in:         make(chan StreamFrame, sessionInputBuffer),
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	if endInput {
+		session.inputDone = true
+		close(session.in)
+	}
+	relay := newFrameRelay(call, emit)
+	started := time.Now()
+	providerDone := make(chan *MigError, 1)
+	go func() {
+		providerDone <- provider.InvokeSession(reqCtx, call.req, session.in, relay.relay)
+	}()
+	go func() {
+		defer cancel()
+		outErr := relay.finish(reqCtx, awaitProvider(ctx, reqCtx, providerDone))
+		if outErr != nil {
+			s.recordError(outErr.Code, "invoke_session")
+		}
+		if cancelled := s.auditStream(actor, call, mode, relay, time.Since(started), outErr); !cancelled {
+			session.err = outErr
+		}
+		close(session.done)
+		session.endInput()
+	}()
+	return session, nil
+}
+
+// Send passes the next input frame to the provider. A frame with EndStream
+// closes the input; the provider keeps producing output until it returns.
+// Send blocks while the provider is not keeping up with its input.
+func (ss *StreamSession) Send(frame StreamFrame) *MigError {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	select {
+	case <-ss.done:
+		return invalid("stream already finished")
+	default:
+	}
+	if ss.inputDone {
+		return invalid("stream input already ended")
+	}
+	if frame.Header.TenantID != "" && frame.Header.TenantID != ss.tenantID {
+		return &MigError{Code: ErrorForbidden, Message: "stream belongs to another tenant", Retryable: false}
+	}
+	if len(ss.inputSteps) > 0 && frame.Payload != nil {
+		transformed, err := applySteps(ss.inputSteps, frame.Payload, false, nil)
+		if err != nil {
+			return invalid("input transform failed: " + err.Error())
+		}
+		frame.Payload = transformed
+	}
+	select {
+	case ss.in <- frame:
+	case <-ss.done:
+		return invalid("stream already finished")
+	}
+	if frame.EndStream {
+		ss.inputDone = true
+		close(ss.in)
+	}
+	return nil
+}
+
+// endInput closes the input of a finished session, so a provider still
+// reading it returns.
+func (ss *StreamSession) endInput() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if !ss.inputDone {
+		ss.inputDone = true
+		close(ss.in)
+	}
+}
+
+// Cancel aborts the session, as when its connection goes away. The provider's
+// context is cancelled and the session ends with MIG_TIMEOUT. A CANCEL for
+// the session's message ID instead ends it with a terminal control frame.
+func (ss *StreamSession) Cancel() {
+	ss.cancel()
+}
+
+// Done is closed once the provider has returned and the session is audited.
+func (ss *StreamSession) Done() <-chan struct{} {
+	return ss.done
+}
+
+// Err reports why the session failed, once Done is closed. It is nil for a
+// session that completed or was ended by CANCEL.
+func (ss *StreamSession) Err() *MigError {
+	<-ss.done
+	return ss.err
+}
+
+// streamSessions tracks the sessions and server-streaming calls running on
+// one stream connection, and routes request frames for both the WebSocket and
+// gRPC bindings. Calls run off the read loop, so control frames such as an
+// in-band cancel are read while they stream.
+type streamSessions struct {
+	s    *Service
+	send func(StreamFrame) error
+
+	mu       sync.Mutex
+	open     map[string]*StreamSession
+	calls    map[uint64]context.CancelFunc
+	nextCall uint64
+	wg       sync.WaitGroup
+}
+
+// newStreamSessions wraps send so that frames from concurrent sessions are
+// written one at a time.
+func (s *Service) newStreamSessions(send func(StreamFrame) error) *streamSessions {
+	var writeMu sync.Mutex
+	return &streamSessions{
+		s: s,
+		send: func(frame StreamFrame) error {
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			return send(frame)
+		},
+		open:  map[string]*StreamSession{},
+		calls: map[uint64]context.CancelFunc{},
+	}
+}
+
+// request handles one request frame: it feeds an open session, opens a new
+// one when the header asks for a session mode, or starts the frame as a
+// server-streaming call. It does not wait for the call or session to finish.
+// Only transport write failures are returned.
+func (m *streamSessions) request(ctx context.Context, frame StreamFrame, actor string, principal Principal) error {
+	m.mu.Lock()
+	session := m.open[frame.StreamID]
+	m.mu.Unlock()
+	if session != nil {
+		if migErr := session.Send(frame); migErr != nil {
+			return m.sendError(frame, migErr)
+		}
+		return nil
+	}
+
+	req := InvokeRequest{Header: frame.Header, Capability: frame.Capability, Payload: frame.Payload}
+	mode, _ := frame.Header.Meta[StreamModeMetaKey].(string)
+	if mode == "" || mode == ModeUnary || mode == ModeServerStream {
+		m.startCall(ctx, frame, req, actor, principal)
+		return nil
+	}
+
+	if frame.StreamID == "" {
+		return m.sendError(frame, invalid("stream_id is required to open a "+mode+" session"))
+	}
+	session, migErr := m.s.OpenSession(ctx, frame.Capability, mode, req, frame.EndStream, actor, principal, func(out StreamFrame) error {
+		out.StreamID = frame.StreamID
+		return m.send(out)
+	})
+	if migErr != nil {
+		return m.sendError(frame, migErr)
+	}
+	m.mu.Lock()
+	m.open[frame.StreamID] = session
+	m.mu.Unlock()
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		<-session.Done()
+		m.mu.Lock()
+		if m.open[frame.StreamID] == session {
+			delete(m.open, frame.StreamID)
+		}
+		m.mu.Unlock()
+		if err := session.Err(); err != nil {
+			_ = m.sendError(frame, err)
+		}
+	}()
+	return nil
+}
+
+// startCall runs a unary or server-streaming frame in its own goroutine. A
+// failed write ends the call; the read loop notices the broken connection.
+func (m *streamSessions) startCall(ctx context.Context, frame StreamFrame, req InvokeRequest, actor string, principal Principal) {
+	callCtx, cancel := context.WithCancel(ctx)
+	m.mu.Lock()
+	m.nextCall++
+	id := m.nextCall
+	m.calls[id] = cancel
+	m.mu.Unlock()
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer func() {
+			m.mu.Lock()
+			delete(m.calls, id)
+			m.mu.Unlock()
+			cancel()
+		}()
+		var writeErr error
+		migErr := m.s.InvokeStream(callCtx, frame.Capability, req, actor, principal, func(out StreamFrame) error {
+			out.StreamID = frame.StreamID
+			writeErr = m.send(out)
+			return writeErr
+		})
+		if migErr != nil && writeErr == nil {
+			_ = m.sendError(frame, migErr)
+		}
+	}()
+}
+
+func (m *streamSessions) sendError(frame StreamFrame, migErr *MigError) error {
+	return m.send(StreamFrame{
+		Header:     frame.Header,
+		StreamID:   frame.StreamID,
+		Capability: frame.Capability,
+		Kind:       "error",
+		EndStream:  true,
+		Error:      migErr,
+	})
+}
+
+// wait blocks until every open session and call has finished and sent its
+// last frame, for when the client has half-closed the connection or after
+// closeAll.
+func (m *streamSessions) wait() {
+	m.wg.Wait()
+}
+
+// closeAll cancels every open session and call, for when the connection goes
+// away.
+func (m *streamSessions) closeAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, session := range m.open {
+		session.Cancel()
+		delete(m.open, id)
+	}
+	for id, cancel := range m.calls {
+		cancel()
+		delete(m.calls, id)
+	}
+}
@@ -0,0 +1,261 @@
+package mig
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	migv01 "github.com/InvariantDynamics/model-interface-gateway-oss/proto/mig/v0_1"
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// transcribe echoes each audio chunk back as a partial transcript and ends
+// with the full text once the input closes.
+func transcribe(_ context.Context, req InvokeRequest, in <-chan StreamFrame, emit func(StreamFrame) error) *MigError {
+	var words []string
+	chunk := func(payload map[string]interface{}) *MigError {
+		word, _ := payload["chunk"].(string)
+		if word == "" {
+			return nil
+		}
+		words = append(words, word)
+		if err := emit(StreamFrame{Kind: "event", Payload: map[string]interface{}{"partial": word}}); err != nil {
+			return &MigError{Code: ErrorUnavailable, Message: err.Error(), Retryable: true}
+		}
+		return nil
+	}
+	if migErr := chunk(req.Payload); migErr != nil {
+		return migErr
+	}
+	for frame := range in {
+		if migErr := chunk(frame.Payload); migErr != nil {
+			return migErr
+		}
+	}
+	_ = emit(StreamFrame{Kind: "response", Payload: map[string]interface{}{"text": strings.Join(words, " ")}, EndStream: true})
+	return nil
+}
+
+func newSessionService(t *testing.T) *Service {
+	t.Helper()
+	svc := NewService()
+	desc := testDescriptor("acme.audio.transcribe")
+	desc.Modes = []string{ModeUnary, ModeClientStream, ModeBidiStream}
+	if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: desc}); err != nil {
+		t.Fatalf("add: %v", err.Message)
+	}
+	_ = svc.BindProvider("acme.audio.transcribe", SessionProviderFunc(transcribe))
+
+	plain := testDescriptor("acme.audio.legacy")
+	plain.Modes = []string{ModeUnary, ModeBidiStream}
+	if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: plain}); err != nil {
+		t.Fatalf("add: %v", err.Message)
+	}
+	_ = svc.BindProvider("acme.audio.legacy", ProviderFunc(func(context.Context, InvokeRequest) (map[string]interface{}, *MigError) {
+		return map[string]interface{}{}, nil
+	}))
+	return svc
+}
+
+func TestOpenSessionFeedsOneInvocation(t *testing.T) {
+	svc := newSessionService(t)
+	var mu sync.Mutex
+	var frames []StreamFrame
+	session, err := svc.OpenSession(context.Background(), "acme.audio.transcribe", ModeBidiStream, InvokeRequest{
+		Header:  MessageHeader{TenantID: "acme", MessageID: "sess-1"},
+		Payload: map[string]interface{}{"chunk": "hello"},
+	}, false, "tester", AnonymousPrincipal(), func(frame StreamFrame) error {
+		mu.Lock()
+		defer mu.Unlock()
+		frames = append(frames, frame)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("open session: %v", err.Message)
+	}
+	if err := session.Send(StreamFrame{Header: MessageHeader{TenantID: "globex"}, Payload: map[string]interface{}{"chunk": "x"}}); err == nil || err.Code != ErrorForbidden {
+		t.Fatalf("frames from another tenant must be rejected, got %#v", err)
+	}
+	if err := session.Send(StreamFrame{Payload: map[string]interface{}{"chunk": "big"}}); err != nil {
+		t.Fatalf("send: %v", err.Message)
+	}
+	if err := session.Send(StreamFrame{Payload: map[string]interface{}{"chunk": "world"}, EndStream: true}); err != nil {
+		t.Fatalf("send: %v", err.Message)
+	}
+	if err := session.Send(StreamFrame{Payload: map[string]interface{}{"chunk": "late"}}); err == nil {
+		t.Fatal("frames after EndStream must be rejected")
+	}
+	if err := session.Err(); err != nil {
+		t.Fatalf("session failed: %v", err.Message)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(frames) != 4 {
+		t.Fatalf("expected three partials and a final frame, got %#v", frames)
+	}
+	if last := frames[3]; !last.EndStream || last.Payload["text"] != "hello big world" || last.Header.MessageID != "sess-1" {
+		t.Fatalf("unexpected final frame: %#v", last)
+	}
+	records := svc.AuditExport("acme")
+	if last := records[len(records)-1]; last.Outcome != "success" || last.Mode != ModeBidiStream || last.Frames != 4 {
+		t.Fatalf("unexpected session audit record: %#v", last)
+	}
+}
+
+func TestOpenSessionRequiresSupport(t *testing.T) {
+	svc := newSessionService(t)
+	open := func(capability, mode string) *MigError {
+		_, err := svc.OpenSession(context.Background(), capability, mode, InvokeRequest{
+			Header: MessageHeader{TenantID: "acme"},
+		}, true, "tester", AnonymousPrincipal(), func(StreamFrame) error { return nil })
+		return err
+	}
+	if err := open("observatory.models.infer", ModeClientStream); err == nil || err.Code != ErrorUnsupportedCapability {
+		t.Fatalf("expected unsupported mode, got %#v", err)
+	}
+	if err := open("acme.audio.legacy", ModeBidiStream); err == nil || err.Code != ErrorUnsupportedCapability {
+		t.Fatalf("expected unsupported provider, got %#v", err)
+	}
+	if err := open("acme.audio.transcribe", ModeServerStream); err == nil || err.Code != ErrorInvalidRequest {
+		t.Fatalf("expected invalid session mode, got %#v", err)
+	}
+}
+
+func TestSessionOverWebSocket(t *testing.T) {
+	svc := newSessionService(t)
+	mux := http.NewServeMux()
+	RegisterHTTPRoutes(mux, svc)
+	srv := httptest.NewServer(AuthMiddleware(AuthConfig{Mode: AuthModeNone})(mux))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+srv.URL[len("http"):]+"/mig/v0.1/stream", nil)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	defer conn.Close()
+	send := func(frame StreamFrame) {
+		frame.StreamID = "audio-1"
+		frame.Capability = "acme.audio.transcribe"
+		frame.Kind = "request"
+		if err := conn.WriteJSON(frame); err != nil {
+			t.Fatalf("write frame: %v", err)
+		}
+	}
+	send(StreamFrame{
+		Header:  MessageHeader{TenantID: "acme", Meta: map[string]interface{}{StreamModeMetaKey: ModeClientStream}},
+		Payload: map[string]interface{}{"chunk": "one"},
+	})
+	send(StreamFrame{Header: MessageHeader{TenantID: "acme"}, Payload: map[string]interface{}{"chunk": "two"}})
+	send(StreamFrame{Header: MessageHeader{TenantID: "acme"}, Payload: map[string]interface{}{"chunk": "three"}, EndStream: true})
+
+	for {
+		var frame StreamFrame
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("read frame: %v", err)
+		}
+		if frame.StreamID != "audio-1" {
+			t.Fatalf("unexpected stream id: %#v", frame)
+		}
+		if frame.EndStream {
+			if frame.Kind != "response" || frame.Payload["text"] != "one two three" {
+				t.Fatalf("unexpected final frame: %#v", frame)
+			}
+			break
+		}
+	}
+
+	if err := conn.WriteJSON(StreamFrame{
+		Header:     MessageHeader{TenantID: "acme", Meta: map[string]interface{}{StreamModeMetaKey: ModeBidiStream}},
+		StreamID:   "audio-legacy",
+		Capability: "acme.audio.legacy",
+		Kind:       "request",
+	}); err != nil {
+		t.Fatalf("write frame: %v", err)
+	}
+	var frame StreamFrame
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := conn.ReadJSON(&frame); err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	if frame.StreamID != "audio-legacy" || frame.Kind != "error" || frame.Error == nil || frame.Error.Code != ErrorUnsupportedCapability {
+		t.Fatalf("expected unsupported capability error frame, got %#v", frame)
+	}
+}
+
+func TestSessionOverGRPC(t *testing.T) {
+	svc := newSessionService(t)
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(grpc.StreamInterceptor(GRPCStreamAuthInterceptor(AuthConfig{Mode: AuthModeNone})))
+	RegisterGRPCServices(server, svc)
+	defer server.Stop()
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("grpc dial: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := migv01.NewInvocationClient(conn).StreamInvoke(ctx)
+	if err != nil {
+		t.Fatalf("stream invoke: %v", err)
+	}
+	meta, _ := structpb.NewStruct(map[string]interface{}{StreamModeMetaKey: ModeClientStream})
+	for i, chunk := range []string{"a", "b", "c"} {
+		payload, _ := structpb.NewStruct(map[string]interface{}{"chunk": chunk})
+		frame := &migv01.StreamFrame{
+			Header:     &migv01.MessageHeader{TenantId: "acme", MigVersion: "0.1"},
+			StreamId:   "audio-2",
+			Capability: "acme.audio.transcribe",
+			Kind:       migv01.FrameKind_FRAME_KIND_REQUEST,
+			Payload:    payload,
+			EndStream:  i == 2,
+		}
+		if i == 0 {
+			frame.Header.Meta = meta
+		}
+		if err := stream.Send(frame); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	// Half-closing the stream still delivers the session output.
+	if err := stream.CloseSend(); err != nil {
+		t.Fatalf("close send: %v", err)
+	}
+	var partials []string
+	for {
+		frame, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("recv: %v", err)
+		}
+		if frame.GetEndStream() {
+			if frame.GetKind() != migv01.FrameKind_FRAME_KIND_RESPONSE || frame.GetPayload().AsMap()["text"] != "a b c" {
+				t.Fatalf("unexpected final frame: %v", frame)
+			}
+			break
+		}
+		partials = append(partials, frame.GetPayload().AsMap()["partial"].(string))
+	}
+	if strings.Join(partials, "") != "abc" {
+		t.Fatalf("unexpected partials: %v", partials)
+	}
+}
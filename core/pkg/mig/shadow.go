@@ -0,0 +1,469 @@
+package mig
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// ShadowMetaKey marks the copy of a request sent to a shadow provider.
+	ShadowMetaKey = "mig.shadow"
+
+	defaultShadowTimeoutMS   = 30000
+	defaultShadowMaxInFlight = 64
+	shadowLogLimit           = 1000
+	shadowMaxDifferences     = 50
+)
+
+// ShadowConfig mirrors a sample of INVOKE traffic for a capability ID to a
+// shadow backend: either another registered version or a dedicated provider.
+// Callers always receive the primary response.
+type ShadowConfig struct {
+	Capability string          `json:"capability"`
+	Version    string          `json:"version,omitempty"`
+	Provider   *ProviderConfig `json:"provider,omitempty"`
+	// SampleRate in (0, 1] is the fraction of invocations mirrored.
+	SampleRate float64 `json:"sample_rate,omitempty"`
+	TimeoutMS  int     `json:"timeout_ms,omitempty"`
+	// MaxInFlight caps concurrent shadow calls; extra samples are dropped.
+	MaxInFlight int `json:"max_in_flight,omitempty"`
+}
+
+// ShadowComparison is one entry of the comparison log.
+type ShadowComparison struct {
+	Capability       string             `json:"capability"`
+	PrimaryVersion   string             `json:"primary_version"`
+	ShadowTarget     string             `json:"shadow_target"`
+	TenantID         string             `json:"tenant_id"`
+	MessageID        string             `json:"message_id"`
+	Timestamp        string             `json:"timestamp"`
+	PrimaryLatencyMS float64            `json:"primary_latency_ms"`
+	ShadowLatencyMS  float64            `json:"shadow_latency_ms"`
+	LatencyDeltaMS   float64            `json:"latency_delta_ms"`
+	Match            bool               `json:"match"`
+	PrimaryError     string             `json:"primary_error,omitempty"`
+	ShadowError      string             `json:"shadow_error,omitempty"`
+	Differences      []ShadowDifference `json:"differences,omitempty"`
+	Truncated        bool               `json:"truncated,omitempty"`
+}
+
+// ShadowDifference is one entry of a structural payload diff. Kind is added
+// (only the shadow has Path), removed (only the primary has it), or changed.
+type ShadowDifference struct {
+	Path    string      `json:"path"`
+	Kind    string      `json:"kind"`
+	Primary interface{} `json:"primary,omitempty"`
+	Shadow  interface{} `json:"shadow,omitempty"`
+}
+
+type shadow struct {
+	cfg      ShadowConfig
+	provider Provider
+	target   string
+	inFlight atomic.Int64
+}
+
+func normalizeShadowConfig(cfg ShadowConfig) (ShadowConfig, *MigError) {
+	if cfg.Capability == "" {
+		return cfg, invalid("capability is required")
+	}
+	if (cfg.Version == "") == (cfg.Provider == nil) {
+		return cfg, invalid("exactly one of version or provider is required")
+	}
+	if cfg.SampleRate < 0 || cfg.SampleRate > 1 {
+		return cfg, invalid("sample_rate must be between 0 and 1")
+	}
+	if cfg.TimeoutMS < 0 || cfg.MaxInFlight < 0 {
+		return cfg, invalid("shadow values must be >= 0")
+	}
+	if cfg.SampleRate == 0 {
+		cfg.SampleRate = 1
+	}
+	if cfg.TimeoutMS == 0 {
+		cfg.TimeoutMS = defaultShadowTimeoutMS
+	}
+	if cfg.MaxInFlight == 0 {
+		cfg.MaxInFlight = defaultShadowMaxInFlight
+	}
+	return cfg, nil
+}
+
+// SetShadow creates or replaces the shadow for a capability ID.
+func (s *Service) SetShadow(cfg ShadowConfig) *MigError {
+	cfg, migErr := normalizeShadowConfig(cfg)
+	if migErr != nil {
+		return migErr
+	}
+	sh := &shadow{cfg: cfg}
+	if cfg.Provider != nil {
+		provider, migErr := s.newProvider(cfg.Capability+"#shadow", *cfg.Provider)
+		if migErr != nil {
+			return migErr
+		}
+		sh.provider = provider
+		sh.target = "provider:" + cfg.Provider.Type
+	} else {
+		sh.target = capabilityKey(cfg.Capability, cfg.Version)
+	}
+
+	s.mu.Lock()
+	if _, _, migErr := s.resolveCapabilityLocked(cfg.Capability, ""); migErr != nil {
+		s.mu.Unlock()
+		closeProvider(sh.provider)
+		return migErr
+	}
+	if cfg.Version != "" {
+		if _, ok := s.capabilities[sh.target]; !ok {
+			s.mu.Unlock()
+			return invalid("version " + cfg.Version + " of " + cfg.Capability + " is not registered")
+		}
+	}
+	previous := s.shadows[cfg.Capability]
+	s.shadows[cfg.Capability] = sh
+	s.mu.Unlock()
+	if previous != nil {
+		closeProvider(previous.provider)
+	}
+	return nil
+}
+
+// DeleteShadow stops mirroring a capability.
+func (s *Service) DeleteShadow(capability string) *MigError {
+	s.mu.Lock()
+	previous, ok := s.shadows[capability]
+	delete(s.shadows, capability)
+	s.mu.Unlock()
+	if !ok {
+		return &MigError{Code: ErrorUnsupportedCapability, Message: "no shadow configured for " + capability, Retryable: false}
+	}
+	closeProvider(previous.provider)
+	return nil
+}
+
+// Shadows lists shadow configs ordered by capability ID.
+func (s *Service) Shadows() []ShadowConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]ShadowConfig, 0, len(s.shadows))
+	for _, sh := range s.shadows {
+		out = append(out, sh.cfg)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Capability < out[j].Capability })
+	return out
+}
+
+// SetShadowOptOut excludes (or re-includes) a tenant's traffic from every
+// shadow.
+func (s *Service) SetShadowOptOut(tenantID string, optOut bool) *MigError {
+	if tenantID == "" {
+		return invalid("tenant_id is required")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if optOut {
+		s.shadowOptOuts[tenantID] = struct{}{}
+	} else {
+		delete(s.shadowOptOuts, tenantID)
+	}
+	return nil
+}
+
+// ShadowOptOuts lists tenants excluded from mirroring.
+func (s *Service) ShadowOptOuts() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]string, 0, len(s.shadowOptOuts))
+	for tenantID := range s.shadowOptOuts {
+		out = append(out, tenantID)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ShadowComparisons returns the most recent comparisons, newest last,
+// optionally filtered by capability ID.
+func (s *Service) ShadowComparisons(capability string, limit int) []ShadowComparison {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]ShadowComparison, 0)
+	for _, entry := range s.shadowLog {
+		if capability == "" || entry.Capability == capability {
+			out = append(out, entry)
+		}
+	}
+	if limit > 0 && len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	return out
+}
+
+// shadowForLocked returns the shadow that should mirror this invocation, if
+// any. Callers must hold s.mu.
+func (s *Service) shadowForLocked(id string, head MessageHeader) *shadow {
+	sh, ok := s.shadows[id]
+	if !ok {
+		return nil
+	}
+	if _, optedOut := s.shadowOptOuts[head.TenantID]; optedOut {
+		return nil
+	}
+	if sh.cfg.SampleRate < 1 && rand.Float64() >= sh.cfg.SampleRate {
+		return nil
+	}
+	return sh
+}
+
+// mirror sends a copy of req, as the caller sent it, to the shadow and logs
+// the comparison with what the caller got back. The shadow runs with the
+// target version's schema validation and transforms, or the primary
+// version's for a dedicated provider, so both sides are compared like for
+// like. Mirrored calls, and the calls composite and scatter targets make,
+// never touch quotas, usage, idempotency, or the audit log.
+func (s *Service) mirror(sh *shadow, req InvokeRequest, primaryInv *invocation, primaryVersion string, primary map[string]interface{}, primaryErr *MigError, primaryLatency time.Duration) {
+	if sh.inFlight.Add(1) > int64(sh.cfg.MaxInFlight) {
+		sh.inFlight.Add(-1)
+		s.recordShadow(sh.cfg.Capability, "dropped")
+		return
+	}
+	go func() {
+		defer sh.inFlight.Add(-1)
+		head := req.Header
+		head.Meta = make(map[string]interface{}, len(req.Header.Meta)+1)
+		for k, v := range req.Header.Meta {
+			head.Meta[k] = v
+		}
+		head.Meta[ShadowMetaKey] = true
+		if sh.cfg.Version != "" {
+			head.Meta[CapabilityVersionMetaKey] = sh.cfg.Version
+		}
+		// A distinct message ID and no idempotency key keep the shadow's
+		// calls apart from the primary's.
+		head.MessageID = req.Header.MessageID + ".shadow"
+		head.IdempotencyKey = ""
+		shadowReq := req
+		shadowReq.Header = head
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(sh.cfg.TimeoutMS)*time.Millisecond)
+		defer cancel()
+		ctx = context.WithValue(ctx, invocationKey{}, &invocation{
+			actor:     "shadow",
+			principal: primaryInv.principal,
+			depth:     primaryInv.depth,
+			shadow:    true,
+		})
+		start := time.Now()
+		payload, shadowErr := s.invokeShadow(ctx, sh, capabilityKey(req.Capability, primaryVersion), shadowReq)
+		shadowLatency := time.Since(start)
+
+		entry := ShadowComparison{
+			Capability:       req.Capability,
+			PrimaryVersion:   primaryVersion,
+			ShadowTarget:     sh.target,
+			TenantID:         req.Header.TenantID,
+			MessageID:        req.Header.MessageID,
+			Timestamp:        time.Now().UTC().Format(time.RFC3339),
+			PrimaryLatencyMS: durationMS(primaryLatency),
+			ShadowLatencyMS:  durationMS(shadowLatency),
+		}
+		entry.LatencyDeltaMS = entry.ShadowLatencyMS - entry.PrimaryLatencyMS
+		if primaryErr != nil {
+			entry.PrimaryError = primaryErr.Code
+		}
+		if shadowErr != nil {
+			entry.ShadowError = shadowErr.Code
+		}
+		if primaryErr == nil && shadowErr == nil {
+			entry.Differences, entry.Truncated = diffPayloads(primary, payload)
+		}
+		entry.Match = entry.PrimaryError == entry.ShadowError && len(entry.Differences) == 0
+
+		outcome := "match"
+		switch {
+		case shadowErr != nil && primaryErr == nil:
+			outcome = "error"
+		case !entry.Match:
+			outcome = "mismatch"
+		}
+		s.recordShadow(req.Capability, outcome)
+		s.appendShadowLog(entry)
+	}()
+}
+
+// invokeShadow validates, transforms, and dispatches a mirrored request.
+// primaryKey names the primary version, whose policies apply when the shadow
+// is a dedicated provider.
+func (s *Service) invokeShadow(ctx context.Context, sh *shadow, primaryKey string, req InvokeRequest) (map[string]interface{}, *MigError) {
+	key, provider := primaryKey, sh.provider
+	s.mu.RLock()
+	if provider == nil {
+		key = sh.target
+		provider = s.providers[key]
+	}
+	capDesc := s.capabilities[key]
+	validation := s.schemaValidation[key]
+	transforms := s.transforms[key]
+	s.mu.RUnlock()
+	if provider == nil {
+		return nil, &MigError{Code: ErrorUnavailable, Message: "no provider bound to shadow target", Retryable: true}
+	}
+
+	if migErr := s.validatePayload(capDesc, validation, req.Payload); migErr != nil {
+		return nil, migErr
+	}
+	if steps := transforms.steps(TransformDirectionInput); len(steps) > 0 {
+		transformed, err := applySteps(steps, req.Payload, false, nil)
+		if err != nil {
+			return nil, invalid("input transform failed: " + err.Error())
+		}
+		req.Payload = transformed
+	}
+	payload, migErr := invokeWithContext(ctx, provider, req)
+	if migErr != nil {
+		return nil, migErr
+	}
+	if steps := transforms.steps(TransformDirectionOutput); len(steps) > 0 {
+		transformed, err := applySteps(steps, payload, false, nil)
+		if err != nil {
+			return nil, &MigError{Code: ErrorInternal, Message: "output transform failed: " + err.Error(), Retryable: false}
+		}
+		payload = transformed
+	}
+	return payload, nil
+}
+
+// invokeWithContext stops waiting for provider once ctx ends, for providers
+// that do not honour cancellation themselves.
+func invokeWithContext(ctx context.Context, provider Provider, req InvokeRequest) (map[string]interface{}, *MigError) {
+	type result struct {
+		payload map[string]interface{}
+		err     *MigError
+	}
+	ch := make(chan result, 1)
+	go func() {
+		payload, err := provider.Invoke(ctx, req)
+		ch <- result{payload: payload, err: err}
+	}()
+	select {
+	case <-ctx.Done():
+		return nil, &MigError{Code: ErrorTimeout, Message: "deadline exceeded", Retryable: true}
+	case out := <-ch:
+		return out.payload, out.err
+	}
+}
+
+func (s *Service) appendShadowLog(entry ShadowComparison) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shadowLog = append(s.shadowLog, entry)
+	if len(s.shadowLog) > shadowLogLimit {
+		s.shadowLog = append([]ShadowComparison(nil), s.shadowLog[len(s.shadowLog)-shadowLogLimit:]...)
+	}
+	if s.shadowLogFile != nil {
+		if payload, err := json.Marshal(entry); err == nil {
+			_, _ = s.shadowLogFile.Write(append(payload, '\n'))
+		}
+	}
+}
+
+func (s *Service) recordShadow(capability, outcome string) {
+	if metrics := s.metricsSnapshot(); metrics != nil {
+		metrics.RecordShadow(capability, outcome)
+	}
+}
+
+func durationMS(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// diffPayloads compares two payloads as JSON documents, so numeric types that
+// encode identically compare equal. It reports at most shadowMaxDifferences
+// entries.
+func diffPayloads(primary, shadow map[string]interface{}) ([]ShadowDifference, bool) {
+	var diffs []ShadowDifference
+	truncated := false
+	var walk func(path string, a, b interface{})
+	add := func(diff ShadowDifference) {
+		if len(diffs) >= shadowMaxDifferences {
+			truncated = true
+			return
+		}
+		diffs = append(diffs, diff)
+	}
+	walk = func(path string, a, b interface{}) {
+		switch av := a.(type) {
+		case map[string]interface{}:
+			bv, ok := b.(map[string]interface{})
+			if !ok {
+				add(ShadowDifference{Path: path, Kind: "changed", Primary: a, Shadow: b})
+				return
+			}
+			keys := make([]string, 0, len(av)+len(bv))
+			for k := range av {
+				keys = append(keys, k)
+			}
+			for k := range bv {
+				if _, ok := av[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				child := path + "." + k
+				aChild, inA := av[k]
+				bChild, inB := bv[k]
+				switch {
+				case !inB:
+					add(ShadowDifference{Path: child, Kind: "removed", Primary: aChild})
+				case !inA:
+					add(ShadowDifference{Path: child, Kind: "added", Shadow: bChild})
+				default:
+					walk(child, aChild, bChild)
+				}
+			}
+		case []interface{}:
+			bv, ok := b.([]interface{})
+			if !ok {
+				add(ShadowDifference{Path: path, Kind: "changed", Primary: a, Shadow: b})
+				return
+			}
+			for i := 0; i < len(av) || i < len(bv); i++ {
+				child := fmt.Sprintf("%s[%d]", path, i)
+				switch {
+				case i >= len(bv):
+					add(ShadowDifference{Path: child, Kind: "removed", Primary: av[i]})
+				case i >= len(av):
+					add(ShadowDifference{Path: child, Kind: "added", Shadow: bv[i]})
+				default:
+					walk(child, av[i], bv[i])
+				}
+			}
+		default:
+			if !reflect.DeepEqual(a, b) {
+				add(ShadowDifference{Path: path, Kind: "changed", Primary: a, Shadow: b})
+			}
+		}
+	}
+	walk("$", normalizeJSON(primary), normalizeJSON(shadow))
+	return diffs, truncated
+}
+
+func normalizeJSON(value map[string]interface{}) interface{} {
+	if value == nil {
+		return map[string]interface{}{}
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var out interface{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return value
+	}
+	return out
+}
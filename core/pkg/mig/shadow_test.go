@@ -0,0 +1,203 @@
+package mig
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShadowMirrorsAndDiffs(t *testing.T) {
+	svc := NewService()
+	if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: testDescriptor("acme.tools.shadowed")}); err != nil {
+		t.Fatalf("add capability: %v", err.Message)
+	}
+	if err := svc.BindProvider("acme.tools.shadowed", ProviderFunc(func(context.Context, InvokeRequest) (map[string]interface{}, *MigError) {
+		return map[string]interface{}{"label": "cat", "score": 0.9, "tags": []interface{}{"a", "b"}}, nil
+	})); err != nil {
+		t.Fatalf("bind: %v", err.Message)
+	}
+	candidate := testDescriptor("acme.tools.shadowed")
+	candidate.Version = "2.0.0-rc.1"
+	if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: candidate}); err != nil {
+		t.Fatalf("add candidate: %v", err.Message)
+	}
+	seenShadow := make(chan InvokeRequest, 4)
+	if err := svc.BindProvider("acme.tools.shadowed@2.0.0-rc.1", ProviderFunc(func(_ context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+		seenShadow <- req
+		time.Sleep(5 * time.Millisecond)
+		return map[string]interface{}{"label": "dog", "score": 0.9, "tags": []interface{}{"a"}, "extra": true}, nil
+	})); err != nil {
+		t.Fatalf("bind candidate: %v", err.Message)
+	}
+	if err := svc.SetShadow(ShadowConfig{Capability: "acme.tools.shadowed", Version: "2.0.0-rc.1"}); err != nil {
+		t.Fatalf("set shadow: %v", err.Message)
+	}
+	if _, err := svc.SetQuota(QuotaRequest{TenantID: "acme", MaxInvocations: 1}); err != nil {
+		t.Fatalf("set quota: %v", err.Message)
+	}
+
+	resp, migErr := svc.Invoke(context.Background(), "acme.tools.shadowed", InvokeRequest{
+		Header:  MessageHeader{TenantID: "acme"},
+		Payload: map[string]interface{}{"image": "x"},
+	}, "tester", AnonymousPrincipal())
+	if migErr != nil {
+		t.Fatalf("invoke: %v", migErr.Message)
+	}
+	if resp.Payload["label"] != "cat" {
+		t.Fatalf("client must get the primary response: %#v", resp.Payload)
+	}
+	req := <-seenShadow
+	if req.Header.Meta[ShadowMetaKey] != true || req.Payload["image"] != "x" {
+		t.Fatalf("unexpected shadow request: %#v", req)
+	}
+
+	var comparisons []ShadowComparison
+	waitFor(t, func() bool {
+		comparisons = svc.ShadowComparisons("acme.tools.shadowed", 0)
+		return len(comparisons) == 1
+	}, "shadow comparison")
+	entry := comparisons[0]
+	if entry.Match || entry.PrimaryVersion != "1.0.0" || entry.ShadowTarget != "acme.tools.shadowed@2.0.0-rc.1" {
+		t.Fatalf("unexpected comparison: %#v", entry)
+	}
+	if entry.ShadowLatencyMS < 5 || entry.LatencyDeltaMS <= 0 {
+		t.Fatalf("unexpected latencies: %#v", entry)
+	}
+	kinds := map[string]string{}
+	for _, diff := range entry.Differences {
+		kinds[diff.Path] = diff.Kind
+	}
+	want := map[string]string{"$.extra": "added", "$.label": "changed", "$.tags[1]": "removed"}
+	if len(kinds) != len(want) {
+		t.Fatalf("unexpected differences: %#v", entry.Differences)
+	}
+	for path, kind := range want {
+		if kinds[path] != kind {
+			t.Fatalf("expected %s %s, got %#v", path, kind, entry.Differences)
+		}
+	}
+	if usage := svc.Usage(); usage.TenantInvocations["acme"] != 1 {
+		t.Fatalf("shadow calls must not count toward usage: %#v", usage.TenantInvocations)
+	}
+
+	// The quota of 1 is used up by the primary call alone.
+	if _, migErr := svc.Invoke(context.Background(), "acme.tools.shadowed", InvokeRequest{
+		Header:  MessageHeader{TenantID: "acme"},
+		Payload: map[string]interface{}{},
+	}, "tester", AnonymousPrincipal()); migErr == nil || migErr.Code != ErrorRateLimited {
+		t.Fatalf("expected quota exhaustion from the primary call only, got %#v", migErr)
+	}
+}
+
+func TestShadowComparesLikeForLike(t *testing.T) {
+	svc := NewService()
+	if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: testDescriptor("acme.models.upper")}); err != nil {
+		t.Fatalf("add step: %v", err.Message)
+	}
+	_ = svc.BindProvider("acme.models.upper", ProviderFunc(func(_ context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+		return map[string]interface{}{"out": strings.ToUpper(req.Payload["text"].(string))}, nil
+	}))
+	// The primary renames fields on the way in and out; the candidate is a
+	// composite that takes the caller's payload as it is.
+	if err := svc.AddCapability(CapabilityUpsertRequest{
+		Descriptor: testDescriptor("acme.models.chat"),
+		Transforms: &TransformConfig{
+			Input:  []TransformStep{{Op: TransformRename, From: "prompt", To: "text"}},
+			Output: []TransformStep{{Op: TransformRename, From: "out", To: "answer"}},
+		},
+	}); err != nil {
+		t.Fatalf("add primary: %v", err.Message)
+	}
+	_ = svc.BindProvider("acme.models.chat", ProviderFunc(func(_ context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+		return map[string]interface{}{"out": strings.ToUpper(req.Payload["text"].(string))}, nil
+	}))
+	candidate := testDescriptor("acme.models.chat")
+	candidate.Version = "2.0.0"
+	if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: candidate, Provider: &ProviderConfig{
+		Type: ProviderTypeComposite,
+		Composite: &CompositeProviderConfig{
+			Steps:  []CompositeStep{{ID: "upper", Capability: "acme.models.upper", Input: map[string]interface{}{"text": "{{input.prompt}}"}}},
+			Output: map[string]interface{}{"answer": "{{steps.upper.out}}"},
+		},
+	}}); err != nil {
+		t.Fatalf("add candidate: %v", err.Message)
+	}
+	if err := svc.SetShadow(ShadowConfig{Capability: "acme.models.chat", Version: "2.0.0"}); err != nil {
+		t.Fatalf("set shadow: %v", err.Message)
+	}
+	if _, err := svc.SetQuota(QuotaRequest{TenantID: "acme", MaxInvocations: 1}); err != nil {
+		t.Fatalf("set quota: %v", err.Message)
+	}
+
+	resp, migErr := svc.Invoke(context.Background(), "acme.models.chat@1.0.0", InvokeRequest{
+		Header:  MessageHeader{TenantID: "acme"},
+		Payload: map[string]interface{}{"prompt": "hi"},
+	}, "tester", AnonymousPrincipal())
+	if migErr != nil || resp.Payload["answer"] != "HI" {
+		t.Fatalf("unexpected primary response: %#v %#v", resp.Payload, migErr)
+	}
+	var comparisons []ShadowComparison
+	waitFor(t, func() bool {
+		comparisons = svc.ShadowComparisons("acme.models.chat", 0)
+		return len(comparisons) == 1
+	}, "shadow comparison")
+	if entry := comparisons[0]; !entry.Match {
+		t.Fatalf("expected the composite shadow to match, got %#v", entry)
+	}
+	if usage := svc.Usage(); usage.TenantInvocations["acme"] != 1 {
+		t.Fatalf("shadow steps must not count toward usage: %#v", usage.TenantInvocations)
+	}
+	for _, record := range svc.AuditExport("acme") {
+		if record.Actor == "shadow" {
+			t.Fatalf("shadow steps must not be audited: %#v", record)
+		}
+	}
+}
+
+func TestShadowRespectsTenantOptOut(t *testing.T) {
+	svc := newDemoService(t)
+	if err := svc.SetShadow(ShadowConfig{
+		Capability: "observatory.models.infer",
+		Provider:   &ProviderConfig{Type: ProviderTypeEcho},
+	}); err != nil {
+		t.Fatalf("set shadow: %v", err.Message)
+	}
+	if err := svc.SetShadowOptOut("private", true); err != nil {
+		t.Fatalf("opt out: %v", err.Message)
+	}
+	invoke := func(tenant string) {
+		t.Helper()
+		if _, err := svc.Invoke(context.Background(), "observatory.models.infer", InvokeRequest{
+			Header:  MessageHeader{TenantID: tenant},
+			Payload: map[string]interface{}{"input": "hi"},
+		}, "tester", AnonymousPrincipal()); err != nil {
+			t.Fatalf("invoke: %v", err.Message)
+		}
+	}
+	invoke("private")
+	invoke("public")
+	waitFor(t, func() bool { return len(svc.ShadowComparisons("", 0)) == 1 }, "shadow comparison")
+	time.Sleep(20 * time.Millisecond)
+	comparisons := svc.ShadowComparisons("", 0)
+	if len(comparisons) != 1 || comparisons[0].TenantID != "public" || !comparisons[0].Match {
+		t.Fatalf("expected one matching comparison for the public tenant, got %#v", comparisons)
+	}
+}
+
+func TestShadowConfigValidation(t *testing.T) {
+	svc := NewService()
+	for _, cfg := range []ShadowConfig{
+		{Capability: "observatory.models.infer"},
+		{Capability: "observatory.models.infer", Version: "1.0.0", Provider: &ProviderConfig{Type: ProviderTypeEcho}},
+		{Capability: "observatory.models.infer", Version: "9.9.9"},
+		{Capability: "observatory.models.infer", Version: "1.0.0", SampleRate: 1.5},
+	} {
+		if err := svc.SetShadow(cfg); err == nil || err.Code != ErrorInvalidRequest {
+			t.Fatalf("expected %#v to be rejected, got %#v", cfg, err)
+		}
+	}
+	if err := svc.SetShadow(ShadowConfig{Capability: "acme.missing", Version: "1.0.0"}); err == nil || err.Code != ErrorUnsupportedCapability {
+		t.Fatalf("expected unknown capability, got %#v", err)
+	}
+}
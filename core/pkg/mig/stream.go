@@ -0,0 +1,356 @@
+package mig
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	ModeUnary        = "unary"
+	ModeServerStream = "server_stream"
+	ModeClientStream = "client_stream"
+	ModeBidiStream   = "bidi_stream"
+)
+
+var errStreamClosed = errors.New("stream closed")
+
+// streamCall is a streaming invocation that passed resolution, scope, quota,
+// and input transform checks and is ready to dispatch.
+type streamCall struct {
+	capDesc     CapabilityDescriptor
+	provider    Provider
+	req         InvokeRequest
+	deadlineAt  time.Time
+	inputSteps  []compiledStep
+	outputSteps []compiledStep
+	metrics     *Metrics
+}
+
+// prepareStream runs the pre-dispatch checks shared by every streaming mode.
+// ok is false, with no error, when the capability does not advertise mode.
+func (s *Service) prepareStream(ctx context.Context, capability string, req InvokeRequest, principal Principal, mode, operation string) (*streamCall, bool, *MigError) {
+	head := req.Header
+	if err := head.Normalize(time.Now()); err != nil {
+		s.recordError(ErrorInvalidRequest, operation)
+		return nil, false, invalid(err.Error())
+	}
+	head.AddIDGMeta("core")
+	deadlineAt := callDeadline(ctx, head, time.Now())
+	head.DeadlineMS = max(int(time.Until(deadlineAt).Milliseconds()), 1)
+	if capability == "" {
+		capability = req.Capability
+	}
+	if capability == "" {
+		s.recordError(ErrorInvalidRequest, operation)
+		return nil, false, invalid("capability is required")
+	}
+	constraint, _ := head.Meta[CapabilityVersionMetaKey].(string)
+
+	s.mu.RLock()
+	key, capDesc, migErr := s.resolveCapabilityLocked(capability, constraint)
+	if migErr != nil {
+		s.mu.RUnlock()
+		s.recordError(migErr.Code, operation)
+		return nil, false, migErr
+	}
+	if !slices.Contains(capDesc.Modes, mode) {
+		s.mu.RUnlock()
+		return nil, false, nil
+	}
+	head.Meta[CapabilityVersionMetaKey] = capDesc.Version
+	req.Capability = capDesc.ID
+	req.Header = head
+	if !principal.HasAnyScope(capDesc.AuthScopes) {
+		s.mu.RUnlock()
+		s.recordError(ErrorForbidden, operation)
+		return nil, false, &MigError{Code: ErrorForbidden, Message: "insufficient capability scope", Retryable: false}
+	}
+	provider := s.providers[key]
+	if provider == nil {
+		s.mu.RUnlock()
+		s.recordError(ErrorUnavailable, operation)
+		return nil, false, &MigError{Code: ErrorUnavailable, Message: "no provider bound to capability", Retryable: true}
+	}
+	if reason, cancelled := s.precancelledLocked(head, principal, time.Now()); cancelled {
+		s.mu.RUnlock()
+		s.recordError(ErrorTimeout, operation)
+		return nil, false, cancelledError(reason)
+	}
+	if migErr := checkBudget(capDesc, deadlineAt, time.Now()); migErr != nil {
+		s.mu.RUnlock()
+		s.recordError(migErr.Code, operation)
+		return nil, false, migErr
+	}
+	quota, hasQuota := s.quotas[head.TenantID]
+	used := s.tenantInvocations[head.TenantID]
+	transforms := s.transforms[key]
+	validation := s.schemaValidation[key]
+	call := &streamCall{
+		capDesc:     capDesc,
+		provider:    provider,
+		deadlineAt:  deadlineAt,
+		inputSteps:  transforms.steps(TransformDirectionInput),
+		outputSteps: transforms.steps(TransformDirectionOutput),
+		metrics:     s.metrics,
+	}
+	s.mu.RUnlock()
+
+	if hasQuota && used >= quota {
+		s.recordError(ErrorRateLimited, operation)
+		return nil, false, &MigError{Code: ErrorRateLimited, Message: "tenant quota exceeded", Retryable: true}
+	}
+	if migErr := s.validatePayload(capDesc, validation, req.Payload); migErr != nil {
+		s.recordError(migErr.Code, operation)
+		return nil, false, migErr
+	}
+	if len(call.inputSteps) > 0 {
+		transformed, err := applySteps(call.inputSteps, req.Payload, false, nil)
+		if err != nil {
+			s.recordError(ErrorInvalidRequest, operation)
+			return nil, false, invalid("input transform failed: " + err.Error())
+		}
+		req.Payload = transformed
+	}
+	call.req = req
+	return call, true, nil
+}
+
+// streamContext derives the provider context: registered for CANCEL, bounded
+// by the call deadline, and carrying the invocation for nested calls.
+func (s *Service) streamContext(ctx context.Context, call *streamCall, actor string, principal Principal) (context.Context, func()) {
+	trackedCtx, release := s.trackInvocation(ctx, call.req.Header, principal)
+	reqCtx, cancel := context.WithDeadline(trackedCtx, call.deadlineAt)
+	inv := &invocation{actor: actor, principal: principal}
+	if parent := invocationFromContext(ctx); parent != nil {
+		inv.depth = parent.depth + 1
+	}
+	return context.WithValue(reqCtx, invocationKey{}, inv), func() {
+		cancel()
+		release()
+	}
+}
+
+// frameRelay forwards provider frames to the caller. It serializes emits and
+// stops accepting frames once the stream has ended, failed, or timed out.
+type frameRelay struct {
+	head        MessageHeader
+	capability  string
+	outputSteps []compiledStep
+	metrics     *Metrics
+	emit        func(StreamFrame) error
+
+	mu        sync.Mutex
+	closed    bool
+	ended     bool
+	cancelled bool
+	frames    int
+	relayErr  *MigError
+	writeFail error
+}
+
+func newFrameRelay(call *streamCall, emit func(StreamFrame) error) *frameRelay {
+	return &frameRelay{
+		head:        call.req.Header,
+		capability:  call.capDesc.ID,
+		outputSteps: call.outputSteps,
+		metrics:     call.metrics,
+		emit:        emit,
+	}
+}
+
+func (r *frameRelay) relay(frame StreamFrame) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || r.ended {
+		return errStreamClosed
+	}
+	if frame.Kind == "" {
+		frame.Kind = "response"
+	}
+	if frame.Kind == "error" {
+		// Providers report failures by returning them; an error frame ends
+		// the stream the same way.
+		r.relayErr = frame.Error
+		if r.relayErr == nil {
+			r.relayErr = &MigError{Code: ErrorInternal, Message: "provider sent an error frame", Retryable: false}
+		}
+		r.ended = true
+		return errStreamClosed
+	}
+	if frame.Kind == "response" && len(r.outputSteps) > 0 && frame.Payload != nil {
+		transformed, err := applySteps(r.outputSteps, frame.Payload, false, nil)
+		if err != nil {
+			r.relayErr = &MigError{Code: ErrorInternal, Message: "output transform failed: " + err.Error(), Retryable: false}
+			r.ended = true
+			return errStreamClosed
+		}
+		frame.Payload = transformed
+	}
+	frame.Header = r.head
+	frame.Capability = r.capability
+	frame.Error = nil
+	if err := r.emit(frame); err != nil {
+		r.writeFail = err
+		r.closed = true
+		return err
+	}
+	r.frames++
+	if r.metrics != nil {
+		r.metrics.RecordStreamFrame(r.capability, frame.Kind)
+	}
+	if frame.EndStream {
+		r.ended = true
+	}
+	return nil
+}
+
+// finish closes the relay and settles the stream outcome. A provider that
+// returned without a terminal frame gets one sent on its behalf, so callers
+// always see EndStream. A stream aborted by CANCEL ends with a terminal
+// control frame instead and is marked cancelled; callers send nothing more.
+func (r *frameRelay) finish(reqCtx context.Context, outErr *MigError) *MigError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	reason, cancelled := cancelledBy(reqCtx)
+	switch {
+	case r.writeFail != nil:
+		outErr = &MigError{Code: ErrorUnavailable, Message: "stream closed: " + r.writeFail.Error(), Retryable: true}
+	case cancelled && (!r.ended || r.relayErr != nil):
+		// An error frame from the provider was never relayed, so the
+		// control frame is still the first terminal frame.
+		r.cancelled = true
+		outErr = cancelledError(reason)
+		if err := r.emit(StreamFrame{
+			Header:     r.head,
+			Capability: r.capability,
+			Kind:       "control",
+			Payload:    map[string]interface{}{"action": "cancelled", "reason": reason},
+			EndStream:  true,
+		}); err == nil {
+			r.frames++
+		}
+	case r.relayErr != nil:
+		outErr = r.relayErr
+	case outErr == nil && !r.ended:
+		if err := r.emit(StreamFrame{Header: r.head, Capability: r.capability, Kind: "response", EndStream: true}); err != nil {
+			outErr = &MigError{Code: ErrorUnavailable, Message: "stream closed: " + err.Error(), Retryable: true}
+		} else {
+			r.frames++
+		}
+	}
+	return outErr
+}
+
+func (r *frameRelay) result() (frames int, cancelled bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.frames, r.cancelled
+}
+
+// awaitProvider waits for the provider to return or the context to end,
+// whichever comes first.
+func awaitProvider(ctx, reqCtx context.Context, done <-chan *MigError) *MigError {
+	select {
+	case <-reqCtx.Done():
+		if reason, cancelled := cancelledBy(reqCtx); cancelled {
+			return cancelledError(reason)
+		}
+		outErr := &MigError{Code: ErrorTimeout, Message: "deadline exceeded", Retryable: true}
+		if ctx.Err() != nil {
+			outErr.Message = "stream cancelled"
+		}
+		return outErr
+	case outErr := <-done:
+		return outErr
+	}
+}
+
+// InvokeStream runs a server-streaming INVOKE and relays every frame the
+// provider emits, in order, until the terminal frame. Relayed frames carry
+// the normalized request header and the resolved capability ID; callers fill
+// in their own StreamID.
+//
+// Capabilities that do not advertise server_stream are invoked through Invoke
+// and answered with one terminal response frame. Streaming calls skip
+// idempotency replay, retries, hedging, fallback chains, canary routing, and
+// shadow traffic, since none of them can be applied once frames have reached
+// the caller.
+//
+// A non-nil error means the stream failed; the caller owns turning it into an
+// error frame or status. Frames already relayed stay delivered. A stream
+// aborted by CANCEL has already ended with a control frame and returns nil.
+func (s *Service) InvokeStream(ctx context.Context, capability string, req InvokeRequest, actor string, principal Principal, emit func(StreamFrame) error) *MigError {
+	call, ok, migErr := s.prepareStream(ctx, capability, req, principal, ModeServerStream, "invoke_stream")
+	if migErr != nil {
+		return migErr
+	}
+	if !ok {
+		resp, migErr := s.Invoke(ctx, capability, req, actor, principal)
+		if migErr != nil {
+			return migErr
+		}
+		if err := emit(StreamFrame{Header: resp.Header, Capability: resp.Capability, Kind: "response", Payload: resp.Payload, EndStream: true}); err != nil {
+			return &MigError{Code: ErrorUnavailable, Message: "stream closed: " + err.Error(), Retryable: true}
+		}
+		return nil
+	}
+	reqCtx, cancel := s.streamContext(ctx, call, actor, principal)
+	defer cancel()
+	relay := newFrameRelay(call, emit)
+
+	started := time.Now()
+	done := make(chan *MigError, 1)
+	go func() {
+		done <- call.provider.InvokeStream(reqCtx, call.req, relay.relay)
+	}()
+	outErr := relay.finish(reqCtx, awaitProvider(ctx, reqCtx, done))
+	if outErr != nil {
+		s.recordError(outErr.Code, "invoke_stream")
+	}
+	if cancelled := s.auditStream(actor, call, ModeServerStream, relay, time.Since(started), outErr); cancelled {
+		return nil
+	}
+	return outErr
+}
+
+// auditStream records the end of a stream and, when it completed, counts it
+// toward tenant and capability usage. It reports whether CANCEL ended the
+// stream.
+func (s *Service) auditStream(actor string, call *streamCall, mode string, relay *frameRelay, elapsed time.Duration, migErr *MigError) bool {
+	head, capDesc := call.req.Header, call.capDesc
+	frames, cancelled := relay.result()
+	record := AuditRecord{
+		Actor:      actor,
+		TenantID:   head.TenantID,
+		Capability: capDesc.ID,
+		Version:    capDesc.Version,
+		Outcome:    "success",
+		Timestamp:  time.Now().UTC().Format(time.RFC3339),
+		MessageID:  head.MessageID,
+		DurationMS: durationMS(elapsed),
+		Mode:       mode,
+		Frames:     frames,
+	}
+	record.Parent, _ = head.Meta[ParentCapabilityMetaKey].(string)
+	if migErr != nil {
+		record.Outcome = "error"
+		if cancelled {
+			record.Outcome = "cancelled"
+		}
+		record.ErrorCode = migErr.Code
+		record.Reason = migErr.Message
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if migErr == nil {
+		s.tenantInvocations[head.TenantID]++
+		s.capabilityInvocations[capDesc.ID]++
+	}
+	s.audit = append(s.audit, record)
+	s.writeAuditLogLocked(record)
+	return cancelled
+}
@@ -0,0 +1,258 @@
+package mig
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	migv01 "github.com/InvariantDynamics/model-interface-gateway-oss/proto/mig/v0_1"
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func streamDescriptor(id string) CapabilityDescriptor {
+	desc := testDescriptor(id)
+	desc.Modes = []string{ModeUnary, ModeServerStream}
+	return desc
+}
+
+func newStreamService(t *testing.T) *Service {
+	t.Helper()
+	svc := newDemoService(t)
+	bind := func(id string, f StreamProviderFunc) {
+		if err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: streamDescriptor(id)}); err != nil {
+			t.Fatalf("add %s: %v", id, err.Message)
+		}
+		_ = svc.BindProvider(id, f)
+	}
+	bind("acme.llm.generate", func(_ context.Context, req InvokeRequest, emit func(StreamFrame) error) *MigError {
+		words := strings.Fields(req.Payload["prompt"].(string))
+		for _, word := range words {
+			if err := emit(StreamFrame{Kind: "event", Payload: map[string]interface{}{"token": word}}); err != nil {
+				return &MigError{Code: ErrorUnavailable, Message: err.Error(), Retryable: true}
+			}
+		}
+		_ = emit(StreamFrame{Kind: "response", Payload: map[string]interface{}{"tokens": len(words)}, EndStream: true})
+		return nil
+	})
+	bind("acme.llm.broken", func(_ context.Context, _ InvokeRequest, emit func(StreamFrame) error) *MigError {
+		_ = emit(StreamFrame{Kind: "event", Payload: map[string]interface{}{"token": "partial"}})
+		return &MigError{Code: ErrorUnavailable, Message: "model crashed", Retryable: true}
+	})
+	bind("acme.llm.open", func(_ context.Context, _ InvokeRequest, emit func(StreamFrame) error) *MigError {
+		_ = emit(StreamFrame{Kind: "event", Payload: map[string]interface{}{"token": "only"}})
+		return nil
+	})
+	return svc
+}
+
+func collectStream(svc *Service, capability string, payload map[string]interface{}) ([]StreamFrame, *MigError) {
+	var frames []StreamFrame
+	migErr := svc.InvokeStream(context.Background(), capability, InvokeRequest{
+		Header:  MessageHeader{TenantID: "acme", MessageID: "msg-" + capability},
+		Payload: payload,
+	}, "tester", AnonymousPrincipal(), func(frame StreamFrame) error {
+		frames = append(frames, frame)
+		return nil
+	})
+	return frames, migErr
+}
+
+func TestInvokeStreamRelaysFrames(t *testing.T) {
+	svc := newStreamService(t)
+	frames, err := collectStream(svc, "acme.llm.generate", map[string]interface{}{"prompt": "one two three"})
+	if err != nil {
+		t.Fatalf("stream: %v", err.Message)
+	}
+	if len(frames) != 4 {
+		t.Fatalf("expected three tokens and a final frame, got %#v", frames)
+	}
+	for i, word := range []string{"one", "two", "three"} {
+		if frames[i].Kind != "event" || frames[i].EndStream || frames[i].Payload["token"] != word {
+			t.Fatalf("unexpected frame %d: %#v", i, frames[i])
+		}
+		if frames[i].Header.MessageID != "msg-acme.llm.generate" || frames[i].Capability != "acme.llm.generate" {
+			t.Fatalf("frames should carry the request header: %#v", frames[i])
+		}
+	}
+	if last := frames[3]; last.Kind != "response" || !last.EndStream || last.Payload["tokens"] != 3 {
+		t.Fatalf("unexpected final frame: %#v", last)
+	}
+
+	records := svc.AuditExport("acme")
+	last := records[len(records)-1]
+	if last.Outcome != "success" || last.Mode != ModeServerStream || last.Frames != 4 {
+		t.Fatalf("unexpected stream audit record: %#v", last)
+	}
+	if usage := svc.Usage(); usage.CapabilityInvocations["acme.llm.generate"] != 1 {
+		t.Fatalf("completed streams should count toward usage: %#v", usage)
+	}
+}
+
+func TestInvokeStreamErrorsAndTermination(t *testing.T) {
+	svc := newStreamService(t)
+	frames, err := collectStream(svc, "acme.llm.broken", nil)
+	if err == nil || err.Code != ErrorUnavailable || len(frames) != 1 {
+		t.Fatalf("expected one frame then the provider error, got %#v %#v", frames, err)
+	}
+	records := svc.AuditExport("acme")
+	if last := records[len(records)-1]; last.Outcome != "error" || last.ErrorCode != ErrorUnavailable || last.Frames != 1 {
+		t.Fatalf("unexpected failed stream audit record: %#v", last)
+	}
+	if usage := svc.Usage(); usage.CapabilityInvocations["acme.llm.broken"] != 0 {
+		t.Fatalf("failed streams should not count toward usage: %#v", usage)
+	}
+
+	frames, err = collectStream(svc, "acme.llm.open", nil)
+	if err != nil || len(frames) != 2 || !frames[1].EndStream {
+		t.Fatalf("the gateway should close an unterminated stream: %#v %#v", frames, err)
+	}
+
+	// Unary-only capabilities answer with a single terminal frame.
+	frames, err = collectStream(svc, "observatory.models.infer", map[string]interface{}{"input": "x"})
+	if err != nil || len(frames) != 1 || frames[0].Kind != "response" || !frames[0].EndStream {
+		t.Fatalf("unexpected unary stream: %#v %#v", frames, err)
+	}
+}
+
+func TestInvokeStreamOverSSEAndWebSocket(t *testing.T) {
+	svc := newStreamService(t)
+	mux := http.NewServeMux()
+	RegisterHTTPRoutes(mux, svc)
+	srv := httptest.NewServer(AuthMiddleware(AuthConfig{Mode: AuthModeNone})(mux))
+	defer srv.Close()
+
+	body := `{"header":{"tenant_id":"acme"},"stream_preference":"server_stream","payload":{"prompt":"hi there"}}`
+	resp, err := http.Post(srv.URL+"/mig/v0.1/invoke/acme.llm.generate", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("sse invoke: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Fatalf("expected an event stream, got %q", ct)
+	}
+	var kinds []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var frame StreamFrame
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &frame); err != nil {
+			t.Fatalf("decode frame: %v", err)
+		}
+		kinds = append(kinds, frame.Kind)
+	}
+	if strings.Join(kinds, ",") != "event,event,response" {
+		t.Fatalf("unexpected sse frames: %v", kinds)
+	}
+
+	body = `{"header":{"tenant_id":"acme"},"stream_preference":"server_stream","payload":{}}`
+	resp, err = http.Post(srv.URL+"/mig/v0.1/invoke/acme.llm.missing", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("sse invoke: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("errors before the first frame should keep their status, got %d", resp.StatusCode)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+srv.URL[len("http"):]+"/mig/v0.1/stream", nil)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	defer conn.Close()
+	for _, capability := range []string{"acme.llm.generate", "acme.llm.broken"} {
+		if err := conn.WriteJSON(StreamFrame{
+			Header:     MessageHeader{TenantID: "acme"},
+			StreamID:   "s-" + capability,
+			Capability: capability,
+			Kind:       "request",
+			Payload:    map[string]interface{}{"prompt": "a b"},
+		}); err != nil {
+			t.Fatalf("write frame: %v", err)
+		}
+	}
+	// Calls on one connection run concurrently, so only the order within
+	// each stream is fixed.
+	got := map[string][]string{}
+	for n := 0; n < 5; n++ {
+		var frame StreamFrame
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("read frame: %v", err)
+		}
+		got[frame.StreamID] = append(got[frame.StreamID], frame.Kind)
+	}
+	if strings.Join(got["s-acme.llm.generate"], ",") != "event,event,response" || strings.Join(got["s-acme.llm.broken"], ",") != "event,error" {
+		t.Fatalf("unexpected websocket frames: %v", got)
+	}
+}
+
+func TestInvokeStreamOverGRPC(t *testing.T) {
+	svc := newStreamService(t)
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(grpc.StreamInterceptor(GRPCStreamAuthInterceptor(AuthConfig{Mode: AuthModeNone})))
+	RegisterGRPCServices(server, svc)
+	defer server.Stop()
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("grpc dial: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := migv01.NewInvocationClient(conn).StreamInvoke(ctx)
+	if err != nil {
+		t.Fatalf("stream invoke: %v", err)
+	}
+	payload, _ := structpb.NewStruct(map[string]interface{}{"prompt": "x y z"})
+	if err := stream.Send(&migv01.StreamFrame{
+		Header:     &migv01.MessageHeader{TenantId: "acme", MigVersion: "0.1"},
+		StreamId:   "s-1",
+		Capability: "acme.llm.generate",
+		Kind:       migv01.FrameKind_FRAME_KIND_REQUEST,
+		Payload:    payload,
+	}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	var tokens []string
+	for {
+		frame, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("recv: %v", err)
+		}
+		if frame.GetStreamId() != "s-1" {
+			t.Fatalf("unexpected stream id: %v", frame)
+		}
+		if frame.GetEndStream() {
+			if frame.GetKind() != migv01.FrameKind_FRAME_KIND_RESPONSE || frame.GetPayload().AsMap()["tokens"] != float64(3) {
+				t.Fatalf("unexpected final frame: %v", frame)
+			}
+			break
+		}
+		tokens = append(tokens, frame.GetPayload().AsMap()["token"].(string))
+	}
+	if strings.Join(tokens, " ") != "x y z" {
+		t.Fatalf("unexpected tokens: %v", tokens)
+	}
+}
@@ -0,0 +1,567 @@
+package mig
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	TransformRename  = "rename"
+	TransformDefault = "default"
+	TransformExtract = "extract"
+	TransformWrap    = "wrap"
+
+	TransformDirectionInput  = "input"
+	TransformDirectionOutput = "output"
+)
+
+// TransformConfig reshapes payloads on the way to the provider (Input) and on
+// the way back to the caller (Output). Steps run in order.
+type TransformConfig struct {
+	Input  []TransformStep `json:"input,omitempty"`
+	Output []TransformStep `json:"output,omitempty"`
+}
+
+// TransformStep is one declarative payload rewrite. Paths use a JSONPath
+// subset: "$.a.b", "a.b", "items[0].name", or "$['odd key']".
+//
+//   - rename moves the value at From to To.
+//   - default sets Path to Value when Path is absent or null.
+//   - extract copies the value at Path to To, or replaces the whole payload
+//     with it when To is empty.
+//   - wrap replaces the payload with Template. A string that is exactly
+//     "{{path}}" becomes the referenced value; other strings interpolate
+//     "{{path}}" references as text.
+type TransformStep struct {
+	Op       string                 `json:"op"`
+	From     string                 `json:"from,omitempty"`
+	To       string                 `json:"to,omitempty"`
+	Path     string                 `json:"path,omitempty"`
+	Value    interface{}            `json:"value,omitempty"`
+	Template map[string]interface{} `json:"template,omitempty"`
+}
+
+// TransformDryRunRequest previews a pipeline. Transforms, when set, is used
+// instead of the one registered for Capability.
+type TransformDryRunRequest struct {
+	Capability string                 `json:"capability,omitempty"`
+	Transforms *TransformConfig       `json:"transforms,omitempty"`
+	Direction  string                 `json:"direction"`
+	Payload    map[string]interface{} `json:"payload"`
+}
+
+// TransformDryRunResponse holds the final payload and the payload after each
+// step.
+type TransformDryRunResponse struct {
+	Payload map[string]interface{}   `json:"payload"`
+	Steps   []map[string]interface{} `json:"steps"`
+}
+
+type pathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+type transformPipeline struct {
+	input  []compiledStep
+	output []compiledStep
+}
+
+type compiledStep struct {
+	TransformStep
+	from, to, path []pathSegment
+}
+
+func compileTransforms(cfg TransformConfig) (*transformPipeline, *MigError) {
+	input, migErr := compileSteps(TransformDirectionInput, cfg.Input)
+	if migErr != nil {
+		return nil, migErr
+	}
+	output, migErr := compileSteps(TransformDirectionOutput, cfg.Output)
+	if migErr != nil {
+		return nil, migErr
+	}
+	return &transformPipeline{input: input, output: output}, nil
+}
+
+func compileSteps(direction string, steps []TransformStep) ([]compiledStep, *MigError) {
+	out := make([]compiledStep, 0, len(steps))
+	for i, step := range steps {
+		fail := func(msg string) *MigError {
+			return invalid(fmt.Sprintf("transforms.%s[%d]: %s", direction, i, msg))
+		}
+		compiled := compiledStep{TransformStep: step}
+		var err error
+		switch step.Op {
+		case TransformRename:
+			if step.From == "" || step.To == "" {
+				return nil, fail("rename requires from and to")
+			}
+			if compiled.from, err = parsePath(step.From); err == nil {
+				compiled.to, err = parsePath(step.To)
+			}
+		case TransformDefault:
+			if step.Path == "" || step.Value == nil {
+				return nil, fail("default requires path and value")
+			}
+			compiled.path, err = parsePath(step.Path)
+		case TransformExtract:
+			if step.Path == "" {
+				return nil, fail("extract requires path")
+			}
+			if compiled.path, err = parsePath(step.Path); err == nil && step.To != "" {
+				compiled.to, err = parsePath(step.To)
+			}
+		case TransformWrap:
+			if len(step.Template) == 0 {
+				return nil, fail("wrap requires template")
+			}
+			err = checkTemplate(step.Template)
+		default:
+			return nil, fail(fmt.Sprintf("unknown op %q", step.Op))
+		}
+		if err != nil {
+			return nil, fail(err.Error())
+		}
+		if (step.Op == TransformRename && (len(compiled.from) == 0 || len(compiled.to) == 0)) || (step.Op == TransformDefault && len(compiled.path) == 0) {
+			return nil, fail("rename and default paths must not be the payload root")
+		}
+		out = append(out, compiled)
+	}
+	return out, nil
+}
+
+// parsePath parses the supported JSONPath subset. "$" alone is the root.
+func parsePath(raw string) ([]pathSegment, error) {
+	p := strings.TrimSpace(raw)
+	p = strings.TrimPrefix(p, "$")
+	var out []pathSegment
+	for len(p) > 0 {
+		switch {
+		case p[0] == '.':
+			p = p[1:]
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid path %q", raw)
+			}
+			out = append(out, pathSegment{key: p[:end]})
+			p = p[end:]
+		case p[0] == '[':
+			end := strings.IndexByte(p, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated [ in path %q", raw)
+			}
+			inner := p[1:end]
+			p = p[end+1:]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				out = append(out, pathSegment{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			idx, err := strconv.Atoi(inner)
+			if err != nil || idx < 0 {
+				return nil, fmt.Errorf("invalid index %q in path %q", inner, raw)
+			}
+			out = append(out, pathSegment{index: idx, isIndex: true})
+		case len(out) == 0 && !strings.HasPrefix(strings.TrimSpace(raw), "$"):
+			// Bare leading field, as in "a.b".
+			p = "." + p
+		default:
+			return nil, fmt.Errorf("invalid path %q", raw)
+		}
+	}
+	return out, nil
+}
+
+func getPath(doc interface{}, path []pathSegment) (interface{}, bool) {
+	current := doc
+	for _, seg := range path {
+		if seg.isIndex {
+			list, ok := current.([]interface{})
+			if !ok || seg.index >= len(list) {
+				return nil, false
+			}
+			current = list[seg.index]
+			continue
+		}
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = obj[seg.key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// setPath writes value at path, creating intermediate objects. Arrays are only
+// written at existing indexes.
+func setPath(doc map[string]interface{}, path []pathSegment, value interface{}) error {
+	var current interface{} = doc
+	for i, seg := range path {
+		last := i == len(path)-1
+		if seg.isIndex {
+			list, ok := current.([]interface{})
+			if !ok || seg.index >= len(list) {
+				return fmt.Errorf("index %d out of range", seg.index)
+			}
+			if last {
+				list[seg.index] = value
+				return nil
+			}
+			current = list[seg.index]
+			continue
+		}
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%q is not an object", seg.key)
+		}
+		if last {
+			obj[seg.key] = value
+			return nil
+		}
+		next, exists := obj[seg.key]
+		if !exists || next == nil {
+			next = map[string]interface{}{}
+			obj[seg.key] = next
+		}
+		current = next
+	}
+	return nil
+}
+
+func deletePath(doc map[string]interface{}, path []pathSegment) {
+	if len(path) == 0 {
+		return
+	}
+	parent, ok := getPath(doc, path[:len(path)-1])
+	if !ok {
+		return
+	}
+	last := path[len(path)-1]
+	if obj, ok := parent.(map[string]interface{}); ok && !last.isIndex {
+		delete(obj, last.key)
+	}
+}
+
+func checkTemplate(value interface{}) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, child := range v {
+			if err := checkTemplate(child); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if err := checkTemplate(child); err != nil {
+				return err
+			}
+		}
+	case string:
+		refs, err := templateRefs(v)
+		if err != nil {
+			return err
+		}
+		for _, ref := range refs {
+			if _, err := parsePath(ref); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func templateRefs(s string) ([]string, error) {
+	var refs []string
+	for {
+		start := strings.Index(s, "{{")
+		if start < 0 {
+			return refs, nil
+		}
+		end := strings.Index(s[start:], "}}")
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated {{ in template %q", s)
+		}
+		refs = append(refs, strings.TrimSpace(s[start+2:start+end]))
+		s = s[start+end+2:]
+	}
+}
+
+// renderTemplate fills a template from doc. With strict set, references to
+// missing paths are errors; otherwise they render as null or "".
+func renderTemplate(value interface{}, doc interface{}, strict bool) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			rendered, err := renderTemplate(child, doc, strict)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = rendered
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, child := range v {
+			rendered, err := renderTemplate(child, doc, strict)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = rendered
+		}
+		return out, nil
+	case string:
+		lookup := func(ref string) (interface{}, error) {
+			path, _ := parsePath(ref)
+			got, ok := getPath(doc, path)
+			if !ok && strict {
+				return nil, fmt.Errorf("template references missing path %q", ref)
+			}
+			return got, nil
+		}
+		trimmed := strings.TrimSpace(v)
+		if strings.HasPrefix(trimmed, "{{") && strings.HasSuffix(trimmed, "}}") && strings.Count(trimmed, "{{") == 1 {
+			return lookup(strings.TrimSpace(trimmed[2 : len(trimmed)-2]))
+		}
+		var b strings.Builder
+		rest := v
+		for {
+			start := strings.Index(rest, "{{")
+			if start < 0 {
+				b.WriteString(rest)
+				return b.String(), nil
+			}
+			end := strings.Index(rest[start:], "}}")
+			b.WriteString(rest[:start])
+			got, err := lookup(strings.TrimSpace(rest[start+2 : start+end]))
+			if err != nil {
+				return nil, err
+			}
+			if got != nil {
+				b.WriteString(fmt.Sprint(got))
+			}
+			rest = rest[start+end+2:]
+		}
+	}
+	return value, nil
+}
+
+// applySteps runs steps over a copy of payload. trace, when non-nil, receives the
+// payload after each step. strict makes missing source paths errors, which is
+// how registration checks pipelines against schema samples.
+func applySteps(steps []compiledStep, payload map[string]interface{}, strict bool, trace *[]map[string]interface{}) (map[string]interface{}, error) {
+	doc, _ := normalizeJSON(payload).(map[string]interface{})
+	if doc == nil {
+		doc = map[string]interface{}{}
+	}
+	for i, step := range steps {
+		fail := func(err error) error {
+			return fmt.Errorf("step %d (%s): %w", i, step.Op, err)
+		}
+		switch step.Op {
+		case TransformRename:
+			value, ok := getPath(doc, step.from)
+			if !ok {
+				if strict {
+					return nil, fail(fmt.Errorf("path %q not found", step.From))
+				}
+				break
+			}
+			deletePath(doc, step.from)
+			if err := setPath(doc, step.to, value); err != nil {
+				return nil, fail(err)
+			}
+		case TransformDefault:
+			if value, ok := getPath(doc, step.path); !ok || value == nil {
+				if err := setPath(doc, step.path, normalizeValue(step.Value)); err != nil {
+					return nil, fail(err)
+				}
+			}
+		case TransformExtract:
+			value, ok := getPath(doc, step.path)
+			if !ok {
+				if strict {
+					return nil, fail(fmt.Errorf("path %q not found", step.Path))
+				}
+				if len(step.to) == 0 {
+					return nil, fail(fmt.Errorf("path %q not found", step.Path))
+				}
+				break
+			}
+			if len(step.to) == 0 {
+				obj, isObj := value.(map[string]interface{})
+				if !isObj {
+					return nil, fail(fmt.Errorf("extracting the payload root requires an object at %q", step.Path))
+				}
+				doc = obj
+				break
+			}
+			if err := setPath(doc, step.to, value); err != nil {
+				return nil, fail(err)
+			}
+		case TransformWrap:
+			rendered, err := renderTemplate(normalizeValue(step.Template), doc, strict)
+			if err != nil {
+				return nil, fail(err)
+			}
+			doc = rendered.(map[string]interface{})
+		}
+		if trace != nil {
+			*trace = append(*trace, normalizeJSON(doc).(map[string]interface{}))
+		}
+	}
+	return doc, nil
+}
+
+func normalizeValue(value interface{}) interface{} {
+	if obj, ok := value.(map[string]interface{}); ok {
+		return normalizeJSON(obj)
+	}
+	return normalizeJSON(map[string]interface{}{"v": value}).(map[string]interface{})["v"]
+}
+
+func (p *transformPipeline) steps(direction string) []compiledStep {
+	if p == nil {
+		return nil
+	}
+	if direction == TransformDirectionOutput {
+		return p.output
+	}
+	return p.input
+}
+
+// validateTransforms checks a pipeline against the capability schemas when
+// they are registered. The input pipeline is run in strict mode over a sample
+// built from the input schema, so it may only read declared fields. Fields
+// written at the top level by the output pipeline must be declared by the
+// output schema when it lists properties.
+func validateTransforms(p *transformPipeline, inputSchema, outputSchema map[string]interface{}) *MigError {
+	if inputSchema != nil && len(p.input) > 0 {
+		sample, _ := schemaSample(inputSchema).(map[string]interface{})
+		if sample == nil {
+			sample = map[string]interface{}{}
+		}
+		if _, err := applySteps(p.input, sample, true, nil); err != nil {
+			return invalid("transforms.input does not match the input schema: " + err.Error())
+		}
+	}
+	if outputSchema == nil || len(p.output) == 0 {
+		return nil
+	}
+	declared, ok := outputSchema["properties"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	var written []string
+	for _, step := range p.output {
+		switch step.Op {
+		case TransformRename:
+			written = append(written, topLevelKey(step.to)...)
+		case TransformDefault:
+			written = append(written, topLevelKey(step.path)...)
+		case TransformExtract:
+			written = append(written, topLevelKey(step.to)...)
+		}
+	}
+	if last := p.output[len(p.output)-1]; last.Op == TransformWrap {
+		// A trailing wrap decides the final top-level shape on its own.
+		written = written[:0]
+		for key := range last.Template {
+			written = append(written, key)
+		}
+	}
+	sort.Strings(written)
+	for _, key := range written {
+		if _, ok := declared[key]; !ok {
+			return invalid(fmt.Sprintf("transforms.output writes %q, which the output schema does not declare", key))
+		}
+	}
+	return nil
+}
+
+func topLevelKey(path []pathSegment) []string {
+	if len(path) == 0 || path[0].isIndex {
+		return nil
+	}
+	return []string{path[0].key}
+}
+
+// schemaSample builds a placeholder instance with every declared property, so
+// a pipeline can be exercised without real traffic.
+func schemaSample(schema interface{}) interface{} {
+	obj, ok := schema.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if example, ok := obj["default"]; ok {
+		return example
+	}
+	typ, _ := obj["type"].(string)
+	if props, ok := obj["properties"].(map[string]interface{}); ok && (typ == "" || typ == "object") {
+		out := make(map[string]interface{}, len(props))
+		for name, prop := range props {
+			out[name] = schemaSample(prop)
+		}
+		return out
+	}
+	switch typ {
+	case "object":
+		return map[string]interface{}{}
+	case "array":
+		if items, ok := obj["items"]; ok {
+			return []interface{}{schemaSample(items)}
+		}
+		return []interface{}{}
+	case "string":
+		return ""
+	case "integer", "number":
+		return float64(0)
+	case "boolean":
+		return false
+	}
+	return nil
+}
+
+// TransformDryRun shows what a pipeline does to a sample payload without
+// invoking a provider.
+func (s *Service) TransformDryRun(req TransformDryRunRequest) (TransformDryRunResponse, *MigError) {
+	if req.Direction == "" {
+		req.Direction = TransformDirectionInput
+	}
+	if req.Direction != TransformDirectionInput && req.Direction != TransformDirectionOutput {
+		return TransformDryRunResponse{}, invalid("direction must be input or output")
+	}
+	var pipeline *transformPipeline
+	if req.Transforms != nil {
+		compiled, migErr := compileTransforms(*req.Transforms)
+		if migErr != nil {
+			return TransformDryRunResponse{}, migErr
+		}
+		pipeline = compiled
+	} else {
+		if req.Capability == "" {
+			return TransformDryRunResponse{}, invalid("capability or transforms is required")
+		}
+		s.mu.RLock()
+		key, _, migErr := s.resolveCapabilityLocked(req.Capability, "")
+		pipeline = s.transforms[key]
+		s.mu.RUnlock()
+		if migErr != nil {
+			return TransformDryRunResponse{}, migErr
+		}
+	}
+	steps := []map[string]interface{}{}
+	out, err := applySteps(pipeline.steps(req.Direction), req.Payload, false, &steps)
+	if err != nil {
+		return TransformDryRunResponse{}, invalid("transform failed: " + err.Error())
+	}
+	return TransformDryRunResponse{Payload: out, Steps: steps}, nil
+}
@@ -0,0 +1,151 @@
+package mig
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTransformPipelineInvoke(t *testing.T) {
+	svc := NewService()
+	var seen map[string]interface{}
+	if err := svc.AddCapability(CapabilityUpsertRequest{
+		Descriptor: testDescriptor("acme.models.chat"),
+		Transforms: &TransformConfig{
+			Input: []TransformStep{
+				{Op: TransformRename, From: "prompt", To: "messages[0].content"},
+				{Op: TransformDefault, Path: "temperature", Value: 0.2},
+			},
+			Output: []TransformStep{
+				{Op: TransformExtract, Path: "$.choices[0].message.content", To: "text"},
+				{Op: TransformWrap, Template: map[string]interface{}{
+					"answer": "{{text}}",
+					"usage":  "{{$.usage.tokens}} tokens",
+				}},
+			},
+		},
+	}); err != nil {
+		t.Fatalf("add capability: %v", err.Message)
+	}
+	if err := svc.BindProvider("acme.models.chat", ProviderFunc(func(_ context.Context, req InvokeRequest) (map[string]interface{}, *MigError) {
+		seen = req.Payload
+		return map[string]interface{}{
+			"choices": []interface{}{map[string]interface{}{"message": map[string]interface{}{"content": "hi there"}}},
+			"usage":   map[string]interface{}{"tokens": 7},
+		}, nil
+	})); err != nil {
+		t.Fatalf("bind: %v", err.Message)
+	}
+
+	resp, err := svc.Invoke(context.Background(), "acme.models.chat", InvokeRequest{
+		Header: MessageHeader{TenantID: "acme"},
+		Payload: map[string]interface{}{
+			"prompt":   "hello",
+			"messages": []interface{}{map[string]interface{}{"role": "user"}},
+		},
+	}, "tester", AnonymousPrincipal())
+	if err != nil {
+		t.Fatalf("invoke: %v", err.Message)
+	}
+	messages, _ := seen["messages"].([]interface{})
+	if len(messages) != 1 || messages[0].(map[string]interface{})["content"] != "hello" || seen["temperature"] != 0.2 {
+		t.Fatalf("unexpected provider payload: %#v", seen)
+	}
+	if _, ok := seen["prompt"]; ok {
+		t.Fatalf("rename should remove the source field: %#v", seen)
+	}
+	if resp.Payload["answer"] != "hi there" || resp.Payload["usage"] != "7 tokens" || len(resp.Payload) != 2 {
+		t.Fatalf("unexpected response payload: %#v", resp.Payload)
+	}
+}
+
+func TestTransformValidationAgainstSchemas(t *testing.T) {
+	svc := NewService()
+	desc := testDescriptor("acme.models.checked")
+	if err := svc.AddSchema(SchemaUpsertRequest{URI: desc.InputSchemaURI, Schema: map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"prompt": map[string]interface{}{"type": "string"}},
+	}}); err != nil {
+		t.Fatalf("add schema: %v", err.Message)
+	}
+	if err := svc.AddSchema(SchemaUpsertRequest{URI: desc.OutputSchemaURI, Schema: map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"answer": map[string]interface{}{"type": "string"}},
+	}}); err != nil {
+		t.Fatalf("add schema: %v", err.Message)
+	}
+
+	cases := []struct {
+		name       string
+		transforms TransformConfig
+		ok         bool
+	}{
+		{"valid", TransformConfig{
+			Input:  []TransformStep{{Op: TransformRename, From: "prompt", To: "input"}},
+			Output: []TransformStep{{Op: TransformExtract, Path: "result", To: "answer"}},
+		}, true},
+		{"undeclared input field", TransformConfig{
+			Input: []TransformStep{{Op: TransformRename, From: "promt", To: "input"}},
+		}, false},
+		{"undeclared template reference", TransformConfig{
+			Input: []TransformStep{{Op: TransformWrap, Template: map[string]interface{}{"q": "{{query}}"}}},
+		}, false},
+		{"undeclared output field", TransformConfig{
+			Output: []TransformStep{{Op: TransformRename, From: "result", To: "reply"}},
+		}, false},
+		{"trailing wrap decides output shape", TransformConfig{
+			Output: []TransformStep{
+				{Op: TransformRename, From: "result", To: "tmp"},
+				{Op: TransformWrap, Template: map[string]interface{}{"answer": "{{tmp}}"}},
+			},
+		}, true},
+		{"unknown op", TransformConfig{Input: []TransformStep{{Op: "upcase"}}}, false},
+		{"bad path", TransformConfig{Input: []TransformStep{{Op: TransformExtract, Path: "items[x]"}}}, false},
+	}
+	for _, tc := range cases {
+		transforms := tc.transforms
+		err := svc.AddCapability(CapabilityUpsertRequest{Descriptor: desc, Transforms: &transforms})
+		if tc.ok && err != nil {
+			t.Fatalf("%s: unexpected error %v", tc.name, err.Message)
+		}
+		if !tc.ok && (err == nil || err.Code != ErrorInvalidRequest) {
+			t.Fatalf("%s: expected invalid request, got %#v", tc.name, err)
+		}
+	}
+}
+
+func TestTransformDryRun(t *testing.T) {
+	svc := NewService()
+	if err := svc.AddCapability(CapabilityUpsertRequest{
+		Descriptor: testDescriptor("acme.models.preview"),
+		Transforms: &TransformConfig{Input: []TransformStep{
+			{Op: TransformRename, From: "q", To: "query.text"},
+			{Op: TransformDefault, Path: "query.lang", Value: "en"},
+		}},
+	}); err != nil {
+		t.Fatalf("add capability: %v", err.Message)
+	}
+	resp, err := svc.TransformDryRun(TransformDryRunRequest{
+		Capability: "acme.models.preview",
+		Direction:  TransformDirectionInput,
+		Payload:    map[string]interface{}{"q": "weather"},
+	})
+	if err != nil {
+		t.Fatalf("dry run: %v", err.Message)
+	}
+	query, _ := resp.Payload["query"].(map[string]interface{})
+	if query["text"] != "weather" || query["lang"] != "en" || len(resp.Steps) != 2 {
+		t.Fatalf("unexpected dry run: %#v", resp)
+	}
+	if _, ok := resp.Steps[0]["query"].(map[string]interface{})["lang"]; ok {
+		t.Fatalf("step trace should show the payload after each step: %#v", resp.Steps)
+	}
+
+	inline, err := svc.TransformDryRun(TransformDryRunRequest{
+		Transforms: &TransformConfig{Output: []TransformStep{{Op: TransformExtract, Path: "$.data"}}},
+		Direction:  TransformDirectionOutput,
+		Payload:    map[string]interface{}{"data": map[string]interface{}{"x": 1}},
+	})
+	if err != nil || inline.Payload["x"] != float64(1) {
+		t.Fatalf("unexpected inline dry run: %#v %#v", inline, err)
+	}
+}
@@ -10,6 +10,10 @@ import (
 const (
 	MIGVersion = "0.1"
 
+	// CapabilityVersionMetaKey carries a version constraint in INVOKE header
+	// meta and the resolved version in the response header meta.
+	CapabilityVersionMetaKey = "mig.capability_version"
+
 	ErrorInvalidRequest        = "MIG_INVALID_REQUEST"
 	ErrorUnauthorized          = "MIG_UNAUTHORIZED"
 	ErrorForbidden             = "MIG_FORBIDDEN"
@@ -126,6 +130,9 @@ type QoSProfile struct {
 	SupportsReplay    bool   `json:"supports_replay,omitempty"`
 	DeliverySemantics string `json:"delivery_semantics,omitempty"`
 	SupportsOrdering  bool   `json:"supports_ordering,omitempty"`
+	// MinLatencyMS is the least time the capability needs to answer. Calls
+	// with a smaller remaining budget fail up front with MIG_TIMEOUT.
+	MinLatencyMS int `json:"min_latency_ms,omitempty"`
 }
 
 type CapabilityDescriptor struct {
@@ -137,6 +144,11 @@ type CapabilityDescriptor struct {
 	EventTopics     []string   `json:"event_topics,omitempty"`
 	AuthScopes      []string   `json:"auth_scopes"`
 	QoS             QoSProfile `json:"qos,omitempty"`
+	// Idempotent marks the capability safe to retry without an idempotency key.
+	Idempotent bool `json:"idempotent,omitempty"`
+	// Fallback is tried in order when an invocation fails with a matching
+	// error code.
+	Fallback *FallbackPolicy `json:"fallback,omitempty"`
 }
 
 type InvokeRequest struct {
@@ -220,7 +232,27 @@ type ConformanceHealth struct {
 }
 
 type CapabilityUpsertRequest struct {
-	Descriptor CapabilityDescriptor `json:"descriptor"`
+	Descriptor     CapabilityDescriptor  `json:"descriptor"`
+	Provider       *ProviderConfig       `json:"provider,omitempty"`
+	CircuitBreaker *CircuitBreakerConfig `json:"circuit_breaker,omitempty"`
+	Retry          *RetryPolicyConfig    `json:"retry,omitempty"`
+	Hedge          *HedgePolicyConfig    `json:"hedge,omitempty"`
+	Transforms     *TransformConfig      `json:"transforms,omitempty"`
+	// SchemaValidation checks INVOKE payloads against the input schema:
+	// enforce (the default), warn, or off.
+	SchemaValidation string `json:"schema_validation,omitempty"`
+}
+
+// ProviderConfig selects and configures the provider bound to a capability
+// registered through the admin API.
+type ProviderConfig struct {
+	Type      string                   `json:"type"`
+	HTTP      *HTTPProviderConfig      `json:"http,omitempty"`
+	NATS      *NATSProviderConfig      `json:"nats,omitempty"`
+	Process   *ProcessProviderConfig   `json:"process,omitempty"`
+	Pool      *PoolProviderConfig      `json:"pool,omitempty"`
+	Composite *CompositeProviderConfig `json:"composite,omitempty"`
+	Scatter   *ScatterProviderConfig   `json:"scatter,omitempty"`
 }
 
 type SchemaUpsertRequest struct {
@@ -256,6 +288,17 @@ type AuditRecord struct {
 	Outcome    string `json:"outcome"`
 	Timestamp  string `json:"timestamp"`
 	MessageID  string `json:"message_id"`
+	Version    string `json:"version,omitempty"`
+	Canary     string `json:"canary,omitempty"`
+	Attempt    int    `json:"attempt,omitempty"`
+	ErrorCode  string `json:"error_code,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+	// Parent names the composite capability a step invocation ran for.
+	Parent     string  `json:"parent,omitempty"`
+	DurationMS float64 `json:"duration_ms,omitempty"`
+	// Mode and Frames are set for streaming invocations.
+	Mode   string `json:"mode,omitempty"`
+	Frames int    `json:"frames,omitempty"`
 }
 
 type UsageSnapshot struct {
@@ -10,7 +10,7 @@ import (
 )
 
 func TestWebSocketStreamInvoke(t *testing.T) {
-	svc := NewService()
+	svc := newDemoService(t)
 	mux := http.NewServeMux()
 	RegisterHTTPRoutes(mux, svc)
 	srv := httptest.NewServer(AuthMiddleware(AuthConfig{Mode: AuthModeNone})(mux))
@@ -752,6 +752,8 @@ type CapabilityDescriptor struct {
 	EventTopics     []string               `protobuf:"bytes,6,rep,name=event_topics,json=eventTopics,proto3" json:"event_topics,omitempty"`
 	AuthScopes      []string               `protobuf:"bytes,7,rep,name=auth_scopes,json=authScopes,proto3" json:"auth_scopes,omitempty"`
 	Qos             *QoSProfile            `protobuf:"bytes,8,opt,name=qos,proto3" json:"qos,omitempty"`
+	Idempotent      bool                   `protobuf:"varint,9,opt,name=idempotent,proto3" json:"idempotent,omitempty"`
+	Fallback        *FallbackPolicy        `protobuf:"bytes,10,opt,name=fallback,proto3" json:"fallback,omitempty"`
 	unknownFields   protoimpl.UnknownFields
 	sizeCache       protoimpl.SizeCache
 }
@@ -842,12 +844,27 @@ func (x *CapabilityDescriptor) GetQos() *QoSProfile {
 	return nil
 }
 
+func (x *CapabilityDescriptor) GetIdempotent() bool {
+	if x != nil {
+		return x.Idempotent
+	}
+	return false
+}
+
+func (x *CapabilityDescriptor) GetFallback() *FallbackPolicy {
+	if x != nil {
+		return x.Fallback
+	}
+	return nil
+}
+
 type QoSProfile struct {
 	state             protoimpl.MessageState `protogen:"open.v1"`
 	MaxPayloadBytes   uint64                 `protobuf:"varint,1,opt,name=max_payload_bytes,json=maxPayloadBytes,proto3" json:"max_payload_bytes,omitempty"`
 	SupportsReplay    bool                   `protobuf:"varint,2,opt,name=supports_replay,json=supportsReplay,proto3" json:"supports_replay,omitempty"`
 	DeliverySemantics DeliverySemantics      `protobuf:"varint,3,opt,name=delivery_semantics,json=deliverySemantics,proto3,enum=mig.v0_1.DeliverySemantics" json:"delivery_semantics,omitempty"`
 	SupportsOrdering  bool                   `protobuf:"varint,4,opt,name=supports_ordering,json=supportsOrdering,proto3" json:"supports_ordering,omitempty"`
+	MinLatencyMs      uint32                 `protobuf:"varint,5,opt,name=min_latency_ms,json=minLatencyMs,proto3" json:"min_latency_ms,omitempty"`
 	unknownFields     protoimpl.UnknownFields
 	sizeCache         protoimpl.SizeCache
 }
@@ -910,6 +927,13 @@ func (x *QoSProfile) GetSupportsOrdering() bool {
 	return false
 }
 
+func (x *QoSProfile) GetMinLatencyMs() uint32 {
+	if x != nil {
+		return x.MinLatencyMs
+	}
+	return 0
+}
+
 type InvokeRequest struct {
 	state            protoimpl.MessageState `protogen:"open.v1"`
 	Header           *MessageHeader         `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
@@ -1758,6 +1782,322 @@ func (x *MigError) GetDetails() *structpb.Struct {
 	return nil
 }
 
+type FallbackPolicy struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Capabilities  []string               `protobuf:"bytes,1,rep,name=capabilities,proto3" json:"capabilities,omitempty"`
+	On            []string               `protobuf:"bytes,2,rep,name=on,proto3" json:"on,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FallbackPolicy) Reset() {
+	*x = FallbackPolicy{}
+	mi := &file_proto_mig_v0_1_mig_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FallbackPolicy) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FallbackPolicy) ProtoMessage() {}
+
+func (x *FallbackPolicy) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_mig_v0_1_mig_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FallbackPolicy.ProtoReflect.Descriptor instead.
+func (*FallbackPolicy) Descriptor() ([]byte, []int) {
+	return file_proto_mig_v0_1_mig_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *FallbackPolicy) GetCapabilities() []string {
+	if x != nil {
+		return x.Capabilities
+	}
+	return nil
+}
+
+func (x *FallbackPolicy) GetOn() []string {
+	if x != nil {
+		return x.On
+	}
+	return nil
+}
+
+type InvokeBatchItem struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	IdempotencyKey string                 `protobuf:"bytes,1,opt,name=idempotency_key,json=idempotencyKey,proto3" json:"idempotency_key,omitempty"`
+	Payload        *structpb.Struct       `protobuf:"bytes,2,opt,name=payload,proto3" json:"payload,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *InvokeBatchItem) Reset() {
+	*x = InvokeBatchItem{}
+	mi := &file_proto_mig_v0_1_mig_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InvokeBatchItem) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InvokeBatchItem) ProtoMessage() {}
+
+func (x *InvokeBatchItem) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_mig_v0_1_mig_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InvokeBatchItem.ProtoReflect.Descriptor instead.
+func (*InvokeBatchItem) Descriptor() ([]byte, []int) {
+	return file_proto_mig_v0_1_mig_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *InvokeBatchItem) GetIdempotencyKey() string {
+	if x != nil {
+		return x.IdempotencyKey
+	}
+	return ""
+}
+
+func (x *InvokeBatchItem) GetPayload() *structpb.Struct {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+type InvokeBatchRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Header         *MessageHeader         `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
+	Capability     string                 `protobuf:"bytes,2,opt,name=capability,proto3" json:"capability,omitempty"`
+	Items          []*InvokeBatchItem     `protobuf:"bytes,3,rep,name=items,proto3" json:"items,omitempty"`
+	MaxConcurrency uint32                 `protobuf:"varint,4,opt,name=max_concurrency,json=maxConcurrency,proto3" json:"max_concurrency,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *InvokeBatchRequest) Reset() {
+	*x = InvokeBatchRequest{}
+	mi := &file_proto_mig_v0_1_mig_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InvokeBatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InvokeBatchRequest) ProtoMessage() {}
+
+func (x *InvokeBatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_mig_v0_1_mig_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InvokeBatchRequest.ProtoReflect.Descriptor instead.
+func (*InvokeBatchRequest) Descriptor() ([]byte, []int) {
+	return file_proto_mig_v0_1_mig_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *InvokeBatchRequest) GetHeader() *MessageHeader {
+	if x != nil {
+		return x.Header
+	}
+	return nil
+}
+
+func (x *InvokeBatchRequest) GetCapability() string {
+	if x != nil {
+		return x.Capability
+	}
+	return ""
+}
+
+func (x *InvokeBatchRequest) GetItems() []*InvokeBatchItem {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *InvokeBatchRequest) GetMaxConcurrency() uint32 {
+	if x != nil {
+		return x.MaxConcurrency
+	}
+	return 0
+}
+
+type InvokeBatchResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Index         uint32                 `protobuf:"varint,1,opt,name=index,proto3" json:"index,omitempty"`
+	MessageId     string                 `protobuf:"bytes,2,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	Payload       *structpb.Struct       `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
+	Error         *MigError              `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InvokeBatchResult) Reset() {
+	*x = InvokeBatchResult{}
+	mi := &file_proto_mig_v0_1_mig_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InvokeBatchResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InvokeBatchResult) ProtoMessage() {}
+
+func (x *InvokeBatchResult) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_mig_v0_1_mig_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InvokeBatchResult.ProtoReflect.Descriptor instead.
+func (*InvokeBatchResult) Descriptor() ([]byte, []int) {
+	return file_proto_mig_v0_1_mig_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *InvokeBatchResult) GetIndex() uint32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+func (x *InvokeBatchResult) GetMessageId() string {
+	if x != nil {
+		return x.MessageId
+	}
+	return ""
+}
+
+func (x *InvokeBatchResult) GetPayload() *structpb.Struct {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *InvokeBatchResult) GetError() *MigError {
+	if x != nil {
+		return x.Error
+	}
+	return nil
+}
+
+type InvokeBatchResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Header        *MessageHeader         `protobuf:"bytes,1,opt,name=header,proto3" json:"header,omitempty"`
+	Capability    string                 `protobuf:"bytes,2,opt,name=capability,proto3" json:"capability,omitempty"`
+	Results       []*InvokeBatchResult   `protobuf:"bytes,3,rep,name=results,proto3" json:"results,omitempty"`
+	Succeeded     uint32                 `protobuf:"varint,4,opt,name=succeeded,proto3" json:"succeeded,omitempty"`
+	Failed        uint32                 `protobuf:"varint,5,opt,name=failed,proto3" json:"failed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *InvokeBatchResponse) Reset() {
+	*x = InvokeBatchResponse{}
+	mi := &file_proto_mig_v0_1_mig_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *InvokeBatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*InvokeBatchResponse) ProtoMessage() {}
+
+func (x *InvokeBatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_mig_v0_1_mig_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use InvokeBatchResponse.ProtoReflect.Descriptor instead.
+func (*InvokeBatchResponse) Descriptor() ([]byte, []int) {
+	return file_proto_mig_v0_1_mig_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *InvokeBatchResponse) GetHeader() *MessageHeader {
+	if x != nil {
+		return x.Header
+	}
+	return nil
+}
+
+func (x *InvokeBatchResponse) GetCapability() string {
+	if x != nil {
+		return x.Capability
+	}
+	return ""
+}
+
+func (x *InvokeBatchResponse) GetResults() []*InvokeBatchResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+func (x *InvokeBatchResponse) GetSucceeded() uint32 {
+	if x != nil {
+		return x.Succeeded
+	}
+	return 0
+}
+
+func (x *InvokeBatchResponse) GetFailed() uint32 {
+	if x != nil {
+		return x.Failed
+	}
+	return 0
+}
+
 var File_proto_mig_v0_1_mig_proto protoreflect.FileDescriptor
 
 const file_proto_mig_v0_1_mig_proto_rawDesc = "" +
@@ -1796,7 +2136,7 @@ const file_proto_mig_v0_1_mig_proto_rawDesc = "" +
 	"includeQos\"\x87\x01\n" +
 	"\x10DiscoverResponse\x12/\n" +
 	"\x06header\x18\x01 \x01(\v2\x17.mig.v0_1.MessageHeaderR\x06header\x12B\n" +
-	"\fcapabilities\x18\x02 \x03(\v2\x1e.mig.v0_1.CapabilityDescriptorR\fcapabilities\"\xb2\x02\n" +
+	"\fcapabilities\x18\x02 \x03(\v2\x1e.mig.v0_1.CapabilityDescriptorR\fcapabilities\"\x88\x03\n" +
 	"\x14CapabilityDescriptor\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x18\n" +
 	"\aversion\x18\x02 \x01(\tR\aversion\x12.\n" +
@@ -1806,13 +2146,19 @@ const file_proto_mig_v0_1_mig_proto_rawDesc = "" +
 	"\fevent_topics\x18\x06 \x03(\tR\veventTopics\x12\x1f\n" +
 	"\vauth_scopes\x18\a \x03(\tR\n" +
 	"authScopes\x12&\n" +
-	"\x03qos\x18\b \x01(\v2\x14.mig.v0_1.QoSProfileR\x03qos\"\xda\x01\n" +
+	"\x03qos\x18\b \x01(\v2\x14.mig.v0_1.QoSProfileR\x03qos\x12\x1e\n" +
+	"\n" +
+	"idempotent\x18\t \x01(\bR\n" +
+	"idempotent\x124\n" +
+	"\bfallback\x18\n" +
+	" \x01(\v2\x18.mig.v0_1.FallbackPolicyR\bfallback\"\x80\x02\n" +
 	"\n" +
 	"QoSProfile\x12*\n" +
 	"\x11max_payload_bytes\x18\x01 \x01(\x04R\x0fmaxPayloadBytes\x12'\n" +
 	"\x0fsupports_replay\x18\x02 \x01(\bR\x0esupportsReplay\x12J\n" +
 	"\x12delivery_semantics\x18\x03 \x01(\x0e2\x1b.mig.v0_1.DeliverySemanticsR\x11deliverySemantics\x12+\n" +
-	"\x11supports_ordering\x18\x04 \x01(\bR\x10supportsOrdering\"\xdc\x01\n" +
+	"\x11supports_ordering\x18\x04 \x01(\bR\x10supportsOrdering\x12$\n" +
+	"\x0emin_latency_ms\x18\x05 \x01(\rR\fminLatencyMs\"\xdc\x01\n" +
 	"\rInvokeRequest\x12/\n" +
 	"\x06header\x18\x01 \x01(\v2\x17.mig.v0_1.MessageHeaderR\x06header\x12\x1e\n" +
 	"\n" +
@@ -1887,7 +2233,34 @@ const file_proto_mig_v0_1_mig_proto_rawDesc = "" +
 	"\x04code\x18\x01 \x01(\x0e2\x16.mig.v0_1.MigErrorCodeR\x04code\x12\x18\n" +
 	"\amessage\x18\x02 \x01(\tR\amessage\x12\x1c\n" +
 	"\tretryable\x18\x03 \x01(\bR\tretryable\x121\n" +
-	"\adetails\x18\x04 \x01(\v2\x17.google.protobuf.StructR\adetails*p\n" +
+	"\adetails\x18\x04 \x01(\v2\x17.google.protobuf.StructR\adetails\"D\n" +
+	"\x0eFallbackPolicy\x12\"\n" +
+	"\fcapabilities\x18\x01 \x03(\tR\fcapabilities\x12\x0e\n" +
+	"\x02on\x18\x02 \x03(\tR\x02on\"m\n" +
+	"\x0fInvokeBatchItem\x12'\n" +
+	"\x0fidempotency_key\x18\x01 \x01(\tR\x0eidempotencyKey\x121\n" +
+	"\apayload\x18\x02 \x01(\v2\x17.google.protobuf.StructR\apayload\"\xbf\x01\n" +
+	"\x12InvokeBatchRequest\x12/\n" +
+	"\x06header\x18\x01 \x01(\v2\x17.mig.v0_1.MessageHeaderR\x06header\x12\x1e\n" +
+	"\n" +
+	"capability\x18\x02 \x01(\tR\n" +
+	"capability\x12/\n" +
+	"\x05items\x18\x03 \x03(\v2\x19.mig.v0_1.InvokeBatchItemR\x05items\x12'\n" +
+	"\x0fmax_concurrency\x18\x04 \x01(\rR\x0emaxConcurrency\"\xa5\x01\n" +
+	"\x11InvokeBatchResult\x12\x14\n" +
+	"\x05index\x18\x01 \x01(\rR\x05index\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\x02 \x01(\tR\tmessageId\x121\n" +
+	"\apayload\x18\x03 \x01(\v2\x17.google.protobuf.StructR\apayload\x12(\n" +
+	"\x05error\x18\x04 \x01(\v2\x12.mig.v0_1.MigErrorR\x05error\"\xd3\x01\n" +
+	"\x13InvokeBatchResponse\x12/\n" +
+	"\x06header\x18\x01 \x01(\v2\x17.mig.v0_1.MessageHeaderR\x06header\x12\x1e\n" +
+	"\n" +
+	"capability\x18\x02 \x01(\tR\n" +
+	"capability\x125\n" +
+	"\aresults\x18\x03 \x03(\v2\x1b.mig.v0_1.InvokeBatchResultR\aresults\x12\x1c\n" +
+	"\tsucceeded\x18\x04 \x01(\rR\tsucceeded\x12\x16\n" +
+	"\x06failed\x18\x05 \x01(\rR\x06failed*p\n" +
 	"\vBindingType\x12\x1c\n" +
 	"\x18BINDING_TYPE_UNSPECIFIED\x10\x00\x12\x15\n" +
 	"\x11BINDING_TYPE_GRPC\x10\x01\x12\x15\n" +
@@ -1932,11 +2305,12 @@ const file_proto_mig_v0_1_mig_proto_rawDesc = "" +
 	"\fMIG_INTERNAL\x10\v2\x88\x01\n" +
 	"\tDiscovery\x128\n" +
 	"\x05Hello\x12\x16.mig.v0_1.HelloRequest\x1a\x17.mig.v0_1.HelloResponse\x12A\n" +
-	"\bDiscover\x12\x19.mig.v0_1.DiscoverRequest\x1a\x1a.mig.v0_1.DiscoverResponse2\x8b\x01\n" +
+	"\bDiscover\x12\x19.mig.v0_1.DiscoverRequest\x1a\x1a.mig.v0_1.DiscoverResponse2\xd7\x01\n" +
 	"\n" +
 	"Invocation\x12;\n" +
 	"\x06Invoke\x12\x17.mig.v0_1.InvokeRequest\x1a\x18.mig.v0_1.InvokeResponse\x12@\n" +
-	"\fStreamInvoke\x12\x15.mig.v0_1.StreamFrame\x1a\x15.mig.v0_1.StreamFrame(\x010\x012\x86\x01\n" +
+	"\fStreamInvoke\x12\x15.mig.v0_1.StreamFrame\x1a\x15.mig.v0_1.StreamFrame(\x010\x01\x12J\n" +
+	"\vInvokeBatch\x12\x1c.mig.v0_1.InvokeBatchRequest\x1a\x1d.mig.v0_1.InvokeBatchResponse2\x86\x01\n" +
 	"\x06Events\x129\n" +
 	"\aPublish\x12\x18.mig.v0_1.PublishRequest\x1a\x14.mig.v0_1.PublishAck\x12A\n" +
 	"\tSubscribe\x12\x1a.mig.v0_1.SubscribeRequest\x1a\x16.mig.v0_1.EventMessage0\x012\x82\x01\n" +
@@ -1958,7 +2332,7 @@ func file_proto_mig_v0_1_mig_proto_rawDescGZIP() []byte {
 }
 
 var file_proto_mig_v0_1_mig_proto_enumTypes = make([]protoimpl.EnumInfo, 6)
-var file_proto_mig_v0_1_mig_proto_msgTypes = make([]protoimpl.MessageInfo, 19)
+var file_proto_mig_v0_1_mig_proto_msgTypes = make([]protoimpl.MessageInfo, 24)
 var file_proto_mig_v0_1_mig_proto_goTypes = []any{
 	(BindingType)(0),              // 0: mig.v0_1.BindingType
 	(InvocationMode)(0),           // 1: mig.v0_1.InvocationMode
@@ -1985,12 +2359,17 @@ var file_proto_mig_v0_1_mig_proto_goTypes = []any{
 	(*HeartbeatRequest)(nil),      // 22: mig.v0_1.HeartbeatRequest
 	(*HeartbeatAck)(nil),          // 23: mig.v0_1.HeartbeatAck
 	(*MigError)(nil),              // 24: mig.v0_1.MigError
-	(*timestamppb.Timestamp)(nil), // 25: google.protobuf.Timestamp
-	(*structpb.Struct)(nil),       // 26: google.protobuf.Struct
+	(*FallbackPolicy)(nil),        // 25: mig.v0_1.FallbackPolicy
+	(*InvokeBatchItem)(nil),       // 26: mig.v0_1.InvokeBatchItem
+	(*InvokeBatchRequest)(nil),    // 27: mig.v0_1.InvokeBatchRequest
+	(*InvokeBatchResult)(nil),     // 28: mig.v0_1.InvokeBatchResult
+	(*InvokeBatchResponse)(nil),   // 29: mig.v0_1.InvokeBatchResponse
+	(*timestamppb.Timestamp)(nil), // 30: google.protobuf.Timestamp
+	(*structpb.Struct)(nil),       // 31: google.protobuf.Struct
 }
 var file_proto_mig_v0_1_mig_proto_depIdxs = []int32{
-	25, // 0: mig.v0_1.MessageHeader.timestamp:type_name -> google.protobuf.Timestamp
-	26, // 1: mig.v0_1.MessageHeader.meta:type_name -> google.protobuf.Struct
+	30, // 0: mig.v0_1.MessageHeader.timestamp:type_name -> google.protobuf.Timestamp
+	31, // 1: mig.v0_1.MessageHeader.meta:type_name -> google.protobuf.Struct
 	6,  // 2: mig.v0_1.HelloRequest.header:type_name -> mig.v0_1.MessageHeader
 	0,  // 3: mig.v0_1.HelloRequest.requested_bindings:type_name -> mig.v0_1.BindingType
 	6,  // 4: mig.v0_1.HelloResponse.header:type_name -> mig.v0_1.MessageHeader
@@ -2000,50 +2379,60 @@ var file_proto_mig_v0_1_mig_proto_depIdxs = []int32{
 	11, // 8: mig.v0_1.DiscoverResponse.capabilities:type_name -> mig.v0_1.CapabilityDescriptor
 	1,  // 9: mig.v0_1.CapabilityDescriptor.modes:type_name -> mig.v0_1.InvocationMode
 	12, // 10: mig.v0_1.CapabilityDescriptor.qos:type_name -> mig.v0_1.QoSProfile
-	3,  // 11: mig.v0_1.QoSProfile.delivery_semantics:type_name -> mig.v0_1.DeliverySemantics
-	6,  // 12: mig.v0_1.InvokeRequest.header:type_name -> mig.v0_1.MessageHeader
-	26, // 13: mig.v0_1.InvokeRequest.payload:type_name -> google.protobuf.Struct
-	2,  // 14: mig.v0_1.InvokeRequest.stream_preference:type_name -> mig.v0_1.StreamPreference
-	6,  // 15: mig.v0_1.InvokeResponse.header:type_name -> mig.v0_1.MessageHeader
-	26, // 16: mig.v0_1.InvokeResponse.payload:type_name -> google.protobuf.Struct
-	6,  // 17: mig.v0_1.StreamFrame.header:type_name -> mig.v0_1.MessageHeader
-	4,  // 18: mig.v0_1.StreamFrame.kind:type_name -> mig.v0_1.FrameKind
-	26, // 19: mig.v0_1.StreamFrame.payload:type_name -> google.protobuf.Struct
-	24, // 20: mig.v0_1.StreamFrame.error:type_name -> mig.v0_1.MigError
-	6,  // 21: mig.v0_1.PublishRequest.header:type_name -> mig.v0_1.MessageHeader
-	26, // 22: mig.v0_1.PublishRequest.payload:type_name -> google.protobuf.Struct
-	6,  // 23: mig.v0_1.PublishAck.header:type_name -> mig.v0_1.MessageHeader
-	6,  // 24: mig.v0_1.SubscribeRequest.header:type_name -> mig.v0_1.MessageHeader
-	6,  // 25: mig.v0_1.EventMessage.header:type_name -> mig.v0_1.MessageHeader
-	26, // 26: mig.v0_1.EventMessage.payload:type_name -> google.protobuf.Struct
-	25, // 27: mig.v0_1.EventMessage.published_at:type_name -> google.protobuf.Timestamp
-	6,  // 28: mig.v0_1.CancelRequest.header:type_name -> mig.v0_1.MessageHeader
-	6,  // 29: mig.v0_1.CancelAck.header:type_name -> mig.v0_1.MessageHeader
-	6,  // 30: mig.v0_1.HeartbeatRequest.header:type_name -> mig.v0_1.MessageHeader
-	6,  // 31: mig.v0_1.HeartbeatAck.header:type_name -> mig.v0_1.MessageHeader
-	5,  // 32: mig.v0_1.MigError.code:type_name -> mig.v0_1.MigErrorCode
-	26, // 33: mig.v0_1.MigError.details:type_name -> google.protobuf.Struct
-	7,  // 34: mig.v0_1.Discovery.Hello:input_type -> mig.v0_1.HelloRequest
-	9,  // 35: mig.v0_1.Discovery.Discover:input_type -> mig.v0_1.DiscoverRequest
-	13, // 36: mig.v0_1.Invocation.Invoke:input_type -> mig.v0_1.InvokeRequest
-	15, // 37: mig.v0_1.Invocation.StreamInvoke:input_type -> mig.v0_1.StreamFrame
-	16, // 38: mig.v0_1.Events.Publish:input_type -> mig.v0_1.PublishRequest
-	18, // 39: mig.v0_1.Events.Subscribe:input_type -> mig.v0_1.SubscribeRequest
-	20, // 40: mig.v0_1.Control.Cancel:input_type -> mig.v0_1.CancelRequest
-	22, // 41: mig.v0_1.Control.Heartbeat:input_type -> mig.v0_1.HeartbeatRequest
-	8,  // 42: mig.v0_1.Discovery.Hello:output_type -> mig.v0_1.HelloResponse
-	10, // 43: mig.v0_1.Discovery.Discover:output_type -> mig.v0_1.DiscoverResponse
-	14, // 44: mig.v0_1.Invocation.Invoke:output_type -> mig.v0_1.InvokeResponse
-	15, // 45: mig.v0_1.Invocation.StreamInvoke:output_type -> mig.v0_1.StreamFrame
-	17, // 46: mig.v0_1.Events.Publish:output_type -> mig.v0_1.PublishAck
-	19, // 47: mig.v0_1.Events.Subscribe:output_type -> mig.v0_1.EventMessage
-	21, // 48: mig.v0_1.Control.Cancel:output_type -> mig.v0_1.CancelAck
-	23, // 49: mig.v0_1.Control.Heartbeat:output_type -> mig.v0_1.HeartbeatAck
-	42, // [42:50] is the sub-list for method output_type
-	34, // [34:42] is the sub-list for method input_type
-	34, // [34:34] is the sub-list for extension type_name
-	34, // [34:34] is the sub-list for extension extendee
-	0,  // [0:34] is the sub-list for field type_name
+	25, // 11: mig.v0_1.CapabilityDescriptor.fallback:type_name -> mig.v0_1.FallbackPolicy
+	3,  // 12: mig.v0_1.QoSProfile.delivery_semantics:type_name -> mig.v0_1.DeliverySemantics
+	6,  // 13: mig.v0_1.InvokeRequest.header:type_name -> mig.v0_1.MessageHeader
+	31, // 14: mig.v0_1.InvokeRequest.payload:type_name -> google.protobuf.Struct
+	2,  // 15: mig.v0_1.InvokeRequest.stream_preference:type_name -> mig.v0_1.StreamPreference
+	6,  // 16: mig.v0_1.InvokeResponse.header:type_name -> mig.v0_1.MessageHeader
+	31, // 17: mig.v0_1.InvokeResponse.payload:type_name -> google.protobuf.Struct
+	6,  // 18: mig.v0_1.StreamFrame.header:type_name -> mig.v0_1.MessageHeader
+	4,  // 19: mig.v0_1.StreamFrame.kind:type_name -> mig.v0_1.FrameKind
+	31, // 20: mig.v0_1.StreamFrame.payload:type_name -> google.protobuf.Struct
+	24, // 21: mig.v0_1.StreamFrame.error:type_name -> mig.v0_1.MigError
+	6,  // 22: mig.v0_1.PublishRequest.header:type_name -> mig.v0_1.MessageHeader
+	31, // 23: mig.v0_1.PublishRequest.payload:type_name -> google.protobuf.Struct
+	6,  // 24: mig.v0_1.PublishAck.header:type_name -> mig.v0_1.MessageHeader
+	6,  // 25: mig.v0_1.SubscribeRequest.header:type_name -> mig.v0_1.MessageHeader
+	6,  // 26: mig.v0_1.EventMessage.header:type_name -> mig.v0_1.MessageHeader
+	31, // 27: mig.v0_1.EventMessage.payload:type_name -> google.protobuf.Struct
+	30, // 28: mig.v0_1.EventMessage.published_at:type_name -> google.protobuf.Timestamp
+	6,  // 29: mig.v0_1.CancelRequest.header:type_name -> mig.v0_1.MessageHeader
+	6,  // 30: mig.v0_1.CancelAck.header:type_name -> mig.v0_1.MessageHeader
+	6,  // 31: mig.v0_1.HeartbeatRequest.header:type_name -> mig.v0_1.MessageHeader
+	6,  // 32: mig.v0_1.HeartbeatAck.header:type_name -> mig.v0_1.MessageHeader
+	5,  // 33: mig.v0_1.MigError.code:type_name -> mig.v0_1.MigErrorCode
+	31, // 34: mig.v0_1.MigError.details:type_name -> google.protobuf.Struct
+	31, // 35: mig.v0_1.InvokeBatchItem.payload:type_name -> google.protobuf.Struct
+	6,  // 36: mig.v0_1.InvokeBatchRequest.header:type_name -> mig.v0_1.MessageHeader
+	26, // 37: mig.v0_1.InvokeBatchRequest.items:type_name -> mig.v0_1.InvokeBatchItem
+	31, // 38: mig.v0_1.InvokeBatchResult.payload:type_name -> google.protobuf.Struct
+	24, // 39: mig.v0_1.InvokeBatchResult.error:type_name -> mig.v0_1.MigError
+	6,  // 40: mig.v0_1.InvokeBatchResponse.header:type_name -> mig.v0_1.MessageHeader
+	28, // 41: mig.v0_1.InvokeBatchResponse.results:type_name -> mig.v0_1.InvokeBatchResult
+	7,  // 42: mig.v0_1.Discovery.Hello:input_type -> mig.v0_1.HelloRequest
+	9,  // 43: mig.v0_1.Discovery.Discover:input_type -> mig.v0_1.DiscoverRequest
+	13, // 44: mig.v0_1.Invocation.Invoke:input_type -> mig.v0_1.InvokeRequest
+	15, // 45: mig.v0_1.Invocation.StreamInvoke:input_type -> mig.v0_1.StreamFrame
+	27, // 46: mig.v0_1.Invocation.InvokeBatch:input_type -> mig.v0_1.InvokeBatchRequest
+	16, // 47: mig.v0_1.Events.Publish:input_type -> mig.v0_1.PublishRequest
+	18, // 48: mig.v0_1.Events.Subscribe:input_type -> mig.v0_1.SubscribeRequest
+	20, // 49: mig.v0_1.Control.Cancel:input_type -> mig.v0_1.CancelRequest
+	22, // 50: mig.v0_1.Control.Heartbeat:input_type -> mig.v0_1.HeartbeatRequest
+	8,  // 51: mig.v0_1.Discovery.Hello:output_type -> mig.v0_1.HelloResponse
+	10, // 52: mig.v0_1.Discovery.Discover:output_type -> mig.v0_1.DiscoverResponse
+	14, // 53: mig.v0_1.Invocation.Invoke:output_type -> mig.v0_1.InvokeResponse
+	15, // 54: mig.v0_1.Invocation.StreamInvoke:output_type -> mig.v0_1.StreamFrame
+	29, // 55: mig.v0_1.Invocation.InvokeBatch:output_type -> mig.v0_1.InvokeBatchResponse
+	17, // 56: mig.v0_1.Events.Publish:output_type -> mig.v0_1.PublishAck
+	19, // 57: mig.v0_1.Events.Subscribe:output_type -> mig.v0_1.EventMessage
+	21, // 58: mig.v0_1.Control.Cancel:output_type -> mig.v0_1.CancelAck
+	23, // 59: mig.v0_1.Control.Heartbeat:output_type -> mig.v0_1.HeartbeatAck
+	51, // [51:60] is the sub-list for method output_type
+	42, // [42:51] is the sub-list for method input_type
+	42, // [42:42] is the sub-list for extension type_name
+	42, // [42:42] is the sub-list for extension extendee
+	0,  // [0:42] is the sub-list for field type_name
 }
 
 func init() { file_proto_mig_v0_1_mig_proto_init() }
@@ -2057,7 +2446,7 @@ func file_proto_mig_v0_1_mig_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_mig_v0_1_mig_proto_rawDesc), len(file_proto_mig_v0_1_mig_proto_rawDesc)),
 			NumEnums:      6,
-			NumMessages:   19,
+			NumMessages:   24,
 			NumExtensions: 0,
 			NumServices:   4,
 		},
@@ -161,6 +161,7 @@ var Discovery_ServiceDesc = grpc.ServiceDesc{
 const (
 	Invocation_Invoke_FullMethodName       = "/mig.v0_1.Invocation/Invoke"
 	Invocation_StreamInvoke_FullMethodName = "/mig.v0_1.Invocation/StreamInvoke"
+	Invocation_InvokeBatch_FullMethodName  = "/mig.v0_1.Invocation/InvokeBatch"
 )
 
 // InvocationClient is the client API for Invocation service.
@@ -169,6 +170,7 @@ const (
 type InvocationClient interface {
 	Invoke(ctx context.Context, in *InvokeRequest, opts ...grpc.CallOption) (*InvokeResponse, error)
 	StreamInvoke(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[StreamFrame, StreamFrame], error)
+	InvokeBatch(ctx context.Context, in *InvokeBatchRequest, opts ...grpc.CallOption) (*InvokeBatchResponse, error)
 }
 
 type invocationClient struct {
@@ -202,12 +204,23 @@ func (c *invocationClient) StreamInvoke(ctx context.Context, opts ...grpc.CallOp
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type Invocation_StreamInvokeClient = grpc.BidiStreamingClient[StreamFrame, StreamFrame]
 
+func (c *invocationClient) InvokeBatch(ctx context.Context, in *InvokeBatchRequest, opts ...grpc.CallOption) (*InvokeBatchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(InvokeBatchResponse)
+	err := c.cc.Invoke(ctx, Invocation_InvokeBatch_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // InvocationServer is the server API for Invocation service.
 // All implementations must embed UnimplementedInvocationServer
 // for forward compatibility.
 type InvocationServer interface {
 	Invoke(context.Context, *InvokeRequest) (*InvokeResponse, error)
 	StreamInvoke(grpc.BidiStreamingServer[StreamFrame, StreamFrame]) error
+	InvokeBatch(context.Context, *InvokeBatchRequest) (*InvokeBatchResponse, error)
 	mustEmbedUnimplementedInvocationServer()
 }
 
@@ -224,6 +237,9 @@ func (UnimplementedInvocationServer) Invoke(context.Context, *InvokeRequest) (*I
 func (UnimplementedInvocationServer) StreamInvoke(grpc.BidiStreamingServer[StreamFrame, StreamFrame]) error {
 	return status.Error(codes.Unimplemented, "method StreamInvoke not implemented")
 }
+func (UnimplementedInvocationServer) InvokeBatch(context.Context, *InvokeBatchRequest) (*InvokeBatchResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method InvokeBatch not implemented")
+}
 func (UnimplementedInvocationServer) mustEmbedUnimplementedInvocationServer() {}
 func (UnimplementedInvocationServer) testEmbeddedByValue()                    {}
 
@@ -270,6 +286,24 @@ func _Invocation_StreamInvoke_Handler(srv interface{}, stream grpc.ServerStream)
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type Invocation_StreamInvokeServer = grpc.BidiStreamingServer[StreamFrame, StreamFrame]
 
+func _Invocation_InvokeBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InvokeBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(InvocationServer).InvokeBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Invocation_InvokeBatch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(InvocationServer).InvokeBatch(ctx, req.(*InvokeBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Invocation_ServiceDesc is the grpc.ServiceDesc for Invocation service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -281,6 +315,10 @@ var Invocation_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Invoke",
 			Handler:    _Invocation_Invoke_Handler,
 		},
+		{
+			MethodName: "InvokeBatch",
+			Handler:    _Invocation_InvokeBatch_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{